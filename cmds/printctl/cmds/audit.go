@@ -0,0 +1,95 @@
+package cmds
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tierklinik-dobersberg/apis/pkg/cli"
+	"github.com/tierklinik-dobersberg/print-service/internal/audit"
+)
+
+func GetAuditCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:  "audit",
+		Args: cobra.NoArgs,
+	}
+
+	cmd.AddCommand(GetVerifyAuditCommand(root))
+
+	return cmd
+}
+
+func GetVerifyAuditCommand(root *cli.Root) *cobra.Command {
+	var keyFile string
+
+	cmd := &cobra.Command{
+		Use:   "verify <path>",
+		Short: "Verify the hash chain of an audit log file. Use - to read from stdin",
+		Long:  "Verify the hash chain of an audit log file using the audit key of the service. The key is read from --key-file or the AUDIT_KEY environment variable.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			value := os.Getenv("AUDIT_KEY")
+			if keyFile != "" {
+				content, err := os.ReadFile(keyFile)
+				if err != nil {
+					logrus.Fatalf("failed to read audit key: %s", err)
+				}
+
+				value = string(content)
+			}
+
+			if value == "" {
+				logrus.Fatalf("missing audit key, use --key-file or AUDIT_KEY")
+			}
+
+			key, err := audit.ParseKey(value)
+			if err != nil {
+				logrus.Fatalf("invalid audit key: %s", err)
+			}
+
+			var r io.Reader = os.Stdin
+
+			if args[0] != "-" {
+				f, err := os.Open(args[0])
+				if err != nil {
+					logrus.Fatalf("failed to open audit log: %s", err)
+				}
+				defer f.Close()
+
+				r = f
+			}
+
+			res, err := audit.Verify(r, key)
+
+			var verr *audit.VerifyError
+			if errors.As(err, &verr) {
+				logrus.Fatalf("audit log is NOT intact after %d valid events: %s", res.Events, verr)
+			} else if err != nil {
+				logrus.Fatalf("failed to read audit log: %s", err)
+			}
+
+			if res.Events == 0 {
+				fmt.Println("audit log is empty")
+				return
+			}
+
+			fmt.Printf("audit log is intact: %d events (seq %d-%d) from %s to %s\n",
+				res.Events,
+				res.First.Sequence,
+				res.Last.Sequence,
+				res.First.Time.Local().Format(time.RFC3339),
+				res.Last.Time.Local().Format(time.RFC3339),
+			)
+			fmt.Printf("last hash: %s\n", res.Last.Hash)
+		},
+	}
+
+	cmd.Flags().StringVar(&keyFile, "key-file", "", "Path to a file holding the hex or base64 encoded audit key")
+
+	return cmd
+}
@@ -1,21 +1,39 @@
 package cmds
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/bufbuild/connect-go"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	longrunningv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/longrunning/v1"
 	printingv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/printing/v1"
 	"github.com/tierklinik-dobersberg/apis/pkg/cli"
+	"google.golang.org/protobuf/encoding/protojson"
 )
 
+// streamChunkSize is the size of the data chunks sent when streaming
+// document content.
+const streamChunkSize = 256 * 1024
+
 func GetPrintCommand(root *cli.Root) *cobra.Command {
 	var (
-		isUrl       bool
-		name        string
-		contentType string
-		printer     string
+		isUrl           bool
+		name            string
+		contentType     string
+		printer         string
+		streamThreshold int64
+		options         map[string]string
+		dryRun          bool
 	)
 
 	cmd := &cobra.Command{
@@ -33,6 +51,33 @@ func GetPrintCommand(root *cli.Root) *cobra.Command {
 					Url: args[0],
 				}
 			} else {
+				stat, err := os.Stat(args[0])
+				if err != nil {
+					logrus.Fatalf("failed to stat file: %s", err)
+				}
+
+				// large files are streamed in chunks to avoid hitting message
+				// size limits
+				if stat.Size() >= streamThreshold && dryRun {
+					report, err := validateFile(root, req, args[0], options)
+					if err != nil {
+						logrus.Fatal(err.Error())
+					}
+
+					printReport(root, report)
+					return
+				}
+
+				if stat.Size() >= streamThreshold {
+					op, err := streamDocument(root, req, args[0], options)
+					if err != nil {
+						logrus.Fatal(err.Error())
+					}
+
+					root.Print(op)
+					return
+				}
+
 				content, err := os.ReadFile(args[0])
 				if err != nil {
 					logrus.Fatalf("failed to read file: %s", err)
@@ -43,9 +88,22 @@ func GetPrintCommand(root *cli.Root) *cobra.Command {
 				}
 			}
 
-			res, err := root.PrintService().PrintDocument(root.Context(), connect.NewRequest(req))
+			if dryRun {
+				report, err := validatePrint(root, req, options)
+				if err != nil {
+					logrus.Fatal(err.Error())
+				}
+
+				printReport(root, report)
+				return
+			}
+
+			creq := connect.NewRequest(req)
+			setPrintOptions(creq.Header(), options)
+
+			res, err := root.PrintService().PrintDocument(root.Context(), creq)
 			if err != nil {
-				logrus.Fatalf(err.Error())
+				logrus.Fatal(err.Error())
 			}
 
 			root.Print(res.Msg)
@@ -58,7 +116,154 @@ func GetPrintCommand(root *cli.Root) *cobra.Command {
 		f.StringVarP(&name, "name", "n", "", "The name of the document (optional)")
 		f.StringVarP(&contentType, "content-type", "C", "", "The content-type of the document (optional)")
 		f.StringVarP(&printer, "printer", "p", "", "The printer to use (optional)")
+		f.Int64Var(&streamThreshold, "stream-threshold", 4*1024*1024, "Files larger than this size in bytes are streamed to the print service")
+		f.StringToStringVarP(&options, "option", "o", nil, "Print options like copies=2 or duplex=true (may be repeated)")
+		f.BoolVar(&dryRun, "dry-run", false, "Only validate the print request without printing anything")
 	}
 
 	return cmd
 }
+
+// setPrintOptions adds options as X-Print- headers to header.
+func setPrintOptions(header http.Header, options map[string]string) {
+	for key, value := range options {
+		header.Set("X-Print-"+key, value)
+	}
+}
+
+// printReport prints a validation report and exits with a non-zero status
+// if the request is invalid.
+func printReport(root *cli.Root, report map[string]any) {
+	root.Print(report)
+
+	if valid, _ := report["valid"].(bool); !valid {
+		os.Exit(1)
+	}
+}
+
+// validatePrint calls the print validation endpoint of the print service.
+func validatePrint(root *cli.Root, doc *printingv1.Document, options map[string]string) (map[string]any, error) {
+	body, err := protojson.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode document: %w", err)
+	}
+
+	return sendValidation(root, bytes.NewReader(body), "application/json", options)
+}
+
+// validateFile uploads the file at path to the print validation endpoint
+// without reading it into memory.
+func validateFile(root *cli.Root, doc *printingv1.Document, path string, options map[string]string) (map[string]any, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+
+	go func() {
+		for key, value := range map[string]string{
+			"name":         doc.Name,
+			"content-type": doc.ContentType,
+			"printer":      doc.Printer,
+		} {
+			if value == "" {
+				continue
+			}
+
+			if err := mw.WriteField(key, value); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+
+		part, err := mw.CreateFormFile("file", filepath.Base(path))
+		if err == nil {
+			_, err = io.Copy(part, file)
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+
+		pw.CloseWithError(err)
+	}()
+
+	return sendValidation(root, pr, mw.FormDataContentType(), options)
+}
+
+func sendValidation(root *cli.Root, body io.Reader, contentType string, options map[string]string) (map[string]any, error) {
+	req, err := http.NewRequestWithContext(root.Context(), http.MethodPost, strings.TrimSuffix(root.Config().PrintService, "/")+"/print/validate", body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	setPrintOptions(req.Header, options)
+
+	res, err := root.HttpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var report map[string]any
+	if err := json.NewDecoder(res.Body).Decode(&report); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %v", res.Status, report["error"])
+	}
+
+	return report, nil
+}
+
+func streamDocument(root *cli.Root, doc *printingv1.Document, path string, options map[string]string) (*longrunningv1.Operation, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	stream := root.PrintService().PrintDocumentStream(root.Context())
+	setPrintOptions(stream.RequestHeader(), options)
+
+	if err := stream.Send(&printingv1.PrintDocumentRequest{
+		Message: &printingv1.PrintDocumentRequest_Document{
+			Document: doc,
+		},
+	}); err != nil {
+		return nil, fmt.Errorf("failed to send document header: %w", err)
+	}
+
+	buf := make([]byte, streamChunkSize)
+	for {
+		n, err := file.Read(buf)
+		if n > 0 {
+			if err := stream.Send(&printingv1.PrintDocumentRequest{
+				Message: &printingv1.PrintDocumentRequest_Data{
+					Data: buf[:n],
+				},
+			}); err != nil {
+				return nil, fmt.Errorf("failed to send document data: %w", err)
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+	}
+
+	res, err := stream.CloseAndReceive()
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Msg, nil
+}
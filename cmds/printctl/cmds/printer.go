@@ -16,7 +16,7 @@ func GetPrinterCommand(root *cli.Root) *cobra.Command {
 		Run: func(cmd *cobra.Command, args []string) {
 			res, err := root.PrintService().ListPrinters(root.Context(), connect.NewRequest(&printingv1.ListPrintersRequest{}))
 			if err != nil {
-				logrus.Fatalf(err.Error())
+				logrus.Fatal(err.Error())
 			}
 
 			root.Print(res.Msg)
@@ -36,7 +36,7 @@ func GetListJobsCommand(root *cli.Root) *cobra.Command {
 				Printers: args,
 			}))
 			if err != nil {
-				logrus.Fatalf(err.Error())
+				logrus.Fatal(err.Error())
 			}
 
 			root.Print(res.Msg)
@@ -12,9 +12,10 @@ func main() {
 	root.AddCommand(
 		cmds.GetPrintCommand(root),
 		cmds.GetPrinterCommand(root),
+		cmds.GetAuditCommand(root),
 	)
 
 	if err := root.ExecuteContext(root.Context()); err != nil {
-		logrus.Fatalf(err.Error())
+		logrus.Fatal(err.Error())
 	}
 }
@@ -15,10 +15,12 @@ import (
 	"github.com/tierklinik-dobersberg/apis/pkg/discovery"
 	"github.com/tierklinik-dobersberg/apis/pkg/discovery/consuldiscover"
 	"github.com/tierklinik-dobersberg/apis/pkg/discovery/wellknown"
-	"github.com/tierklinik-dobersberg/apis/pkg/log"
 	"github.com/tierklinik-dobersberg/apis/pkg/server"
 	"github.com/tierklinik-dobersberg/apis/pkg/validator"
 	"github.com/tierklinik-dobersberg/print-service/internal/config"
+	"github.com/tierklinik-dobersberg/print-service/internal/hotfolder"
+	"github.com/tierklinik-dobersberg/print-service/internal/ippserver"
+	"github.com/tierklinik-dobersberg/print-service/internal/privacy"
 	"github.com/tierklinik-dobersberg/print-service/internal/service"
 	"google.golang.org/protobuf/reflect/protoregistry"
 )
@@ -45,40 +47,112 @@ func main() {
 		os.Exit(-1)
 	}
 
-	// TODO(ppacher): privacy-interceptor
+	// keep document names, which often contain personal data, out of
+	// the logs
+	redactor, err := privacy.New(cfg.PrivacyMode, cfg.PrivacyKey)
+	if err != nil {
+		slog.Error("failed to configure privacy mode", slog.Any("error", err.Error()))
+		os.Exit(-1)
+	}
+	privacy.SetDefault(redactor)
+
 	interceptors := connect.WithInterceptors(
-		log.NewLoggingInterceptor(),
+		privacy.NewLoggingInterceptor(redactor),
 		validator.NewInterceptor(protoValidator),
 	)
 
-	if roleClient, err := wellknown.RoleService.Create(ctx, catalog); err == nil {
+	corsConfig := cors.Config{
+		AllowedOrigins:   cfg.AllowedOrigins,
+		AllowCredentials: true,
+	}
+
+	providers, err := cfg.ConfigureProviders(ctx, catalog)
+	if err != nil {
+		slog.Error("failed to configure providers", slog.Any("error", err.Error()))
+		os.Exit(-1)
+	}
+
+	// unary RPCs and the HTTP handlers resolve roles the same way
+	if providers.Roles != nil {
 		authInterceptor := auth.NewAuthAnnotationInterceptor(
 			protoregistry.GlobalFiles,
-			auth.NewIDMRoleResolver(roleClient),
+			providers.Roles,
 			auth.RemoteHeaderExtractor,
 		)
 
 		interceptors = connect.WithOptions(interceptors, connect.WithInterceptors(authInterceptor))
 	}
 
-	corsConfig := cors.Config{
-		AllowedOrigins:   cfg.AllowedOrigins,
-		AllowCredentials: true,
-	}
-
-	providers, err := cfg.ConfigureProviders(ctx, catalog)
+	svc, err := service.New(providers)
 	if err != nil {
-		slog.Error("failed to configure providers", slog.Any("error", err.Error()))
+		slog.Error("failed to create service", slog.Any("error", err.Error()))
 		os.Exit(-1)
 	}
 
-	svc := service.New(providers)
+	// start watching hot-folders, if any
+	for _, folder := range cfg.HotFolders {
+		watcher, err := hotfolder.New(folder, svc)
+		if err != nil {
+			slog.Error("failed to setup hot-folder", slog.Any("error", err.Error()))
+			os.Exit(-1)
+		}
+
+		go watcher.Run(ctx)
+	}
+
+	// reload document templates on change
+	if providers.Templates != nil {
+		go providers.Templates.Watch(ctx, cfg.TemplatesReloadInterval)
+	}
+
+	// remove archived documents after the retention period
+	if providers.Archive != nil {
+		go providers.Archive.Watch(ctx, cfg.ReprintPurgeInterval)
+	}
 
 	serveMux := http.NewServeMux()
 
 	path, handler := printingv1connect.NewPrintServiceHandler(svc, interceptors)
 	serveMux.Handle(path, handler)
 
+	// plain HTTP endpoint for clients that cannot speak connect
+	serveMux.HandleFunc("POST /print", svc.HandlePrint)
+	serveMux.HandleFunc("POST /print/validate", svc.HandleValidatePrint)
+	serveMux.HandleFunc("POST /preview", svc.HandlePreviewDocument)
+
+	// routing rules
+	serveMux.HandleFunc("POST /routing/explain", svc.HandleExplainRouting)
+
+	// default printers and options
+	serveMux.HandleFunc("GET /preferences", svc.HandleGetPrintPreferences)
+	serveMux.HandleFunc("POST /preferences", svc.HandleSetPrintPreferences)
+
+	// print usage and quotas
+	serveMux.HandleFunc("GET /usage", svc.HandleGetUsage)
+	serveMux.HandleFunc("GET /usage/list", svc.HandleListUsage)
+
+	// job history
+	serveMux.HandleFunc("GET /history", svc.HandleListJobHistory)
+	serveMux.HandleFunc("POST /history/{id}/reprint", svc.HandleReprint)
+
+	// label templates
+	serveMux.HandleFunc("GET /labels/templates", svc.HandleListLabelTemplates)
+	serveMux.HandleFunc("POST /labels/print", svc.HandlePrintLabel)
+	serveMux.HandleFunc("POST /labels/preview", svc.HandlePreviewLabel)
+
+	// HTML document templates
+	serveMux.HandleFunc("GET /templates", svc.HandleListTemplates)
+	serveMux.HandleFunc("POST /templates/print", svc.HandlePrintTemplate)
+	serveMux.HandleFunc("POST /templates/render", svc.HandleRenderTemplate)
+
+	// PDF forms
+	serveMux.HandleFunc("POST /forms/fields", svc.HandleListFormFields)
+	serveMux.HandleFunc("POST /forms/print", svc.HandlePrintFilledForm)
+
+	if cfg.IPPServer.Enabled {
+		serveMux.Handle(ippserver.PathPrefix, ippserver.New(cfg.IPPServer, cfg.StoragePath, svc))
+	}
+
 	loggingHandler := func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
@@ -90,7 +164,7 @@ func main() {
 	}
 
 	// Create the server
-	srv, err := server.CreateWithOptions(cfg.ListenAddress, loggingHandler(serveMux), server.WithCORS(corsConfig))
+	srv, err := server.CreateWithOptions(cfg.ListenAddress, loggingHandler(service.ClientInfoHandler(serveMux)), server.WithCORS(corsConfig))
 	if err != nil {
 		slog.Error("failed to setup server", slog.Any("error", err.Error()))
 		os.Exit(-1)
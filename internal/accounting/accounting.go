@@ -0,0 +1,563 @@
+// Package accounting records the impressions, sheets and costs of print jobs
+// and enforces monthly print quotas per user and role.
+package accounting
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrQuotaExceeded is returned if a print job exceeds a hard quota.
+var ErrQuotaExceeded = errors.New("print quota exceeded")
+
+// Config configures rates and quotas.
+type Config struct {
+	Rates  Rates   `json:"rates"`
+	Quotas []Quota `json:"quotas"`
+}
+
+// Rates defines the cost of print jobs.
+type Rates struct {
+	// Mono and Color are charged per impression, i.e. per printed side.
+	Mono  float64 `json:"mono"`
+	Color float64 `json:"color"`
+
+	// Sheet is charged per sheet of paper. Media overrides it for paper
+	// sizes like A3.
+	Sheet float64            `json:"sheet"`
+	Media map[string]float64 `json:"media"`
+
+	// Duplex is added per sheet of duplex jobs. It may be negative to
+	// grant a discount.
+	Duplex float64 `json:"duplex"`
+}
+
+// Limit holds the maximum usage within a month. Zero values are not
+// limited.
+type Limit struct {
+	Impressions int     `json:"impressions,omitempty"`
+	Cost        float64 `json:"cost,omitempty"`
+}
+
+// IsZero returns true if l does not limit anything.
+func (l Limit) IsZero() bool {
+	return l.Impressions == 0 && l.Cost == 0
+}
+
+// reached returns true if t reaches or exceeds l.
+func (l Limit) reached(t Totals) bool {
+	return (l.Impressions > 0 && t.Impressions >= l.Impressions) ||
+		(l.Cost > 0 && t.Cost >= l.Cost)
+}
+
+// exceeded returns true if t is above l.
+func (l Limit) exceeded(t Totals) bool {
+	return (l.Impressions > 0 && t.Impressions > l.Impressions) ||
+		(l.Cost > 0 && t.Cost > l.Cost)
+}
+
+// Quota limits the monthly usage of users.
+type Quota struct {
+	// Name identifies the quota in usage reports and errors.
+	Name string `json:"name"`
+
+	// Users and Roles select the users the quota applies to. Roles holds
+	// role IDs. A quota without users and roles applies to everyone.
+	Users []string `json:"users"`
+	Roles []string `json:"roles"`
+
+	// Shared applies the quota to the combined usage of all matching
+	// users, like a department budget. Otherwise every user has a quota
+	// of their own.
+	Shared bool `json:"shared"`
+
+	// Soft only causes a warning while Hard rejects jobs that would
+	// exceed it.
+	Soft Limit `json:"soft"`
+	Hard Limit `json:"hard"`
+}
+
+func (q Quota) appliesTo(user string, roles []string) bool {
+	if len(q.Users) == 0 && len(q.Roles) == 0 {
+		return true
+	}
+
+	return slices.Contains(q.Users, user) || slices.ContainsFunc(roles, func(role string) bool {
+		return slices.Contains(q.Roles, role)
+	})
+}
+
+// Record holds the usage of a single print job. Roles holds the role IDs
+// of the user.
+type Record struct {
+	Time        time.Time `json:"time"`
+	User        string    `json:"user"`
+	Roles       []string  `json:"roles,omitempty"`
+	Printer     string    `json:"printer"`
+	Document    string    `json:"document"`
+	OperationID string    `json:"operationId,omitempty"`
+	JobID       int       `json:"jobId,omitempty"`
+	State       string    `json:"state,omitempty"`
+
+	// Pages is the page count of the submitted document or zero if it is
+	// unknown.
+	Pages  int  `json:"pages"`
+	Copies int  `json:"copies"`
+	Color  bool `json:"color"`
+	Duplex bool `json:"duplex"`
+
+	// Media is the paper size of the document if all pages share one.
+	Media string `json:"media,omitempty"`
+
+	Impressions int `json:"impressions"`
+	Sheets      int `json:"sheets"`
+
+	// Reported is set if impressions and sheets have been reported by the
+	// printer instead of being estimated from the page count.
+	Reported bool `json:"reported"`
+
+	Cost float64 `json:"cost"`
+}
+
+// Estimate sets the impressions and sheets of r from the page count, the
+// number of copies and the duplex mode. If the page count is unknown, one
+// page per copy is assumed so such jobs still count against quotas.
+func (r *Record) Estimate() {
+	copies := max(r.Copies, 1)
+	pages := max(r.Pages, 1)
+
+	sheets := pages
+	if r.Duplex {
+		sheets = (pages + 1) / 2
+	}
+
+	r.Impressions = pages * copies
+	r.Sheets = sheets * copies
+	r.Reported = false
+}
+
+// Totals holds the summed up usage of multiple jobs.
+type Totals struct {
+	Jobs        int     `json:"jobs"`
+	Impressions int     `json:"impressions"`
+	Sheets      int     `json:"sheets"`
+	Cost        float64 `json:"cost"`
+}
+
+func (t Totals) add(r Record) Totals {
+	t.Jobs++
+	t.Impressions += r.Impressions
+	t.Sheets += r.Sheets
+	t.Cost += r.Cost
+
+	return t
+}
+
+// QuotaStatus is the state of a quota for a user.
+type QuotaStatus struct {
+	Quota  string `json:"quota"`
+	Shared bool   `json:"shared"`
+	Soft   Limit  `json:"soft"`
+	Hard   Limit  `json:"hard"`
+
+	// Usage holds the usage counted against the quota in the current
+	// month. For checks of new jobs the job is included.
+	Usage Totals `json:"usage"`
+
+	SoftExceeded bool `json:"softExceeded"`
+	HardExceeded bool `json:"hardExceeded"`
+}
+
+// Ledger stores usage records in a file with one JSON record per line.
+type Ledger struct {
+	cfg  Config
+	path string
+
+	l       sync.RWMutex
+	records []Record
+
+	// pending holds the estimated usage of submitted jobs that have not
+	// been recorded yet, keyed by operation ID. They count against quotas
+	// but are not stored.
+	pending map[string]Record
+}
+
+// Open validates cfg and loads the records stored at path. If path is
+// empty, records are only kept in memory.
+func Open(cfg Config, path string) (*Ledger, error) {
+	names := make(map[string]bool)
+	for idx, q := range cfg.Quotas {
+		if q.Name == "" {
+			return nil, fmt.Errorf("quota #%d: missing name", idx+1)
+		}
+
+		if names[q.Name] {
+			return nil, fmt.Errorf("duplicate quota %q", q.Name)
+		}
+		names[q.Name] = true
+
+		if q.Soft.IsZero() && q.Hard.IsZero() {
+			return nil, fmt.Errorf("quota %q: missing limits", q.Name)
+		}
+	}
+
+	l := &Ledger{
+		cfg:     cfg,
+		path:    path,
+		pending: make(map[string]Record),
+	}
+
+	if path == "" {
+		return l, nil
+	}
+
+	f, err := os.Open(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return l, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to open accounting file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("invalid accounting file %q: line %d: %w", path, line, err)
+		}
+
+		l.records = append(l.records, r)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read accounting file: %w", err)
+	}
+
+	return l, nil
+}
+
+// Cost returns the cost of r according to the configured rates.
+func (l *Ledger) Cost(r Record) float64 {
+	rates := l.cfg.Rates
+
+	perImpression := rates.Mono
+	if r.Color {
+		perImpression = rates.Color
+	}
+
+	perSheet := rates.Sheet
+	if rate, ok := rates.Media[r.Media]; ok && r.Media != "" {
+		perSheet = rate
+	}
+
+	if r.Duplex {
+		perSheet += rates.Duplex
+	}
+
+	return float64(r.Impressions)*perImpression + float64(r.Sheets)*perSheet
+}
+
+// Add calculates the cost of r and stores it. A reservation for the
+// operation of r is released.
+func (l *Ledger) Add(r Record) error {
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+
+	r.Cost = l.Cost(r)
+
+	l.l.Lock()
+	defer l.l.Unlock()
+
+	if r.OperationID != "" {
+		delete(l.pending, r.OperationID)
+	}
+
+	if l.path != "" {
+		content, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return fmt.Errorf("failed to open accounting file: %w", err)
+		}
+
+		_, err = f.Write(append(content, '\n'))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to write accounting record: %w", err)
+		}
+	}
+
+	l.records = append(l.records, r)
+
+	return nil
+}
+
+// MonthOf returns the start of the month of t in local time.
+func MonthOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.Local)
+}
+
+// Records returns all records of the month starting at month that match
+// filter. If filter is nil, all records of the month are returned.
+func (l *Ledger) Records(month time.Time, filter func(Record) bool) []Record {
+	l.l.RLock()
+	defer l.l.RUnlock()
+
+	return filterRecords(l.records, month, filter)
+}
+
+// filterRecords returns the records of the month starting at month that
+// match filter.
+func filterRecords(records []Record, month time.Time, filter func(Record) bool) []Record {
+	end := month.AddDate(0, 1, 0)
+
+	var result []Record
+	for _, r := range records {
+		if r.Time.Before(month) || !r.Time.Before(end) {
+			continue
+		}
+
+		if filter == nil || filter(r) {
+			result = append(result, r)
+		}
+	}
+
+	return result
+}
+
+// Usage returns the totals of user in the month starting at month.
+func (l *Ledger) Usage(user string, month time.Time) Totals {
+	var t Totals
+	for _, r := range l.Records(month, func(r Record) bool { return r.User == user }) {
+		t = t.add(r)
+	}
+
+	return t
+}
+
+// Total returns the totals of all users in the month starting at month.
+func (l *Ledger) Total(month time.Time) Totals {
+	var t Totals
+	for _, r := range l.Records(month, nil) {
+		t = t.add(r)
+	}
+
+	return t
+}
+
+// Grouping selects how ListUsage groups records.
+type Grouping string
+
+const (
+	GroupByUser    = Grouping("user")
+	GroupByRole    = Grouping("role")
+	GroupByPrinter = Grouping("printer")
+)
+
+// ParseGrouping parses a grouping name. An empty value groups by user.
+func ParseGrouping(value string) (Grouping, error) {
+	switch g := Grouping(value); g {
+	case "":
+		return GroupByUser, nil
+	case GroupByUser, GroupByRole, GroupByPrinter:
+		return g, nil
+	}
+
+	return "", fmt.Errorf("invalid grouping %q, expected user, role or printer", value)
+}
+
+// GroupTotals holds the totals of a single group.
+type GroupTotals struct {
+	Key string `json:"key"`
+	Totals
+}
+
+// ListUsage returns the totals of the month starting at month grouped by
+// g, sorted by key. Records of users with multiple roles are counted for
+// every role ID.
+func (l *Ledger) ListUsage(month time.Time, g Grouping) []GroupTotals {
+	groups := make(map[string]Totals)
+
+	for _, r := range l.Records(month, nil) {
+		var keys []string
+
+		switch g {
+		case GroupByRole:
+			keys = r.Roles
+		case GroupByPrinter:
+			keys = []string{r.Printer}
+		default:
+			keys = []string{r.User}
+		}
+
+		for _, key := range keys {
+			groups[key] = groups[key].add(r)
+		}
+	}
+
+	result := make([]GroupTotals, 0, len(groups))
+	for key, t := range groups {
+		result = append(result, GroupTotals{
+			Key:    key,
+			Totals: t,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key < result[j].Key
+	})
+
+	return result
+}
+
+// Quotas returns the status of all quotas that apply to user with the
+// given roles in the current month. The usage includes reserved jobs.
+func (l *Ledger) Quotas(user string, roles []string) []QuotaStatus {
+	l.l.RLock()
+	defer l.l.RUnlock()
+
+	return l.quotas(user, roles, Record{})
+}
+
+// Check returns the status of all quotas that apply to the user of job in
+// the current month including job itself and reserved jobs. The impressions
+// and sheets of job should be set to the estimated usage or left at zero if
+// they are unknown. If job would exceed a hard limit, an error wrapping
+// ErrQuotaExceeded is returned.
+func (l *Ledger) Check(job Record) ([]QuotaStatus, error) {
+	l.l.RLock()
+	defer l.l.RUnlock()
+
+	return l.check(job)
+}
+
+// Reserve checks job like Check. If no hard limit is exceeded, the
+// estimated usage of job counts against the quotas until it is recorded
+// using Add or released. The reservation is identified by the operation ID
+// of job.
+func (l *Ledger) Reserve(job Record) ([]QuotaStatus, error) {
+	if job.OperationID == "" {
+		return nil, fmt.Errorf("missing operation ID")
+	}
+
+	l.l.Lock()
+	defer l.l.Unlock()
+
+	statuses, err := l.check(job)
+	if err != nil {
+		return statuses, err
+	}
+
+	if job.Time.IsZero() {
+		job.Time = time.Now()
+	}
+
+	job.Cost = l.Cost(job)
+	l.pending[job.OperationID] = job
+
+	return statuses, nil
+}
+
+// Release removes the reservation of the operation id, e.g. if the job
+// could not be submitted.
+func (l *Ledger) Release(id string) {
+	l.l.Lock()
+	defer l.l.Unlock()
+
+	delete(l.pending, id)
+}
+
+// check implements Check. The caller must hold l.l.
+func (l *Ledger) check(job Record) ([]QuotaStatus, error) {
+	job.Cost = l.Cost(job)
+
+	statuses := l.quotas(job.User, job.Roles, job)
+	for _, s := range statuses {
+		if s.HardExceeded {
+			return statuses, fmt.Errorf("%w: %q allows %s per month", ErrQuotaExceeded, s.Quota, describeLimit(s.Hard))
+		}
+	}
+
+	return statuses, nil
+}
+
+// quotas returns the status of the quotas that apply to user. The caller
+// must hold l.l.
+func (l *Ledger) quotas(user string, roles []string, job Record) []QuotaStatus {
+	month := MonthOf(time.Now())
+
+	result := []QuotaStatus{}
+
+	records := slices.Concat(l.records, slices.Collect(maps.Values(l.pending)))
+
+	for _, q := range l.cfg.Quotas {
+		if !q.appliesTo(user, roles) {
+			continue
+		}
+
+		var usage Totals
+		for _, r := range filterRecords(records, month, func(r Record) bool {
+			if q.Shared {
+				return q.appliesTo(r.User, r.Roles)
+			}
+
+			return r.User == user
+		}) {
+			usage = usage.add(r)
+		}
+
+		status := QuotaStatus{
+			Quota:  q.Name,
+			Shared: q.Shared,
+			Soft:   q.Soft,
+			Hard:   q.Hard,
+		}
+
+		if job.User == "" {
+			status.Usage = usage
+			status.SoftExceeded = q.Soft.reached(usage)
+			status.HardExceeded = q.Hard.reached(usage)
+		} else {
+			// a job with unknown usage is only rejected if the limit has
+			// already been reached
+			status.Usage = usage.add(job)
+			status.SoftExceeded = q.Soft.exceeded(status.Usage) || q.Soft.reached(usage)
+			status.HardExceeded = q.Hard.exceeded(status.Usage) || q.Hard.reached(usage)
+		}
+
+		result = append(result, status)
+	}
+
+	return result
+}
+
+func describeLimit(l Limit) string {
+	switch {
+	case l.Impressions > 0 && l.Cost > 0:
+		return fmt.Sprintf("%d impressions and a cost of %.2f", l.Impressions, l.Cost)
+	case l.Impressions > 0:
+		return fmt.Sprintf("%d impressions", l.Impressions)
+	default:
+		return fmt.Sprintf("a cost of %.2f", l.Cost)
+	}
+}
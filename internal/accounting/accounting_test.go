@@ -0,0 +1,69 @@
+package accounting
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReserve(t *testing.T) {
+	l, err := Open(Config{
+		Quotas: []Quota{
+			{Name: "monthly", Hard: Limit{Impressions: 10}},
+		},
+	}, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	job := func(id string, impressions int) Record {
+		return Record{User: "alice", OperationID: id, Impressions: impressions}
+	}
+
+	if _, err := l.Reserve(job("a", 6)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// the first job is still in-flight
+	if _, err := l.Reserve(job("b", 6)); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected the reserved usage to count against the quota, got %v", err)
+	}
+
+	if usage := l.Quotas("alice", nil)[0].Usage.Impressions; usage != 6 {
+		t.Errorf("expected a usage of 6 impressions, got %d", usage)
+	}
+
+	l.Release("a")
+
+	if _, err := l.Reserve(job("b", 6)); err != nil {
+		t.Fatalf("expected the released reservation to be freed, got %v", err)
+	}
+
+	// recording the job replaces the reservation
+	if err := l.Add(job("b", 2)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if usage := l.Quotas("alice", nil)[0].Usage.Impressions; usage != 2 {
+		t.Errorf("expected a usage of 2 impressions, got %d", usage)
+	}
+
+	if _, err := l.Reserve(Record{User: "alice"}); err == nil {
+		t.Errorf("expected reservations without operation ID to be rejected")
+	}
+}
+
+func TestEstimateUnknownPages(t *testing.T) {
+	r := Record{Copies: 3}
+	r.Estimate()
+
+	if r.Impressions != 3 || r.Sheets != 3 {
+		t.Errorf("expected one page per copy, got %d impressions and %d sheets", r.Impressions, r.Sheets)
+	}
+
+	r = Record{Pages: 5, Copies: 2, Duplex: true}
+	r.Estimate()
+
+	if r.Impressions != 10 || r.Sheets != 6 {
+		t.Errorf("expected 10 impressions on 6 sheets, got %d and %d", r.Impressions, r.Sheets)
+	}
+}
@@ -0,0 +1,97 @@
+// Package acl restricts which users may use a printer.
+package acl
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrDenied is returned if a user must not use a printer.
+var ErrDenied = errors.New("access denied")
+
+// Policies for printers without rules.
+const (
+	PolicyAllow = "allow"
+	PolicyDeny  = "deny"
+)
+
+// Config holds the access rules of all printers.
+type Config struct {
+	// Default is either allow or deny and applies to printers without
+	// rules. It defaults to allow.
+	Default string `json:"default"`
+
+	// Printers maps printer and pool names to their rules. Access to pools
+	// is decided by the rules of the pool, not the ones of the members.
+	Printers map[string]Rule `json:"printers"`
+}
+
+// Rule defines who may use a printer. Deny entries take precedence. If
+// any allow entry is set, only matching users may use the printer.
+type Rule struct {
+	AllowUsers []string `json:"allowUsers"`
+	AllowRoles []string `json:"allowRoles"`
+	DenyUsers  []string `json:"denyUsers"`
+	DenyRoles  []string `json:"denyRoles"`
+}
+
+// ACL decides whether users may use printers.
+type ACL struct {
+	cfg Config
+}
+
+// New validates cfg and returns a new ACL.
+func New(cfg Config) (*ACL, error) {
+	switch cfg.Default {
+	case "":
+		cfg.Default = PolicyAllow
+	case PolicyAllow, PolicyDeny:
+	default:
+		return nil, fmt.Errorf("invalid default policy %q, expected allow or deny", cfg.Default)
+	}
+
+	return &ACL{
+		cfg: cfg,
+	}, nil
+}
+
+// Check returns an error wrapping ErrDenied if user with the given roles
+// must not use printer. roles may contain role IDs and names.
+func (a *ACL) Check(printer string, user string, roles []string) error {
+	rule, ok := a.cfg.Printers[printer]
+	if !ok {
+		if a.cfg.Default == PolicyDeny {
+			return fmt.Errorf("%w: printer %q is not shared", ErrDenied, printer)
+		}
+
+		return nil
+	}
+
+	hasRole := func(candidates []string) bool {
+		return slices.ContainsFunc(roles, func(role string) bool {
+			return slices.Contains(candidates, role)
+		})
+	}
+
+	switch {
+	case slices.Contains(rule.DenyUsers, user):
+		return fmt.Errorf("%w: user %q must not use printer %q", ErrDenied, user, printer)
+
+	case hasRole(rule.DenyRoles):
+		return fmt.Errorf("%w: a role of user %q must not use printer %q", ErrDenied, user, printer)
+
+	case len(rule.AllowUsers) == 0 && len(rule.AllowRoles) == 0:
+		return nil
+
+	case slices.Contains(rule.AllowUsers, user), hasRole(rule.AllowRoles):
+		return nil
+	}
+
+	return fmt.Errorf("%w: user %q is not allowed to use printer %q", ErrDenied, user, printer)
+}
+
+// Allowed returns true if Check does not return an error.
+func (a *ACL) Allowed(printer string, user string, roles []string) bool {
+	return a.Check(printer, user, roles) == nil
+}
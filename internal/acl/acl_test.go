@@ -0,0 +1,79 @@
+package acl
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	a, err := New(Config{
+		Printers: map[string]Rule{
+			"prescriptions": {
+				AllowRoles: []string{"vet"},
+				AllowUsers: []string{"carol"},
+				DenyUsers:  []string{"mallory"},
+				DenyRoles:  []string{"intern"},
+			},
+			"deny-only": {
+				DenyRoles: []string{"intern"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		printer string
+		user    string
+		roles   []string
+		allowed bool
+	}{
+		{"allowed role", "prescriptions", "alice", []string{"vet"}, true},
+		{"allowed user", "prescriptions", "carol", nil, true},
+		{"not allowed", "prescriptions", "bob", []string{"reception"}, false},
+		{"denied role before allowed role", "prescriptions", "alice", []string{"vet", "intern"}, false},
+		{"denied user before allowed role", "prescriptions", "mallory", []string{"vet"}, false},
+		{"denied role before allowed user", "prescriptions", "carol", []string{"intern"}, false},
+		{"deny only", "deny-only", "bob", []string{"reception"}, true},
+		{"deny only denied", "deny-only", "bob", []string{"intern"}, false},
+		{"no rules", "office", "bob", nil, true},
+	}
+
+	for _, c := range cases {
+		err := a.Check(c.printer, c.user, c.roles)
+
+		if c.allowed && err != nil {
+			t.Errorf("%s: expected access, got %s", c.name, err)
+		}
+
+		if !c.allowed && !errors.Is(err, ErrDenied) {
+			t.Errorf("%s: expected ErrDenied, got %v", c.name, err)
+		}
+	}
+}
+
+func TestCheckDefaultDeny(t *testing.T) {
+	a, err := New(Config{
+		Default: PolicyDeny,
+		Printers: map[string]Rule{
+			"office": {},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !a.Allowed("office", "bob", nil) {
+		t.Errorf("expected printers with rules to be shared")
+	}
+
+	if a.Allowed("labels", "bob", nil) {
+		t.Errorf("expected printers without rules not to be shared")
+	}
+
+	if _, err := New(Config{Default: "maybe"}); err == nil {
+		t.Errorf("expected an invalid default policy to be rejected")
+	}
+}
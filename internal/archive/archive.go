@@ -0,0 +1,221 @@
+// Package archive keeps encrypted copies of printed documents so they can be
+// printed again.
+package archive
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned if a document is not archived or has expired.
+var ErrNotFound = errors.New("document is not archived")
+
+// fileSuffix is appended to the ID of archived documents.
+const fileSuffix = ".bin"
+
+// Archive stores documents encrypted with AES-256-GCM in a directory. Each
+// file holds the random nonce followed by the sealed document.
+type Archive struct {
+	dir       string
+	aead      cipher.AEAD
+	retention time.Duration
+}
+
+// ParseKey decodes a base64 or hex encoded 256 bit key.
+func ParseKey(value string) ([]byte, error) {
+	value = strings.TrimSpace(value)
+
+	key, err := hex.DecodeString(value)
+	if err != nil {
+		key, err = base64.StdEncoding.DecodeString(value)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("key must be hex or base64 encoded")
+	}
+
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes long, got %d", len(key))
+	}
+
+	return key, nil
+}
+
+// New returns an archive that stores documents in dir for the given
+// retention period.
+func New(dir string, key []byte, retention time.Duration) (*Archive, error) {
+	if retention <= 0 {
+		return nil, fmt.Errorf("retention must be positive")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	return &Archive{
+		dir:       dir,
+		aead:      aead,
+		retention: retention,
+	}, nil
+}
+
+// Retention returns how long documents are kept.
+func (a *Archive) Retention() time.Duration {
+	return a.retention
+}
+
+func (a *Archive) path(id string) (string, error) {
+	if id == "" || strings.ContainsFunc(id, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_')
+	}) {
+		return "", fmt.Errorf("invalid archive id %q", id)
+	}
+
+	return filepath.Join(a.dir, id+fileSuffix), nil
+}
+
+// Store encrypts content and stores it under id. The ID is authenticated so
+// archived files cannot be swapped.
+func (a *Archive) Store(id string, content []byte) error {
+	path, err := a.path(id)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, a.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	sealed := a.aead.Seal(nonce, nonce, content, []byte(id))
+
+	tmp, err := os.CreateTemp(a.dir, id+".*")
+	if err != nil {
+		return fmt.Errorf("failed to archive document: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(sealed); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to archive document: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to archive document: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to archive document: %w", err)
+	}
+
+	return nil
+}
+
+// Load returns the decrypted document stored under id. Expired documents
+// are reported as ErrNotFound even if they have not been purged yet.
+func (a *Archive) Load(id string) ([]byte, error) {
+	path, err := a.path(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	stat, err := os.Stat(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil, ErrNotFound
+	case err != nil:
+		return nil, err
+	case time.Since(stat.ModTime()) > a.retention:
+		return nil, ErrNotFound
+	}
+
+	sealed, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	size := a.aead.NonceSize()
+	if len(sealed) < size {
+		return nil, fmt.Errorf("archived document %q is corrupted", id)
+	}
+
+	content, err := a.aead.Open(nil, sealed[:size], sealed[size:], []byte(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt archived document %q: %w", id, err)
+	}
+
+	return content, nil
+}
+
+// Purge removes all documents older than the retention period and returns
+// the number of removed documents.
+func (a *Archive) Purge() (int, error) {
+	entries, err := os.ReadDir(a.dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var removed int
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), fileSuffix) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) <= a.retention {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(a.dir, entry.Name())); err != nil {
+			slog.Error("failed to remove expired document", "file", entry.Name(), "error", err)
+			continue
+		}
+
+		removed++
+	}
+
+	return removed, nil
+}
+
+// Watch purges expired documents immediately and then every interval until
+// ctx is cancelled.
+func (a *Archive) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		removed, err := a.Purge()
+		if err != nil {
+			slog.Error("failed to purge archived documents", "path", a.dir, "error", err)
+		} else if removed > 0 {
+			slog.Info("purged expired documents", "count", removed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testKey is a fixed 256 bit key used by the tests.
+var testKey = make([]byte, 32)
+
+func TestWatchPurgesImmediately(t *testing.T) {
+	dir := t.TempDir()
+
+	a, err := New(dir, testKey, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Store("expired", []byte("content")); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "expired"+fileSuffix)
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go a.Watch(ctx, time.Hour)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("expired document has not been purged on start")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStoreLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	a, err := New(dir, testKey, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Store("job-1", []byte("content")); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := a.Load("job-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != "content" {
+		t.Errorf("expected the stored content, got %q", content)
+	}
+
+	raw, err := os.ReadFile(filepath.Join(dir, "job-1"+fileSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(raw, []byte("content")) {
+		t.Errorf("expected the document to be encrypted")
+	}
+
+	for _, id := range []string{"job-2", "../job-1", ""} {
+		if _, err := a.Load(id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%q: expected ErrNotFound, got %v", id, err)
+		}
+	}
+
+	if err := a.Store("../job-1", []byte("content")); err == nil {
+		t.Errorf("expected invalid IDs to be rejected")
+	}
+}
+
+func TestLoadSwappedFile(t *testing.T) {
+	dir := t.TempDir()
+
+	a, err := New(dir, testKey, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Store("job-1", []byte("content")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the ID is authenticated so the file cannot be loaded under another ID
+	if err := os.Rename(filepath.Join(dir, "job-1"+fileSuffix), filepath.Join(dir, "job-2"+fileSuffix)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.Load("job-2"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a decryption error, got %v", err)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	dir := t.TempDir()
+
+	a, err := New(dir, testKey, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"old", "new"} {
+		if err := a.Store(id, []byte(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "old"+fileSuffix), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.Load("old"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected expired documents not to be loaded, got %v", err)
+	}
+
+	removed, err := a.Purge()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if removed != 1 {
+		t.Errorf("expected one document to be purged, got %d", removed)
+	}
+
+	if _, err := a.Load("new"); err != nil {
+		t.Errorf("expected the new document to be kept, got %v", err)
+	}
+}
@@ -0,0 +1,229 @@
+// Package audit records security relevant print activity.
+//
+// Events form a hash chain: each event holds the hash of its predecessor
+// and its own hash covers all fields including the previous hash. Hashes
+// are HMAC-SHA256 sums using a secret key so the chain cannot be recomputed
+// by someone who is only able to modify the audit log. Removing, reordering
+// or modifying recorded events therefore breaks the chain, which is
+// detected by Verify. Events only describe documents using their name, hash
+// and metadata and never hold the content.
+package audit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tierklinik-dobersberg/print-service/internal/privacy"
+)
+
+// Actions recorded in the audit trail.
+const (
+	ActionAccessDenied = "access-denied"
+	ActionPolicyDenied = "policy-denied"
+	ActionQuotaDenied  = "quota-denied"
+
+	ActionSubmitted    = "submitted"
+	ActionSubmitFailed = "submit-failed"
+	ActionReprinted    = "reprinted"
+	ActionCancelled    = "cancelled"
+	ActionMoved        = "moved"
+	ActionAdmin        = "admin"
+)
+
+// Event is a single entry of the audit trail.
+type Event struct {
+	// Sequence is the position of the event in the chain, starting at 1.
+	Sequence uint64 `json:"seq"`
+
+	Time     time.Time `json:"time"`
+	Action   string    `json:"action"`
+	User     string    `json:"user,omitempty"`
+	Printer  string    `json:"printer,omitempty"`
+	Document string    `json:"document,omitempty"`
+
+	// DocumentHash is the hex encoded SHA-256 hash of the printed
+	// document.
+	DocumentHash string `json:"documentHash,omitempty"`
+
+	// Reason explains why an action has been denied.
+	Reason string `json:"reason,omitempty"`
+
+	// Details holds additional action specific attributes.
+	Details map[string]string `json:"details,omitempty"`
+
+	// PrevHash is the hash of the previous event and empty for the first
+	// one.
+	PrevHash string `json:"prevHash"`
+
+	// Hash is the hex encoded HMAC-SHA256 of the event. It is calculated
+	// by Sum.
+	Hash string `json:"hash"`
+}
+
+// minKeySize is the minimum size of the key used to hash events.
+const minKeySize = 32
+
+// ParseKey decodes a base64 or hex encoded key of at least 256 bits.
+func ParseKey(value string) ([]byte, error) {
+	value = strings.TrimSpace(value)
+
+	key, err := hex.DecodeString(value)
+	if err != nil {
+		key, err = base64.StdEncoding.DecodeString(value)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("key must be hex or base64 encoded")
+	}
+
+	if len(key) < minKeySize {
+		return nil, fmt.Errorf("key must be at least %d bytes long, got %d", minKeySize, len(key))
+	}
+
+	return key, nil
+}
+
+// Sum returns the HMAC-SHA256 of e using key. The Hash field itself is not
+// covered.
+func (e Event) Sum(key []byte) (string, error) {
+	e.Hash = ""
+
+	blob, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(blob)
+
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Sink persists or forwards audit events. Write is called in the order of
+// the chain.
+type Sink interface {
+	Write(ctx context.Context, e Event) error
+}
+
+// headSink is implemented by sinks that know the last event written in a
+// previous run so the chain can be continued.
+type headSink interface {
+	Head() (Event, bool)
+}
+
+// Log is the audit trail of the service. Document names are only redacted
+// in the log output but kept in sinks.
+type Log struct {
+	logger *slog.Logger
+	key    []byte
+	sinks  []Sink
+
+	// mu guards the chain state. writeMu is taken before mu is released
+	// so sinks receive events in the order of the chain without calling
+	// them while holding mu.
+	mu      sync.Mutex
+	writeMu sync.Mutex
+	last    Event
+}
+
+// New returns a new audit log that hashes events using key and writes them
+// to the default logger and all sinks. The chain is continued from the
+// first sink that knows the last recorded event.
+func New(key []byte, sinks ...Sink) *Log {
+	l := &Log{
+		logger: slog.Default().With("log", "audit"),
+		key:    key,
+		sinks:  sinks,
+	}
+
+	for _, s := range sinks {
+		if hs, ok := s.(headSink); ok {
+			if last, ok := hs.Head(); ok {
+				l.last = last
+				break
+			}
+		}
+	}
+
+	// a different key breaks the chain, which Verify reports later on
+	if l.last.Hash != "" {
+		if hash, err := l.last.Sum(key); err != nil || hash != l.last.Hash {
+			l.logger.Error("the last audit event does not match the audit key, the chain will not verify", "seq", l.last.Sequence)
+		}
+	}
+
+	return l
+}
+
+// Record adds e to the audit trail. If e.Time is not set, the current time
+// is used.
+func (l *Log) Record(ctx context.Context, e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	// the time is stored in UTC so the hash does not depend on the
+	// local time zone.
+	e.Time = e.Time.UTC()
+
+	l.mu.Lock()
+
+	e.Sequence = l.last.Sequence + 1
+	e.PrevHash = l.last.Hash
+
+	hash, err := e.Sum(l.key)
+	if err != nil {
+		l.mu.Unlock()
+		l.logger.ErrorContext(ctx, "failed to hash audit event", "action", e.Action, "error", err)
+		return
+	}
+
+	e.Hash = hash
+	l.last = e
+
+	l.writeMu.Lock()
+	defer l.writeMu.Unlock()
+
+	l.mu.Unlock()
+
+	attrs := []any{
+		"action", e.Action,
+		"time", e.Time,
+		"user", e.User,
+		"seq", e.Sequence,
+		"hash", e.Hash,
+	}
+
+	if e.Printer != "" {
+		attrs = append(attrs, "printer", e.Printer)
+	}
+
+	if e.Document != "" {
+		attrs = append(attrs, "document", privacy.Name(e.Document))
+	}
+
+	if e.Reason != "" {
+		attrs = append(attrs, "reason", e.Reason)
+	}
+
+	for key, value := range e.Details {
+		attrs = append(attrs, key, value)
+	}
+
+	l.logger.InfoContext(ctx, "audit event", attrs...)
+
+	for _, s := range l.sinks {
+		if err := s.Write(ctx, e); err != nil {
+			l.logger.ErrorContext(ctx, "failed to write audit event", "sink", fmt.Sprintf("%T", s), "seq", e.Sequence, "error", err)
+		}
+	}
+}
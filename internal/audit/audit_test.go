@@ -0,0 +1,139 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// testKey is used to hash the events of tests.
+var testKey = bytes.Repeat([]byte{0x42}, minKeySize)
+
+func TestRecordConcurrentOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	sink, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := New(testKey, sink)
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for range 20 {
+				log.Record(context.Background(), Event{Action: ActionSubmitted, User: "alice"})
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	res, err := Verify(f, testKey)
+	if err != nil {
+		t.Fatalf("expected events to be written in chain order: %s", err)
+	}
+
+	if res.Events != 400 {
+		t.Fatalf("expected 400 events, got %d", res.Events)
+	}
+}
+
+func TestVerifyRequiresKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	sink, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := New(testKey, sink)
+	for _, user := range []string{"alice", "bob", "carol"} {
+		log.Record(context.Background(), Event{Action: ActionSubmitted, User: user})
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Verify(bytes.NewReader(content), testKey); err != nil {
+		t.Fatalf("expected the log to verify: %s", err)
+	}
+
+	var verr *VerifyError
+	if _, err := Verify(bytes.NewReader(content), bytes.Repeat([]byte{0x01}, minKeySize)); !errors.As(err, &verr) || verr.Line != 1 {
+		t.Errorf("expected verification with another key to fail on line 1, got %v", err)
+	}
+
+	// modify the second event and recompute the chain without the key
+	var (
+		events []Event
+		forged bytes.Buffer
+	)
+
+	for _, line := range bytes.Split(bytes.TrimSpace(content), []byte("\n")) {
+		var e Event
+		if err := json.Unmarshal(line, &e); err != nil {
+			t.Fatal(err)
+		}
+
+		events = append(events, e)
+	}
+
+	events[1].User = "mallory"
+	for idx := range events {
+		if idx > 0 {
+			events[idx].PrevHash = events[idx-1].Hash
+		}
+
+		if events[idx].Hash, err = events[idx].Sum(nil); err != nil {
+			t.Fatal(err)
+		}
+
+		line, _ := json.Marshal(events[idx])
+		forged.Write(append(line, '\n'))
+	}
+
+	if _, err := Verify(&forged, testKey); !errors.As(err, &verr) {
+		t.Errorf("expected the forged log to be rejected, got %v", err)
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	cases := map[string]bool{
+		"":                                     false,
+		"not a key":                            false,
+		string(bytes.Repeat([]byte("ab"), 16)): false,
+		string(bytes.Repeat([]byte("ab"), 32)): true,
+		"QkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkI=": true,
+	}
+
+	for value, valid := range cases {
+		if _, err := ParseKey(value); (err == nil) != valid {
+			t.Errorf("%q: expected valid=%t, got %v", value, valid, err)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/tierklinik-dobersberg/apis/gen/go/tkd/events/v1/eventsv1connect"
+	"github.com/tierklinik-dobersberg/apis/pkg/events"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// FileSink appends events as JSON lines to a file.
+type FileSink struct {
+	mu   sync.Mutex
+	f    *os.File
+	head Event
+	ok   bool
+}
+
+// OpenFile opens or creates the append-only audit log at path. The last
+// event of an existing log is used to continue the chain.
+func OpenFile(path string) (*FileSink, error) {
+	sink := new(FileSink)
+
+	existing, err := os.Open(path)
+	switch {
+	case err == nil:
+		sink.head, sink.ok, err = lastEvent(existing)
+		existing.Close()
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read audit log: %w", err)
+		}
+
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	sink.f, err = os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	return sink, nil
+}
+
+func lastEvent(f *os.File) (Event, bool, error) {
+	var (
+		last  Event
+		found bool
+	)
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, maxLineSize)
+
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		if err := json.Unmarshal(scanner.Bytes(), &last); err != nil {
+			return last, false, fmt.Errorf("invalid audit event: %w", err)
+		}
+
+		found = true
+	}
+
+	return last, found, scanner.Err()
+}
+
+// Head returns the last event of the log when it has been opened.
+func (s *FileSink) Head() (Event, bool) {
+	return s.head, s.ok
+}
+
+// Write appends e to the file and syncs it to disk.
+func (s *FileSink) Write(_ context.Context, e Event) error {
+	blob, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.f.Write(append(blob, '\n')); err != nil {
+		return err
+	}
+
+	return s.f.Sync()
+}
+
+// Close closes the file.
+func (s *FileSink) Close() error {
+	return s.f.Close()
+}
+
+const (
+	// maxPendingEvents limits the number of unpublished events kept by
+	// EventSink. The oldest events are discarded if the EventService is
+	// unavailable for too long. The file sink still holds all of them.
+	maxPendingEvents = 10000
+
+	minPublishDelay = time.Second
+	maxPublishDelay = time.Minute
+)
+
+// eventState is persisted by EventSink.
+type eventState struct {
+	// Head is the last event written to the sink.
+	Head *Event `json:"head,omitempty"`
+
+	// Pending holds the events that have not been published yet.
+	Pending []Event `json:"pending,omitempty"`
+}
+
+// EventSink publishes events as google.protobuf.Struct messages to the
+// EventService. Write only records the event as pending and a background
+// worker publishes pending events in order so recording is never blocked
+// by the EventService. Failed events are retried until they are published.
+//
+// If a state file is configured, the last written event and all events
+// that have not been published yet are kept there. The chain is continued
+// from that event and pending events are published after a restart.
+type EventSink struct {
+	cli    eventsv1connect.EventServiceClient
+	path   string
+	notify chan struct{}
+
+	mu    sync.Mutex
+	state eventState
+}
+
+// NewEventSink returns a sink that publishes events using cli until ctx is
+// cancelled. statePath is optional.
+func NewEventSink(ctx context.Context, cli eventsv1connect.EventServiceClient, statePath string) (*EventSink, error) {
+	sink := &EventSink{
+		cli:    cli,
+		path:   statePath,
+		notify: make(chan struct{}, 1),
+	}
+
+	if statePath != "" {
+		content, err := os.ReadFile(statePath)
+		switch {
+		case err == nil:
+			if err := json.Unmarshal(content, &sink.state); err != nil {
+				return nil, fmt.Errorf("invalid audit event state: %w", err)
+			}
+
+		case !errors.Is(err, os.ErrNotExist):
+			return nil, fmt.Errorf("failed to read audit event state: %w", err)
+		}
+	}
+
+	if count := len(sink.state.Pending); count > 0 {
+		slog.Info("publishing pending audit events", "count", count)
+	}
+
+	go sink.run(ctx)
+
+	return sink, nil
+}
+
+// run publishes pending events until ctx is cancelled.
+func (s *EventSink) run(ctx context.Context) {
+	for {
+		s.mu.Lock()
+		var (
+			next Event
+			ok   = len(s.state.Pending) > 0
+		)
+		if ok {
+			next = s.state.Pending[0]
+		}
+		s.mu.Unlock()
+
+		if ok {
+			if !s.publish(ctx, next) {
+				return
+			}
+
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.notify:
+		}
+	}
+}
+
+// publish publishes e and retries until it succeeds. It returns false if
+// ctx has been cancelled before.
+func (s *EventSink) publish(ctx context.Context, e Event) bool {
+	msg, err := eventMessage(e)
+	if err != nil {
+		// retrying does not help, the event is still kept in the file sink
+		slog.Error("failed to encode audit event", "seq", e.Sequence, "error", err)
+		s.published(e)
+
+		return true
+	}
+
+	delay := minPublishDelay
+	for {
+		err := events.PublishTo(ctx, s.cli, msg, false)
+		if err == nil {
+			s.published(e)
+
+			return true
+		}
+
+		slog.Warn("failed to publish audit event, retrying", "seq", e.Sequence, "retry-in", delay, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(delay):
+		}
+
+		delay = min(delay*2, maxPublishDelay)
+	}
+}
+
+func eventMessage(e Event) (*structpb.Struct, error) {
+	blob, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := new(structpb.Struct)
+	if err := msg.UnmarshalJSON(blob); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// published removes e from the pending events.
+func (s *EventSink) published(e Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state.Pending = slices.DeleteFunc(s.state.Pending, func(p Event) bool {
+		return p.Sequence == e.Sequence
+	})
+
+	if err := s.save(); err != nil {
+		slog.Error("failed to save audit event state", "error", err)
+	}
+}
+
+// save writes the state file. The caller must hold s.mu.
+func (s *EventSink) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	content, err := json.Marshal(s.state)
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first so the state is not lost if the
+	// service is stopped while writing.
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// Head returns the last event written to the sink, including previous runs
+// if a state file is configured.
+func (s *EventSink) Head() (Event, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state.Head == nil {
+		return Event{}, false
+	}
+
+	return *s.state.Head, true
+}
+
+// Write adds e to the pending events and wakes up the worker. It does not
+// block on the EventService.
+func (s *EventSink) Write(_ context.Context, e Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state.Head = &e
+	s.state.Pending = append(s.state.Pending, e)
+
+	if dropped := len(s.state.Pending) - maxPendingEvents; dropped > 0 {
+		slog.Error("too many unpublished audit events, discarding the oldest", "count", dropped, "seq", s.state.Pending[0].Sequence)
+		s.state.Pending = slices.Delete(s.state.Pending, 0, dropped)
+	}
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+		// the worker has already been notified
+	}
+
+	if err := s.save(); err != nil {
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+
+	return nil
+}
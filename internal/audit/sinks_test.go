@@ -0,0 +1,120 @@
+package audit
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	eventsv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/events/v1"
+	"github.com/tierklinik-dobersberg/apis/gen/go/tkd/events/v1/eventsv1connect"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// fakeEvents records the sequence numbers of published events. If block
+// is set, Publish waits until the context is cancelled.
+type fakeEvents struct {
+	eventsv1connect.EventServiceClient
+
+	block     bool
+	published chan uint64
+}
+
+func (f *fakeEvents) Publish(ctx context.Context, req *connect.Request[eventsv1.Event]) (*connect.Response[emptypb.Empty], error) {
+	if f.block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	var msg structpb.Struct
+	if err := req.Msg.Event.UnmarshalTo(&msg); err != nil {
+		return nil, err
+	}
+
+	f.published <- uint64(msg.Fields["seq"].GetNumberValue())
+
+	return connect.NewResponse(new(emptypb.Empty)), nil
+}
+
+func TestEventSinkState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.json")
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sink, err := NewEventSink(ctx, &fakeEvents{block: true}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := New(testKey, sink)
+	log.Record(ctx, Event{Action: ActionSubmitted, User: "alice"})
+	log.Record(ctx, Event{Action: ActionCancelled, User: "alice"})
+
+	cancel()
+
+	// the events could not be published before the "restart"
+	cli := &fakeEvents{published: make(chan uint64, 2)}
+
+	sink, err = NewEventSink(context.Background(), cli, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	head, ok := sink.Head()
+	if !ok || head.Sequence != 2 || head.Action != ActionCancelled {
+		t.Fatalf("expected the last event to be the head, got %+v, %t", head, ok)
+	}
+
+	for _, want := range []uint64{1, 2} {
+		select {
+		case seq := <-cli.published:
+			if seq != want {
+				t.Fatalf("expected event %d to be published, got %d", want, seq)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("pending event %d has not been published", want)
+		}
+	}
+
+	// the chain continues after the restart
+	log = New(testKey, sink)
+	log.Record(context.Background(), Event{Action: ActionAdmin, User: "bob"})
+
+	head, _ = sink.Head()
+	if head.Sequence != 3 || head.PrevHash == "" {
+		t.Fatalf("expected the chain to be continued, got %+v", head)
+	}
+}
+
+func TestEventSinkWriteDoesNotBlock(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sink, err := NewEventSink(ctx, &fakeEvents{block: true}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := New(testKey, sink)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		for range 1000 {
+			log.Record(context.Background(), Event{Action: ActionSubmitted, User: "alice"})
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("recording blocked while the EventService is unavailable")
+	}
+
+	if head, _ := sink.Head(); head.Sequence != 1000 {
+		t.Fatalf("expected all events to be pending, got head %d", head.Sequence)
+	}
+}
@@ -0,0 +1,98 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// maxLineSize is the maximum size of a single event in an audit log file.
+const maxLineSize = 1 << 20
+
+// VerifyError describes the first broken link of an audit log.
+type VerifyError struct {
+	// Line is the line number in the log, starting at 1.
+	Line int
+
+	// Sequence is the sequence number of the offending event, if it could
+	// be decoded.
+	Sequence uint64
+
+	Reason string
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("line %d (seq %d): %s", e.Line, e.Sequence, e.Reason)
+}
+
+// Result summarizes a verified audit log.
+type Result struct {
+	// Events is the number of verified events.
+	Events int
+
+	// First and Last are the first and last event of the log.
+	First Event
+	Last  Event
+}
+
+// Verify reads an audit log written by FileSink from r and checks the hash
+// chain using the key the events have been recorded with. A log must start
+// with the first event of the chain. It returns a *VerifyError for the first
+// event that does not match its hash or does not follow its predecessor.
+func Verify(r io.Reader, key []byte) (Result, error) {
+	var (
+		res  Result
+		line int
+	)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLineSize)
+
+	for scanner.Scan() {
+		line++
+
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return res, &VerifyError{Line: line, Reason: fmt.Sprintf("invalid event: %s", err)}
+		}
+
+		fail := func(format string, args ...any) (Result, error) {
+			return res, &VerifyError{Line: line, Sequence: e.Sequence, Reason: fmt.Sprintf(format, args...)}
+		}
+
+		if e.Sequence != res.Last.Sequence+1 {
+			return fail("expected sequence %d", res.Last.Sequence+1)
+		}
+
+		if e.PrevHash != res.Last.Hash {
+			return fail("previous hash %q does not match %q", e.PrevHash, res.Last.Hash)
+		}
+
+		hash, err := e.Sum(key)
+		if err != nil {
+			return fail("failed to hash event: %s", err)
+		}
+
+		if hash != e.Hash {
+			return fail("hash %q does not match the content (%q)", e.Hash, hash)
+		}
+
+		if res.Events == 0 {
+			res.First = e
+		}
+
+		res.Last = e
+		res.Events++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return res, err
+	}
+
+	return res, nil
+}
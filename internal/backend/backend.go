@@ -0,0 +1,78 @@
+package backend
+
+import (
+	"errors"
+
+	"github.com/phin1x/go-ipp"
+	"github.com/tierklinik-dobersberg/print-service/internal/cups"
+)
+
+// PrinterBackend is implemented by all types that are able to submit jobs
+// to printers.
+type PrinterBackend interface {
+	// ListPrinters returns all printers served by the backend.
+	ListPrinters() ([]cups.Printer, error)
+
+	// HasPrinter returns true if the backend serves the printer with the
+	// given name.
+	HasPrinter(name string) bool
+
+	// DefaultPrinter returns the name of the default printer of the backend
+	// or an empty string if there is none.
+	DefaultPrinter() string
+
+	// ListJobs returns all jobs of printer.
+	ListJobs(printer string) ([]cups.Job, error)
+
+	// GetJob returns the job with the given id from printer.
+	GetJob(printer string, id int) (cups.Job, error)
+
+	// Print submits doc to printer and returns the ID of the new job.
+	Print(doc ipp.Document, printer string, attrs map[string]any) (int, error)
+}
+
+// PrinterLookup is implemented by backends that have to ask a server
+// whether a printer exists.
+type PrinterLookup interface {
+	// LookupPrinter returns true if the backend serves the printer with the
+	// given name. An error is returned if this cannot be determined, e.g.
+	// because the server is not reachable.
+	LookupPrinter(name string) (bool, error)
+}
+
+// ErrUnknownPrinter is returned by Registry.Lookup if no backend serves a
+// printer.
+var ErrUnknownPrinter = errors.New("unknown printer")
+
+// ErrValidationNotSupported is returned by Registry.ValidateJob if the
+// backend of a printer cannot validate jobs.
+var ErrValidationNotSupported = errors.New("job validation is not supported by the printer backend")
+
+// ErrJobNotFound is returned by GetJob if the printer does not know the
+// job (anymore).
+var ErrJobNotFound = errors.New("job not found")
+
+// Validator is implemented by backends that can check whether a printer
+// would accept a job without actually printing anything.
+type Validator interface {
+	// ValidateJob checks if printer accepts a document of the given MIME
+	// type using attrs.
+	ValidateJob(printer string, mimeType string, attrs map[string]any) error
+}
+
+// Compile time check
+var (
+	_ PrinterBackend = (*cups.Client)(nil)
+	_ Validator      = (*cups.Client)(nil)
+	_ PrinterLookup  = (*cups.Client)(nil)
+)
+
+// hasPrinter returns true if b serves printer. Backends implementing
+// PrinterLookup may return an error.
+func hasPrinter(b PrinterBackend, printer string) (bool, error) {
+	if l, ok := b.(PrinterLookup); ok {
+		return l.LookupPrinter(printer)
+	}
+
+	return b.HasPrinter(printer), nil
+}
@@ -0,0 +1,418 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"strconv"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	ipp "github.com/phin1x/go-ipp"
+	longrunningv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/longrunning/v1"
+	"github.com/tierklinik-dobersberg/apis/gen/go/tkd/longrunning/v1/longrunningv1connect"
+	printingv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/printing/v1"
+	"github.com/tierklinik-dobersberg/print-service/internal/cups"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// maxPollErrors is the number of consecutive errors after which the state
+// of a job is not polled anymore.
+const maxPollErrors = 20
+
+// pollInterval is the interval in which the state of submitted jobs is
+// polled.
+var pollInterval = 15 * time.Second
+
+// Operation is a registered long-running operation for a print job.
+type Operation struct {
+	lrun      longrunningv1connect.LongRunningServiceClient
+	operation *longrunningv1.Operation
+	authToken string
+
+	// annotations are sent with every update of the operation.
+	annotations map[string]string
+
+	// onUpdate is called with every polled state of the job and
+	// onComplete with the final one.
+	onUpdate   []func(cups.Job)
+	onComplete []func(cups.Job)
+
+	// printer and jobID identify the job created by Submit.
+	printer string
+	jobID   int
+}
+
+// ResolvePrinter returns printer or the default printer of b if printer is
+// empty.
+func ResolvePrinter(b PrinterBackend, printer string) (string, error) {
+	if printer != "" {
+		return printer, nil
+	}
+
+	printer = b.DefaultPrinter()
+	if printer == "" {
+		return "", fmt.Errorf("no printer specified and no default printer available")
+	}
+
+	return printer, nil
+}
+
+// StartOperation registers a new long-running operation for a print job. The
+// caller must either call Submit or Fail on the returned operation.
+func StartOperation(ctx context.Context, lrun longrunningv1connect.LongRunningServiceClient, description string, creator string, annotations map[string]string) (*Operation, error) {
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+
+	req := connect.NewRequest(&longrunningv1.RegisterOperationRequest{
+		Owner:        "tkd.printing.v1.PrintService",
+		Creator:      creator,
+		InitialState: longrunningv1.OperationState_OperationState_PENDING,
+		Ttl:          durationpb.New(time.Second * 30),
+		GracePeriod:  durationpb.New(time.Second * 30),
+		Description:  description,
+		Kind:         "tkd.printing.v1/print-job",
+		Annotations:  annotations,
+	})
+
+	operationResponse, err := lrun.RegisterOperation(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Operation{
+		lrun:      lrun,
+		operation: operationResponse.Msg.Operation,
+		authToken: operationResponse.Msg.AuthToken,
+	}, nil
+}
+
+// ID returns the unique ID of the operation.
+func (op *Operation) ID() string {
+	return op.operation.UniqueId
+}
+
+// Proto returns the registered operation.
+func (op *Operation) Proto() *longrunningv1.Operation {
+	return op.operation
+}
+
+// isPermanentError returns true if err reports that a job does not exist.
+func isPermanentError(err error) bool {
+	var ippErr ipp.IPPError
+	if errors.As(err, &ippErr) {
+		return ippErr.Status == ipp.StatusErrorNotFound
+	}
+
+	return errors.Is(err, ErrJobNotFound)
+}
+
+// Job returns the printer and the ID of the job created by Submit. Jobs
+// that are resubmitted to another pool member are not reflected.
+func (op *Operation) Job() (string, int) {
+	return op.printer, op.jobID
+}
+
+// Annotate adds annotations to the operation. They are kept for all later
+// updates of the operation.
+func (op *Operation) Annotate(ctx context.Context, annotations map[string]string) error {
+	if op.annotations == nil {
+		op.annotations = make(map[string]string, len(annotations))
+	}
+
+	maps.Copy(op.annotations, annotations)
+
+	_, err := op.lrun.UpdateOperation(ctx, connect.NewRequest(&longrunningv1.UpdateOperationRequest{
+		UniqueId:    op.operation.UniqueId,
+		AuthToken:   op.authToken,
+		Annotations: op.annotations,
+	}))
+
+	return err
+}
+
+// OnUpdate registers fn to be called with the job every time its state is
+// polled, including the final state. It must be called before Submit.
+func (op *Operation) OnUpdate(fn func(cups.Job)) {
+	op.onUpdate = append(op.onUpdate, fn)
+}
+
+// OnComplete registers fn to be called with the job once it reached a
+// final state. It must be called before Submit.
+func (op *Operation) OnComplete(fn func(cups.Job)) {
+	op.onComplete = append(op.onComplete, fn)
+}
+
+// Fail completes the operation with an error.
+func (op *Operation) Fail(err error) {
+	if _, err := op.lrun.CompleteOperation(context.Background(), connect.NewRequest(&longrunningv1.CompleteOperationRequest{
+		UniqueId:  op.operation.UniqueId,
+		AuthToken: op.authToken,
+		Result: &longrunningv1.CompleteOperationRequest_Error{
+			Error: &longrunningv1.OperationError{
+				Message: err.Error(),
+			},
+		},
+	})); err != nil {
+		slog.Error("failed to complete operation", "error", err.Error())
+	}
+}
+
+// PrintWithOperation submits doc to printer using b and registers a
+// long-running operation that tracks the state of the print job.
+func PrintWithOperation(ctx context.Context, lrun longrunningv1connect.LongRunningServiceClient, b PrinterBackend, doc ipp.Document, printer string, creator string, annotations map[string]string, customAttrs map[string]any) (*longrunningv1.Operation, error) {
+	printer, err := ResolvePrinter(b, printer)
+	if err != nil {
+		return nil, err
+	}
+
+	op, err := StartOperation(ctx, lrun, doc.Name, creator, annotations)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := op.Submit(b, doc, printer, customAttrs); err != nil {
+		return nil, err
+	}
+
+	return op.Proto(), nil
+}
+
+// Submit sends doc to printer and tracks the state of the resulting job. If
+// the job cannot be submitted the operation is failed. If b is a
+// PrinterSelector and printer is a pool, the job is sent to the selected
+// member and resubmitted to another member if it is aborted.
+func (op *Operation) Submit(b PrinterBackend, doc ipp.Document, printer string, customAttrs map[string]any) error {
+	if customAttrs == nil {
+		customAttrs = make(map[string]any)
+	}
+
+	customAttrs[cups.AttributeLongRunningOperationID] = op.operation.UniqueId
+
+	selector, _ := b.(PrinterSelector)
+
+	var (
+		pooled  bool
+		content []byte
+		tried   []string
+	)
+
+	if selector != nil {
+		target, err := selector.SelectPrinter(printer, nil)
+		if err != nil {
+			op.Fail(err)
+
+			return err
+		}
+
+		pooled = target != printer
+	}
+
+	if pooled {
+		// the document must be sent again if the job is aborted
+		var err error
+		content, err = io.ReadAll(doc.Document)
+		if err != nil {
+			err = fmt.Errorf("failed to read document: %w", err)
+			op.Fail(err)
+
+			return err
+		}
+
+		if op.annotations == nil {
+			op.annotations = make(map[string]string)
+		}
+		op.annotations["pool"] = printer
+	}
+
+	// submit sends the document to printer or the next member of the pool
+	// that has not been tried yet.
+	submit := func() (string, int, error) {
+		if !pooled {
+			id, err := b.Print(doc, printer, customAttrs)
+
+			return printer, id, err
+		}
+
+		var lastErr error
+		for {
+			target, err := selector.SelectPrinter(printer, tried)
+			if err != nil {
+				if lastErr != nil {
+					return "", -1, fmt.Errorf("printer pool %q: %w", printer, lastErr)
+				}
+
+				return "", -1, err
+			}
+
+			tried = append(tried, target)
+			doc.Document = bytes.NewReader(content)
+
+			id, err := b.Print(doc, target, customAttrs)
+			if err == nil {
+				slog.Info("submitted job to pool member", "pool", printer, "printer", target, "job-id", id, "operation-id", op.operation.UniqueId)
+
+				return target, id, nil
+			}
+
+			slog.Warn("failed to submit job to pool member", "pool", printer, "printer", target, "operation-id", op.operation.UniqueId, "error", err)
+			lastErr = err
+		}
+	}
+
+	update := func(ctx context.Context, j cups.Job) {
+		annotations := map[string]string{
+			"state":      j.State.String(),
+			"percent":    fmt.Sprintf("%d%%", j.Progress),
+			"jobID":      strconv.Itoa(j.ID),
+			"printer":    j.PrinterName,
+			"printerUri": j.PrinterURI,
+		}
+		maps.Copy(annotations, op.annotations)
+
+		_, err := op.lrun.UpdateOperation(ctx, connect.NewRequest(&longrunningv1.UpdateOperationRequest{
+			UniqueId:    op.operation.UniqueId,
+			AuthToken:   op.authToken,
+			Running:     j.State == cups.JobStateProcessing,
+			Annotations: annotations,
+		}))
+		if err != nil {
+			slog.Error("failed to update job operation", "error", err.Error(), "job-id", j.ID, "operation-id", op.operation.UniqueId)
+		}
+	}
+
+	target, id, err := submit()
+	if err != nil {
+		op.Fail(err)
+
+		return err
+	}
+
+	op.printer, op.jobID = target, id
+
+	go func() {
+		// last is reported if the state of the job cannot be polled
+		// anymore.
+		last := cups.Job{
+			ID:          id,
+			PrinterName: target,
+			OperationID: op.operation.UniqueId,
+		}
+
+		var failures int
+
+		for {
+			<-time.After(pollInterval)
+
+			j, err := b.GetJob(target, id)
+			if err != nil {
+				failures++
+
+				if !isPermanentError(err) && failures < maxPollErrors {
+					slog.Warn("failed to get job, retrying", "printer", target, "job-id", id, "operation-id", op.operation.UniqueId, "attempt", failures, "error", err.Error())
+					continue
+				}
+
+				slog.Error("failed to get job, giving up", "printer", target, "job-id", id, "operation-id", op.operation.UniqueId, "error", err.Error())
+
+				// the final state of the job is unknown
+				last.State = cups.JobStateUnknown
+				for _, fn := range op.onComplete {
+					fn(last)
+				}
+
+				op.Fail(fmt.Errorf("failed to get the state of job %d on printer %q: %w", id, target, err))
+
+				return
+			}
+
+			failures = 0
+
+			if j.PrinterName == "" {
+				j.PrinterName = target
+			}
+
+			last = j
+
+			for _, fn := range op.onUpdate {
+				fn(j)
+			}
+
+			switch {
+			case j.State == cups.JobStatePending, j.State == cups.JobStateProcessing, j.State == cups.JobStateHeld:
+				update(context.Background(), j)
+				continue
+
+			case j.State == cups.JobStateAborted && pooled:
+				slog.Warn("job aborted on pool member, resubmitting", "pool", printer, "printer", target, "job-id", id, "operation-id", op.operation.UniqueId)
+
+				update(context.Background(), j)
+
+				next, nextID, err := submit()
+				if err != nil {
+					slog.Error("failed to resubmit aborted job", "pool", printer, "operation-id", op.operation.UniqueId, "error", err)
+
+					for _, fn := range op.onComplete {
+						fn(j)
+					}
+
+					op.Fail(err)
+
+					return
+				}
+
+				target, id = next, nextID
+				last = cups.Job{
+					ID:          id,
+					PrinterName: target,
+					OperationID: op.operation.UniqueId,
+				}
+
+				continue
+
+			default:
+				for _, fn := range op.onComplete {
+					fn(j)
+				}
+
+				// finally, makr the operation as done
+				result := &printingv1.PrintOperationState{
+					State: j.State.ToProto(),
+					Document: &printingv1.Document{
+						Name:        doc.Name,
+						ContentType: doc.MimeType,
+						Printer:     j.PrinterName,
+					},
+				}
+
+				resultPb, err := anypb.New(result)
+				if err != nil {
+					slog.Error("failed to perpare print result", "error", err)
+				}
+
+				if _, err := op.lrun.CompleteOperation(context.Background(), connect.NewRequest(&longrunningv1.CompleteOperationRequest{
+					UniqueId:  op.operation.UniqueId,
+					AuthToken: op.authToken,
+					Result: &longrunningv1.CompleteOperationRequest_Success{
+						Success: &longrunningv1.OperationSuccess{
+							Message: j.State.String(),
+							Result:  resultPb,
+						},
+					},
+				})); err != nil {
+					slog.Error("failed to complete operation", "error", err.Error())
+				}
+
+				return
+			}
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	ipp "github.com/phin1x/go-ipp"
+	longrunningv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/longrunning/v1"
+	"github.com/tierklinik-dobersberg/apis/gen/go/tkd/longrunning/v1/longrunningv1connect"
+	"github.com/tierklinik-dobersberg/print-service/internal/cups"
+)
+
+// fakeLongRunning records completed operations.
+type fakeLongRunning struct {
+	longrunningv1connect.LongRunningServiceClient
+
+	completed chan *longrunningv1.CompleteOperationRequest
+}
+
+func (f *fakeLongRunning) RegisterOperation(context.Context, *connect.Request[longrunningv1.RegisterOperationRequest]) (*connect.Response[longrunningv1.RegisterOperationResponse], error) {
+	return connect.NewResponse(&longrunningv1.RegisterOperationResponse{
+		Operation: &longrunningv1.Operation{UniqueId: "op"},
+	}), nil
+}
+
+func (f *fakeLongRunning) UpdateOperation(context.Context, *connect.Request[longrunningv1.UpdateOperationRequest]) (*connect.Response[longrunningv1.Operation], error) {
+	return connect.NewResponse(&longrunningv1.Operation{}), nil
+}
+
+func (f *fakeLongRunning) CompleteOperation(_ context.Context, req *connect.Request[longrunningv1.CompleteOperationRequest]) (*connect.Response[longrunningv1.Operation], error) {
+	f.completed <- req.Msg
+
+	return connect.NewResponse(&longrunningv1.Operation{}), nil
+}
+
+// fakeBackend returns the results of GetJob in order.
+type fakeBackend struct {
+	PrinterBackend
+
+	mu      sync.Mutex
+	results []func() (cups.Job, error)
+}
+
+func (b *fakeBackend) Print(ipp.Document, string, map[string]any) (int, error) {
+	return 1, nil
+}
+
+func (b *fakeBackend) GetJob(printer string, id int) (cups.Job, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	next := b.results[0]
+	if len(b.results) > 1 {
+		b.results = b.results[1:]
+	}
+
+	return next()
+}
+
+func TestOperationPolling(t *testing.T) {
+	pollInterval = time.Millisecond
+	defer func() { pollInterval = 15 * time.Second }()
+
+	transient := func() (cups.Job, error) { return cups.Job{}, errors.New("connection refused") }
+	notFound := func() (cups.Job, error) { return cups.Job{}, ErrJobNotFound }
+	complete := func() (cups.Job, error) { return cups.Job{ID: 1, State: cups.JobStateComplete}, nil }
+	pending := func() (cups.Job, error) { return cups.Job{ID: 1, State: cups.JobStatePending}, nil }
+
+	cases := []struct {
+		name    string
+		results []func() (cups.Job, error)
+		state   cups.JobState
+		failed  bool
+	}{
+		{"transient errors are retried", []func() (cups.Job, error){transient, pending, transient, complete}, cups.JobStateComplete, false},
+		{"unknown jobs fail the operation", []func() (cups.Job, error){pending, notFound}, cups.JobStateUnknown, true},
+		{"persistent errors fail the operation", []func() (cups.Job, error){transient}, cups.JobStateUnknown, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			lrun := &fakeLongRunning{completed: make(chan *longrunningv1.CompleteOperationRequest, 1)}
+
+			op, err := StartOperation(context.Background(), lrun, "doc", "user", nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			done := make(chan cups.Job, 1)
+			op.OnComplete(func(j cups.Job) { done <- j })
+
+			if err := op.Submit(&fakeBackend{results: c.results}, ipp.Document{}, "printer", nil); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			select {
+			case j := <-done:
+				if j.State != c.state {
+					t.Errorf("expected the job to complete in state %s, got %s", c.state, j.State)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("the operation has not been completed")
+			}
+
+			req := <-lrun.completed
+			if _, failed := req.Result.(*longrunningv1.CompleteOperationRequest_Error); failed != c.failed {
+				t.Errorf("expected failed=%t, got %T", c.failed, req.Result)
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package backend
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/tierklinik-dobersberg/print-service/internal/cups"
+)
+
+// PoolConfig defines a virtual printer that distributes jobs to its member
+// printers.
+type PoolConfig struct {
+	// Name is the name of the pool that is used instead of a printer name.
+	Name string `json:"name"`
+
+	// Description is reported as the description of the pool.
+	Description string `json:"description"`
+
+	// Location is reported as the location of the pool.
+	Location string `json:"location"`
+
+	// Members holds the names of the printers that receive jobs sent to
+	// the pool. If members have the same load, the first one is used.
+	Members []string `json:"members"`
+}
+
+// PrinterSelector is implemented by backends that serve virtual printers.
+type PrinterSelector interface {
+	// SelectPrinter returns the printer that should receive the next job
+	// sent to printer. Physical printers are returned as is while pools
+	// return the least-loaded member that is not in exclude.
+	SelectPrinter(printer string, exclude []string) (string, error)
+}
+
+// Compile time check
+var _ PrinterSelector = (*Registry)(nil)
+
+// AddPool adds a printer pool to the registry.
+func (r *Registry) AddPool(pool PoolConfig) error {
+	if pool.Name == "" {
+		return fmt.Errorf("printer pools must have a name")
+	}
+
+	if len(pool.Members) == 0 {
+		return fmt.Errorf("printer pool %q does not have any members", pool.Name)
+	}
+
+	if _, ok := r.pools[pool.Name]; ok {
+		return fmt.Errorf("duplicate printer pool %q", pool.Name)
+	}
+
+	for _, member := range pool.Members {
+		if _, ok := r.pools[member]; ok || member == pool.Name {
+			return fmt.Errorf("printer pool %q: member %q is a printer pool", pool.Name, member)
+		}
+	}
+
+	for _, other := range r.pools {
+		if slices.Contains(other.Members, pool.Name) {
+			return fmt.Errorf("printer pool %q: name is used as a member of pool %q", pool.Name, other.Name)
+		}
+	}
+
+	if r.pools == nil {
+		r.pools = make(map[string]PoolConfig)
+	}
+
+	r.pools[pool.Name] = pool
+	r.poolOrder = append(r.poolOrder, pool.Name)
+
+	return nil
+}
+
+// IsPool returns true if name is a printer pool.
+func (r *Registry) IsPool(name string) bool {
+	_, ok := r.pools[name]
+
+	return ok
+}
+
+// SelectPrinter implements PrinterSelector. Members are skipped if they are
+// not accepting jobs, are stopped or report an error state reason. Of the
+// remaining ones, the member with the fewest queued jobs is selected.
+func (r *Registry) SelectPrinter(printer string, exclude []string) (string, error) {
+	pool, ok := r.pools[printer]
+	if !ok {
+		return printer, nil
+	}
+
+	var (
+		selected string
+		best     load
+	)
+
+	for _, member := range r.memberStates(pool) {
+		if slices.Contains(exclude, member.Name) {
+			continue
+		}
+
+		l, usable := printerLoad(member)
+		if !usable {
+			slog.Debug("skipping unusable pool member", "pool", pool.Name, "printer", member.Name, "state", member.State.String(), "reasons", member.StateReasons)
+			continue
+		}
+
+		if selected == "" || l.less(best) {
+			selected, best = member.Name, l
+		}
+	}
+
+	if selected == "" {
+		return "", fmt.Errorf("printer pool %q: no member printer is accepting jobs", pool.Name)
+	}
+
+	return selected, nil
+}
+
+// memberStates returns the current state of all members of pool. Members
+// that cannot be queried are reported as stopped.
+func (r *Registry) memberStates(pool PoolConfig) []cups.Printer {
+	// query each backend only once
+	states := make(map[string]cups.Printer)
+	queried := make([]bool, len(r.backends))
+
+	for _, member := range pool.Members {
+		idx := slices.IndexFunc(r.backends, func(b PrinterBackend) bool {
+			ok, err := hasPrinter(b, member)
+			if err != nil {
+				slog.Error("failed to look up pool member", "pool", pool.Name, "printer", member, "error", err)
+			}
+
+			return ok
+		})
+		if idx < 0 {
+			slog.Warn("unknown member of printer pool", "pool", pool.Name, "printer", member)
+			continue
+		}
+
+		if queried[idx] {
+			continue
+		}
+		queried[idx] = true
+
+		b := r.backends[idx]
+
+		printers, err := b.ListPrinters()
+		if err != nil {
+			slog.Error("failed to get state of pool members", "pool", pool.Name, "backend", fmt.Sprintf("%T", b), "error", err)
+			continue
+		}
+
+		for _, p := range printers {
+			states[p.Name] = p
+		}
+	}
+
+	result := make([]cups.Printer, len(pool.Members))
+	for idx, member := range pool.Members {
+		p, ok := states[member]
+		if !ok {
+			p = cups.Printer{
+				Name:  member,
+				State: cups.PrinterStateStopped,
+			}
+		}
+
+		result[idx] = p
+	}
+
+	return result
+}
+
+// poolPrinter returns the virtual printer reported for pool. Its state is
+// derived from the states of the members.
+func (r *Registry) poolPrinter(pool PoolConfig, printers []cups.Printer) cups.Printer {
+	p := cups.Printer{
+		Name:     pool.Name,
+		Location: pool.Location,
+		Info:     pool.Description,
+		Model:    "Printer pool (" + strings.Join(pool.Members, ", ") + ")",
+		State:    cups.PrinterStateStopped,
+	}
+
+	for _, member := range printers {
+		if !slices.Contains(pool.Members, member.Name) {
+			continue
+		}
+
+		p.QueuedJobs += member.QueuedJobs
+
+		if _, usable := printerLoad(member); !usable {
+			continue
+		}
+
+		p.Accepting = true
+
+		switch {
+		case member.State == cups.PrinterStateIdle:
+			p.State = cups.PrinterStateIdle
+		case p.State != cups.PrinterStateIdle:
+			p.State = member.State
+		}
+	}
+
+	if !p.Accepting {
+		p.StateReason = "other-error"
+		p.StateReasons = []string{p.StateReason}
+		p.StateMessage = "no member printer is accepting jobs"
+	}
+
+	return p
+}
+
+// load describes how busy a printer is.
+type load struct {
+	jobs     int
+	warnings int
+}
+
+func (l load) less(other load) bool {
+	if l.jobs != other.jobs {
+		return l.jobs < other.jobs
+	}
+
+	return l.warnings < other.warnings
+}
+
+// printerLoad returns the load of p and whether p can receive jobs at all.
+func printerLoad(p cups.Printer) (load, bool) {
+	if !p.Accepting || p.State == cups.PrinterStateStopped || p.State == cups.PrinterStateUnknown {
+		return load{}, false
+	}
+
+	l := load{
+		jobs: p.QueuedJobs,
+	}
+
+	// queued-job-count includes the job being processed but not all
+	// backends report it.
+	if p.State == cups.PrinterStateProcessing && l.jobs == 0 {
+		l.jobs = 1
+	}
+
+	for _, reason := range p.StateReasons {
+		switch {
+		case reason == "none" || reason == "":
+		case reason == "offline-report":
+			return load{}, false
+		case strings.HasSuffix(reason, "-warning"):
+			l.warnings++
+		case strings.HasSuffix(reason, "-report"):
+		case strings.HasPrefix(reason, "cups-") && !strings.HasSuffix(reason, "-error"):
+			// informational CUPS keywords like cups-waiting-for-job-completed
+		default:
+			// reasons without a severity suffix are errors (RFC 8011,
+			// section 5.4.12)
+			return load{}, false
+		}
+	}
+
+	return l, true
+}
@@ -0,0 +1,233 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	ipp "github.com/phin1x/go-ipp"
+	longrunningv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/longrunning/v1"
+	"github.com/tierklinik-dobersberg/print-service/internal/cups"
+)
+
+// membersBackend serves printers with a fixed state. Jobs sent to printers
+// in abort are aborted, all other jobs complete.
+type membersBackend struct {
+	printers []cups.Printer
+	abort    []string
+
+	mu        sync.Mutex
+	submitted []string
+	documents []string
+}
+
+func (b *membersBackend) ListPrinters() ([]cups.Printer, error) {
+	return b.printers, nil
+}
+
+func (b *membersBackend) HasPrinter(name string) bool {
+	return slices.ContainsFunc(b.printers, func(p cups.Printer) bool {
+		return p.Name == name
+	})
+}
+
+func (b *membersBackend) DefaultPrinter() string { return "" }
+
+func (b *membersBackend) ListJobs(string) ([]cups.Job, error) { return nil, nil }
+
+func (b *membersBackend) GetJob(printer string, id int) (cups.Job, error) {
+	state := cups.JobStateComplete
+	if slices.Contains(b.abort, printer) {
+		state = cups.JobStateAborted
+	}
+
+	return cups.Job{ID: id, PrinterName: printer, State: state}, nil
+}
+
+func (b *membersBackend) Print(doc ipp.Document, printer string, _ map[string]any) (int, error) {
+	content, err := io.ReadAll(doc.Document)
+	if err != nil {
+		return -1, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.submitted = append(b.submitted, printer)
+	b.documents = append(b.documents, string(content))
+
+	return len(b.submitted), nil
+}
+
+func newPoolRegistry(t *testing.T, members ...cups.Printer) (*Registry, *membersBackend) {
+	t.Helper()
+
+	b := &membersBackend{printers: members}
+	r := NewRegistry(b)
+
+	var names []string
+	for _, m := range members {
+		names = append(names, m.Name)
+	}
+
+	if err := r.AddPool(PoolConfig{Name: "office", Members: names}); err != nil {
+		t.Fatal(err)
+	}
+
+	return r, b
+}
+
+func TestSelectPrinter(t *testing.T) {
+	idle := func(name string, jobs int, reasons ...string) cups.Printer {
+		return cups.Printer{Name: name, State: cups.PrinterStateIdle, Accepting: true, QueuedJobs: jobs, StateReasons: reasons}
+	}
+
+	stopped := idle("stopped", 0)
+	stopped.State = cups.PrinterStateStopped
+
+	rejecting := idle("rejecting", 0)
+	rejecting.Accepting = false
+
+	processing := idle("processing", 0)
+	processing.State = cups.PrinterStateProcessing
+
+	cases := []struct {
+		name     string
+		members  []cups.Printer
+		exclude  []string
+		expected string
+	}{
+		{"least loaded", []cups.Printer{idle("a", 3), idle("b", 1), idle("c", 2)}, nil, "b"},
+		{"first on equal load", []cups.Printer{idle("a", 1), idle("b", 1)}, nil, "a"},
+		{"fewer warnings", []cups.Printer{idle("a", 0, "toner-low-warning"), idle("b", 0, "none")}, nil, "b"},
+		{"processing counts as a job", []cups.Printer{processing, idle("b", 0)}, nil, "b"},
+		{"skips stopped", []cups.Printer{stopped, idle("b", 5)}, nil, "b"},
+		{"skips not accepting", []cups.Printer{rejecting, idle("b", 5)}, nil, "b"},
+		{"skips errors", []cups.Printer{idle("a", 0, "media-empty-error"), idle("b", 5)}, nil, "b"},
+		{"skips offline", []cups.Printer{idle("a", 0, "offline-report"), idle("b", 5)}, nil, "b"},
+		{"excluded", []cups.Printer{idle("a", 0), idle("b", 5)}, []string{"a"}, "b"},
+		{"none usable", []cups.Printer{stopped, rejecting}, nil, ""},
+		{"all excluded", []cups.Printer{idle("a", 0), idle("b", 0)}, []string{"a", "b"}, ""},
+	}
+
+	for _, c := range cases {
+		r, _ := newPoolRegistry(t, c.members...)
+
+		selected, err := r.SelectPrinter("office", c.exclude)
+
+		switch {
+		case c.expected == "" && err == nil:
+			t.Errorf("%s: expected an error, got %q", c.name, selected)
+		case c.expected != "" && err != nil:
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+		case selected != c.expected:
+			t.Errorf("%s: expected %q, got %q", c.name, c.expected, selected)
+		}
+	}
+
+	// physical printers are returned as is
+	r, _ := newPoolRegistry(t, idle("a", 0))
+	if selected, err := r.SelectPrinter("a", []string{"a"}); err != nil || selected != "a" {
+		t.Errorf("expected printers to be returned as is, got %q, %v", selected, err)
+	}
+}
+
+func TestPoolPrinter(t *testing.T) {
+	r, _ := newPoolRegistry(t,
+		cups.Printer{Name: "a", State: cups.PrinterStateStopped, Accepting: true, QueuedJobs: 2},
+		cups.Printer{Name: "b", State: cups.PrinterStateProcessing, Accepting: true, QueuedJobs: 1},
+	)
+
+	printers, err := r.ListPrinters()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := printers[len(printers)-1]
+	if pool.Name != "office" || !pool.Accepting || pool.State != cups.PrinterStateProcessing || pool.QueuedJobs != 3 {
+		t.Errorf("expected a processing pool with 3 jobs, got %+v", pool)
+	}
+
+	r, _ = newPoolRegistry(t, cups.Printer{Name: "a", State: cups.PrinterStateIdle})
+
+	printers, err = r.ListPrinters()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pool := printers[len(printers)-1]; pool.Accepting || pool.State != cups.PrinterStateStopped {
+		t.Errorf("expected a stopped pool without usable members, got %+v", pool)
+	}
+}
+
+func TestSubmitResubmitsAbortedJobs(t *testing.T) {
+	pollInterval = time.Millisecond
+	defer func() { pollInterval = 15 * time.Second }()
+
+	cases := []struct {
+		name      string
+		abort     []string
+		submitted []string
+		state     cups.JobState
+		failed    bool
+	}{
+		{"resubmitted to the next member", []string{"a"}, []string{"a", "b"}, cups.JobStateComplete, false},
+		{"all members aborted", []string{"a", "b"}, []string{"a", "b"}, cups.JobStateAborted, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r, b := newPoolRegistry(t,
+				cups.Printer{Name: "a", State: cups.PrinterStateIdle, Accepting: true},
+				cups.Printer{Name: "b", State: cups.PrinterStateIdle, Accepting: true, QueuedJobs: 1},
+			)
+			b.abort = c.abort
+
+			lrun := &fakeLongRunning{completed: make(chan *longrunningv1.CompleteOperationRequest, 1)}
+
+			op, err := StartOperation(context.Background(), lrun, "doc", "user", nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			done := make(chan cups.Job, 1)
+			op.OnComplete(func(j cups.Job) { done <- j })
+
+			doc := ipp.Document{Document: bytes.NewReader([]byte("content")), Name: "doc"}
+			if err := op.Submit(r, doc, "office", nil); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			select {
+			case j := <-done:
+				if j.State != c.state {
+					t.Errorf("expected the job to complete in state %s, got %s", c.state, j.State)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("the operation has not been completed")
+			}
+
+			req := <-lrun.completed
+			if _, failed := req.Result.(*longrunningv1.CompleteOperationRequest_Error); failed != c.failed {
+				t.Errorf("expected failed=%t, got %T", c.failed, req.Result)
+			}
+
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			if !slices.Equal(b.submitted, c.submitted) {
+				t.Errorf("expected the job to be sent to %v, got %v", c.submitted, b.submitted)
+			}
+
+			for idx, content := range b.documents {
+				if content != "content" {
+					t.Errorf("expected submission #%d to contain the whole document, got %q", idx+1, content)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package backend
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/phin1x/go-ipp"
+	"github.com/tierklinik-dobersberg/print-service/internal/cups"
+)
+
+// Registry dispatches requests to the backend that serves a printer. Backends
+// are queried in the order they have been registered. Printer pools added
+// using AddPool are served by the registry itself.
+type Registry struct {
+	backends []PrinterBackend
+
+	pools     map[string]PoolConfig
+	poolOrder []string
+}
+
+// NewRegistry returns a new registry for backends.
+func NewRegistry(backends ...PrinterBackend) *Registry {
+	return &Registry{
+		backends: backends,
+	}
+}
+
+// Lookup returns the backend that serves printer. If no backend serves
+// printer, an error wrapping ErrUnknownPrinter is returned unless a backend
+// could not be queried.
+func (r *Registry) Lookup(printer string) (PrinterBackend, error) {
+	var lookupErr error
+
+	for _, b := range r.backends {
+		ok, err := hasPrinter(b, printer)
+		if err != nil {
+			slog.Error("failed to look up printer", "backend", fmt.Sprintf("%T", b), "printer", printer, "error", err)
+			lookupErr = err
+
+			continue
+		}
+
+		if ok {
+			return b, nil
+		}
+	}
+
+	if lookupErr != nil {
+		return nil, fmt.Errorf("failed to look up printer %q: %w", printer, lookupErr)
+	}
+
+	return nil, fmt.Errorf("%w %q", ErrUnknownPrinter, printer)
+}
+
+func (r *Registry) ListPrinters() ([]cups.Printer, error) {
+	var result []cups.Printer
+
+	for _, b := range r.backends {
+		printers, err := b.ListPrinters()
+		if err != nil {
+			slog.Error("failed to list printers of backend", "backend", fmt.Sprintf("%T", b), "error", err)
+			continue
+		}
+
+		result = append(result, printers...)
+	}
+
+	for _, name := range r.poolOrder {
+		result = append(result, r.poolPrinter(r.pools[name], result))
+	}
+
+	return result, nil
+}
+
+func (r *Registry) HasPrinter(name string) bool {
+	return r.CheckPrinter(name) == nil
+}
+
+// CheckPrinter returns nil if name is a printer or pool. Like Lookup, it
+// returns an error wrapping ErrUnknownPrinter only if all backends could be
+// queried.
+func (r *Registry) CheckPrinter(name string) error {
+	if r.IsPool(name) {
+		return nil
+	}
+
+	_, err := r.Lookup(name)
+
+	return err
+}
+
+func (r *Registry) DefaultPrinter() string {
+	for _, b := range r.backends {
+		if name := b.DefaultPrinter(); name != "" {
+			return name
+		}
+	}
+
+	return ""
+}
+
+func (r *Registry) ListJobs(printer string) ([]cups.Job, error) {
+	if pool, ok := r.pools[printer]; ok {
+		var result []cups.Job
+
+		for _, member := range pool.Members {
+			jobs, err := r.ListJobs(member)
+			if err != nil {
+				slog.Error("failed to list jobs of pool member", "pool", pool.Name, "printer", member, "error", err)
+				continue
+			}
+
+			result = append(result, jobs...)
+		}
+
+		return result, nil
+	}
+
+	b, err := r.Lookup(printer)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.ListJobs(printer)
+}
+
+func (r *Registry) GetJob(printer string, id int) (cups.Job, error) {
+	if r.IsPool(printer) {
+		return cups.Job{}, fmt.Errorf("jobs of printer pool %q must be queried using the member printer", printer)
+	}
+
+	b, err := r.Lookup(printer)
+	if err != nil {
+		return cups.Job{}, err
+	}
+
+	return b.GetJob(printer, id)
+}
+
+// Print submits doc to printer. Jobs for printer pools are sent to the
+// member returned by SelectPrinter.
+func (r *Registry) Print(doc ipp.Document, printer string, attrs map[string]any) (int, error) {
+	if printer == "" {
+		printer = r.DefaultPrinter()
+		if printer == "" {
+			return -1, fmt.Errorf("no printer specified and no default printer available")
+		}
+	}
+
+	printer, err := r.SelectPrinter(printer, nil)
+	if err != nil {
+		return -1, err
+	}
+
+	b, err := r.Lookup(printer)
+	if err != nil {
+		return -1, err
+	}
+
+	return b.Print(doc, printer, attrs)
+}
+
+// ValidateJob validates a job using the backend of printer. It returns
+// ErrValidationNotSupported if the backend does not implement Validator.
+// Jobs for printer pools are validated using the member that would receive
+// the job.
+func (r *Registry) ValidateJob(printer string, mimeType string, attrs map[string]any) error {
+	printer, err := r.SelectPrinter(printer, nil)
+	if err != nil {
+		return err
+	}
+
+	b, err := r.Lookup(printer)
+	if err != nil {
+		return err
+	}
+
+	v, ok := b.(Validator)
+	if !ok {
+		return ErrValidationNotSupported
+	}
+
+	return v.ValidateJob(printer, mimeType, attrs)
+}
@@ -0,0 +1,53 @@
+package backend
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/tierklinik-dobersberg/print-service/internal/cups"
+)
+
+// unreachableBackend cannot be asked for its printers.
+type unreachableBackend struct {
+	membersBackend
+}
+
+func (b *unreachableBackend) LookupPrinter(string) (bool, error) {
+	return false, errors.New("connection refused")
+}
+
+func TestLookup(t *testing.T) {
+	reachable := &membersBackend{printers: []cups.Printer{{Name: "office"}}}
+
+	cases := []struct {
+		name     string
+		backends []PrinterBackend
+		printer  string
+		found    bool
+		unknown  bool
+	}{
+		{"found", []PrinterBackend{reachable}, "office", true, false},
+		{"unknown", []PrinterBackend{reachable}, "lab", false, true},
+		{"found after unreachable backend", []PrinterBackend{&unreachableBackend{}, reachable}, "office", true, false},
+		{"unreachable backend", []PrinterBackend{reachable, &unreachableBackend{}}, "lab", false, false},
+	}
+
+	for _, c := range cases {
+		r := NewRegistry(c.backends...)
+
+		b, err := r.Lookup(c.printer)
+
+		switch {
+		case c.found && (err != nil || b != PrinterBackend(reachable)):
+			t.Errorf("%s: expected the printer to be found, got %v", c.name, err)
+		case !c.found && err == nil:
+			t.Errorf("%s: expected an error", c.name)
+		case !c.found && errors.Is(err, ErrUnknownPrinter) != c.unknown:
+			t.Errorf("%s: expected unknown=%t, got %v", c.name, c.unknown, err)
+		}
+
+		if err := r.CheckPrinter(c.printer); (err == nil) != c.found {
+			t.Errorf("%s: expected CheckPrinter to return the lookup result, got %v", c.name, err)
+		}
+	}
+}
@@ -2,26 +2,286 @@ package config
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/fs"
+	"log/slog"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/dcaraxes/gotenberg-go-client/v8"
+	"github.com/ghodss/yaml"
 	"github.com/sethvargo/go-envconfig"
 	"github.com/tierklinik-dobersberg/apis/gen/go/tkd/events/v1/eventsv1connect"
 	"github.com/tierklinik-dobersberg/apis/gen/go/tkd/longrunning/v1/longrunningv1connect"
+	"github.com/tierklinik-dobersberg/apis/pkg/auth"
 	"github.com/tierklinik-dobersberg/apis/pkg/discovery"
 	"github.com/tierklinik-dobersberg/apis/pkg/discovery/wellknown"
+	"github.com/tierklinik-dobersberg/print-service/internal/accounting"
+	"github.com/tierklinik-dobersberg/print-service/internal/acl"
+	"github.com/tierklinik-dobersberg/print-service/internal/archive"
+	"github.com/tierklinik-dobersberg/print-service/internal/audit"
+	"github.com/tierklinik-dobersberg/print-service/internal/backend"
 	"github.com/tierklinik-dobersberg/print-service/internal/cups"
+	"github.com/tierklinik-dobersberg/print-service/internal/history"
+	"github.com/tierklinik-dobersberg/print-service/internal/ippdirect"
+	"github.com/tierklinik-dobersberg/print-service/internal/labels"
+	"github.com/tierklinik-dobersberg/print-service/internal/pdf"
+	"github.com/tierklinik-dobersberg/print-service/internal/policy"
+	"github.com/tierklinik-dobersberg/print-service/internal/preferences"
+	"github.com/tierklinik-dobersberg/print-service/internal/preview"
+	"github.com/tierklinik-dobersberg/print-service/internal/rawsocket"
+	"github.com/tierklinik-dobersberg/print-service/internal/routing"
+	"github.com/tierklinik-dobersberg/print-service/internal/templates"
 )
 
+// HotFolder configures a directory that is watched for new files which are
+// then printed automatically.
+type HotFolder struct {
+	// Path is the directory to watch.
+	Path string `json:"path"`
+
+	// Printer is the target printer. If empty, the default printer is used.
+	Printer string `json:"printer"`
+
+	// User is the username that is used as the requesting user for all jobs
+	// printed from this folder.
+	User string `json:"user"`
+
+	// Roles holds the role IDs or names of User. They are used for printer
+	// ACLs, routing rules and print policies that match roles.
+	Roles []string `json:"roles"`
+
+	// Options holds additional print options using the same keys as the
+	// HTTP print endpoint (copies, duplex, orientation).
+	Options map[string]string `json:"options"`
+
+	// StableFor is the duration a file must not change before it is
+	// printed.
+	StableFor Duration `json:"stableFor"`
+
+	// PollInterval defines how often the directory is scanned for new files.
+	PollInterval Duration `json:"pollInterval"`
+}
+
+// Duration is a time.Duration that is decoded from a duration string like
+// "10s" in configuration files.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(blob []byte) error {
+	var s string
+	if err := json.Unmarshal(blob, &s); err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+
+	return nil
+}
+
+// IPPServer configures the built-in IPP endpoint.
+type IPPServer struct {
+	// Enabled enables the IPP endpoint at /ipp/print/<queue>.
+	Enabled bool `json:"enabled"`
+
+	// Name is reported as the printer-info of all queues that do not
+	// specify their own description.
+	Name string `json:"name"`
+
+	// AllowAnonymous permits IPP clients that are not authenticated by the
+	// forward-authentication proxy. Their jobs are printed as the user
+	// "anonymous".
+	AllowAnonymous bool `json:"allowAnonymous"`
+
+	// TrustRequestingUserName uses the requesting-user-name attribute sent
+	// by anonymous clients as the username. The attribute is not verified
+	// so it should only be enabled if all clients are trusted.
+	TrustRequestingUserName bool `json:"trustRequestingUserName"`
+
+	// Queues holds the queues exposed via IPP. If empty, each printer is
+	// exposed using its own name.
+	Queues []IPPQueue `json:"queues"`
+}
+
+// IPPQueue defines a queue of the built-in IPP endpoint.
+type IPPQueue struct {
+	// Name is the name of the queue as used in /ipp/print/<name>.
+	Name string `json:"name"`
+
+	// Printer is the target printer of the queue. If empty, the default
+	// printer is used.
+	Printer string `json:"printer"`
+
+	// Description is reported as printer-info.
+	Description string `json:"description"`
+
+	// Options holds additional print options using the same keys as the
+	// HTTP print endpoint.
+	Options map[string]string `json:"options"`
+}
+
+// FileConfig holds configuration that is too complex for environment
+// variables and is loaded from the file specified in CONFIG_FILE.
+type FileConfig struct {
+	HotFolders  []HotFolder               `json:"hotFolders"`
+	IPPServer   IPPServer                 `json:"ippServer"`
+	IPPPrinters []ippdirect.PrinterConfig `json:"ippPrinters"`
+	RawPrinters []rawsocket.PrinterConfig `json:"rawPrinters"`
+	Labels      labels.Config             `json:"labels"`
+	Stamps      Stamps                    `json:"stamps"`
+	Overlays    Overlays                  `json:"overlays"`
+	Pools       []backend.PoolConfig      `json:"pools"`
+	Routing     routing.Config            `json:"routing"`
+	ACL         acl.Config                `json:"acl"`
+	Policies    policy.Config             `json:"policies"`
+	Accounting  accounting.Config         `json:"accounting"`
+}
+
+// Stamps configures watermarks and footers that are added to printed PDF
+// documents.
+type Stamps struct {
+	// Profiles holds named stamps that can be requested using the stamp
+	// print option or assigned to printers.
+	Profiles map[string]pdf.Stamp `json:"profiles"`
+
+	// Printers maps a printer name to the stamp profiles that are applied
+	// to all documents printed on that printer.
+	Printers map[string][]string `json:"printers"`
+}
+
+func (s Stamps) validate() error {
+	for name, stamp := range s.Profiles {
+		if err := stamp.Validate(); err != nil {
+			return fmt.Errorf("stamp profile %q: %w", name, err)
+		}
+	}
+
+	for printer, profiles := range s.Printers {
+		for _, name := range profiles {
+			if _, ok := s.Profiles[name]; !ok {
+				return fmt.Errorf("printer %q: unknown stamp profile %q", printer, name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Overlays configures letterheads that are merged underneath printed PDF
+// documents.
+type Overlays struct {
+	// Profiles holds named letterheads that can be requested using the
+	// overlay print option or assigned to printers.
+	Profiles map[string]pdf.Overlay `json:"profiles"`
+
+	// Printers maps a printer name to the letterhead that is applied to
+	// all documents printed on that printer.
+	Printers map[string]string `json:"printers"`
+}
+
+func (o Overlays) validate() error {
+	for name, overlay := range o.Profiles {
+		if err := overlay.Validate(); err != nil {
+			return fmt.Errorf("overlay profile %q: %w", name, err)
+		}
+	}
+
+	for printer, name := range o.Printers {
+		if _, ok := o.Profiles[name]; !ok {
+			return fmt.Errorf("printer %q: unknown overlay profile %q", printer, name)
+		}
+	}
+
+	return nil
+}
+
 type Config struct {
+	FileConfig
+
+	ConfigFile     string   `env:"CONFIG_FILE"`
 	AllowedOrigins []string `env:"ALLOWED_ORIGINS,default=*"`
 	ListenAddress  string   `env:"LISTEN,default=:8081"`
 	StoragePath    string   `env:"STORAGE_PATH"`
 	Gotenberg      string   `env:"GOTENBERG"`
-	CUPSServer     struct {
+
+	// MaxDocumentSize is the maximum size of a document in bytes. It is
+	// enforced for uploads, streams and converted documents. Zero disables
+	// the limit.
+	MaxDocumentSize int64 `env:"MAX_DOCUMENT_SIZE,default=104857600"`
+
+	// PreviewRasterizer selects the tool used to render page thumbnails.
+	// Supported values are pdftoppm, mutool and ghostscript. If empty, the
+	// built-in rasterizer is used which only renders the first page.
+	PreviewRasterizer string `env:"PREVIEW_RASTERIZER"`
+
+	// PreferencesFile stores default printers and options per user, role
+	// and workstation. If empty, preferences are lost on restart.
+	PreferencesFile string `env:"PREFERENCES_FILE"`
+
+	// AccountingFile stores the usage records of all print jobs. If empty,
+	// usage is lost on restart.
+	AccountingFile string `env:"ACCOUNTING_FILE"`
+
+	// HistoryDatabase is the path of the database that stores the history
+	// of all print jobs. If empty, the job history is disabled.
+	HistoryDatabase string `env:"HISTORY_DATABASE"`
+
+	// ReprintArchivePath is the directory that keeps encrypted copies of
+	// printed documents for reprints. It requires the job history and a
+	// hex or base64 encoded 256 bit ReprintArchiveKey. If empty, documents
+	// can only be reprinted if CUPS preserves the job files. Documents older
+	// than ReprintRetention are removed every ReprintPurgeInterval.
+	ReprintArchivePath   string        `env:"REPRINT_ARCHIVE_PATH"`
+	ReprintArchiveKey    string        `env:"REPRINT_ARCHIVE_KEY"`
+	ReprintRetention     time.Duration `env:"REPRINT_RETENTION,default=168h"`
+	ReprintPurgeInterval time.Duration `env:"REPRINT_PURGE_INTERVAL,default=1h"`
+
+	// AuditLogFile is the append-only file that holds the hash chained
+	// audit trail. Use "printctl audit verify" to check it. If empty, audit
+	// events are only logged.
+	AuditLogFile string `env:"AUDIT_LOG_FILE"`
+
+	// AuditKey is the hex or base64 encoded secret of at least 256 bits
+	// used to hash audit events. It is required if audit events are
+	// persisted or published and must be kept apart from the audit log so
+	// the chain cannot be recomputed after modifying events.
+	AuditKey string `env:"AUDIT_KEY"`
+
+	// AuditPublishEvents publishes audit events to the EventService.
+	// AuditEventStateFile keeps the last recorded audit event and events
+	// that have not been published yet so the chain and publishing continue
+	// after a restart.
+	AuditPublishEvents  bool   `env:"AUDIT_PUBLISH_EVENTS"`
+	AuditEventStateFile string `env:"AUDIT_EVENT_STATE_FILE"`
+
+	// PrivacyMode selects how document names are written to logs. Supported
+	// values are off, redact and pseudonymize. PrivacyKey is the secret used
+	// to derive pseudonyms. If empty, pseudonyms change on every restart.
+	PrivacyMode string `env:"PRIVACY_MODE,default=redact"`
+	PrivacyKey  string `env:"PRIVACY_KEY"`
+
+	// OpaqueJobNames sends the operation ID instead of the document name
+	// as job-name to printers. The real name is kept in the job history.
+	OpaqueJobNames bool `env:"OPAQUE_JOB_NAMES"`
+
+	// AdminRoles holds role IDs or names of administrators. They may
+	// manage preferences of other users, roles and workstations and access
+	// the usage and job history of all users. Role names are only matched
+	// if the RoleService is available.
+	AdminRoles []string `env:"ADMIN_ROLES"`
+
+	// TemplatesPath is the directory that holds HTML document templates.
+	// Each sub-directory is a template.
+	TemplatesPath           string        `env:"TEMPLATES_PATH"`
+	TemplatesReloadInterval time.Duration `env:"TEMPLATES_RELOAD_INTERVAL,default=10s"`
+	CUPSServer              struct {
+		Disabled bool   `json:"disabled" env:"CUPS_DISABLED"`
 		Address  string `json:"address" env:"CUPS_ADDRESS,default=localhost:631"`
 		Username string `json:"username" env:"CUPS_USER"`
 		Password string `json:"password" env:"CUPS_PASSWORD"`
@@ -35,12 +295,32 @@ func LoadConfig(ctx context.Context) (*Config, error) {
 		return nil, fmt.Errorf("invalid config: %w", err)
 	}
 
+	if cfg.ConfigFile != "" {
+		content, err := os.ReadFile(cfg.ConfigFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+
+		if err := yaml.Unmarshal(content, &cfg.FileConfig); err != nil {
+			return nil, fmt.Errorf("invalid config file %q: %w", cfg.ConfigFile, err)
+		}
+	}
+
+	if err := cfg.Stamps.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	if err := cfg.Overlays.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
 	return &cfg, nil
 }
 
 func (cfg *Config) ConfigureProviders(ctx context.Context, catalog discovery.Discoverer) (*Providers, error) {
 	var events eventsv1connect.EventServiceClient
 	var lrun longrunningv1connect.LongRunningServiceClient
+	var roles auth.RoleResolverFunc
 	if catalog != nil {
 		var err error
 
@@ -53,11 +333,47 @@ func (cfg *Config) ConfigureProviders(ctx context.Context, catalog discovery.Dis
 		if err != nil {
 			return nil, fmt.Errorf("tkd.longrunning.v1.LongRunningService: %w", err)
 		}
+
+		if roleCli, err := wellknown.RoleService.Create(ctx, catalog); err == nil {
+			roles = cacheRoles(auth.NewIDMRoleResolver(roleCli))
+		}
 	}
 
-	cli, err := cups.NewClient(cfg.CUPSServer.Address, cfg.CUPSServer.Username, cfg.CUPSServer.Password)
-	if err != nil {
-		return nil, fmt.Errorf("failed to configure CUPS client: %w", err)
+	if roles == nil {
+		slog.Warn("tkd.idm.v1.RoleService not available, only role IDs are matched")
+	}
+
+	var backends []backend.PrinterBackend
+
+	if len(cfg.IPPPrinters) > 0 {
+		ippCli, err := ippdirect.NewClient(cfg.IPPPrinters)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure IPP printers: %w", err)
+		}
+
+		backends = append(backends, ippCli)
+	}
+
+	if len(cfg.RawPrinters) > 0 {
+		rawCli, err := rawsocket.NewClient(cfg.RawPrinters)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure raw printers: %w", err)
+		}
+
+		backends = append(backends, rawCli)
+	}
+
+	var cli *cups.Client
+	if !cfg.CUPSServer.Disabled {
+		var err error
+
+		cli, err = cups.NewClient(cfg.CUPSServer.Address, cfg.CUPSServer.Username, cfg.CUPSServer.Password)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure CUPS client: %w", err)
+		}
+
+		// CUPS must be the last backend since it may serve any printer
+		backends = append(backends, cli)
 	}
 
 	var storage fs.FS
@@ -70,21 +386,167 @@ func (cfg *Config) ConfigureProviders(ctx context.Context, catalog discovery.Dis
 		storage = root.FS()
 	}
 
+	labelRegistry, err := labels.NewRegistry(cfg.Labels)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure label templates: %w", err)
+	}
+
+	var templateRegistry *templates.Registry
+	if cfg.TemplatesPath != "" {
+		templateRegistry, err = templates.NewRegistry(cfg.TemplatesPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load document templates: %w", err)
+		}
+	}
+
 	var gotenbergClient *gotenberg.Client
 	if cfg.Gotenberg != "" {
+		var err error
 		gotenbergClient, err = gotenberg.NewClient(cfg.Gotenberg, http.DefaultClient)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create gotenberg client: %w", err)
 		}
 	}
 
+	printers := backend.NewRegistry(backends...)
+	for _, pool := range cfg.Pools {
+		if err := printers.AddPool(pool); err != nil {
+			return nil, fmt.Errorf("failed to configure printer pools: %w", err)
+		}
+	}
+
+	router, err := routing.New(cfg.Routing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure routing rules: %w", err)
+	}
+
+	printerACL, err := acl.New(cfg.ACL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure printer ACL: %w", err)
+	}
+
+	policies, err := policy.New(cfg.Policies)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure print policies: %w", err)
+	}
+
+	if cfg.AccountingFile == "" {
+		slog.Warn("no accounting file configured, print usage is not persisted")
+	}
+
+	ledger, err := accounting.Open(cfg.Accounting, cfg.AccountingFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure accounting: %w", err)
+	}
+
+	var jobHistory *history.Store
+	if cfg.HistoryDatabase != "" {
+		jobHistory, err = history.Open(cfg.HistoryDatabase)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		slog.Warn("no history database configured, the job history is disabled")
+	}
+
+	var documentArchive *archive.Archive
+	if cfg.ReprintArchivePath != "" {
+		if jobHistory == nil {
+			return nil, fmt.Errorf("the reprint archive requires a history database")
+		}
+
+		if cfg.ReprintPurgeInterval <= 0 {
+			return nil, fmt.Errorf("the reprint purge interval must be positive")
+		}
+
+		key, err := archive.ParseKey(cfg.ReprintArchiveKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid reprint archive key: %w", err)
+		}
+
+		documentArchive, err = archive.New(cfg.ReprintArchivePath, key, cfg.ReprintRetention)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure reprint archive: %w", err)
+		}
+	}
+
+	var auditKey []byte
+	if cfg.AuditLogFile != "" || cfg.AuditPublishEvents {
+		auditKey, err = audit.ParseKey(cfg.AuditKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid audit key: %w", err)
+		}
+	}
+
+	var auditSinks []audit.Sink
+	if cfg.AuditLogFile != "" {
+		sink, err := audit.OpenFile(cfg.AuditLogFile)
+		if err != nil {
+			return nil, err
+		}
+
+		auditSinks = append(auditSinks, sink)
+	} else {
+		slog.Warn("no audit log file configured, audit events are not persisted")
+	}
+
+	if cfg.AuditPublishEvents {
+		if events == nil {
+			return nil, fmt.Errorf("publishing audit events requires the EventService")
+		}
+
+		if cfg.AuditEventStateFile == "" {
+			slog.Warn("no audit event state file configured, unpublished audit events are lost on restart")
+		}
+
+		sink, err := audit.NewEventSink(ctx, events, cfg.AuditEventStateFile)
+		if err != nil {
+			return nil, err
+		}
+
+		auditSinks = append(auditSinks, sink)
+	}
+
+	if cfg.PreferencesFile == "" {
+		slog.Warn("no preferences file configured, print preferences are not persisted")
+	}
+
+	prefs, err := preferences.Open(cfg.PreferencesFile)
+	if err != nil {
+		return nil, err
+	}
+
+	rasterizer, err := preview.New(cfg.PreviewRasterizer, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure preview rasterizer: %w", err)
+	}
+
+	if cfg.PreviewRasterizer != "" {
+		// the built-in rasterizer still renders the first page if the tool
+		// is not installed or fails.
+		rasterizer = preview.WithFallback(rasterizer, preview.Builtin{})
+	}
+
 	return &Providers{
 		Config:       cfg,
 		Catalog:      catalog,
 		CUPS:         cli,
+		Printers:     printers,
 		EventService: events,
 		LongRunning:  lrun,
+		Roles:        roles,
 		Storage:      storage,
 		Gotenberg:    gotenbergClient,
+		Labels:       labelRegistry,
+		Templates:    templateRegistry,
+		Preview:      rasterizer,
+		Routing:      router,
+		Preferences:  prefs,
+		ACL:          printerACL,
+		Policies:     policies,
+		Accounting:   ledger,
+		History:      jobHistory,
+		Archive:      documentArchive,
+		Audit:        audit.New(auditKey, auditSinks...),
 	}, nil
 }
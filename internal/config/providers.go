@@ -6,8 +6,21 @@ import (
 	"github.com/dcaraxes/gotenberg-go-client/v8"
 	"github.com/tierklinik-dobersberg/apis/gen/go/tkd/events/v1/eventsv1connect"
 	"github.com/tierklinik-dobersberg/apis/gen/go/tkd/longrunning/v1/longrunningv1connect"
+	"github.com/tierklinik-dobersberg/apis/pkg/auth"
 	"github.com/tierklinik-dobersberg/apis/pkg/discovery"
+	"github.com/tierklinik-dobersberg/print-service/internal/accounting"
+	"github.com/tierklinik-dobersberg/print-service/internal/acl"
+	"github.com/tierklinik-dobersberg/print-service/internal/archive"
+	"github.com/tierklinik-dobersberg/print-service/internal/audit"
+	"github.com/tierklinik-dobersberg/print-service/internal/backend"
 	"github.com/tierklinik-dobersberg/print-service/internal/cups"
+	"github.com/tierklinik-dobersberg/print-service/internal/history"
+	"github.com/tierklinik-dobersberg/print-service/internal/labels"
+	"github.com/tierklinik-dobersberg/print-service/internal/policy"
+	"github.com/tierklinik-dobersberg/print-service/internal/preferences"
+	"github.com/tierklinik-dobersberg/print-service/internal/preview"
+	"github.com/tierklinik-dobersberg/print-service/internal/routing"
+	"github.com/tierklinik-dobersberg/print-service/internal/templates"
 )
 
 type Providers struct {
@@ -15,13 +28,56 @@ type Providers struct {
 
 	Catalog discovery.Discoverer
 
+	// CUPS is nil if CUPS support is disabled.
 	CUPS *cups.Client
 
+	// Printers dispatches requests to the printer backends.
+	Printers *backend.Registry
+
 	EventService eventsv1connect.EventServiceClient
 
 	LongRunning longrunningv1connect.LongRunningServiceClient
 
+	// Roles resolves role IDs so rules can match role names. It is nil if
+	// the RoleService is not available.
+	Roles auth.RoleResolverFunc
+
 	Storage fs.FS
 
 	Gotenberg *gotenberg.Client
+
+	// Labels holds all configured label templates.
+	Labels *labels.Registry
+
+	// Templates is nil if no template directory is configured.
+	Templates *templates.Registry
+
+	// Preview renders page thumbnails of previewed documents.
+	Preview preview.Rasterizer
+
+	// Routing selects the printer for documents without a printer or with
+	// a logical target.
+	Routing *routing.Engine
+
+	// Preferences holds default printers and options per user, role and
+	// workstation.
+	Preferences *preferences.Store
+
+	// ACL decides which users may use a printer.
+	ACL *acl.ACL
+
+	// Policies rewrite the options of print jobs or deny them.
+	Policies *policy.Engine
+
+	// Accounting records the usage of print jobs and enforces quotas.
+	Accounting *accounting.Ledger
+
+	// History is nil if the job history is disabled.
+	History *history.Store
+
+	// Archive keeps printed documents for reprints. It is nil if disabled.
+	Archive *archive.Archive
+
+	// Audit records denied and security relevant requests.
+	Audit *audit.Log
 }
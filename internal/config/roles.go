@@ -0,0 +1,51 @@
+package config
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	idmv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1"
+	"github.com/tierklinik-dobersberg/apis/pkg/auth"
+)
+
+// roleCacheTTL defines how long resolved roles are cached so renamed roles
+// are picked up eventually.
+const roleCacheTTL = 5 * time.Minute
+
+type cachedRole struct {
+	role    *idmv1.Role
+	expires time.Time
+}
+
+// cacheRoles returns a resolver that caches the roles returned by resolve.
+func cacheRoles(resolve auth.RoleResolverFunc) auth.RoleResolverFunc {
+	var (
+		mu    sync.Mutex
+		cache = make(map[string]cachedRole)
+	)
+
+	return func(ctx context.Context, roleID string) (*idmv1.Role, error) {
+		mu.Lock()
+		cached, ok := cache[roleID]
+		mu.Unlock()
+
+		if ok && time.Now().Before(cached.expires) {
+			return cached.role, nil
+		}
+
+		role, err := resolve(ctx, roleID)
+		if err != nil {
+			return nil, err
+		}
+
+		mu.Lock()
+		cache[roleID] = cachedRole{
+			role:    role,
+			expires: time.Now().Add(roleCacheTTL),
+		}
+		mu.Unlock()
+
+		return role, nil
+	}
+}
@@ -83,6 +83,12 @@ func (cli *Client) GetDefaultPrinter() (Printer, error) {
 	return cli.newPrinter("", resp.PrinterAttributes[0])
 }
 
+// DefaultPrinter returns the name of the CUPS default printer as determined
+// when the client was created.
+func (cli *Client) DefaultPrinter() string {
+	return cli.defaultPrinterName
+}
+
 func (cli *Client) Ping() error {
 	return cli.cli.TestConnection()
 }
@@ -115,4 +121,13 @@ func init() {
 	ipp.AttributeTagMapping[AttributePrintColorMode] = ipp.TagKeyword
 	ipp.AttributeTagMapping[AttributePrintColorModeDefault] = ipp.TagKeyword
 	ipp.DefaultJobAttributes = append(ipp.DefaultJobAttributes, AttributePrintColorModeDefault)
+
+	ipp.AttributeTagMapping[AttributeSides] = ipp.TagKeyword
+
+	ipp.AttributeTagMapping[AttributeJobImpressionsCompleted] = ipp.TagInteger
+	ipp.AttributeTagMapping[AttributeJobMediaSheetsCompleted] = ipp.TagInteger
+	ipp.DefaultJobAttributes = append(ipp.DefaultJobAttributes, AttributeJobImpressionsCompleted, AttributeJobMediaSheetsCompleted)
+
+	ipp.AttributeTagMapping[AttributeQueuedJobCount] = ipp.TagInteger
+	ipp.DefaultPrinterAttributes = append(ipp.DefaultPrinterAttributes, ipp.AttributePrinterIsAcceptingJobs, AttributeQueuedJobCount)
 }
@@ -6,6 +6,9 @@ const (
 	ColorModeAuto      = ColorMode("auto")
 	ColorModeColor     = ColorMode("color")
 	ColorModeGrayScale = ColorMode("grayscale")
+
+	// ColorModeMonochrome is the IPP keyword for grayscale printing.
+	ColorModeMonochrome = ColorMode("monochrome")
 )
 
 type Orientation string
@@ -19,4 +22,17 @@ const (
 	AttributeLongRunningOperationID = "long-running-operation-id" // ipp.TagString
 	AttributePrintColorMode         = "print-color-mode"          // ipp.TagKeyword
 	AttributePrintColorModeDefault  = "print-color-mode-default"  // ipp.TagKeyword
+	AttributeSides                  = "sides"                     // ipp.TagKeyword
+	AttributeQueuedJobCount         = "queued-job-count"          // ipp.TagInteger
+
+	AttributeJobImpressionsCompleted = "job-impressions-completed"  // ipp.TagInteger
+	AttributeJobMediaSheetsCompleted = "job-media-sheets-completed" // ipp.TagInteger
+)
+
+type Sides string
+
+const (
+	SidesOneSided          = Sides("one-sided")
+	SidesTwoSidedLongEdge  = Sides("two-sided-long-edge")
+	SidesTwoSidedShortEdge = Sides("two-sided-short-edge")
 )
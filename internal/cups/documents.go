@@ -0,0 +1,34 @@
+package cups
+
+import (
+	"bytes"
+	"fmt"
+
+	ipp "github.com/phin1x/go-ipp"
+)
+
+// OperationCupsGetDocument is the CUPS-Get-Document operation.
+const OperationCupsGetDocument int16 = 0x4027
+
+// GetDocument returns the content and format of the first document of the
+// job with the given id. It only succeeds if CUPS preserved the job files
+// (PreserveJobFiles) and the user may read them.
+func (cli *Client) GetDocument(printer string, id int) ([]byte, string, error) {
+	req := ipp.NewRequest(OperationCupsGetDocument, 1)
+	req.OperationAttributes[ipp.AttributePrinterURI] = fmt.Sprintf("ipp://localhost/printers/%s", printer)
+	req.OperationAttributes[ipp.AttributeJobID] = id
+	req.OperationAttributes[ipp.AttributeDocumentNumber] = 1
+
+	adapter := ipp.NewHttpAdapter(cli.host, cli.port, cli.username, cli.password, false)
+
+	var content bytes.Buffer
+
+	res, err := cli.cli.SendRequest(adapter.GetHttpUri("printers", printer), req, &content)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get document of job %d: %w", id, err)
+	}
+
+	format, _ := getFirstValue[string](res.OperationAttributes[ipp.AttributeDocumentFormat], ipp.TagMimeType)
+
+	return content.Bytes(), format, nil
+}
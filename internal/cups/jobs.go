@@ -77,6 +77,11 @@ type Job struct {
 	PrinterName string
 	Progress    int
 
+	// ImpressionsCompleted and MediaSheetsCompleted are reported by the
+	// printer. They are zero if the printer does not support them.
+	ImpressionsCompleted int
+	MediaSheetsCompleted int
+
 	OperationID string
 }
 
@@ -114,6 +119,12 @@ func (cli *Client) ListJobs(printer string) ([]Job, error) {
 	return result, nil
 }
 
+// GetJob returns the job with the given id. The printer is not required
+// since CUPS job IDs are unique across all printers.
+func (cli *Client) GetJob(printer string, id int) (Job, error) {
+	return cli.GetJobById(id)
+}
+
 func (cli *Client) GetJobById(id int) (Job, error) {
 	res, err := cli.cli.GetJobAttributes(id, nil)
 	if err != nil {
@@ -124,6 +135,22 @@ func (cli *Client) GetJobById(id int) (Job, error) {
 }
 
 func (cli *Client) newJob(jobId int, attr ipp.Attributes) (Job, error) {
+	job, err := ParseJobAttributes(jobId, attr)
+	if err != nil {
+		return job, err
+	}
+
+	if job.PrinterURI != "" {
+		job.PrinterName = cli.getPrinterName(job.PrinterURI)
+	}
+
+	return job, nil
+}
+
+// ParseJobAttributes creates a new job from the IPP job attributes. Note that
+// the PrinterName field is not populated since the printer name cannot
+// be determined from the printer URI in a generic way.
+func ParseJobAttributes(jobId int, attr ipp.Attributes) (Job, error) {
 	job := Job{
 		ID: jobId,
 	}
@@ -148,8 +175,6 @@ func (cli *Client) newJob(jobId int, attr ipp.Attributes) (Job, error) {
 	job.PrinterURI, err = getFirstValue[string](attr[ipp.AttributePrinterURI], ipp.TagUri)
 	if err != nil {
 		l.Error("job.PrinterURI", "error", err.Error())
-	} else {
-		job.PrinterName = cli.getPrinterName(job.PrinterURI)
 	}
 
 	job.Progress, err = getFirstValue[int](attr[ipp.AttributeJobMediaProgress], ipp.TagCupsInvalid)
@@ -162,6 +187,10 @@ func (cli *Client) newJob(jobId int, attr ipp.Attributes) (Job, error) {
 		l.Error("job.OperationID", "error", err.Error())
 	}
 
+	// the counters are optional so missing values are not logged
+	job.ImpressionsCompleted, _ = getFirstValue[int](attr[AttributeJobImpressionsCompleted], ipp.TagInteger)
+	job.MediaSheetsCompleted, _ = getFirstValue[int](attr[AttributeJobMediaSheetsCompleted], ipp.TagInteger)
+
 	return job, nil
 }
 
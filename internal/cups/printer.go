@@ -1,6 +1,7 @@
 package cups
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 
@@ -54,6 +55,15 @@ type Printer struct {
 	Location     string
 	Info         string
 	Model        string
+
+	// StateReasons holds all values of printer-state-reasons.
+	StateReasons []string
+
+	// Accepting is set if the printer accepts new jobs.
+	Accepting bool
+
+	// QueuedJobs is the number of jobs that are queued or processing.
+	QueuedJobs int
 }
 
 func (p Printer) ToProto() *printingv1.Printer {
@@ -65,6 +75,30 @@ func (p Printer) ToProto() *printingv1.Printer {
 	}
 }
 
+// HasPrinter returns true if CUPS knows a printer with the given name. Use
+// LookupPrinter to tell unknown printers from failed requests.
+func (cli *Client) HasPrinter(name string) bool {
+	ok, _ := cli.LookupPrinter(name)
+
+	return ok
+}
+
+// LookupPrinter returns true if CUPS knows a printer with the given name.
+// An error is only returned if CUPS cannot be asked.
+func (cli *Client) LookupPrinter(name string) (bool, error) {
+	_, err := cli.cli.GetPrinterAttributes(name, []string{ipp.AttributePrinterName})
+
+	var ippErr ipp.IPPError
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.As(err, &ippErr) && ippErr.Status == ipp.StatusErrorNotFound:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
 func (cli *Client) ListPrinters() ([]Printer, error) {
 	res, err := cli.cli.GetPrinters(nil)
 	if err != nil {
@@ -86,6 +120,12 @@ func (cli *Client) ListPrinters() ([]Printer, error) {
 }
 
 func (cli *Client) newPrinter(name string, attrs ipp.Attributes) (Printer, error) {
+	return ParsePrinterAttributes(name, attrs)
+}
+
+// ParsePrinterAttributes creates a new printer from the IPP printer attributes.
+// If name is empty, the printer-name attribute is used.
+func ParsePrinterAttributes(name string, attrs ipp.Attributes) (Printer, error) {
 	l := slog.Default().With("name", name)
 
 	p := Printer{
@@ -112,6 +152,21 @@ func (cli *Client) newPrinter(name string, attrs ipp.Attributes) (Printer, error
 		l.Warn("failed to get printer state reason", "error", err)
 	}
 
+	for _, attr := range attrs[ipp.AttributePrinterStateReasons] {
+		if reason, ok := attr.Value.(string); ok {
+			p.StateReasons = append(p.StateReasons, reason)
+		}
+	}
+
+	// printers that do not report printer-is-accepting-jobs are expected to
+	// accept jobs.
+	p.Accepting = true
+	if accepting, err := getFirstValue[bool](attrs[ipp.AttributePrinterIsAcceptingJobs], ipp.TagBoolean); err == nil {
+		p.Accepting = accepting
+	}
+
+	p.QueuedJobs, _ = getFirstValue[int](attrs[AttributeQueuedJobCount], ipp.TagInteger)
+
 	p.StateMessage, _ = getFirstValue[string](attrs[ipp.AttributePrinterStateMessage], ipp.TagString)
 	p.Location, _ = getFirstValue[string](attrs[ipp.AttributePrinterLocation], ipp.TagText)
 	p.Info, _ = getFirstValue[string](attrs[ipp.AttributePrinterInfo], ipp.TagText)
@@ -0,0 +1,369 @@
+// Package history keeps a persistent record of all print jobs submitted
+// through the service.
+package history
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tierklinik-dobersberg/print-service/internal/pdf"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrNotFound is returned if a record does not exist.
+var ErrNotFound = errors.New("history record not found")
+
+var (
+	jobsBucket       = []byte("jobs")
+	operationsBucket = []byte("operations")
+)
+
+// States recorded in addition to the IPP job states.
+const (
+	StateSubmitted = "submitted"
+	StateFailed    = "failed"
+)
+
+// Record describes a single print job.
+type Record struct {
+	// ID is the unique ID of the record. It is assigned by Add.
+	ID string `json:"id"`
+
+	OperationID string `json:"operationId"`
+	User        string `json:"user"`
+	Document    string `json:"document"`
+
+	// DocumentHash is the hex encoded SHA-256 hash of the submitted
+	// document.
+	DocumentHash string `json:"documentHash,omitempty"`
+
+	// Printer is the printer or pool the job has been sent to.
+	Printer string `json:"printer"`
+
+	// JobPrinter is the printer that processed the job. It differs from
+	// Printer if the job has been sent to a pool.
+	JobPrinter string `json:"jobPrinter,omitempty"`
+	JobID      int    `json:"jobId,omitempty"`
+
+	// Options holds the print options using the same keys as the HTTP
+	// print endpoint.
+	Options map[string]string `json:"options,omitempty"`
+
+	// ContentType is the type of the received document and
+	// SubmittedContentType the one sent to the printer.
+	ContentType          string `json:"contentType"`
+	SubmittedContentType string `json:"submittedContentType"`
+	Converted            bool   `json:"converted"`
+	Size                 int64  `json:"size"`
+
+	// RoutingRule is the name of the routing rule that selected the
+	// printer.
+	RoutingRule string `json:"routingRule,omitempty"`
+
+	// Info holds the inspection result of PDF documents.
+	Info *pdf.Info `json:"info,omitempty"`
+
+	// States holds the time each job state has been observed first.
+	States map[string]time.Time `json:"states"`
+
+	// FinalState is set once the job is finished.
+	FinalState string `json:"finalState,omitempty"`
+
+	// Archived is set if the submitted document has been archived for
+	// reprints.
+	Archived bool `json:"archived"`
+
+	// Unprocessed is set if no post-processing has been applied to the
+	// archived document so the stages of the target printer are applied
+	// when it is reprinted.
+	Unprocessed bool `json:"unprocessed,omitempty"`
+
+	// Original is set if the document before post-processing has been
+	// archived in addition to the submitted one so it can be reprinted on
+	// other printers.
+	Original bool `json:"original,omitempty"`
+
+	// ReprintOf is the ID of the record that has been printed again.
+	ReprintOf string `json:"reprintOf,omitempty"`
+
+	// Error holds the reason for failed submissions.
+	Error string `json:"error,omitempty"`
+
+	Created   time.Time `json:"created"`
+	Completed time.Time `json:"completed,omitzero"`
+}
+
+// Observe records the time state has been seen first.
+func (r *Record) Observe(state string, t time.Time) {
+	if r.States == nil {
+		r.States = make(map[string]time.Time)
+	}
+
+	if _, ok := r.States[state]; !ok {
+		r.States[state] = t
+	}
+}
+
+// Store persists records in a bbolt database.
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens or creates the database at path.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open job history: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{jobsBucket, operationsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		db.Close()
+
+		return nil, fmt.Errorf("failed to prepare job history: %w", err)
+	}
+
+	return &Store{
+		db: db,
+	}, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Add stores r and returns it with the assigned ID. If r.Created is not
+// set, the current time is used.
+func (s *Store) Add(r Record) (Record, error) {
+	if r.Created.IsZero() {
+		r.Created = time.Now()
+	}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		jobs := tx.Bucket(jobsBucket)
+
+		seq, err := jobs.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		r.ID = strconv.FormatUint(seq, 10)
+
+		if err := put(jobs, seq, r); err != nil {
+			return err
+		}
+
+		if r.OperationID != "" {
+			return tx.Bucket(operationsBucket).Put([]byte(r.OperationID), key(seq))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return r, fmt.Errorf("failed to add history record: %w", err)
+	}
+
+	return r, nil
+}
+
+// Get returns the record with the given ID.
+func (s *Store) Get(id string) (Record, error) {
+	seq, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return Record{}, ErrNotFound
+	}
+
+	var r Record
+	err = s.db.View(func(tx *bolt.Tx) error {
+		r, err = get(tx.Bucket(jobsBucket), key(seq))
+
+		return err
+	})
+
+	return r, err
+}
+
+// GetByOperation returns the record of the job with the given operation ID.
+func (s *Store) GetByOperation(operationID string) (Record, error) {
+	var r Record
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		k := tx.Bucket(operationsBucket).Get([]byte(operationID))
+		if k == nil {
+			return ErrNotFound
+		}
+
+		var err error
+		r, err = get(tx.Bucket(jobsBucket), k)
+
+		return err
+	})
+
+	return r, err
+}
+
+// Update calls fn with the record with the given ID and stores the
+// modified record.
+func (s *Store) Update(id string, fn func(r *Record)) error {
+	seq, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		jobs := tx.Bucket(jobsBucket)
+
+		r, err := get(jobs, key(seq))
+		if err != nil {
+			return err
+		}
+
+		fn(&r)
+
+		return put(jobs, seq, r)
+	})
+}
+
+// Filter selects records. Empty fields match all records.
+type Filter struct {
+	User    string
+	Printer string
+
+	// Document is matched case-insensitively as a substring of the
+	// document name.
+	Document string
+
+	// State matches the final state or, for unfinished jobs, "pending".
+	State string
+
+	// From and To limit the creation time of records.
+	From time.Time
+	To   time.Time
+}
+
+// Matches returns true if r matches f.
+func (f Filter) Matches(r Record) bool {
+	state := r.FinalState
+	if state == "" {
+		state = "pending"
+	}
+
+	switch {
+	case f.User != "" && r.User != f.User:
+		return false
+	case f.Printer != "" && r.Printer != f.Printer && r.JobPrinter != f.Printer:
+		return false
+	case f.Document != "" && !strings.Contains(strings.ToLower(r.Document), strings.ToLower(f.Document)):
+		return false
+	case f.State != "" && state != f.State:
+		return false
+	case !f.From.IsZero() && r.Created.Before(f.From):
+		return false
+	case !f.To.IsZero() && !r.Created.Before(f.To):
+		return false
+	}
+
+	return true
+}
+
+// List returns up to limit records matching f, newest first. If pageToken
+// is not empty, the listing continues after the record returned last by the
+// previous call. The returned token is empty if there are no more records.
+// A limit of zero returns all matching records.
+func (s *Store) List(f Filter, limit int, pageToken string) ([]Record, string, error) {
+	var start []byte
+	if pageToken != "" {
+		seq, err := strconv.ParseUint(pageToken, 10, 64)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid page token %q", pageToken)
+		}
+
+		start = key(seq)
+	}
+
+	var (
+		result []Record
+		next   string
+	)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(jobsBucket).Cursor()
+
+		var k, v []byte
+		if start == nil {
+			k, v = c.Last()
+		} else {
+			// the token is the last returned record
+			c.Seek(start)
+			k, v = c.Prev()
+		}
+
+		for ; k != nil; k, v = c.Prev() {
+			var r Record
+			if err := json.Unmarshal(v, &r); err != nil {
+				return fmt.Errorf("invalid history record %d: %w", binary.BigEndian.Uint64(k), err)
+			}
+
+			if !f.Matches(r) {
+				continue
+			}
+
+			if limit > 0 && len(result) == limit {
+				next = result[len(result)-1].ID
+				break
+			}
+
+			result = append(result, r)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return result, next, nil
+}
+
+func key(seq uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, seq)
+}
+
+func get(b *bolt.Bucket, k []byte) (Record, error) {
+	v := b.Get(k)
+	if v == nil {
+		return Record{}, ErrNotFound
+	}
+
+	var r Record
+	if err := json.Unmarshal(v, &r); err != nil {
+		return r, fmt.Errorf("invalid history record: %w", err)
+	}
+
+	return r, nil
+}
+
+func put(b *bolt.Bucket, seq uint64, r Record) error {
+	v, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	return b.Put(key(seq), v)
+}
@@ -0,0 +1,172 @@
+package history
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func openStore(t *testing.T) *Store {
+	t.Helper()
+
+	store, err := Open(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	return store
+}
+
+func recordIDs(records []Record) []string {
+	ids := make([]string, len(records))
+	for idx, r := range records {
+		ids[idx] = r.ID
+	}
+
+	return ids
+}
+
+func TestFilterMatches(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	r := Record{
+		User:       "alice",
+		Document:   "Befund Max Mustermann.pdf",
+		Printer:    "office",
+		JobPrinter: "office-1",
+		Created:    now,
+	}
+
+	finished := r
+	finished.FinalState = "completed"
+
+	cases := []struct {
+		name     string
+		filter   Filter
+		record   Record
+		expected bool
+	}{
+		{"empty filter", Filter{}, r, true},
+		{"user", Filter{User: "alice"}, r, true},
+		{"other user", Filter{User: "bob"}, r, false},
+		{"pool", Filter{Printer: "office"}, r, true},
+		{"pool member", Filter{Printer: "office-1"}, r, true},
+		{"other printer", Filter{Printer: "office-2"}, r, false},
+		{"document case-insensitive", Filter{Document: "max MUSTER"}, r, true},
+		{"other document", Filter{Document: "invoice"}, r, false},
+		{"pending", Filter{State: "pending"}, r, true},
+		{"pending finished", Filter{State: "pending"}, finished, false},
+		{"final state", Filter{State: "completed"}, finished, true},
+		{"final state unfinished", Filter{State: "completed"}, r, false},
+		{"from is inclusive", Filter{From: now}, r, true},
+		{"before from", Filter{From: now.Add(time.Second)}, r, false},
+		{"to is exclusive", Filter{To: now}, r, false},
+		{"before to", Filter{To: now.Add(time.Second)}, r, true},
+	}
+
+	for _, c := range cases {
+		if got := c.filter.Matches(c.record); got != c.expected {
+			t.Errorf("%s: expected %t, got %t", c.name, c.expected, got)
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	store := openStore(t)
+
+	// records of bob are skipped by the filter
+	for _, user := range []string{"alice", "bob", "alice", "alice", "bob", "alice", "alice"} {
+		if _, err := store.Add(Record{User: user}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filter := Filter{User: "alice"}
+
+	var (
+		pages [][]string
+		token string
+	)
+
+	for {
+		records, next, err := store.List(filter, 2, token)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		pages = append(pages, recordIDs(records))
+
+		if next == "" {
+			break
+		}
+
+		if last := records[len(records)-1].ID; next != last {
+			t.Fatalf("expected the page token to be the last returned ID %q, got %q", last, next)
+		}
+
+		if len(pages) > 5 {
+			t.Fatalf("pagination does not terminate: %v", pages)
+		}
+
+		token = next
+	}
+
+	expected := [][]string{{"7", "6"}, {"4", "3"}, {"1"}}
+	if !slices.EqualFunc(pages, expected, slices.Equal) {
+		t.Errorf("expected pages %v, got %v", expected, pages)
+	}
+
+	all, next, err := store.List(Filter{}, 0, "")
+	if err != nil || next != "" || len(all) != 7 || all[0].ID != "7" {
+		t.Errorf("expected all records newest first without a token, got %v, %q, %v", recordIDs(all), next, err)
+	}
+
+	if _, _, err := store.List(Filter{}, 2, "invalid"); err == nil {
+		t.Errorf("expected invalid page tokens to be rejected")
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	store := openStore(t)
+
+	r, err := store.Add(Record{OperationID: "op-1", User: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.ID == "" || r.Created.IsZero() {
+		t.Errorf("expected an ID and creation time to be assigned, got %+v", r)
+	}
+
+	completed := time.Now()
+	err = store.Update(r.ID, func(r *Record) {
+		r.FinalState = "completed"
+		r.Observe("completed", completed)
+		r.Observe("completed", completed.Add(time.Minute))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.GetByOperation("op-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.ID != r.ID || got.FinalState != "completed" || !got.States["completed"].Equal(completed) {
+		t.Errorf("expected the updated record with the first observation, got %+v", got)
+	}
+
+	for name, err := range map[string]error{
+		"unknown operation": func() error { _, err := store.GetByOperation("op-2"); return err }(),
+		"unknown ID":        store.Update("42", func(*Record) {}),
+		"invalid ID":        store.Update("invalid", func(*Record) {}),
+	} {
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: expected ErrNotFound, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package hotfolder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	v1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/printing/v1"
+	"github.com/tierklinik-dobersberg/apis/pkg/auth"
+	"github.com/tierklinik-dobersberg/print-service/internal/config"
+	"github.com/tierklinik-dobersberg/print-service/internal/cups"
+	"github.com/tierklinik-dobersberg/print-service/internal/privacy"
+	"github.com/tierklinik-dobersberg/print-service/internal/service"
+)
+
+const (
+	// PrintingFolder is the name of the sub-directory where submitted files
+	// are kept until their job is finished.
+	PrintingFolder = "printing"
+
+	// DoneFolder is the name of the sub-directory where successfully printed
+	// files are moved to.
+	DoneFolder = "done"
+
+	// FailedFolder is the name of the sub-directory where files that failed
+	// to print are moved to.
+	FailedFolder = "failed"
+
+	// ErrorSuffix is appended to the file name of the sidecar file that holds
+	// the error message for failed files.
+	ErrorSuffix = ".error.txt"
+
+	defaultUser         = "hotfolder"
+	defaultStableFor    = 10 * time.Second
+	defaultPollInterval = 5 * time.Second
+)
+
+// Watcher watches a hot-folder for new files and prints them once they
+// did not change for the configured stable duration.
+//
+// Polling is used instead of file system notifications because the folders
+// are usually exported via SMB where notifications are not reliable.
+type Watcher struct {
+	folder config.HotFolder
+	opts   service.PrintOptions
+	user   *auth.RemoteUser
+	svc    *service.Service
+
+	stableFor    time.Duration
+	pollInterval time.Duration
+
+	seen map[string]fileState
+}
+
+type fileState struct {
+	size    int64
+	modTime time.Time
+	since   time.Time
+}
+
+// New creates a new watcher for folder.
+func New(folder config.HotFolder, svc *service.Service) (*Watcher, error) {
+	values := make(url.Values)
+	for key, value := range folder.Options {
+		values.Set(key, value)
+	}
+
+	opts, err := service.ParsePrintOptions(values)
+	if err != nil {
+		return nil, fmt.Errorf("hot-folder %q: %w", folder.Path, err)
+	}
+
+	for _, dir := range []string{PrintingFolder, DoneFolder, FailedFolder} {
+		if err := os.MkdirAll(filepath.Join(folder.Path, dir), 0o755); err != nil {
+			return nil, fmt.Errorf("hot-folder %q: failed to create %s directory: %w", folder.Path, dir, err)
+		}
+	}
+
+	w := &Watcher{
+		folder:       folder,
+		opts:         opts,
+		svc:          svc,
+		stableFor:    time.Duration(folder.StableFor),
+		pollInterval: time.Duration(folder.PollInterval),
+		seen:         make(map[string]fileState),
+		user: &auth.RemoteUser{
+			Username: folder.User,
+			RoleIDs:  folder.Roles,
+		},
+	}
+
+	if w.user.Username == "" {
+		w.user.Username = defaultUser
+	}
+
+	if w.stableFor <= 0 {
+		w.stableFor = defaultStableFor
+	}
+
+	if w.pollInterval <= 0 {
+		w.pollInterval = defaultPollInterval
+	}
+
+	return w, nil
+}
+
+// Run watches the hot-folder until ctx is cancelled.
+func (w *Watcher) Run(ctx context.Context) {
+	slog.Info("watching hot-folder", "path", w.folder.Path, "printer", w.folder.Printer)
+
+	w.recover()
+
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		w.scan(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Watcher) scan(ctx context.Context) {
+	entries, err := os.ReadDir(w.folder.Path)
+	if err != nil {
+		slog.Error("failed to read hot-folder", "path", w.folder.Path, "error", err)
+		return
+	}
+
+	now := time.Now()
+	present := make(map[string]struct{}, len(entries))
+
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		name := entry.Name()
+		present[name] = struct{}{}
+
+		state, ok := w.seen[name]
+		if !ok || state.size != info.Size() || !state.modTime.Equal(info.ModTime()) {
+			w.seen[name] = fileState{
+				size:    info.Size(),
+				modTime: info.ModTime(),
+				since:   now,
+			}
+
+			continue
+		}
+
+		if now.Sub(state.since) < w.stableFor {
+			continue
+		}
+
+		delete(w.seen, name)
+		w.process(ctx, name, info.Size())
+	}
+
+	// forget about files that have been removed in the meantime
+	for name := range w.seen {
+		if _, ok := present[name]; !ok {
+			delete(w.seen, name)
+		}
+	}
+}
+
+// process moves the file name to the printing folder and submits it. Once
+// the job is finished, it is moved to the done or failed folder depending on
+// the final job state. The file is moved first so it cannot be printed
+// again if moving fails.
+func (w *Watcher) process(ctx context.Context, name string, size int64) {
+	path := filepath.Join(w.folder.Path, name)
+
+	printing, err := moveFile(path, filepath.Join(w.folder.Path, PrintingFolder), name)
+	if err != nil {
+		slog.Error("failed to move hot-folder file", "path", w.folder.Path, "name", privacy.Name(name), "folder", PrintingFolder, "error", scrub(err, name))
+		return
+	}
+
+	finished := func(job cups.Job) {
+		if job.State == cups.JobStateComplete {
+			slog.Info("printed hot-folder file", "path", w.folder.Path, "name", privacy.Name(name), "job-id", job.ID)
+			w.finish(printing, DoneFolder, nil)
+
+			return
+		}
+
+		w.finish(printing, FailedFolder, fmt.Errorf("job %d on printer %q finished in state %s", job.ID, job.PrinterName, job.State))
+	}
+
+	if err := w.print(ctx, printing, name, size, finished); err != nil {
+		w.finish(printing, FailedFolder, err)
+		return
+	}
+
+	slog.Info("submitted hot-folder file", "path", w.folder.Path, "name", privacy.Name(name))
+}
+
+// recover moves files that have been left in the printing folder by a
+// previous run to the failed folder. Their jobs are not tracked anymore so
+// they are not printed again to avoid duplicates.
+func (w *Watcher) recover() {
+	dir := filepath.Join(w.folder.Path, PrintingFolder)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		slog.Error("failed to read hot-folder", "path", dir, "error", err)
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		w.finish(filepath.Join(dir, entry.Name()), FailedFolder, errors.New("the service has been stopped before the job finished, check whether the document has been printed"))
+	}
+}
+
+// finish moves the file at path to the folder dir. If err is set, it is
+// written to a sidecar file next to the moved file.
+func (w *Watcher) finish(path string, dir string, err error) {
+	name := filepath.Base(path)
+
+	if err != nil {
+		slog.Error("failed to print hot-folder file", "path", w.folder.Path, "name", privacy.Name(name), "error", scrub(err, name))
+	}
+
+	target, moveErr := moveFile(path, filepath.Join(w.folder.Path, dir), name)
+	if moveErr != nil {
+		slog.Error("failed to move hot-folder file", "path", w.folder.Path, "name", privacy.Name(name), "folder", dir, "error", scrub(moveErr, name))
+		return
+	}
+
+	if err == nil {
+		return
+	}
+
+	sidecar := target + ErrorSuffix
+	if err := os.WriteFile(sidecar, []byte(err.Error()+"\n"), 0o644); err != nil {
+		slog.Error("failed to write error sidecar", "path", w.folder.Path, "name", privacy.Name(name), "folder", dir, "error", scrub(err, name))
+	}
+}
+
+func (w *Watcher) print(ctx context.Context, path string, name string, size int64, done func(cups.Job)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = w.svc.PrintContent(ctx, w.user, &v1.Document{
+		Name:        name,
+		Printer:     w.folder.Printer,
+		Orientation: w.opts.Orientation,
+	}, w.opts, f, size, done)
+
+	return err
+}
+
+// scrub returns the text of err with all occurrences of the file names
+// redacted since errors of file operations contain the path.
+func scrub(err error, names ...string) string {
+	return privacy.Default().Scrub(err.Error(), names...)
+}
+
+// maxMoveAttempts limits the number of names tried by moveFile.
+const maxMoveAttempts = 100
+
+// moveFile moves the file at path into dir and returns the new path. If a
+// file with the same name already exists in dir, a timestamp and, if
+// required, a counter are prepended to name. Existing files are never
+// replaced.
+func moveFile(path string, dir string, name string) (string, error) {
+	prefix := time.Now().Format("20060102-150405")
+
+	for attempt := range maxMoveAttempts {
+		target := filepath.Join(dir, name)
+
+		switch {
+		case attempt == 1:
+			target = filepath.Join(dir, prefix+"-"+name)
+		case attempt > 1:
+			target = filepath.Join(dir, fmt.Sprintf("%s-%d-%s", prefix, attempt, name))
+		}
+
+		// unlike rename, link fails if the target exists
+		err := os.Link(path, target)
+		switch {
+		case err == nil:
+			if err := os.Remove(path); err != nil {
+				os.Remove(target)
+
+				return "", err
+			}
+
+			return target, nil
+
+		case errors.Is(err, fs.ErrExist):
+			continue
+		}
+
+		// the file system does not support hard links
+		if _, err := os.Lstat(target); !errors.Is(err, fs.ErrNotExist) {
+			if err != nil {
+				return "", err
+			}
+
+			continue
+		}
+
+		return target, os.Rename(path, target)
+	}
+
+	return "", fmt.Errorf("no free file name in %s", dir)
+}
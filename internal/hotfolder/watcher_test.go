@@ -0,0 +1,180 @@
+package hotfolder
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/tierklinik-dobersberg/print-service/internal/config"
+	"github.com/tierklinik-dobersberg/print-service/internal/privacy"
+)
+
+func TestNew(t *testing.T) {
+	dir := t.TempDir()
+
+	w, err := New(config.HotFolder{
+		Path:  dir,
+		Roles: []string{"reception"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if w.user.Username != defaultUser {
+		t.Errorf("expected user %q, got %q", defaultUser, w.user.Username)
+	}
+
+	if !slices.Equal(w.user.RoleIDs, []string{"reception"}) {
+		t.Errorf("expected the configured roles, got %v", w.user.RoleIDs)
+	}
+
+	for _, sub := range []string{PrintingFolder, DoneFolder, FailedFolder} {
+		if stat, err := os.Stat(filepath.Join(dir, sub)); err != nil || !stat.IsDir() {
+			t.Errorf("expected the %s folder to be created", sub)
+		}
+	}
+}
+
+func TestMoveFile(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, FailedFolder)
+
+	if err := os.Mkdir(target, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// all files are moved within the same second
+	var moved []string
+	for idx := range 3 {
+		if err := os.WriteFile(filepath.Join(dir, "a.pdf"), []byte{byte(idx)}, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		path, err := moveFile(filepath.Join(dir, "a.pdf"), target, "a.pdf")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if _, err := os.Stat(filepath.Join(dir, "a.pdf")); !os.IsNotExist(err) {
+			t.Errorf("expected the source file to be removed, got %v", err)
+		}
+
+		moved = append(moved, path)
+	}
+
+	for idx, path := range moved {
+		content, err := os.ReadFile(path)
+		if err != nil || len(content) != 1 || content[0] != byte(idx) {
+			t.Errorf("expected file #%d at %s, got %v, %v", idx+1, path, content, err)
+		}
+	}
+
+	entries, _ := os.ReadDir(target)
+	if len(entries) != 3 {
+		t.Errorf("expected the clashing files to be renamed, got %d files", len(entries))
+	}
+}
+
+func TestProcessFailedMove(t *testing.T) {
+	dir := t.TempDir()
+
+	w, err := New(config.HotFolder{Path: dir}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// files cannot be moved into the printing folder if it is a file
+	printing := filepath.Join(dir, PrintingFolder)
+	if err := os.Remove(printing); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(printing, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "a.pdf"), []byte("%PDF"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the watcher has no service so submitting the file would panic
+	w.process(context.Background(), "a.pdf", 4)
+
+	if _, err := os.Stat(filepath.Join(dir, "a.pdf")); err != nil {
+		t.Errorf("expected the file to stay in the hot-folder: %s", err)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	dir := t.TempDir()
+
+	w, err := New(config.HotFolder{Path: dir}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, PrintingFolder, "a.pdf"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	w.recover()
+
+	if _, err := os.Stat(filepath.Join(dir, FailedFolder, "a.pdf")); err != nil {
+		t.Errorf("expected the file to be moved to the failed folder: %s", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, FailedFolder, "a.pdf"+ErrorSuffix)); err != nil {
+		t.Errorf("expected an error sidecar: %s", err)
+	}
+
+	if entries, _ := os.ReadDir(filepath.Join(dir, PrintingFolder)); len(entries) != 0 {
+		t.Errorf("expected the printing folder to be empty, got %d files", len(entries))
+	}
+}
+
+func TestProcessLogsRedactedNames(t *testing.T) {
+	redactor, err := privacy.New("redact", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privacy.SetDefault(redactor)
+	t.Cleanup(func() { privacy.SetDefault(nil) })
+
+	var logs bytes.Buffer
+
+	logger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(logger) })
+
+	dir := t.TempDir()
+
+	w, err := New(config.HotFolder{Path: dir}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// moving the file fails since the printing folder is missing
+	if err := os.Remove(filepath.Join(dir, PrintingFolder)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "Max Mustermann.pdf"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	w.process(context.Background(), "Max Mustermann.pdf", 0)
+
+	if logs.Len() == 0 {
+		t.Fatal("expected the failed move to be logged")
+	}
+
+	if strings.Contains(logs.String(), "Mustermann") {
+		t.Fatalf("expected the file name to be redacted, got %s", logs.String())
+	}
+}
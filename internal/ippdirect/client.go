@@ -0,0 +1,524 @@
+package ippdirect
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phin1x/go-ipp"
+	"github.com/tierklinik-dobersberg/print-service/internal/backend"
+	"github.com/tierklinik-dobersberg/print-service/internal/cups"
+)
+
+const (
+	AttributeDocumentFormatSupported = "document-format-supported" // ipp.TagMimeType
+)
+
+// maxOperations is the number of operation IDs that are kept per printer.
+const maxOperations = 100
+
+// printerAttributes are requested from the printer using
+// Get-Printer-Attributes.
+var printerAttributes = []string{
+	ipp.AttributePrinterName,
+	ipp.AttributePrinterState,
+	ipp.AttributePrinterStateReasons,
+	ipp.AttributePrinterStateMessage,
+	ipp.AttributePrinterLocation,
+	ipp.AttributePrinterInfo,
+	ipp.AttributePrinterMakeAndModel,
+	ipp.AttributePrinterIsAcceptingJobs,
+	AttributeDocumentFormatSupported,
+	cups.AttributeQueuedJobCount,
+}
+
+// PrinterConfig configures a driverless (IPP Everywhere) printer that is
+// accessed directly without CUPS.
+type PrinterConfig struct {
+	// Name is the name of the printer as used in print requests.
+	Name string `json:"name"`
+
+	// URI is the IPP URI of the printer, e.g. ipp://printer.local/ipp/print.
+	// ipp:// and ipps:// URIs without a port use port 631, http:// and
+	// https:// URIs use port 80 and 443.
+	URI string `json:"uri"`
+
+	// Username and Password are used for HTTP basic authentication.
+	Username string `json:"username"`
+	Password string `json:"password"`
+
+	// Insecure disables TLS certificate verification for ipps:// URIs.
+	Insecure bool `json:"insecure"`
+
+	// Location and Description override the values reported by the printer.
+	Location    string `json:"location"`
+	Description string `json:"description"`
+
+	// Default marks the printer as the default printer.
+	Default bool `json:"default"`
+}
+
+// Client is a printer backend that talks IPP directly to driverless (IPP
+// Everywhere) printers without a CUPS server in between.
+type Client struct {
+	printers map[string]*printer
+	order    []string
+
+	defaultPrinter string
+}
+
+type printer struct {
+	PrinterConfig
+
+	uri     string
+	httpURL string
+	client  *http.Client
+
+	// operations maps job IDs to the long-running operation ID since
+	// printers do not store custom job attributes. Only the IDs of the
+	// last maxOperations jobs are kept, in order of submission.
+	l          sync.Mutex
+	operations map[int]string
+	submitted  []int
+}
+
+// Compile time check
+var (
+	_ backend.PrinterBackend = (*Client)(nil)
+	_ backend.Validator      = (*Client)(nil)
+)
+
+// NewClient creates a new backend for the configured printers.
+func NewClient(printers []PrinterConfig) (*Client, error) {
+	cli := &Client{
+		printers: make(map[string]*printer, len(printers)),
+	}
+
+	for _, cfg := range printers {
+		if cfg.Name == "" {
+			return nil, fmt.Errorf("printer %q: missing name", cfg.URI)
+		}
+
+		if _, ok := cli.printers[cfg.Name]; ok {
+			return nil, fmt.Errorf("printer %q: duplicate name", cfg.Name)
+		}
+
+		u, err := url.Parse(cfg.URI)
+		if err != nil {
+			return nil, fmt.Errorf("printer %q: invalid URI: %w", cfg.Name, err)
+		}
+
+		p := &printer{
+			PrinterConfig: cfg,
+			client: &http.Client{
+				Timeout: time.Minute,
+				Transport: &http.Transport{
+					TLSClientConfig: &tls.Config{
+						// driverless printers usually use self-signed certificates
+						InsecureSkipVerify: cfg.Insecure,
+					},
+				},
+			},
+			operations: make(map[int]string),
+		}
+
+		switch u.Scheme {
+		case "ipp", "http":
+			// ipp uses the IPP port by default while http URIs use the
+			// default HTTP port
+			port := ":631"
+			if u.Scheme == "http" {
+				port = ":80"
+			}
+
+			u.Scheme = "ipp"
+			p.uri = u.String()
+
+			u.Scheme = "http"
+			if u.Port() == "" {
+				u.Host += port
+			}
+			p.httpURL = u.String()
+
+		case "ipps", "https":
+			// ipps uses the IPP port by default, like ipp
+			port := ":631"
+			if u.Scheme == "https" {
+				port = ":443"
+			}
+
+			u.Scheme = "ipps"
+			p.uri = u.String()
+
+			u.Scheme = "https"
+			if u.Port() == "" {
+				u.Host += port
+			}
+			p.httpURL = u.String()
+
+		default:
+			return nil, fmt.Errorf("printer %q: unsupported URI scheme %q", cfg.Name, u.Scheme)
+		}
+
+		cli.printers[cfg.Name] = p
+		cli.order = append(cli.order, cfg.Name)
+
+		if cfg.Default && cli.defaultPrinter == "" {
+			cli.defaultPrinter = cfg.Name
+		}
+	}
+
+	return cli, nil
+}
+
+func (cli *Client) HasPrinter(name string) bool {
+	_, ok := cli.printers[name]
+	return ok
+}
+
+func (cli *Client) DefaultPrinter() string {
+	return cli.defaultPrinter
+}
+
+func (cli *Client) ListPrinters() ([]cups.Printer, error) {
+	result := make([]cups.Printer, 0, len(cli.order))
+
+	for _, name := range cli.order {
+		p := cli.printers[name]
+
+		printer, _, err := p.getPrinter()
+		if err != nil {
+			// still report the printer but mark it as stopped
+			printer = cups.Printer{
+				Name:         p.Name,
+				URI:          p.uri,
+				State:        cups.PrinterStateStopped,
+				StateMessage: err.Error(),
+			}
+		}
+
+		if p.Location != "" {
+			printer.Location = p.Location
+		}
+
+		if p.Description != "" {
+			printer.Info = p.Description
+		}
+
+		result = append(result, printer)
+	}
+
+	return result, nil
+}
+
+func (cli *Client) ListJobs(name string) ([]cups.Job, error) {
+	p, ok := cli.printers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown printer %q", name)
+	}
+
+	req := p.newRequest(ipp.OperationGetJobs)
+	req.OperationAttributes[ipp.AttributeWhichJobs] = "all"
+	req.OperationAttributes[ipp.AttributeRequestedAttributes] = ipp.DefaultJobAttributes
+
+	res, err := p.send(req, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]cups.Job, 0, len(res.JobAttributes))
+	for _, attrs := range res.JobAttributes {
+		id, err := getJobID(attrs)
+		if err != nil {
+			continue
+		}
+
+		job, err := p.newJob(id, attrs)
+		if err != nil {
+			continue
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
+func (cli *Client) GetJob(name string, id int) (cups.Job, error) {
+	p, ok := cli.printers[name]
+	if !ok {
+		return cups.Job{}, fmt.Errorf("unknown printer %q", name)
+	}
+
+	req := p.newRequest(ipp.OperationGetJobAttributes)
+	req.OperationAttributes[ipp.AttributeJobID] = id
+	req.OperationAttributes[ipp.AttributeRequestedAttributes] = ipp.DefaultJobAttributes
+
+	res, err := p.send(req, nil)
+	if err != nil {
+		return cups.Job{}, err
+	}
+
+	if len(res.JobAttributes) == 0 {
+		return cups.Job{}, fmt.Errorf("printer did not return job attributes")
+	}
+
+	return p.newJob(id, res.JobAttributes[0])
+}
+
+func (cli *Client) Print(doc ipp.Document, name string, attrs map[string]any) (int, error) {
+	p, ok := cli.printers[name]
+	if !ok {
+		return -1, fmt.Errorf("unknown printer %q", name)
+	}
+
+	if err := p.checkFormat(doc.MimeType); err != nil {
+		return -1, err
+	}
+
+	req := p.newRequest(ipp.OperationPrintJob)
+	req.OperationAttributes[ipp.AttributeJobName] = doc.Name
+	req.OperationAttributes[ipp.AttributeDocumentFormat] = doc.MimeType
+
+	var operationID string
+	for key, value := range attrs {
+		switch key {
+		case cups.AttributeLongRunningOperationID:
+			// not supported by printers, keep track ourself
+			operationID, _ = value.(string)
+
+		case ipp.AttributeRequestingUserName:
+			req.OperationAttributes[key] = value
+
+		default:
+			req.JobAttributes[key] = value
+		}
+	}
+
+	req.File = doc.Document
+	req.FileSize = doc.Size
+
+	res, err := p.send(req, nil)
+	if err != nil {
+		return -1, err
+	}
+
+	if len(res.JobAttributes) == 0 {
+		return -1, fmt.Errorf("printer did not return a job id")
+	}
+
+	id, err := getJobID(res.JobAttributes[0])
+	if err != nil {
+		return -1, err
+	}
+
+	if operationID != "" {
+		p.rememberOperation(id, operationID)
+	}
+
+	return id, nil
+}
+
+// ValidateJob uses the IPP Validate-Job operation to check if the printer
+// would accept a document of the given MIME type using attrs.
+func (cli *Client) ValidateJob(name string, mimeType string, attrs map[string]any) error {
+	p, ok := cli.printers[name]
+	if !ok {
+		return fmt.Errorf("unknown printer %q", name)
+	}
+
+	if err := p.checkFormat(mimeType); err != nil {
+		return err
+	}
+
+	req := p.newRequest(ipp.OperationValidateJob)
+	req.OperationAttributes[ipp.AttributeDocumentFormat] = mimeType
+
+	for key, value := range attrs {
+		switch key {
+		case cups.AttributeLongRunningOperationID:
+		case ipp.AttributeRequestingUserName:
+			req.OperationAttributes[key] = value
+		default:
+			req.JobAttributes[key] = value
+		}
+	}
+
+	_, err := p.send(req, nil)
+
+	return err
+}
+
+// checkFormat makes sure the printer supports the document format. Printers
+// that do not report supported formats will reject the job if required.
+func (p *printer) checkFormat(mimeType string) error {
+	_, formats, err := p.getPrinter()
+	if err != nil {
+		return fmt.Errorf("failed to get printer attributes: %w", err)
+	}
+
+	if len(formats) > 0 && !slices.Contains(formats, mimeType) && !slices.Contains(formats, ipp.MimeTypeOctetStream) {
+		return fmt.Errorf("printer %q does not support document format %q (supported: %s)", p.Name, mimeType, strings.Join(formats, ", "))
+	}
+
+	return nil
+}
+
+// getPrinter returns the printer and the list of supported document formats.
+func (p *printer) getPrinter() (cups.Printer, []string, error) {
+	req := p.newRequest(ipp.OperationGetPrinterAttributes)
+	req.OperationAttributes[ipp.AttributeRequestedAttributes] = printerAttributes
+
+	res, err := p.send(req, nil)
+	if err != nil {
+		return cups.Printer{}, nil, err
+	}
+
+	if len(res.PrinterAttributes) == 0 {
+		return cups.Printer{}, nil, fmt.Errorf("printer did not return any attributes")
+	}
+
+	attrs := res.PrinterAttributes[0]
+
+	printer, err := cups.ParsePrinterAttributes(p.Name, attrs)
+	if err != nil {
+		return printer, nil, err
+	}
+	printer.URI = p.uri
+
+	var formats []string
+	for _, attr := range attrs[AttributeDocumentFormatSupported] {
+		if s, ok := attr.Value.(string); ok {
+			formats = append(formats, s)
+		}
+	}
+
+	return printer, formats, nil
+}
+
+func (p *printer) newJob(id int, attrs ipp.Attributes) (cups.Job, error) {
+	job, err := cups.ParseJobAttributes(id, attrs)
+	if err != nil {
+		return job, err
+	}
+
+	job.PrinterName = p.Name
+	job.PrinterURI = p.uri
+
+	p.l.Lock()
+	job.OperationID = p.operations[id]
+	p.l.Unlock()
+
+	return job, nil
+}
+
+// rememberOperation stores the operation ID of the job id and forgets the
+// oldest one once more than maxOperations are stored.
+func (p *printer) rememberOperation(id int, operationID string) {
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	p.operations[id] = operationID
+	p.submitted = append(p.submitted, id)
+
+	if len(p.submitted) > maxOperations {
+		delete(p.operations, p.submitted[0])
+		p.submitted = p.submitted[1:]
+	}
+}
+
+func (p *printer) newRequest(op int16) *ipp.Request {
+	req := ipp.NewRequest(op, 1)
+	req.OperationAttributes[ipp.AttributePrinterURI] = p.uri
+	req.OperationAttributes[ipp.AttributeRequestingUserName] = p.Username
+
+	if p.Username == "" {
+		req.OperationAttributes[ipp.AttributeRequestingUserName] = "print-service"
+	}
+
+	return req
+}
+
+// send sends req to the printer. Other than ipp.HttpAdapter, successful
+// status codes like successful-ok-ignored-or-substituted-attributes are not
+// treated as errors.
+func (p *printer) send(req *ipp.Request, data io.Writer) (*ipp.Response, error) {
+	payload, err := req.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	size := len(payload)
+	var body io.Reader = bytes.NewReader(payload)
+
+	if req.File != nil && req.FileSize != -1 {
+		size += req.FileSize
+		body = io.MultiReader(body, req.File)
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, p.httpURL, body)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq.ContentLength = int64(size)
+	httpReq.Header.Set("Content-Type", ipp.ContentTypeIPP)
+
+	if p.Username != "" && p.Password != "" {
+		httpReq.SetBasicAuth(p.Username, p.Password)
+	}
+
+	httpRes, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpRes.Body.Close()
+
+	if httpRes.StatusCode != http.StatusOK {
+		return nil, ipp.HTTPError{
+			Code: httpRes.StatusCode,
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if _, err := io.Copy(buf, httpRes.Body); err != nil {
+		return nil, fmt.Errorf("unable to buffer response: %w", err)
+	}
+
+	res, err := ipp.NewResponseDecoder(buf).Decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// status codes below 0x0100 are successful
+	if res.StatusCode >= 0x0100 {
+		return nil, res.CheckForErrors()
+	}
+
+	return res, nil
+}
+
+func getJobID(attrs ipp.Attributes) (int, error) {
+	values := attrs[ipp.AttributeJobID]
+	if len(values) == 0 {
+		return 0, fmt.Errorf("missing job-id")
+	}
+
+	id, ok := values[0].Value.(int)
+	if !ok {
+		return 0, fmt.Errorf("unexpected job-id value %T", values[0].Value)
+	}
+
+	return id, nil
+}
+
+func init() {
+	ipp.AttributeTagMapping[AttributeDocumentFormatSupported] = ipp.TagMimeType
+}
@@ -0,0 +1,65 @@
+package ippdirect
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestNewClientURI(t *testing.T) {
+	cases := []struct {
+		uri     string
+		ippURI  string
+		httpURL string
+	}{
+		{"ipp://printer/ipp/print", "ipp://printer/ipp/print", "http://printer:631/ipp/print"},
+		{"ipps://printer/ipp/print", "ipps://printer/ipp/print", "https://printer:631/ipp/print"},
+		{"ipps://printer:8443/ipp/print", "ipps://printer:8443/ipp/print", "https://printer:8443/ipp/print"},
+		{"https://printer/ipp/print", "ipps://printer/ipp/print", "https://printer:443/ipp/print"},
+		{"http://printer/ipp/print", "ipp://printer/ipp/print", "http://printer:80/ipp/print"},
+		{"http://printer:631/ipp/print", "ipp://printer:631/ipp/print", "http://printer:631/ipp/print"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.uri, func(t *testing.T) {
+			cli, err := NewClient([]PrinterConfig{{Name: "p", URI: c.uri}})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			p := cli.printers["p"]
+
+			if p.uri != c.ippURI {
+				t.Errorf("expected URI %q, got %q", c.ippURI, p.uri)
+			}
+
+			if p.httpURL != c.httpURL {
+				t.Errorf("expected HTTP URL %q, got %q", c.httpURL, p.httpURL)
+			}
+		})
+	}
+}
+
+func TestRememberOperation(t *testing.T) {
+	cli, err := NewClient([]PrinterConfig{{Name: "p", URI: "ipp://printer/ipp/print"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := cli.printers["p"]
+
+	for id := 1; id <= maxOperations+10; id++ {
+		p.rememberOperation(id, fmt.Sprintf("op-%d", id))
+	}
+
+	if len(p.operations) != maxOperations || len(p.submitted) != maxOperations {
+		t.Fatalf("expected %d operations, got %d", maxOperations, len(p.operations))
+	}
+
+	if _, ok := p.operations[10]; ok {
+		t.Errorf("expected the operation of job 10 to be forgotten")
+	}
+
+	if op := p.operations[maxOperations+10]; op != fmt.Sprintf("op-%d", maxOperations+10) {
+		t.Errorf("expected the operation of the last job to be kept, got %q", op)
+	}
+}
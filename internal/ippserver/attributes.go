@@ -0,0 +1,232 @@
+package ippserver
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/phin1x/go-ipp"
+	"github.com/tierklinik-dobersberg/print-service/internal/cups"
+)
+
+const (
+	AttributeCharsetConfigured                 = "charset-configured"                   // ipp.TagCharset
+	AttributeCharsetSupported                  = "charset-supported"                    // ipp.TagCharset
+	AttributeCompressionSupported              = "compression-supported"                // ipp.TagKeyword
+	AttributeCopiesDefault                     = "copies-default"                       // ipp.TagInteger
+	AttributeDocumentFormatDefault             = "document-format-default"              // ipp.TagMimeType
+	AttributeDocumentFormatSupported           = "document-format-supported"            // ipp.TagMimeType
+	AttributeGeneratedNaturalLanguageSupported = "generated-natural-language-supported" // ipp.TagLanguage
+	AttributeIPPVersionsSupported              = "ipp-versions-supported"               // ipp.TagKeyword
+	AttributeJobStateReasons                   = "job-state-reasons"                    // ipp.TagKeyword
+	AttributeNaturalLanguageConfigured         = "natural-language-configured"          // ipp.TagLanguage
+	AttributeOperationsSupported               = "operations-supported"                 // ipp.TagEnum
+	AttributePDLOverrideSupported              = "pdl-override-supported"               // ipp.TagKeyword
+	AttributePrinterUpTime                     = "printer-up-time"                      // ipp.TagInteger
+	AttributeSidesDefault                      = "sides-default"                        // ipp.TagKeyword
+	AttributeSidesSupported                    = "sides-supported"                      // ipp.TagKeyword
+	AttributeURIAuthenticationSupported        = "uri-authentication-supported"         // ipp.TagKeyword
+	AttributeURISecuritySupported              = "uri-security-supported"               // ipp.TagKeyword
+)
+
+// orientationLandscape is the orientation-requested enum value for
+// landscape.
+const orientationLandscape = 4
+
+// supportedFormats lists the document formats accepted by the print
+// pipeline. Everything else is passed through as is.
+var supportedFormats = []string{
+	ipp.MimeTypeOctetStream,
+	"application/pdf",
+	ipp.MimeTypePostscript,
+	"text/plain",
+	"text/html",
+	"image/jpeg",
+	"image/png",
+}
+
+func isSupportedFormat(format string) bool {
+	// strip parameters like charset
+	format, _, _ = strings.Cut(format, ";")
+
+	for _, f := range supportedFormats {
+		if strings.EqualFold(f, strings.TrimSpace(format)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// printerURI returns the URI of the queue as seen by the client.
+func printerURI(r *http.Request, queue string) string {
+	scheme := "ipp"
+	if r.TLS != nil {
+		scheme = "ipps"
+	}
+
+	return fmt.Sprintf("%s://%s%s%s", scheme, r.Host, PathPrefix, queue)
+}
+
+func (srv *Server) getPrinterAttributes(r *http.Request, req *ipp.Request, q queue) *ipp.Response {
+	var printer cups.Printer
+
+	printers, err := srv.svc.Printers()
+	if err != nil {
+		return errorResponse(req, statusFromError(err), err)
+	}
+
+	for _, p := range printers {
+		if p.Name == q.Printer {
+			printer = p
+			break
+		}
+	}
+
+	info := q.Description
+	if info == "" {
+		info = srv.cfg.Name
+	}
+	if info == "" {
+		info = q.Name
+	}
+
+	state := ipp.PrinterStateIdle
+	switch printer.State {
+	case cups.PrinterStateProcessing:
+		state = ipp.PrinterStateProcessing
+	case cups.PrinterStateStopped:
+		state = ipp.PrinterStateStopped
+	}
+
+	reason := printer.StateReason
+	if reason == "" {
+		reason = "none"
+	}
+
+	queued := 0
+	if jobs, err := srv.svc.Jobs(q.Printer); err == nil {
+		for _, j := range jobs {
+			switch j.State {
+			case cups.JobStatePending, cups.JobStateHeld, cups.JobStateProcessing:
+				queued++
+			}
+		}
+	}
+
+	authentication := "none"
+	if srv.cfg.AllowAnonymous && srv.cfg.TrustRequestingUserName {
+		authentication = "requesting-user-name"
+	}
+
+	sidesDefault := string(cups.SidesOneSided)
+	if q.opts.Sides != "" {
+		sidesDefault = string(q.opts.Sides)
+	}
+
+	copiesDefault := 1
+	if q.opts.Copies > 0 {
+		copiesDefault = q.opts.Copies
+	}
+
+	attrs := ipp.Attributes{
+		ipp.AttributePrinterUriSupported:    {{Value: printerURI(r, q.Name)}},
+		AttributeURISecuritySupported:       {{Value: "none"}},
+		AttributeURIAuthenticationSupported: {{Value: authentication}},
+		ipp.AttributePrinterName:            {{Value: q.Name}},
+		ipp.AttributePrinterInfo:            {{Value: info}},
+		ipp.AttributePrinterLocation:        {{Value: printer.Location}},
+		ipp.AttributePrinterMakeAndModel:    {{Value: printer.Model}},
+		ipp.AttributePrinterState:           {{Value: int(state)}},
+		ipp.AttributePrinterStateReasons:    {{Value: reason}},
+		ipp.AttributePrinterIsAcceptingJobs: {{Value: true}},
+		cups.AttributeQueuedJobCount:        {{Value: queued}},
+		AttributePrinterUpTime:              {{Value: int(time.Since(srv.startedAt).Seconds())}},
+		AttributeIPPVersionsSupported:       {{Value: []string{"1.1", "2.0"}}},
+		AttributeOperationsSupported: {{Value: []int{
+			int(ipp.OperationPrintJob),
+			int(ipp.OperationValidateJob),
+			int(ipp.OperationGetJobs),
+			int(ipp.OperationGetPrinterAttributes),
+		}}},
+		AttributeCharsetConfigured:                 {{Value: ipp.Charset}},
+		AttributeCharsetSupported:                  {{Value: ipp.Charset}},
+		AttributeNaturalLanguageConfigured:         {{Value: strings.ToLower(ipp.CharsetLanguage)}},
+		AttributeGeneratedNaturalLanguageSupported: {{Value: strings.ToLower(ipp.CharsetLanguage)}},
+		AttributeDocumentFormatDefault:             {{Value: ipp.MimeTypeOctetStream}},
+		AttributeDocumentFormatSupported:           {{Value: supportedFormats}},
+		AttributePDLOverrideSupported:              {{Value: "not-attempted"}},
+		AttributeCompressionSupported:              {{Value: "none"}},
+		AttributeCopiesDefault:                     {{Value: copiesDefault}},
+		AttributeSidesDefault:                      {{Value: sidesDefault}},
+		AttributeSidesSupported: {{Value: []string{
+			string(cups.SidesOneSided),
+			string(cups.SidesTwoSidedLongEdge),
+			string(cups.SidesTwoSidedShortEdge),
+		}}},
+	}
+
+	res := ipp.NewResponse(ipp.StatusOk, req.RequestId)
+	res.PrinterAttributes = append(res.PrinterAttributes, attrs)
+
+	return res
+}
+
+func jobAttributes(r *http.Request, q queue, j cups.Job) ipp.Attributes {
+	state := ipp.JobStatePending
+	switch j.State {
+	case cups.JobStateHeld:
+		state = ipp.JobStateHeld
+	case cups.JobStateProcessing:
+		state = ipp.JobStateProcessing
+	case cups.JobStateStopped:
+		state = ipp.JobStateStopped
+	case cups.JobStateCanceled:
+		state = ipp.JobStateCanceled
+	case cups.JobStateAborted:
+		state = ipp.JobStateAborted
+	case cups.JobStateComplete:
+		state = ipp.JobStateCompleted
+	}
+
+	attrs := ipp.Attributes{
+		ipp.AttributeJobID:         {{Value: j.ID}},
+		ipp.AttributeJobURI:        {{Value: fmt.Sprintf("%s/%d", printerURI(r, q.Name), j.ID)}},
+		ipp.AttributeJobPrinterURI: {{Value: printerURI(r, q.Name)}},
+		ipp.AttributeJobName:       {{Value: j.Name}},
+		ipp.AttributeJobState:      {{Value: int(state)}},
+		AttributeJobStateReasons:   {{Value: "none"}},
+	}
+
+	if j.OperationID != "" {
+		attrs[cups.AttributeLongRunningOperationID] = []ipp.Attribute{{Value: j.OperationID}}
+	}
+
+	return attrs
+}
+
+func init() {
+	ipp.AttributeTagMapping[AttributeCharsetConfigured] = ipp.TagCharset
+	ipp.AttributeTagMapping[AttributeCharsetSupported] = ipp.TagCharset
+	ipp.AttributeTagMapping[AttributeCompressionSupported] = ipp.TagKeyword
+	ipp.AttributeTagMapping[AttributeCopiesDefault] = ipp.TagInteger
+	ipp.AttributeTagMapping[AttributeDocumentFormatDefault] = ipp.TagMimeType
+	ipp.AttributeTagMapping[AttributeDocumentFormatSupported] = ipp.TagMimeType
+	ipp.AttributeTagMapping[AttributeGeneratedNaturalLanguageSupported] = ipp.TagLanguage
+	ipp.AttributeTagMapping[AttributeIPPVersionsSupported] = ipp.TagKeyword
+	ipp.AttributeTagMapping[AttributeJobStateReasons] = ipp.TagKeyword
+	ipp.AttributeTagMapping[AttributeNaturalLanguageConfigured] = ipp.TagLanguage
+	ipp.AttributeTagMapping[AttributeOperationsSupported] = ipp.TagEnum
+	ipp.AttributeTagMapping[AttributePDLOverrideSupported] = ipp.TagKeyword
+	ipp.AttributeTagMapping[AttributePrinterUpTime] = ipp.TagInteger
+	ipp.AttributeTagMapping[AttributeSidesDefault] = ipp.TagKeyword
+	ipp.AttributeTagMapping[AttributeSidesSupported] = ipp.TagKeyword
+	ipp.AttributeTagMapping[AttributeURIAuthenticationSupported] = ipp.TagKeyword
+	ipp.AttributeTagMapping[AttributeURISecuritySupported] = ipp.TagKeyword
+
+	// the following attributes are used in responses but are not mapped by
+	// go-ipp
+	ipp.AttributeTagMapping[ipp.AttributePrinterUriSupported] = ipp.TagUri
+	ipp.AttributeTagMapping[ipp.AttributePrinterMakeAndModel] = ipp.TagText
+}
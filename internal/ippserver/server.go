@@ -0,0 +1,387 @@
+package ippserver
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/phin1x/go-ipp"
+	v1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/printing/v1"
+	"github.com/tierklinik-dobersberg/apis/pkg/auth"
+	"github.com/tierklinik-dobersberg/print-service/internal/config"
+	"github.com/tierklinik-dobersberg/print-service/internal/cups"
+	"github.com/tierklinik-dobersberg/print-service/internal/service"
+)
+
+// PathPrefix is the HTTP path prefix of the IPP endpoint. The queue name
+// follows the prefix.
+const PathPrefix = "/ipp/print/"
+
+// Server implements a minimal IPP printer for each configured queue. Jobs
+// are submitted through the normal print pipeline of the service.
+type Server struct {
+	cfg       config.IPPServer
+	svc       *service.Service
+	spoolDir  string
+	startedAt time.Time
+}
+
+type queue struct {
+	config.IPPQueue
+
+	opts service.PrintOptions
+}
+
+// New creates a new IPP server. Documents received are spooled to
+// spoolDir before they are printed.
+func New(cfg config.IPPServer, spoolDir string, svc *service.Service) *Server {
+	return &Server{
+		cfg:       cfg,
+		svc:       svc,
+		spoolDir:  spoolDir,
+		startedAt: time.Now(),
+	}
+}
+
+func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if ct := r.Header.Get("Content-Type"); ct != ipp.ContentTypeIPP {
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	spool, err := os.CreateTemp(srv.spoolDir, "ipp-*")
+	if err != nil {
+		slog.Error("failed to create IPP spool file", "error", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}()
+
+	srv.svc.LimitRequestBody(w, r)
+
+	req, err := ipp.NewRequestDecoder(bufio.NewReader(r.Body)).Decode(spool)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid IPP request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	res := srv.handle(r, req, spool)
+
+	payload, err := res.Encode()
+	if err != nil {
+		slog.Error("failed to encode IPP response", "operation", req.Operation, "error", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ipp.ContentTypeIPP)
+	w.WriteHeader(http.StatusOK)
+	w.Write(payload)
+}
+
+func (srv *Server) handle(r *http.Request, req *ipp.Request, spool *os.File) *ipp.Response {
+	q, err := srv.getQueue(strings.TrimPrefix(r.URL.Path, PathPrefix))
+	if err != nil {
+		return errorResponse(req, ipp.StatusErrorNotFound, err)
+	}
+
+	switch req.Operation {
+	case ipp.OperationGetPrinterAttributes:
+		return srv.getPrinterAttributes(r, req, q)
+
+	case ipp.OperationGetJobs:
+		return srv.getJobs(r, req, q)
+
+	case ipp.OperationValidateJob:
+		return srv.validateJob(r, req, q)
+
+	case ipp.OperationPrintJob:
+		return srv.printJob(r, req, q, spool)
+
+	default:
+		return errorResponse(req, ipp.StatusErrorOperationNotSupported, fmt.Errorf("operation 0x%04x is not supported", req.Operation))
+	}
+}
+
+func (srv *Server) getQueue(name string) (queue, error) {
+	if name == "" {
+		return queue{}, fmt.Errorf("missing queue name")
+	}
+
+	var (
+		q     queue
+		found bool
+	)
+
+	if len(srv.cfg.Queues) == 0 {
+		printers, err := srv.svc.Printers()
+		if err != nil {
+			return q, err
+		}
+
+		for _, p := range printers {
+			if p.Name == name {
+				q.Name = p.Name
+				q.Printer = p.Name
+				q.Description = p.Info
+				found = true
+				break
+			}
+		}
+	} else {
+		for _, cfg := range srv.cfg.Queues {
+			if cfg.Name == name {
+				q.IPPQueue = cfg
+				found = true
+				break
+			}
+		}
+	}
+
+	if !found {
+		return q, fmt.Errorf("unknown queue %q", name)
+	}
+
+	values := make(url.Values)
+	for key, value := range q.Options {
+		values.Set(key, value)
+	}
+
+	var err error
+	q.opts, err = service.ParsePrintOptions(values)
+	if err != nil {
+		return q, fmt.Errorf("queue %q: %w", name, err)
+	}
+
+	return q, nil
+}
+
+// anonymousUser is the username of unauthenticated IPP clients.
+const anonymousUser = "anonymous"
+
+func (srv *Server) getUser(r *http.Request, req *ipp.Request) (*auth.RemoteUser, error) {
+	if r.Header.Get("X-Remote-User-ID") != "" || !srv.cfg.AllowAnonymous {
+		return srv.svc.UserFromHeader(r.Context(), r.Header)
+	}
+
+	username := anonymousUser
+	if srv.cfg.TrustRequestingUserName {
+		if name := getString(req.OperationAttributes, ipp.AttributeRequestingUserName); name != "" {
+			username = name
+		}
+	}
+
+	return &auth.RemoteUser{
+		Username: username,
+	}, nil
+}
+
+// jobRequest returns the document and print options requested by the
+// Print-Job or Validate-Job request req. If the request is not supported,
+// the IPP status code to respond with is returned together with the error.
+func jobRequest(req *ipp.Request, q queue) (*v1.Document, service.PrintOptions, int16, error) {
+	format := getString(req.OperationAttributes, ipp.AttributeDocumentFormat)
+	if format != "" && !isSupportedFormat(format) {
+		return nil, q.opts, ipp.StatusErrorDocumentFormatNotSupported, fmt.Errorf("document format %q is not supported", format)
+	}
+
+	// let the service sniff the content type
+	if format == ipp.MimeTypeOctetStream {
+		format = ""
+	}
+
+	name := getString(req.OperationAttributes, ipp.AttributeJobName)
+	if name == "" {
+		name = getString(req.OperationAttributes, ipp.AttributeDocumentName)
+	}
+	if name == "" {
+		name = "ipp-job"
+	}
+
+	opts := q.opts
+	if copies, ok := req.JobAttributes[ipp.AttributeCopies].(int); ok && copies > 0 {
+		opts.Copies = copies
+	}
+
+	if sides, ok := req.JobAttributes[cups.AttributeSides].(string); ok && sides != "" {
+		switch sides := cups.Sides(sides); sides {
+		case cups.SidesOneSided, cups.SidesTwoSidedLongEdge, cups.SidesTwoSidedShortEdge:
+			opts.Sides = sides
+		default:
+			return nil, q.opts, ipp.StatusErrorAttributesOrValues, fmt.Errorf("sides value %q is not supported", sides)
+		}
+	}
+
+	if orientation, ok := req.JobAttributes[ipp.AttributeOrientationRequested].(int); ok && orientation == orientationLandscape {
+		opts.Orientation = v1.Orientation_ORIENTATION_LANDSCAPE
+	}
+
+	return &v1.Document{
+		Name:        name,
+		ContentType: format,
+		Printer:     q.Printer,
+		Orientation: opts.Orientation,
+	}, opts, ipp.StatusOk, nil
+}
+
+func (srv *Server) validateJob(r *http.Request, req *ipp.Request, q queue) *ipp.Response {
+	user, err := srv.getUser(r, req)
+	if err != nil {
+		return errorResponse(req, ipp.StatusErrorNotAuthenticated, err)
+	}
+
+	doc, opts, status, err := jobRequest(req, q)
+	if err != nil {
+		return errorResponse(req, status, err)
+	}
+
+	report := srv.svc.ValidateJob(r.Context(), user, doc, opts)
+	for _, p := range report.Problems {
+		if p.Severity == service.SeverityError {
+			return errorResponse(req, validationStatus(p), errors.New(p.Message))
+		}
+	}
+
+	return ipp.NewResponse(ipp.StatusOk, req.RequestId)
+}
+
+func (srv *Server) printJob(r *http.Request, req *ipp.Request, q queue, spool *os.File) *ipp.Response {
+	user, err := srv.getUser(r, req)
+	if err != nil {
+		return errorResponse(req, ipp.StatusErrorNotAuthenticated, err)
+	}
+
+	doc, opts, status, err := jobRequest(req, q)
+	if err != nil {
+		return errorResponse(req, status, err)
+	}
+
+	stat, err := spool.Stat()
+	if err != nil {
+		return errorResponse(req, ipp.StatusErrorInternal, err)
+	}
+
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return errorResponse(req, ipp.StatusErrorInternal, err)
+	}
+
+	operation, err := srv.svc.PrintContent(r.Context(), user, doc, opts, spool, stat.Size(), nil)
+	if err != nil {
+		slog.Error("failed to print IPP job", "queue", q.Name, "error", err)
+		return errorResponse(req, statusFromError(err), err)
+	}
+
+	// the job-id is the one assigned by the printer so it matches the
+	// jobs reported by Get-Jobs.
+	_, jobID := operation.Job()
+
+	res := ipp.NewResponse(ipp.StatusOk, req.RequestId)
+	res.JobAttributes = append(res.JobAttributes, ipp.Attributes{
+		ipp.AttributeJobID:                   {{Value: jobID}},
+		ipp.AttributeJobURI:                  {{Value: fmt.Sprintf("%s/%d", printerURI(r, q.Name), jobID)}},
+		ipp.AttributeJobState:                {{Value: int(ipp.JobStatePending)}},
+		AttributeJobStateReasons:             {{Value: "none"}},
+		cups.AttributeLongRunningOperationID: {{Value: operation.ID()}},
+	})
+
+	return res
+}
+
+func (srv *Server) getJobs(r *http.Request, req *ipp.Request, q queue) *ipp.Response {
+	user, err := srv.getUser(r, req)
+	if err != nil {
+		return errorResponse(req, ipp.StatusErrorNotAuthenticated, err)
+	}
+
+	jobs, err := srv.svc.UserJobs(r.Context(), user, q.Printer)
+	if err != nil {
+		return errorResponse(req, statusFromError(err), err)
+	}
+
+	which := getString(req.OperationAttributes, ipp.AttributeWhichJobs)
+	if which == "" {
+		which = "not-completed"
+	}
+
+	res := ipp.NewResponse(ipp.StatusOk, req.RequestId)
+	for _, j := range jobs {
+		completed := j.State == cups.JobStateCanceled || j.State == cups.JobStateAborted || j.State == cups.JobStateComplete
+
+		if (which == "completed" && !completed) || (which == "not-completed" && completed) {
+			continue
+		}
+
+		res.JobAttributes = append(res.JobAttributes, jobAttributes(r, q, j))
+	}
+
+	return res
+}
+
+func statusFromError(err error) int16 {
+	var cerr *connect.Error
+	if !errors.As(err, &cerr) {
+		return ipp.StatusErrorInternal
+	}
+
+	switch cerr.Code() {
+	case connect.CodeInvalidArgument:
+		return ipp.StatusErrorBadRequest
+	case connect.CodeUnauthenticated:
+		return ipp.StatusErrorNotAuthenticated
+	case connect.CodePermissionDenied:
+		return ipp.StatusErrorForbidden
+	case connect.CodeNotFound:
+		return ipp.StatusErrorNotFound
+	case connect.CodeUnavailable:
+		return ipp.StatusErrorServiceUnavailable
+	default:
+		return ipp.StatusErrorInternal
+	}
+}
+
+// validationStatus returns the IPP status code for the validation problem
+// p.
+func validationStatus(p service.Problem) int16 {
+	switch p.Check {
+	case service.CheckOptions:
+		return ipp.StatusErrorBadRequest
+	case service.CheckConversion:
+		return ipp.StatusErrorDocumentFormatNotSupported
+	case service.CheckPrinter:
+		return ipp.StatusErrorForbidden
+	case service.CheckQuota:
+		return ipp.StatusErrorAccountLimitReached
+	case service.CheckCapabilities:
+		return ipp.StatusErrorAttributesOrValues
+	default:
+		return ipp.StatusErrorNotPossible
+	}
+}
+
+func errorResponse(req *ipp.Request, status int16, err error) *ipp.Response {
+	res := ipp.NewResponse(status, req.RequestId)
+	res.OperationAttributes[ipp.AttributeStatusMessage] = []ipp.Attribute{{Value: err.Error()}}
+
+	return res
+}
+
+func getString(attrs map[string]any, name string) string {
+	s, _ := attrs[name].(string)
+	return s
+}
@@ -0,0 +1,79 @@
+package ippserver
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/phin1x/go-ipp"
+	"github.com/tierklinik-dobersberg/print-service/internal/config"
+	"github.com/tierklinik-dobersberg/print-service/internal/cups"
+)
+
+func TestGetUserAnonymous(t *testing.T) {
+	cases := []struct {
+		name  string
+		cfg   config.IPPServer
+		want  string
+		valid bool
+	}{
+		{"disabled", config.IPPServer{}, "", false},
+		{"anonymous", config.IPPServer{AllowAnonymous: true}, anonymousUser, true},
+		{"trusted", config.IPPServer{AllowAnonymous: true, TrustRequestingUserName: true}, "alice", true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			srv := &Server{cfg: c.cfg}
+
+			req := ipp.NewRequest(ipp.OperationPrintJob, 1)
+			req.OperationAttributes[ipp.AttributeRequestingUserName] = "alice"
+
+			user, err := srv.getUser(httptest.NewRequest("POST", PathPrefix+"queue", nil), req)
+			if !c.valid {
+				if err == nil {
+					t.Fatalf("expected an error, got user %q", user.Username)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if user.Username != c.want {
+				t.Errorf("expected user %q, got %q", c.want, user.Username)
+			}
+		})
+	}
+}
+
+func TestJobRequestSides(t *testing.T) {
+	cases := []struct {
+		sides  string
+		want   cups.Sides
+		status int16
+	}{
+		{"", "", ipp.StatusOk},
+		{"one-sided", cups.SidesOneSided, ipp.StatusOk},
+		{"two-sided-long-edge", cups.SidesTwoSidedLongEdge, ipp.StatusOk},
+		{"two-sided-short-edge", cups.SidesTwoSidedShortEdge, ipp.StatusOk},
+		{"three-sided", "", ipp.StatusErrorAttributesOrValues},
+	}
+
+	for _, c := range cases {
+		t.Run(c.sides, func(t *testing.T) {
+			req := ipp.NewRequest(ipp.OperationPrintJob, 1)
+			req.JobAttributes[cups.AttributeSides] = c.sides
+
+			_, opts, status, err := jobRequest(req, queue{})
+			if status != c.status {
+				t.Fatalf("expected status %#x, got %#x (%v)", c.status, status, err)
+			}
+
+			if opts.Sides != c.want {
+				t.Errorf("expected sides %q, got %q", c.want, opts.Sides)
+			}
+		})
+	}
+}
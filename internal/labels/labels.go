@@ -0,0 +1,364 @@
+package labels
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// FieldType defines how the value of a label field is rendered.
+type FieldType string
+
+const (
+	FieldText       = FieldType("text")
+	FieldCode128    = FieldType("code128")
+	FieldQR         = FieldType("qr")
+	FieldDataMatrix = FieldType("datamatrix")
+	FieldDate       = FieldType("date")
+)
+
+const (
+	defaultFontHeight = 30
+	defaultBarHeight  = 80
+	defaultModule     = 2
+	defaultDateFormat = "02.01.2006"
+
+	// MaxQuantity is the maximum number of labels that can be printed with
+	// a single request.
+	MaxQuantity = 1000
+)
+
+// dateLayouts are accepted as input values for date fields.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"02.01.2006",
+}
+
+// Config configures the label subsystem.
+type Config struct {
+	// Printer is the default label printer used for all templates that do
+	// not specify their own printer.
+	Printer string `json:"printer"`
+
+	// Templates holds all label templates.
+	Templates []Template `json:"templates"`
+}
+
+// Template describes a label and its fields.
+type Template struct {
+	// Name is the unique name of the template.
+	Name string `json:"name"`
+
+	// Description is an optional human readable description.
+	Description string `json:"description"`
+
+	// Printer overwrites the default label printer.
+	Printer string `json:"printer"`
+
+	// Width and Height are the label dimensions in dots.
+	Width  int `json:"width"`
+	Height int `json:"height"`
+
+	// Fields holds the fields of the label.
+	Fields []Field `json:"fields"`
+}
+
+// Field is a single element on a label.
+type Field struct {
+	// Name is used to assign a value to the field. Fields without a name
+	// must have a static Value.
+	Name string `json:"name"`
+
+	// Type defines how the field is rendered.
+	Type FieldType `json:"type"`
+
+	// X and Y hold the position of the top-left corner in dots.
+	X int `json:"x"`
+	Y int `json:"y"`
+
+	// Value holds a static value. If set, the value cannot be changed when
+	// printing the label.
+	Value string `json:"value"`
+
+	// Default is used if no value is provided.
+	Default string `json:"default"`
+
+	// Required marks the field as required.
+	Required bool `json:"required"`
+
+	// MaxLength limits the number of characters of the value.
+	MaxLength int `json:"maxLength"`
+
+	// FontHeight is the height of text and date fields in dots.
+	FontHeight int `json:"fontHeight"`
+
+	// BarHeight is the height of Code128 barcodes in dots.
+	BarHeight int `json:"barHeight"`
+
+	// Module is the width of the narrowest bar or the size of a 2D barcode
+	// module in dots.
+	Module int `json:"module"`
+
+	// Format holds the Go time layout used to render date fields.
+	Format string `json:"format"`
+}
+
+// ValidationError is returned if field values are invalid.
+type ValidationError struct {
+	Fields map[string]string
+}
+
+func (v *ValidationError) Error() string {
+	names := make([]string, 0, len(v.Fields))
+	for name := range v.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	msgs := make([]string, len(names))
+	for idx, name := range names {
+		msgs[idx] = fmt.Sprintf("%s: %s", name, v.Fields[name])
+	}
+
+	return "invalid label fields: " + strings.Join(msgs, "; ")
+}
+
+// Registry holds all label templates.
+type Registry struct {
+	printer   string
+	templates map[string]*Template
+}
+
+// NewRegistry creates a new registry from cfg and validates all template
+// definitions.
+func NewRegistry(cfg Config) (*Registry, error) {
+	r := &Registry{
+		printer:   cfg.Printer,
+		templates: make(map[string]*Template, len(cfg.Templates)),
+	}
+
+	for idx := range cfg.Templates {
+		t := cfg.Templates[idx]
+
+		if t.Name == "" {
+			return nil, fmt.Errorf("label template #%d: missing name", idx)
+		}
+
+		if _, ok := r.templates[t.Name]; ok {
+			return nil, fmt.Errorf("label template %q: duplicate name", t.Name)
+		}
+
+		if t.Width <= 0 || t.Height <= 0 {
+			return nil, fmt.Errorf("label template %q: invalid dimensions", t.Name)
+		}
+
+		seen := make(map[string]struct{})
+		for fidx := range t.Fields {
+			f := &t.Fields[fidx]
+
+			if err := f.setDefaults(); err != nil {
+				return nil, fmt.Errorf("label template %q: field #%d: %w", t.Name, fidx, err)
+			}
+
+			if f.Name == "" {
+				if f.Value == "" {
+					return nil, fmt.Errorf("label template %q: field #%d: either name or value must be set", t.Name, fidx)
+				}
+
+				if _, err := f.resolve(f.Value); err != nil {
+					return nil, fmt.Errorf("label template %q: field #%d: %w", t.Name, fidx, err)
+				}
+
+				continue
+			}
+
+			if _, ok := seen[f.Name]; ok {
+				return nil, fmt.Errorf("label template %q: duplicate field %q", t.Name, f.Name)
+			}
+			seen[f.Name] = struct{}{}
+		}
+
+		r.templates[t.Name] = &t
+	}
+
+	return r, nil
+}
+
+// Get returns the template with the given name.
+func (r *Registry) Get(name string) (*Template, bool) {
+	t, ok := r.templates[name]
+	return t, ok
+}
+
+// Printer returns the printer that should be used for t.
+func (r *Registry) Printer(t *Template) string {
+	if t.Printer != "" {
+		return t.Printer
+	}
+
+	return r.printer
+}
+
+// List returns all templates sorted by name.
+func (r *Registry) List() []*Template {
+	result := make([]*Template, 0, len(r.templates))
+	for _, t := range r.templates {
+		result = append(result, t)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
+
+func (f *Field) setDefaults() error {
+	switch f.Type {
+	case FieldText, FieldDate:
+		if f.FontHeight <= 0 {
+			f.FontHeight = defaultFontHeight
+		}
+
+		if f.Type == FieldDate && f.Format == "" {
+			f.Format = defaultDateFormat
+		}
+
+	case FieldCode128:
+		if f.BarHeight <= 0 {
+			f.BarHeight = defaultBarHeight
+		}
+
+		if f.Module <= 0 {
+			f.Module = defaultModule
+		}
+
+	case FieldQR, FieldDataMatrix:
+		if f.Module <= 0 {
+			f.Module = defaultModule * 2
+		}
+
+	default:
+		return fmt.Errorf("unsupported field type %q", f.Type)
+	}
+
+	return nil
+}
+
+// Resolve validates values and returns the final, rendered value for each
+// field in the order of t.Fields. Fields without a value are returned as an
+// empty string.
+func (t *Template) Resolve(values map[string]string) ([]string, error) {
+	verr := &ValidationError{
+		Fields: make(map[string]string),
+	}
+
+	known := make(map[string]struct{}, len(t.Fields))
+	result := make([]string, len(t.Fields))
+
+	for idx, f := range t.Fields {
+		// static fields are rendered as well, e.g. to format dates
+		if f.Name == "" {
+			rendered, err := f.resolve(f.Value)
+			if err != nil {
+				verr.Fields[fmt.Sprintf("#%d", idx)] = err.Error()
+				continue
+			}
+
+			result[idx] = rendered
+			continue
+		}
+
+		known[f.Name] = struct{}{}
+
+		value, ok := values[f.Name]
+		if f.Value != "" {
+			if ok && value != f.Value {
+				verr.Fields[f.Name] = "field is read-only"
+			}
+
+			value = f.Value
+		}
+
+		if value == "" {
+			value = f.Default
+		}
+
+		if value == "" {
+			if f.Required {
+				verr.Fields[f.Name] = "field is required"
+			}
+
+			continue
+		}
+
+		rendered, err := f.resolve(value)
+		if err != nil {
+			verr.Fields[f.Name] = err.Error()
+			continue
+		}
+
+		result[idx] = rendered
+	}
+
+	for name := range values {
+		if _, ok := known[name]; !ok {
+			verr.Fields[name] = "unknown field"
+		}
+	}
+
+	if len(verr.Fields) > 0 {
+		return nil, verr
+	}
+
+	return result, nil
+}
+
+// resolve validates value and returns the rendered value.
+func (f *Field) resolve(value string) (string, error) {
+	if f.MaxLength > 0 && utf8.RuneCountInString(value) > f.MaxLength {
+		return "", fmt.Errorf("value must not exceed %d characters", f.MaxLength)
+	}
+
+	return f.render(value)
+}
+
+func (f *Field) render(value string) (string, error) {
+	switch f.Type {
+	case FieldDate:
+		t, err := parseDate(value)
+		if err != nil {
+			return "", err
+		}
+
+		return t.Format(f.Format), nil
+
+	case FieldCode128:
+		for _, r := range value {
+			if r > 127 {
+				return "", errors.New("Code128 only supports ASCII characters")
+			}
+		}
+	}
+
+	return value, nil
+}
+
+func parseDate(value string) (time.Time, error) {
+	if value == "now" || value == "today" {
+		return time.Now(), nil
+	}
+
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid date %q", value)
+}
@@ -0,0 +1,64 @@
+package labels
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestResolveStaticFields(t *testing.T) {
+	r, err := NewRegistry(Config{
+		Templates: []Template{
+			{
+				Name:   "sample",
+				Width:  400,
+				Height: 200,
+				Fields: []Field{
+					{Type: FieldDate, Value: "2024-03-01"},
+					{Name: "code", Type: FieldCode128, MaxLength: 4},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	tmpl, _ := r.Get("sample")
+
+	values, err := tmpl.Resolve(map[string]string{"code": "1234"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if values[0] != "01.03.2024" {
+		t.Errorf("expected the static date to be rendered, got %q", values[0])
+	}
+
+	_, err = tmpl.Resolve(map[string]string{"code": "12345"})
+
+	var verr *ValidationError
+	if !errors.As(err, &verr) || verr.Fields["code"] == "" {
+		t.Errorf("expected a validation error for code, got %v", err)
+	}
+}
+
+func TestNewRegistryInvalidStaticField(t *testing.T) {
+	cases := map[string]Field{
+		"max length": {Type: FieldText, Value: "too long", MaxLength: 3},
+		"code128":    {Type: FieldCode128, Value: "ÄÖÜ"},
+		"date":       {Type: FieldDate, Value: "not a date"},
+	}
+
+	for name, f := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewRegistry(Config{
+				Templates: []Template{
+					{Name: "sample", Width: 400, Height: 200, Fields: []Field{f}},
+				},
+			})
+			if err == nil {
+				t.Errorf("expected an error for static value %q", f.Value)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package labels
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code128"
+	"github.com/boombuler/barcode/datamatrix"
+	"github.com/boombuler/barcode/qr"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// Preview renders an approximation of the label as it would be printed.
+// Text is rendered using a fixed bitmap font scaled to the configured font
+// height so the result only shows the layout, not the exact printer font.
+func (t *Template) Preview(values map[string]string) (image.Image, error) {
+	resolved, err := t.Resolve(values)
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, t.Width, t.Height))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	for idx, f := range t.Fields {
+		value := resolved[idx]
+		if value == "" {
+			continue
+		}
+
+		var element image.Image
+
+		switch f.Type {
+		case FieldText, FieldDate:
+			element = renderText(value, f.FontHeight)
+
+		case FieldCode128:
+			bc, err := code128.Encode(value)
+			if err != nil {
+				return nil, fmt.Errorf("field %q: %w", f.Name, err)
+			}
+
+			element, err = barcode.Scale(bc, bc.Bounds().Dx()*f.Module, f.BarHeight)
+			if err != nil {
+				return nil, fmt.Errorf("field %q: %w", f.Name, err)
+			}
+
+		case FieldQR:
+			bc, err := qr.Encode(value, qr.M, qr.Auto)
+			if err != nil {
+				return nil, fmt.Errorf("field %q: %w", f.Name, err)
+			}
+
+			element, err = barcode.Scale(bc, bc.Bounds().Dx()*f.Module, bc.Bounds().Dy()*f.Module)
+			if err != nil {
+				return nil, fmt.Errorf("field %q: %w", f.Name, err)
+			}
+
+		case FieldDataMatrix:
+			bc, err := datamatrix.Encode(value)
+			if err != nil {
+				return nil, fmt.Errorf("field %q: %w", f.Name, err)
+			}
+
+			element, err = barcode.Scale(bc, bc.Bounds().Dx()*f.Module, bc.Bounds().Dy()*f.Module)
+			if err != nil {
+				return nil, fmt.Errorf("field %q: %w", f.Name, err)
+			}
+		}
+
+		b := element.Bounds()
+		draw.Draw(img, image.Rect(f.X, f.Y, f.X+b.Dx(), f.Y+b.Dy()), element, b.Min, draw.Over)
+	}
+
+	return img, nil
+}
+
+// renderText renders s using the basic 7x13 bitmap font and scales it to
+// height.
+func renderText(s string, height int) image.Image {
+	face := basicfont.Face7x13
+
+	width := font.MeasureString(face, s).Ceil()
+	src := image.NewRGBA(image.Rect(0, 0, width, face.Height))
+
+	d := &font.Drawer{
+		Dst:  src,
+		Src:  image.NewUniform(color.Black),
+		Face: face,
+		Dot:  fixed.P(0, face.Ascent),
+	}
+	d.DrawString(s)
+
+	scaledWidth := width * height / face.Height
+	dst := image.NewRGBA(image.Rect(0, 0, max(scaledWidth, 1), height))
+	draw.NearestNeighbor.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Over, nil)
+
+	return dst
+}
@@ -0,0 +1,73 @@
+package labels
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// ContentType is used when submitting rendered ZPL to a printer. CUPS
+// passes raw data to the printer without filtering.
+const ContentType = "application/vnd.cups-raw"
+
+// zplEscaper escapes characters that have a special meaning in ZPL. It
+// must be used together with the ^FH\ field hex indicator.
+var zplEscaper = strings.NewReplacer(
+	`\`, `\5C`,
+	`^`, `\5E`,
+	`~`, `\7E`,
+)
+
+// Render validates values and renders the ZPL code for quantity labels.
+func (t *Template) Render(values map[string]string, quantity int) ([]byte, error) {
+	if quantity < 1 || quantity > MaxQuantity {
+		return nil, fmt.Errorf("quantity must be between 1 and %d", MaxQuantity)
+	}
+
+	resolved, err := t.Resolve(values)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+
+	buf.WriteString("^XA\n")
+	buf.WriteString("^CI28\n") // UTF-8 encoding
+	fmt.Fprintf(buf, "^PW%d\n", t.Width)
+	fmt.Fprintf(buf, "^LL%d\n", t.Height)
+
+	for idx, f := range t.Fields {
+		value := resolved[idx]
+		if value == "" {
+			continue
+		}
+
+		fmt.Fprintf(buf, "^FO%d,%d", f.X, f.Y)
+
+		switch f.Type {
+		case FieldText, FieldDate:
+			fmt.Fprintf(buf, "^A0N,%d,%d", f.FontHeight, f.FontHeight)
+			fmt.Fprintf(buf, "^FH\\^FD%s^FS\n", zplEscaper.Replace(value))
+
+		case FieldCode128:
+			fmt.Fprintf(buf, "^BY%d", f.Module)
+			// no interpretation line so the result matches the preview
+			fmt.Fprintf(buf, "^BCN,%d,N,N,N", f.BarHeight)
+			fmt.Fprintf(buf, "^FH\\^FD%s^FS\n", zplEscaper.Replace(value))
+
+		case FieldQR:
+			fmt.Fprintf(buf, "^BQN,2,%d", f.Module)
+			// M = error correction level, A = automatic input mode
+			fmt.Fprintf(buf, "^FH\\^FDMA,%s^FS\n", zplEscaper.Replace(value))
+
+		case FieldDataMatrix:
+			fmt.Fprintf(buf, "^BXN,%d,200", f.Module)
+			fmt.Fprintf(buf, "^FH\\^FD%s^FS\n", zplEscaper.Replace(value))
+		}
+	}
+
+	fmt.Fprintf(buf, "^PQ%d\n", quantity)
+	buf.WriteString("^XZ\n")
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,325 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// annotation flags, see PDF 32000-1:2008, 12.5.3
+const (
+	annotFlagHidden = 1 << 1
+	annotFlagNoView = 1 << 5
+)
+
+// flattenForm draws the normal appearance of all widget annotations into
+// the page content and removes the interactive form.
+func flattenForm(ctx *model.Context) error {
+	for pageNr := 1; pageNr <= ctx.PageCount; pageNr++ {
+		pageDict, _, _, err := ctx.PageDict(pageNr, true)
+		if err != nil {
+			return err
+		}
+
+		if err := flattenPage(ctx, pageDict); err != nil {
+			return fmt.Errorf("page %d: %w", pageNr, err)
+		}
+	}
+
+	delete(ctx.RootDict, "AcroForm")
+
+	return nil
+}
+
+func flattenPage(ctx *model.Context, pageDict types.Dict) error {
+	obj, ok := pageDict.Find("Annots")
+	if !ok {
+		return nil
+	}
+
+	annots, err := ctx.DereferenceArray(obj)
+	if err != nil {
+		return err
+	}
+
+	var (
+		keep     types.Array
+		content  bytes.Buffer
+		xobjects = types.Dict{}
+	)
+
+	for _, a := range annots {
+		annot, err := ctx.DereferenceDict(a)
+		if err != nil {
+			return err
+		}
+
+		if annot == nil || annot.Subtype() == nil || *annot.Subtype() != "Widget" {
+			keep = append(keep, a)
+			continue
+		}
+
+		if flags := annot.IntEntry("F"); flags != nil && *flags&(annotFlagHidden|annotFlagNoView) != 0 {
+			continue
+		}
+
+		ref, sd, err := normalAppearance(ctx, annot)
+		if err != nil {
+			return err
+		}
+
+		if sd == nil {
+			continue
+		}
+
+		cm, err := appearanceMatrix(ctx, annot, sd)
+		if err != nil {
+			return err
+		}
+
+		if cm == nil {
+			continue
+		}
+
+		sd.InsertName("Type", "XObject")
+		sd.InsertName("Subtype", "Form")
+
+		name := fmt.Sprintf("FlatAP%d", len(xobjects))
+		xobjects[name] = *ref
+
+		fmt.Fprintf(&content, "q %.4f 0 0 %.4f %.4f %.4f cm /%s Do Q\n", cm[0], cm[1], cm[2], cm[3], name)
+	}
+
+	if len(keep) > 0 {
+		pageDict.Update("Annots", keep)
+	} else {
+		pageDict.Delete("Annots")
+	}
+
+	if len(xobjects) == 0 {
+		return nil
+	}
+
+	if err := addXObjects(ctx, pageDict, xobjects); err != nil {
+		return err
+	}
+
+	return wrapContent(ctx, pageDict, content.Bytes())
+}
+
+// normalAppearance returns the normal appearance stream of annot taking the
+// appearance state of check boxes and radio buttons into account.
+func normalAppearance(ctx *model.Context, annot types.Dict) (*types.IndirectRef, *types.StreamDict, error) {
+	apObj, ok := annot.Find("AP")
+	if !ok {
+		return nil, nil, nil
+	}
+
+	ap, err := ctx.DereferenceDict(apObj)
+	if err != nil || ap == nil {
+		return nil, nil, err
+	}
+
+	n, ok := ap.Find("N")
+	if !ok {
+		return nil, nil, nil
+	}
+
+	// check boxes and radio buttons have a sub-dictionary of states
+	resolved, err := ctx.Dereference(n)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if states, ok := resolved.(types.Dict); ok {
+		state := annot.NameEntry("AS")
+		if state == nil {
+			return nil, nil, nil
+		}
+
+		if n, ok = states.Find(*state); !ok {
+			return nil, nil, nil
+		}
+	}
+
+	ref, ok := n.(types.IndirectRef)
+	if !ok {
+		sd, ok := n.(types.StreamDict)
+		if !ok {
+			return nil, nil, nil
+		}
+
+		newRef, err := ctx.IndRefForNewObject(sd)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		ref = *newRef
+	}
+
+	entry, ok := ctx.FindTableEntryForIndRef(&ref)
+	if !ok || entry == nil {
+		return nil, nil, nil
+	}
+
+	sd, ok := entry.Object.(types.StreamDict)
+	if !ok {
+		return nil, nil, nil
+	}
+
+	// make sure modifications to the stream dictionary are persisted
+	entry.Object = sd
+
+	return &ref, &sd, nil
+}
+
+// appearanceMatrix calculates the transformation that maps the bounding box
+// of the appearance stream to the annotation rectangle. It returns
+// [sx, sy, tx, ty] or nil if the annotation is empty.
+func appearanceMatrix(ctx *model.Context, annot types.Dict, sd *types.StreamDict) ([]float64, error) {
+	rect, err := numberArray(ctx, annot, "Rect")
+	if err != nil || len(rect) != 4 {
+		return nil, err
+	}
+
+	bbox, err := numberArray(ctx, sd.Dict, "BBox")
+	if err != nil || len(bbox) != 4 {
+		return nil, err
+	}
+
+	matrix, err := numberArray(ctx, sd.Dict, "Matrix")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(matrix) != 6 {
+		matrix = []float64{1, 0, 0, 1, 0, 0}
+	}
+
+	// transform all corners of the bounding box and find the enclosing box
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+
+	for _, p := range [][2]float64{{bbox[0], bbox[1]}, {bbox[0], bbox[3]}, {bbox[2], bbox[1]}, {bbox[2], bbox[3]}} {
+		x := matrix[0]*p[0] + matrix[2]*p[1] + matrix[4]
+		y := matrix[1]*p[0] + matrix[3]*p[1] + matrix[5]
+
+		minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+		minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+	}
+
+	rx0, rx1 := math.Min(rect[0], rect[2]), math.Max(rect[0], rect[2])
+	ry0, ry1 := math.Min(rect[1], rect[3]), math.Max(rect[1], rect[3])
+
+	if maxX-minX == 0 || maxY-minY == 0 || rx1-rx0 == 0 || ry1-ry0 == 0 {
+		return nil, nil
+	}
+
+	sx := (rx1 - rx0) / (maxX - minX)
+	sy := (ry1 - ry0) / (maxY - minY)
+
+	return []float64{sx, sy, rx0 - minX*sx, ry0 - minY*sy}, nil
+}
+
+func numberArray(ctx *model.Context, d types.Dict, key string) ([]float64, error) {
+	obj, ok := d.Find(key)
+	if !ok {
+		return nil, nil
+	}
+
+	arr, err := ctx.DereferenceArray(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]float64, len(arr))
+	for idx, o := range arr {
+		if result[idx], err = ctx.DereferenceNumber(o); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// addXObjects adds xobjects to the resources of pageDict.
+func addXObjects(ctx *model.Context, pageDict types.Dict, xobjects types.Dict) error {
+	resources := types.Dict{}
+	if obj, ok := pageDict.Find("Resources"); ok {
+		d, err := ctx.DereferenceDict(obj)
+		if err != nil {
+			return err
+		}
+
+		if d != nil {
+			resources = d.Clone().(types.Dict)
+		}
+	}
+
+	existing := types.Dict{}
+	if obj, ok := resources.Find("XObject"); ok {
+		d, err := ctx.DereferenceDict(obj)
+		if err != nil {
+			return err
+		}
+
+		if d != nil {
+			existing = d.Clone().(types.Dict)
+		}
+	}
+
+	for name, ref := range xobjects {
+		existing[name] = ref
+	}
+
+	resources["XObject"] = existing
+	pageDict["Resources"] = resources
+
+	return nil
+}
+
+// wrapContent wraps the existing page content in a q/Q pair so changes to
+// the graphics state do not leak and appends content.
+func wrapContent(ctx *model.Context, pageDict types.Dict, content []byte) error {
+	prefix, err := ctx.StreamDictIndRef([]byte("q\n"))
+	if err != nil {
+		return err
+	}
+
+	suffix, err := ctx.StreamDictIndRef(append([]byte("\nQ\n"), content...))
+	if err != nil {
+		return err
+	}
+
+	contents := types.Array{*prefix}
+
+	if obj, ok := pageDict.Find("Contents"); ok {
+		switch v := obj.(type) {
+		case types.IndirectRef:
+			resolved, err := ctx.Dereference(v)
+			if err != nil {
+				return err
+			}
+
+			if arr, ok := resolved.(types.Array); ok {
+				contents = append(contents, arr...)
+			} else {
+				contents = append(contents, v)
+			}
+
+		case types.Array:
+			contents = append(contents, v...)
+
+		default:
+			return fmt.Errorf("unexpected page content type %T", obj)
+		}
+	}
+
+	contents = append(contents, *suffix)
+	pageDict["Contents"] = contents
+
+	return nil
+}
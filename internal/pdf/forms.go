@@ -0,0 +1,250 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/form"
+)
+
+// FieldType is the type of an AcroForm field.
+type FieldType string
+
+const (
+	FieldText     = FieldType("text")
+	FieldDate     = FieldType("date")
+	FieldCheckBox = FieldType("checkbox")
+	FieldRadio    = FieldType("radio")
+	FieldComboBox = FieldType("combobox")
+	FieldListBox  = FieldType("listbox")
+)
+
+// FormField describes a single AcroForm field.
+type FormField struct {
+	Name      string    `json:"name"`
+	Type      FieldType `json:"type"`
+	Value     string    `json:"value,omitempty"`
+	Options   []string  `json:"options,omitempty"`
+	Format    string    `json:"format,omitempty"`
+	MaxLength int       `json:"maxLength,omitempty"`
+	Multiline bool      `json:"multiline,omitempty"`
+	Multi     bool      `json:"multi,omitempty"`
+	Locked    bool      `json:"locked,omitempty"`
+	Pages     []int     `json:"pages"`
+}
+
+// FormFields returns all AcroForm fields of the PDF document.
+func FormFields(content []byte) ([]FormField, error) {
+	group, err := exportForm(content)
+	if err != nil {
+		return nil, err
+	}
+
+	f := group.Forms[0]
+
+	var result []FormField
+
+	for _, tf := range f.TextFields {
+		result = append(result, FormField{Name: fieldName(tf.Name, tf.ID), Type: FieldText, Value: tf.Value, MaxLength: tf.MaxLen, Multiline: tf.Multiline, Locked: tf.Locked, Pages: tf.Pages})
+	}
+
+	for _, df := range f.DateFields {
+		result = append(result, FormField{Name: fieldName(df.Name, df.ID), Type: FieldDate, Value: df.Value, Format: df.Format, Locked: df.Locked, Pages: df.Pages})
+	}
+
+	for _, cb := range f.CheckBoxes {
+		result = append(result, FormField{Name: fieldName(cb.Name, cb.ID), Type: FieldCheckBox, Value: strconv.FormatBool(cb.Value), Locked: cb.Locked, Pages: cb.Pages})
+	}
+
+	for _, rb := range f.RadioButtonGroups {
+		result = append(result, FormField{Name: fieldName(rb.Name, rb.ID), Type: FieldRadio, Value: rb.Value, Options: rb.Options, Locked: rb.Locked, Pages: rb.Pages})
+	}
+
+	for _, cb := range f.ComboBoxes {
+		result = append(result, FormField{Name: fieldName(cb.Name, cb.ID), Type: FieldComboBox, Value: cb.Value, Options: cb.Options, Locked: cb.Locked, Pages: cb.Pages})
+	}
+
+	for _, lb := range f.ListBoxes {
+		result = append(result, FormField{Name: fieldName(lb.Name, lb.ID), Type: FieldListBox, Value: strings.Join(lb.Values, ","), Options: lb.Options, Multi: lb.Multi, Locked: lb.Locked, Pages: lb.Pages})
+	}
+
+	return result, nil
+}
+
+// FillForm fills the AcroForm fields of the PDF document with values. Check
+// boxes accept boolean values and list boxes a comma separated list of
+// options. If flatten is set, the form fields are merged into the page
+// content so they can no longer be changed.
+func FillForm(content []byte, values map[string]string, flatten bool) ([]byte, error) {
+	group, err := exportForm(content)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &group.Forms[0]
+
+	for name, value := range values {
+		if err := setFieldValue(f, name, value); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := json.Marshal(group)
+	if err != nil {
+		return nil, err
+	}
+
+	filled := new(bytes.Buffer)
+	if err := api.FillForm(bytes.NewReader(content), bytes.NewReader(data), filled, newConfig()); err != nil {
+		// pdfcpu reports an error if no field has been changed which is
+		// fine for us.
+		if !errors.Is(err, api.ErrNoFormFieldsAffected) {
+			return nil, fmt.Errorf("failed to fill form: %w", err)
+		}
+
+		filled.Reset()
+		filled.Write(content)
+	}
+
+	if !flatten {
+		return filled.Bytes(), nil
+	}
+
+	ctx, err := readContext(filled.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := flattenForm(ctx); err != nil {
+		return nil, fmt.Errorf("failed to flatten form: %w", err)
+	}
+
+	return writeContext(ctx)
+}
+
+func exportForm(content []byte) (*form.FormGroup, error) {
+	group, err := api.ExportForm(bytes.NewReader(content), "", newConfig())
+	if err != nil {
+		// pdfcpu does not export a sentinel error for documents without
+		// an AcroForm.
+		if errors.Is(err, api.ErrNoFormFieldsAffected) || strings.Contains(err.Error(), "no form available") {
+			return nil, invalidInput("document does not contain form fields")
+		}
+
+		return nil, fmt.Errorf("failed to read form: %w", err)
+	}
+
+	if len(group.Forms) == 0 {
+		return nil, invalidInput("document does not contain form fields")
+	}
+
+	return group, nil
+}
+
+func fieldName(name, id string) string {
+	if name != "" {
+		return name
+	}
+
+	return id
+}
+
+func setFieldValue(f *form.Form, name, value string) error {
+	match := func(fname, id string) bool {
+		return fname == name || (fname == "" && id == name)
+	}
+
+	for _, tf := range f.TextFields {
+		if match(tf.Name, tf.ID) {
+			if tf.MaxLen > 0 && len([]rune(value)) > tf.MaxLen {
+				return invalidInput("field %q: value must not exceed %d characters", name, tf.MaxLen)
+			}
+
+			tf.Value = value
+			return nil
+		}
+	}
+
+	for _, df := range f.DateFields {
+		if match(df.Name, df.ID) {
+			df.Value = value
+			return nil
+		}
+	}
+
+	for _, cb := range f.CheckBoxes {
+		if match(cb.Name, cb.ID) {
+			b, err := parseBool(value)
+			if err != nil {
+				return invalidInput("field %q: %s", name, err)
+			}
+
+			cb.Value = b
+			return nil
+		}
+	}
+
+	for _, rb := range f.RadioButtonGroups {
+		if match(rb.Name, rb.ID) {
+			if value != "" && !slices.Contains(rb.Options, value) {
+				return invalidInput("field %q: invalid option %q", name, value)
+			}
+
+			rb.Value = value
+			return nil
+		}
+	}
+
+	for _, cb := range f.ComboBoxes {
+		if match(cb.Name, cb.ID) {
+			if value != "" && !cb.Editable && !slices.Contains(cb.Options, value) {
+				return invalidInput("field %q: invalid option %q", name, value)
+			}
+
+			cb.Value = value
+			return nil
+		}
+	}
+
+	for _, lb := range f.ListBoxes {
+		if match(lb.Name, lb.ID) {
+			var selected []string
+			if value != "" {
+				selected = strings.Split(value, ",")
+			}
+
+			if len(selected) > 1 && !lb.Multi {
+				return invalidInput("field %q: only one option may be selected", name)
+			}
+
+			for idx, s := range selected {
+				selected[idx] = strings.TrimSpace(s)
+				if !slices.Contains(lb.Options, selected[idx]) {
+					return invalidInput("field %q: invalid option %q", name, selected[idx])
+				}
+			}
+
+			lb.Values = selected
+			return nil
+		}
+	}
+
+	return invalidInput("unknown form field %q", name)
+}
+
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "", "0", "false", "no", "off":
+		return false, nil
+	case "1", "true", "yes", "on", "x":
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid boolean value %q", value)
+	}
+}
@@ -0,0 +1,111 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// formPDF returns a single page document with a text field "name" and a
+// check box "urgent".
+func formPDF() []byte {
+	content := "0.5 g 100 100 200 200 re f"
+	on := "0 g 0 0 12 12 re f"
+
+	return buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R /AcroForm << /Fields [5 0 R 6 0 R] /DA (/Helv 12 Tf 0 g) /DR << /Font << /Helv 7 0 R >> >> >> >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595.28 841.89] /Contents 4 0 R /Resources << >> /Annots [5 0 R 6 0 R] >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+		"<< /Type /Annot /Subtype /Widget /FT /Tx /T (name) /Rect [50 700 250 720] /P 3 0 R /DA (/Helv 12 Tf 0 g) /F 4 >>",
+		"<< /Type /Annot /Subtype /Widget /FT /Btn /T (urgent) /Rect [50 650 62 662] /P 3 0 R /V /Off /AS /Off /F 4 /AP << /N << /Yes 8 0 R /Off 9 0 R >> >> >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Type /XObject /Subtype /Form /BBox [0 0 12 12] /Length %d >>\nstream\n%s\nendstream", len(on), on),
+		"<< /Type /XObject /Subtype /Form /BBox [0 0 12 12] /Length 0 >>\nstream\n\nendstream",
+	)
+}
+
+// fieldValues returns the values of all form fields by name.
+func fieldValues(t *testing.T, content []byte) map[string]string {
+	t.Helper()
+
+	fields, err := FormFields(content)
+	if err != nil {
+		t.Fatalf("failed to list form fields: %s", err)
+	}
+
+	values := make(map[string]string, len(fields))
+	for _, f := range fields {
+		values[f.Name] = f.Value
+	}
+
+	return values
+}
+
+func TestFormFields(t *testing.T) {
+	fields, err := FormFields(formPDF())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, f := range fields {
+		names = append(names, fmt.Sprintf("%s:%s", f.Name, f.Type))
+	}
+	slices.Sort(names)
+
+	if want := []string{"name:text", "urgent:checkbox"}; !slices.Equal(names, want) {
+		t.Errorf("expected fields %v, got %v", want, names)
+	}
+
+	if _, err := FormFields(onePagePDF()); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("expected ErrInvalidInput for a document without a form, got %v", err)
+	}
+}
+
+func TestFillForm(t *testing.T) {
+	filled, err := FillForm(formPDF(), map[string]string{"name": "Bello", "urgent": "yes"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := fieldValues(t, filled)
+	if values["name"] != "Bello" || values["urgent"] != "true" {
+		t.Errorf("expected the filled values to be listed, got %v", values)
+	}
+
+	cases := map[string]map[string]string{
+		"unknown field":   {"owner": "Alice"},
+		"invalid boolean": {"urgent": "maybe"},
+	}
+
+	for name, values := range cases {
+		if _, err := FillForm(formPDF(), values, false); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("%s: expected ErrInvalidInput, got %v", name, err)
+		}
+	}
+}
+
+func TestFillFormFlatten(t *testing.T) {
+	flat, err := FillForm(formPDF(), map[string]string{"name": "Bello", "urgent": "yes"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := FormFields(flat); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("expected the form to be removed, got %v", err)
+	}
+
+	// the appearance of both widgets is drawn into the page content
+	for _, name := range []string{"/FlatAP0 Do", "/FlatAP1 Do"} {
+		if !bytes.Contains(flat, []byte(name)) {
+			t.Errorf("expected the page content to draw %s", name)
+		}
+	}
+
+	if info := Inspect(flat); info.Damaged || info.PageCount != 1 {
+		t.Errorf("expected a valid single page document, got %+v", info)
+	}
+}
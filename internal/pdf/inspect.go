@@ -0,0 +1,338 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// Info holds metadata about a PDF document.
+type Info struct {
+	// Version is the PDF version of the document.
+	Version string `json:"version,omitempty"`
+
+	// PageCount is the number of pages.
+	PageCount int `json:"pageCount"`
+
+	// Pages holds the size of each page.
+	Pages []PageInfo `json:"pages,omitempty"`
+
+	// Encrypted is set if the document is encrypted. Documents that
+	// require a password to be opened cannot be inspected any further.
+	Encrypted bool `json:"encrypted"`
+
+	// Damaged is set if the document could not be parsed. Error holds
+	// the reason.
+	Damaged bool   `json:"damaged"`
+	Error   string `json:"error,omitempty"`
+
+	// Color is set if the document likely contains color content. It is
+	// detected from non-gray color operators and color images, so a
+	// document may be reported as color even though it looks gray.
+	Color bool `json:"color"`
+
+	// Fonts holds all fonts used by the document.
+	Fonts []FontInfo `json:"fonts,omitempty"`
+}
+
+// PageInfo holds the size of a single page in points, taking the page
+// rotation into account.
+type PageInfo struct {
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+
+	// Media is the name of the matching paper size, if any.
+	Media string `json:"media,omitempty"`
+}
+
+// FontInfo describes a font used by the document.
+type FontInfo struct {
+	Name     string `json:"name"`
+	Type     string `json:"type,omitempty"`
+	Embedded bool   `json:"embedded"`
+}
+
+// commonMedia are matched against page sizes in order.
+var commonMedia = []string{"A3", "A4", "A5", "A6", "B4", "B5", "Letter", "Legal", "Ledger"}
+
+// Media returns the paper size shared by all pages or an empty string if the
+// pages differ or do not match a common paper size.
+func (info *Info) Media() string {
+	if len(info.Pages) == 0 {
+		return ""
+	}
+
+	media := info.Pages[0].Media
+	for _, page := range info.Pages[1:] {
+		if page.Media != media {
+			return ""
+		}
+	}
+
+	return media
+}
+
+// Inspect parses the PDF document and returns metadata about it. A broken
+// or password protected document is not an error but reported in the
+// returned Info.
+func Inspect(content []byte) *Info {
+	info := new(Info)
+
+	conf := newConfig()
+
+	// makes pdfcpu check whether fonts are embedded
+	conf.Cmd = model.LISTINFO
+
+	ctx, err := api.ReadContext(bytes.NewReader(content), conf)
+	if err != nil {
+		info.Damaged = !errors.Is(err, pdfcpu.ErrWrongPassword)
+		info.Encrypted = !info.Damaged
+		info.Error = err.Error()
+
+		return info
+	}
+
+	info.Encrypted = ctx.Encrypt != nil
+	info.Version = ctx.VersionString()
+
+	// pdfcpu reconstructs the cross reference table of truncated documents
+	// so they must be detected separately.
+	if !hasEOFMarker(content) {
+		info.Damaged = true
+		info.Error = "document is truncated: missing %%EOF marker"
+
+		return info
+	}
+
+	err = api.ValidateContext(ctx)
+	if err == nil {
+		err = api.OptimizeContext(ctx)
+	}
+	if err == nil {
+		err = ctx.EnsurePageCount()
+	}
+	if err != nil {
+		info.Damaged = true
+		info.Error = err.Error()
+
+		return info
+	}
+
+	info.PageCount = ctx.PageCount
+
+	if dims, err := ctx.PageDims(); err == nil {
+		for _, dim := range dims {
+			info.Pages = append(info.Pages, PageInfo{
+				Width:  math.Round(dim.Width*100) / 100,
+				Height: math.Round(dim.Height*100) / 100,
+				Media:  matchMedia(dim),
+			})
+		}
+	}
+
+	for _, font := range ctx.Optimize.FontObjects {
+		fi := FontInfo{
+			Name:     font.FontName,
+			Type:     font.SubType(),
+			Embedded: font.Embedded,
+		}
+
+		if !slices.Contains(info.Fonts, fi) {
+			info.Fonts = append(info.Fonts, fi)
+		}
+	}
+
+	slices.SortFunc(info.Fonts, func(a, b FontInfo) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	info.Color = hasColor(ctx)
+
+	return info
+}
+
+// hasEOFMarker reports whether the end of content holds the %%EOF marker
+// that terminates every complete PDF document.
+func hasEOFMarker(content []byte) bool {
+	const tail = 1024
+
+	if len(content) > tail {
+		content = content[len(content)-tail:]
+	}
+
+	return bytes.Contains(content, []byte("%%EOF"))
+}
+
+func matchMedia(dim types.Dim) string {
+	const tolerance = 2 // points
+
+	for _, name := range commonMedia {
+		size := types.PaperSize[name]
+
+		for _, candidate := range []types.Dim{*size, {Width: size.Height, Height: size.Width}} {
+			if math.Abs(candidate.Width-dim.Width) <= tolerance && math.Abs(candidate.Height-dim.Height) <= tolerance {
+				return name
+			}
+		}
+	}
+
+	return ""
+}
+
+// hasColor checks all page and form XObject content streams for non-gray
+// colors as well as all images for color spaces with color components.
+func hasColor(ctx *model.Context) bool {
+	for page := 1; page <= ctx.PageCount; page++ {
+		d, _, _, err := ctx.PageDict(page, false)
+		if err != nil || d == nil {
+			continue
+		}
+
+		content, err := ctx.PageContent(d, page)
+		if err == nil && contentHasColor(content) {
+			return true
+		}
+	}
+
+	for _, entry := range ctx.Table {
+		if entry == nil || entry.Free {
+			continue
+		}
+
+		sd, ok := entry.Object.(types.StreamDict)
+		if !ok {
+			continue
+		}
+
+		switch subtype := sd.Subtype(); {
+		case subtype == nil:
+		case *subtype == "Image":
+			if colorSpaceHasColor(ctx, sd.Dict["ColorSpace"]) {
+				return true
+			}
+		case *subtype == "Form":
+			if err := sd.Decode(); err == nil && contentHasColor(sd.Content) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func colorSpaceHasColor(ctx *model.Context, obj types.Object) bool {
+	obj, err := ctx.Dereference(obj)
+	if err != nil || obj == nil {
+		return false
+	}
+
+	switch cs := obj.(type) {
+	case types.Name:
+		switch cs {
+		case "DeviceRGB", "DeviceCMYK", "CalRGB", "Lab":
+			return true
+		}
+
+	case types.Array:
+		if len(cs) == 0 {
+			return false
+		}
+
+		name, _ := cs[0].(types.Name)
+		switch name {
+		case "ICCBased":
+			if len(cs) < 2 {
+				return false
+			}
+
+			sd, _, err := ctx.DereferenceStreamDict(cs[1])
+			if err != nil || sd == nil {
+				return false
+			}
+
+			n := sd.IntEntry("N")
+			return n != nil && *n > 1
+
+		case "Indexed":
+			return len(cs) > 1 && colorSpaceHasColor(ctx, cs[1])
+
+		case "Separation", "DeviceN":
+			// spot colors are treated as color
+			return true
+
+		default:
+			return colorSpaceHasColor(ctx, name)
+		}
+	}
+
+	return false
+}
+
+// contentHasColor scans a content stream for color operators that set a
+// non-gray color.
+func contentHasColor(content []byte) bool {
+	var operands []float64
+
+	for _, token := range bytes.Fields(content) {
+		if value, err := strconv.ParseFloat(string(token), 64); err == nil {
+			operands = append(operands, value)
+			continue
+		}
+
+		switch string(token) {
+		case "rg", "RG":
+			if isColorRGB(operands) {
+				return true
+			}
+
+		case "k", "K":
+			if isColorCMYK(operands) {
+				return true
+			}
+
+		case "sc", "scn", "SC", "SCN":
+			// the color space is not tracked so the number of operands
+			// is used to guess it
+			switch {
+			case len(operands) >= 4 && isColorCMYK(operands):
+				return true
+			case len(operands) == 3 && isColorRGB(operands):
+				return true
+			}
+		}
+
+		operands = operands[:0]
+	}
+
+	return false
+}
+
+const colorTolerance = 0.01
+
+func isColorRGB(operands []float64) bool {
+	if len(operands) < 3 {
+		return false
+	}
+
+	rgb := operands[len(operands)-3:]
+
+	return math.Abs(rgb[0]-rgb[1]) > colorTolerance || math.Abs(rgb[1]-rgb[2]) > colorTolerance
+}
+
+func isColorCMYK(operands []float64) bool {
+	if len(operands) < 4 {
+		return false
+	}
+
+	cmyk := operands[len(operands)-4:]
+
+	return math.Abs(cmyk[0]-cmyk[1]) > colorTolerance || math.Abs(cmyk[1]-cmyk[2]) > colorTolerance
+}
@@ -0,0 +1,92 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// buildPDF returns a PDF document consisting of objs with a valid cross
+// reference table.
+func buildPDF(objs ...string) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString("%PDF-1.4\n")
+
+	offsets := make([]int, len(objs))
+	for i, obj := range objs {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objs)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objs)+1, xref)
+
+	return buf.Bytes()
+}
+
+// onePagePDF returns a single A4 page that draws a gray rectangle.
+func onePagePDF() []byte {
+	content := "0.5 g 100 100 200 200 re f"
+
+	return buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595.28 841.89] /Contents 4 0 R /Resources << >> >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+	)
+}
+
+func TestInspect(t *testing.T) {
+	info := Inspect(onePagePDF())
+
+	if info.Damaged {
+		t.Fatalf("valid document reported as damaged: %s", info.Error)
+	}
+
+	if info.PageCount != 1 {
+		t.Errorf("expected 1 page, got %d", info.PageCount)
+	}
+
+	if media := info.Media(); media != "A4" {
+		t.Errorf("expected A4 media, got %q", media)
+	}
+
+	if info.Color {
+		t.Errorf("gray document reported as color")
+	}
+}
+
+func TestInspectDamaged(t *testing.T) {
+	valid := onePagePDF()
+
+	cases := map[string][]byte{
+		// cut within the page dictionary
+		"truncated": valid[:bytes.Index(valid, []byte("/MediaBox"))],
+		"garbage":   []byte("%PDF-1.4\nthis is not a pdf"),
+		"missing page": buildPDF(
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+			"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		),
+	}
+
+	for name, content := range cases {
+		t.Run(name, func(t *testing.T) {
+			info := Inspect(content)
+
+			if !info.Damaged {
+				t.Fatalf("damaged document not detected: %+v", info)
+			}
+
+			if info.Error == "" {
+				t.Errorf("expected an error description")
+			}
+		})
+	}
+}
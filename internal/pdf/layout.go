@@ -0,0 +1,210 @@
+package pdf
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// DefaultMedia is the sheet size used for n-up and booklet imposition if no
+// media is specified.
+const DefaultMedia = "A4"
+
+// Layout describes how the pages of a document are arranged on the printed
+// sheets.
+type Layout struct {
+	// Pages selects the pages to print, e.g. "1-3,5" or "2-". The
+	// syntax is the one used by pdfcpu. Pages are printed in the order
+	// they are listed and may be repeated.
+	Pages string
+
+	// Reverse prints the selected pages in reverse order.
+	Reverse bool
+
+	// Rotate rotates every page clockwise by a multiple of 90 degrees.
+	Rotate int
+
+	// Media is the name of the target paper size, e.g. A4 or Letter. If
+	// set, pages are scaled to fit the media.
+	Media string
+
+	// NUp places 2 or 4 pages on a single sheet.
+	NUp int
+
+	// Booklet imposes the pages as a saddle-stitch booklet with two pages
+	// on each side of a sheet. The result must be printed duplex, flipped
+	// on the short edge.
+	Booklet bool
+}
+
+// IsZero reports whether l leaves the document unchanged.
+func (l Layout) IsZero() bool {
+	return l == Layout{}
+}
+
+// Arranges reports whether l selects, reorders or rotates pages.
+func (l Layout) Arranges() bool {
+	return l.Pages != "" || l.Reverse || l.Rotate != 0
+}
+
+// Imposes reports whether l scales or imposes pages onto sheets.
+func (l Layout) Imposes() bool {
+	return l.Media != "" || l.NUp > 1 || l.Booklet
+}
+
+// Validate checks if the layout options are valid.
+func (l Layout) Validate() error {
+	if l.Pages != "" {
+		if _, err := api.ParsePageSelection(l.Pages); err != nil {
+			return invalidInput("invalid page selection %q", l.Pages)
+		}
+	}
+
+	if l.Rotate%90 != 0 {
+		return invalidInput("rotation must be a multiple of 90 degrees")
+	}
+
+	if l.Media != "" {
+		if _, ok := types.PaperSize[l.Media]; !ok {
+			return invalidInput("unknown media %q", l.Media)
+		}
+	}
+
+	if !slices.Contains([]int{0, 1, 2, 4}, l.NUp) {
+		return invalidInput("n-up must be one of 1, 2 or 4")
+	}
+
+	if l.Booklet && l.NUp > 1 {
+		return invalidInput("n-up cannot be combined with booklet")
+	}
+
+	return nil
+}
+
+// ArrangePages selects, reorders and rotates the pages of the PDF document.
+func ArrangePages(content []byte, l Layout) ([]byte, error) {
+	if !l.Arranges() {
+		return content, nil
+	}
+
+	if err := l.Validate(); err != nil {
+		return nil, err
+	}
+
+	ctx, err := readContext(content)
+	if err != nil {
+		return nil, err
+	}
+
+	if l.Pages != "" || l.Reverse {
+		// all pages are selected if only the order is reversed
+		selection := []string{"1-"}
+		if l.Pages != "" {
+			// validated above
+			selection, _ = api.ParsePageSelection(l.Pages)
+		}
+
+		pages, err := api.PagesForPageCollection(ctx.PageCount, selection)
+		if err != nil {
+			return nil, invalidInput("invalid page selection %q: %s", l.Pages, err)
+		}
+
+		if len(pages) == 0 {
+			return nil, invalidInput("page selection %q does not match any page", l.Pages)
+		}
+
+		if l.Reverse {
+			slices.Reverse(pages)
+		}
+
+		ctx, err = pdfcpu.ExtractPages(ctx, pages, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to select pages: %w", err)
+		}
+
+		if err := ctx.EnsurePageCount(); err != nil {
+			return nil, fmt.Errorf("failed to select pages: %w", err)
+		}
+	}
+
+	if l.Rotate != 0 {
+		if err := pdfcpu.RotatePages(ctx, allPages(ctx), l.Rotate); err != nil {
+			return nil, fmt.Errorf("failed to rotate pages: %w", err)
+		}
+	}
+
+	return writeContext(ctx)
+}
+
+// Impose scales the pages of the PDF document to the target media and
+// places them on sheets for n-up or booklet printing.
+func Impose(content []byte, l Layout) ([]byte, error) {
+	if !l.Imposes() {
+		return content, nil
+	}
+
+	if err := l.Validate(); err != nil {
+		return nil, err
+	}
+
+	ctx, err := readContext(content)
+	if err != nil {
+		return nil, err
+	}
+
+	media := withDefault(l.Media, DefaultMedia)
+
+	switch {
+	case l.Booklet:
+		nup, err := pdfcpu.PDFBookletConfig(2, "formsize:"+media, ctx.Configuration)
+		if err != nil {
+			return nil, fmt.Errorf("booklet: %w", err)
+		}
+
+		if err := pdfcpu.BookletFromPDF(ctx, allPages(ctx), nup); err != nil {
+			return nil, fmt.Errorf("failed to create booklet: %w", err)
+		}
+
+	case l.NUp > 1:
+		desc := []string{"formsize:" + media, "border:off", "margin:0"}
+		if l.NUp == 2 {
+			// two portrait pages fit side by side on a landscape sheet
+			desc[0] += "L"
+		}
+
+		nup, err := pdfcpu.PDFNUpConfig(l.NUp, strings.Join(desc, ", "), ctx.Configuration)
+		if err != nil {
+			return nil, fmt.Errorf("n-up: %w", err)
+		}
+
+		if err := pdfcpu.NUpFromPDF(ctx, allPages(ctx), nup); err != nil {
+			return nil, fmt.Errorf("failed to create n-up layout: %w", err)
+		}
+
+	default:
+		res, err := pdfcpu.ParseResizeConfig("form:"+media, types.POINTS)
+		if err != nil {
+			return nil, fmt.Errorf("resize: %w", err)
+		}
+
+		if err := pdfcpu.Resize(ctx, allPages(ctx), res); err != nil {
+			return nil, fmt.Errorf("failed to scale pages: %w", err)
+		}
+	}
+
+	return writeContext(ctx)
+}
+
+func allPages(ctx *model.Context) types.IntSet {
+	pages := make(types.IntSet, ctx.PageCount)
+	for page := 1; page <= ctx.PageCount; page++ {
+		pages[page] = true
+	}
+
+	return pages
+}
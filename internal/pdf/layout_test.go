@@ -0,0 +1,148 @@
+package pdf
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// pagesPDF returns a document with one page for each width. All pages are
+// 500 points high so they can be told apart by their width.
+func pagesPDF(widths ...int) []byte {
+	content := "0.5 g 10 10 50 50 re f"
+
+	kids := make([]string, len(widths))
+	for idx := range widths {
+		kids[idx] = fmt.Sprintf("%d 0 R", idx+3)
+	}
+
+	objs := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(widths)),
+	}
+
+	// the content stream of each page follows the page objects
+	for idx, width := range widths {
+		objs = append(objs, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d 500] /Contents %d 0 R /Resources << >> >>", width, len(widths)+idx+3))
+	}
+
+	for range widths {
+		objs = append(objs, fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content))
+	}
+
+	return buildPDF(objs...)
+}
+
+// pageWidths returns the width of each page of content.
+func pageWidths(t *testing.T, content []byte) []int {
+	t.Helper()
+
+	info := Inspect(content)
+	if info.Damaged {
+		t.Fatalf("invalid document: %s", info.Error)
+	}
+
+	widths := make([]int, len(info.Pages))
+	for idx, page := range info.Pages {
+		widths[idx] = int(page.Width + 0.5)
+	}
+
+	return widths
+}
+
+func TestArrangePages(t *testing.T) {
+	doc := pagesPDF(100, 200, 300, 400)
+
+	cases := []struct {
+		name   string
+		layout Layout
+		want   []int
+	}{
+		{"unchanged", Layout{}, []int{100, 200, 300, 400}},
+		{"range", Layout{Pages: "2-3"}, []int{200, 300}},
+		{"open range", Layout{Pages: "3-"}, []int{300, 400}},
+		{"list", Layout{Pages: "1,4"}, []int{100, 400}},
+		{"reverse", Layout{Reverse: true}, []int{400, 300, 200, 100}},
+		{"reverse selection", Layout{Pages: "1-2", Reverse: true}, []int{200, 100}},
+		{"rotate", Layout{Pages: "1", Rotate: 90}, []int{500}},
+		{"rotate half", Layout{Pages: "1", Rotate: 180}, []int{100}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			result, err := ArrangePages(doc, c.layout)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := pageWidths(t, result); !slices.Equal(got, c.want) {
+				t.Errorf("expected pages %v, got %v", c.want, got)
+			}
+		})
+	}
+}
+
+func TestImpose(t *testing.T) {
+	doc := pagesPDF(595, 595, 595, 595, 595, 595)
+
+	cases := []struct {
+		name   string
+		layout Layout
+		sheets int
+	}{
+		{"media", Layout{Media: "A5"}, 6},
+		{"2-up", Layout{NUp: 2}, 3},
+		{"4-up", Layout{NUp: 4}, 2},
+		{"booklet", Layout{Booklet: true}, 4},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			result, err := Impose(doc, c.layout)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			info := Inspect(result)
+			if info.PageCount != c.sheets {
+				t.Errorf("expected %d pages, got %d", c.sheets, info.PageCount)
+			}
+
+			if want := withDefault(c.layout.Media, DefaultMedia); info.Media() != want {
+				t.Errorf("expected %s pages, got %q", want, info.Media())
+			}
+		})
+	}
+}
+
+func TestLayoutInvalidInput(t *testing.T) {
+	doc := pagesPDF(100, 200)
+
+	cases := []struct {
+		name   string
+		layout Layout
+	}{
+		{"page selection", Layout{Pages: "a-b"}},
+		{"no matching page", Layout{Pages: "5-"}},
+		{"rotation", Layout{Rotate: 45}},
+		{"media", Layout{Media: "A42"}},
+		{"n-up", Layout{NUp: 3}},
+		{"booklet n-up", Layout{NUp: 2, Booklet: true}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := ArrangePages(doc, c.layout)
+			if c.layout.Arranges() && !errors.Is(err, ErrInvalidInput) {
+				t.Errorf("ArrangePages: expected ErrInvalidInput, got %v", err)
+			}
+
+			_, err = Impose(doc, c.layout)
+			if c.layout.Imposes() && !errors.Is(err, ErrInvalidInput) {
+				t.Errorf("Impose: expected ErrInvalidInput, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// Overlay is a letterhead that is merged underneath the pages of a document.
+// The first page of each letterhead PDF is used.
+type Overlay struct {
+	// FirstPage is the path to the PDF used for the first page of a
+	// document.
+	FirstPage string `json:"firstPage"`
+
+	// FollowingPages is the path to the PDF used for all other pages. If
+	// empty, only the first page receives a letterhead.
+	FollowingPages string `json:"followingPages"`
+}
+
+// Validate checks if the letterhead files exist and can be read.
+func (o Overlay) Validate() error {
+	if o.FirstPage == "" && o.FollowingPages == "" {
+		return fmt.Errorf("at least one of firstPage or followingPages must be set")
+	}
+
+	for _, path := range []string{o.FirstPage, o.FollowingPages} {
+		if path == "" {
+			continue
+		}
+
+		if err := api.ValidateFile(path, newConfig()); err != nil {
+			return fmt.Errorf("letterhead %q: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// ApplyOverlay merges the letterhead underneath the pages of the PDF
+// document.
+func ApplyOverlay(content []byte, overlay Overlay) ([]byte, error) {
+	ctx, err := readContext(content)
+	if err != nil {
+		return nil, err
+	}
+
+	following := make(map[int]bool)
+	for page := 2; page <= ctx.PageCount; page++ {
+		following[page] = true
+	}
+
+	layers := []struct {
+		path  string
+		pages map[int]bool
+	}{
+		{overlay.FirstPage, map[int]bool{1: true}},
+		{overlay.FollowingPages, following},
+	}
+
+	for _, layer := range layers {
+		if layer.path == "" || len(layer.pages) == 0 {
+			continue
+		}
+
+		letterhead, err := os.ReadFile(layer.path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read letterhead: %w", err)
+		}
+
+		wm, err := api.PDFWatermarkForReadSeeker(bytes.NewReader(letterhead), 1, "scalefactor:1 abs, rotation:0, opacity:1, position:c", false, false, types.POINTS)
+		if err != nil {
+			return nil, fmt.Errorf("letterhead %q: %w", layer.path, err)
+		}
+
+		if err := pdfcpu.AddWatermarks(ctx, layer.pages, wm); err != nil {
+			return nil, fmt.Errorf("failed to add letterhead: %w", err)
+		}
+	}
+
+	return writeContext(ctx)
+}
@@ -0,0 +1,115 @@
+package pdf
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeLetterhead stores a one page letterhead in a temporary file and
+// returns its path.
+func writeLetterhead(t *testing.T) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "letterhead.pdf")
+	if err := os.WriteFile(path, pagesPDF(100), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// pageXObjects returns the number of XObjects referenced by each page of
+// content. Letterheads are added as form XObjects.
+func pageXObjects(t *testing.T, content []byte) []int {
+	t.Helper()
+
+	ctx, err := readContext(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := make([]int, ctx.PageCount)
+	for page := 1; page <= ctx.PageCount; page++ {
+		_, _, inherited, err := ctx.PageDict(page, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if inherited.Resources == nil {
+			continue
+		}
+
+		xobjects, err := ctx.DereferenceDict(inherited.Resources["XObject"])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		counts[page-1] = len(xobjects)
+	}
+
+	return counts
+}
+
+func TestOverlayValidate(t *testing.T) {
+	letterhead := writeLetterhead(t)
+
+	cases := []struct {
+		name    string
+		overlay Overlay
+		err     string
+	}{
+		{"first page", Overlay{FirstPage: letterhead}, ""},
+		{"all pages", Overlay{FirstPage: letterhead, FollowingPages: letterhead}, ""},
+		{"empty", Overlay{}, "at least one of"},
+		{"missing file", Overlay{FirstPage: filepath.Join(t.TempDir(), "missing.pdf")}, "letterhead"},
+	}
+
+	for _, c := range cases {
+		err := c.overlay.Validate()
+
+		switch {
+		case c.err == "" && err != nil:
+			t.Errorf("%s: expected no error, got %v", c.name, err)
+		case c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)):
+			t.Errorf("%s: expected an error containing %q, got %v", c.name, c.err, err)
+		}
+	}
+}
+
+func TestApplyOverlay(t *testing.T) {
+	letterhead := writeLetterhead(t)
+
+	cases := []struct {
+		name     string
+		overlay  Overlay
+		expected []int
+	}{
+		{"first page only", Overlay{FirstPage: letterhead}, []int{1, 0, 0}},
+		{"following pages only", Overlay{FollowingPages: letterhead}, []int{0, 1, 1}},
+		{"all pages", Overlay{FirstPage: letterhead, FollowingPages: letterhead}, []int{1, 1, 1}},
+	}
+
+	for _, c := range cases {
+		content, err := ApplyOverlay(pagesPDF(200, 300, 400), c.overlay)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+			continue
+		}
+
+		if widths := pageWidths(t, content); !slices.Equal(widths, []int{200, 300, 400}) {
+			t.Errorf("%s: expected the pages to be unchanged, got widths %v", c.name, widths)
+		}
+
+		if counts := pageXObjects(t, content); !slices.Equal(counts, c.expected) {
+			t.Errorf("%s: expected letterheads %v, got %v", c.name, c.expected, counts)
+		}
+	}
+
+	_, err := ApplyOverlay(pagesPDF(200), Overlay{FirstPage: filepath.Join(t.TempDir(), "missing.pdf")})
+	if err == nil {
+		t.Errorf("expected missing letterheads to fail")
+	}
+}
@@ -0,0 +1,58 @@
+// Package pdf implements manipulation of PDF documents before they are
+// submitted to a printer.
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// ErrInvalidInput is wrapped by all errors caused by invalid user input
+// rather than a broken document.
+var ErrInvalidInput = errors.New("invalid input")
+
+func init() {
+	// prevent pdfcpu from creating a configuration directory in the home
+	// directory of the service user.
+	model.ConfigPath = "disable"
+}
+
+func newConfig() *model.Configuration {
+	conf := model.NewDefaultConfiguration()
+	conf.ValidationMode = model.ValidationRelaxed
+
+	// content streams are modified per page so they must not be shared
+	conf.OptimizeDuplicateContentStreams = false
+
+	return conf
+}
+
+func readContext(content []byte) (*model.Context, error) {
+	ctx, err := api.ReadValidateAndOptimize(bytes.NewReader(content), newConfig())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PDF: %w", err)
+	}
+
+	if err := ctx.EnsurePageCount(); err != nil {
+		return nil, fmt.Errorf("failed to read PDF: %w", err)
+	}
+
+	return ctx, nil
+}
+
+func writeContext(ctx *model.Context) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := api.WriteContext(ctx, buf); err != nil {
+		return nil, fmt.Errorf("failed to write PDF: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func invalidInput(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidInput, fmt.Sprintf(format, args...))
+}
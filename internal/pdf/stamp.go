@@ -0,0 +1,233 @@
+package pdf
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// DefaultAuditFooter is used if an audit footer is requested without
+// specifying a text.
+const DefaultAuditFooter = "{{ .User }} · {{ .Time.Format \"02.01.2006 15:04:05\" }} · {{ .OperationID }} · %p/%P"
+
+// Stamp describes marks that are added to every page of a document.
+type Stamp struct {
+	// Watermark is added to every page.
+	Watermark *Watermark `json:"watermark"`
+
+	// Footer is added to the bottom of every page.
+	Footer *Footer `json:"footer"`
+}
+
+// Watermark is a text or image watermark.
+type Watermark struct {
+	// Text is the watermark text. Text is a Go template that is executed
+	// with StampData. %p and %P are replaced with the current page number
+	// and the total number of pages.
+	Text string `json:"text"`
+
+	// Image is the path to a PNG, JPEG or TIFF image. Only one of Text and
+	// Image may be set.
+	Image string `json:"image"`
+
+	// FontName is one of the PDF core fonts. Defaults to Helvetica.
+	FontName string `json:"fontName"`
+
+	// FontSize is the font size in points. Defaults to 72.
+	FontSize int `json:"fontSize"`
+
+	// Color is a hex color like #808080. Defaults to gray.
+	Color string `json:"color"`
+
+	// Opacity is between 0 and 1. Defaults to 0.3.
+	Opacity float64 `json:"opacity"`
+
+	// Rotation in degrees. Defaults to the page diagonal.
+	Rotation *float64 `json:"rotation"`
+
+	// Position is one of tl, tc, tr, l, c, r, bl, bc, br. Defaults to c.
+	Position string `json:"position"`
+
+	// Scale is the size relative to the page. Defaults to 0.5.
+	Scale float64 `json:"scale"`
+
+	// Background puts the watermark behind the page content. Note that it
+	// might be hidden by opaque content like scanned images.
+	Background bool `json:"background"`
+}
+
+// Footer is a line of text printed at the bottom of each page.
+type Footer struct {
+	// Text is a Go template that is executed with StampData. %p and %P are
+	// replaced with the current page number and the total number of pages.
+	// Defaults to DefaultAuditFooter.
+	Text string `json:"text"`
+
+	// FontSize in points. Defaults to 7.
+	FontSize int `json:"fontSize"`
+
+	// Position is one of bl, bc, br. Defaults to bc.
+	Position string `json:"position"`
+}
+
+// StampData is available in watermark and footer templates.
+type StampData struct {
+	User        string
+	OperationID string
+	Document    string
+	Printer     string
+	Time        time.Time
+}
+
+// Validate checks if the stamp can be applied.
+func (s Stamp) Validate() error {
+	if wm := s.Watermark; wm != nil {
+		if (wm.Text == "") == (wm.Image == "") {
+			return fmt.Errorf("watermark: exactly one of text or image must be set")
+		}
+
+		if _, err := parseTemplate(wm.Text); err != nil {
+			return fmt.Errorf("watermark: %w", err)
+		}
+	}
+
+	if s.Footer != nil {
+		if _, err := parseTemplate(s.Footer.Text); err != nil {
+			return fmt.Errorf("footer: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ApplyStamps adds all stamps to every page of the PDF document.
+func ApplyStamps(content []byte, stamps []Stamp, data StampData) ([]byte, error) {
+	if len(stamps) == 0 {
+		return content, nil
+	}
+
+	ctx, err := readContext(content)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range stamps {
+		var watermarks []*model.Watermark
+
+		if s.Watermark != nil {
+			wm, err := s.Watermark.build(data)
+			if err != nil {
+				return nil, err
+			}
+
+			watermarks = append(watermarks, wm)
+		}
+
+		if s.Footer != nil {
+			wm, err := s.Footer.build(data)
+			if err != nil {
+				return nil, err
+			}
+
+			watermarks = append(watermarks, wm)
+		}
+
+		for _, wm := range watermarks {
+			if err := pdfcpu.AddWatermarks(ctx, nil, wm); err != nil {
+				return nil, fmt.Errorf("failed to add stamp: %w", err)
+			}
+		}
+	}
+
+	return writeContext(ctx)
+}
+
+func (wm *Watermark) build(data StampData) (*model.Watermark, error) {
+	desc := []string{
+		"scalefactor:" + formatFloat(wm.Scale, 0.5) + " rel",
+		"opacity:" + formatFloat(wm.Opacity, 0.3),
+		"position:" + withDefault(wm.Position, "c"),
+	}
+
+	if wm.Rotation != nil {
+		desc = append(desc, "rotation:"+formatFloat(*wm.Rotation, 0))
+	}
+
+	if wm.Image != "" {
+		return api.ImageWatermark(wm.Image, strings.Join(desc, ", "), !wm.Background, false, types.POINTS)
+	}
+
+	text, err := executeTemplate(wm.Text, data)
+	if err != nil {
+		return nil, err
+	}
+
+	desc = append(desc,
+		"fontname:"+withDefault(wm.FontName, "Helvetica"),
+		fmt.Sprintf("points:%d", withDefault(wm.FontSize, 72)),
+		"fillcolor:"+withDefault(wm.Color, "#808080"),
+	)
+
+	return api.TextWatermark(text, strings.Join(desc, ", "), !wm.Background, false, types.POINTS)
+}
+
+func (f *Footer) build(data StampData) (*model.Watermark, error) {
+	text, err := executeTemplate(withDefault(f.Text, DefaultAuditFooter), data)
+	if err != nil {
+		return nil, err
+	}
+
+	desc := []string{
+		"fontname:Helvetica",
+		fmt.Sprintf("points:%d", withDefault(f.FontSize, 7)),
+		"fillcolor:#000000",
+		"scalefactor:1 abs",
+		"rotation:0",
+		"opacity:1",
+		"position:" + withDefault(f.Position, "bc"),
+		"offset:0 10",
+	}
+
+	return api.TextWatermark(text, strings.Join(desc, ", "), true, false, types.POINTS)
+}
+
+func parseTemplate(text string) (*template.Template, error) {
+	return template.New("stamp").Option("missingkey=error").Parse(text)
+}
+
+func executeTemplate(text string, data StampData) (string, error) {
+	t, err := parseTemplate(text)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render stamp text: %w", err)
+	}
+
+	return b.String(), nil
+}
+
+func formatFloat(value, def float64) string {
+	if value == 0 {
+		value = def
+	}
+
+	return fmt.Sprintf("%g", value)
+}
+
+func withDefault[T comparable](value, def T) T {
+	var zero T
+	if value == zero {
+		return def
+	}
+
+	return value
+}
@@ -0,0 +1,107 @@
+package pdf
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStampValidate(t *testing.T) {
+	cases := []struct {
+		name  string
+		stamp Stamp
+		err   string
+	}{
+		{"text watermark", Stamp{Watermark: &Watermark{Text: "Kopie {{ .User }}"}}, ""},
+		{"image watermark", Stamp{Watermark: &Watermark{Image: "logo.png"}}, ""},
+		{"default footer", Stamp{Footer: &Footer{}}, ""},
+		{"watermark without text or image", Stamp{Watermark: &Watermark{}}, "exactly one of text or image"},
+		{"watermark with text and image", Stamp{Watermark: &Watermark{Text: "Kopie", Image: "logo.png"}}, "exactly one of text or image"},
+		{"invalid watermark template", Stamp{Watermark: &Watermark{Text: "{{ .User "}}, "watermark:"},
+		{"invalid footer template", Stamp{Footer: &Footer{Text: "{{ end }}"}}, "footer:"},
+	}
+
+	for _, c := range cases {
+		err := c.stamp.Validate()
+
+		switch {
+		case c.err == "" && err != nil:
+			t.Errorf("%s: expected no error, got %v", c.name, err)
+		case c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)):
+			t.Errorf("%s: expected an error containing %q, got %v", c.name, c.err, err)
+		}
+	}
+}
+
+func TestExecuteTemplate(t *testing.T) {
+	data := StampData{
+		User:        "alice",
+		OperationID: "op-1",
+		Document:    "letter.pdf",
+		Printer:     "prescriptions",
+		Time:        time.Date(2025, 1, 2, 10, 0, 0, 0, time.UTC),
+	}
+
+	// watermarks requested by users are quoted so they are printed as is
+	quoted := func(text string) string {
+		return "{{ " + strconv.Quote(text) + " }}"
+	}
+
+	cases := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{"default audit footer", DefaultAuditFooter, "alice · 02.01.2025 10:00:00 · op-1 · %p/%P"},
+		{"custom footer", "{{ .Document }} on {{ .Printer }}", "letter.pdf on prescriptions"},
+		{"quoted watermark", quoted("KOPIE"), "KOPIE"},
+		{"quoted template", quoted("Kopie {{ .User }}"), "Kopie {{ .User }}"},
+		{"quoted delimiters", quoted(`}} "x" {{`), `}} "x" {{`},
+	}
+
+	for _, c := range cases {
+		text, err := executeTemplate(c.text, data)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+			continue
+		}
+
+		if text != c.expected {
+			t.Errorf("%s: expected %q, got %q", c.name, c.expected, text)
+		}
+	}
+}
+
+func TestApplyStamps(t *testing.T) {
+	data := StampData{User: "alice", OperationID: "op-1", Time: time.Now()}
+
+	content := onePagePDF()
+
+	stamped, err := ApplyStamps(content, []Stamp{
+		{Watermark: &Watermark{Text: "{{ " + strconv.Quote("Kopie {{ .User }}") + " }}"}},
+		{Footer: &Footer{}},
+	}, data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if info := Inspect(stamped); info.Damaged || info.PageCount != 1 {
+		t.Errorf("expected an intact document with 1 page, got %+v", info)
+	}
+
+	if len(stamped) <= len(content) {
+		t.Errorf("expected the stamps to be added to the document")
+	}
+
+	// unknown fields are rejected when the stamp is rendered
+	_, err = ApplyStamps(content, []Stamp{{Footer: &Footer{Text: "{{ .Unknown }}"}}}, data)
+	if err == nil || !strings.Contains(err.Error(), "failed to render stamp text") {
+		t.Errorf("expected unknown template fields to fail, got %v", err)
+	}
+
+	unchanged, err := ApplyStamps(content, nil, data)
+	if err != nil || string(unchanged) != string(content) {
+		t.Errorf("expected the document to be unchanged without stamps, got %v", err)
+	}
+}
@@ -0,0 +1,264 @@
+// Package policy evaluates print policies from the configuration file. A
+// policy may rewrite the print options of matching jobs or deny them.
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// ErrDenied is returned if a print job is rejected by a policy.
+var ErrDenied = errors.New("denied by print policy")
+
+// Config holds the print policies.
+type Config struct {
+	// Rules are evaluated in order and all matching rules apply.
+	Rules []Rule `json:"rules"`
+}
+
+// Rule is a single print policy.
+type Rule struct {
+	// Name identifies the rule in logs, denials and validation reports.
+	Name string `json:"name"`
+
+	// Match holds the conditions of the rule. All conditions must match.
+	Match Match `json:"match"`
+
+	// Deny rejects all matching jobs.
+	Deny bool `json:"deny"`
+
+	// Reason is reported to the user if the rule rejects a job. If empty,
+	// a reason is generated.
+	Reason string `json:"reason"`
+
+	// MaxPages and MaxCopies reject matching jobs with more pages or
+	// copies. Documents with an unknown page count, e.g. images or
+	// PostScript, are rejected by the page limit as well.
+	MaxPages  int `json:"maxPages"`
+	MaxCopies int `json:"maxCopies"`
+
+	// ContentTypes holds glob patterns like image/* of the content types
+	// matching jobs may use. Jobs of other types are rejected.
+	ContentTypes []string `json:"contentTypes"`
+
+	// Options holds print options that replace the ones of the request
+	// using the same keys as the HTTP print endpoint (e.g. color:
+	// grayscale).
+	Options map[string]string `json:"options"`
+
+	// Defaults holds print options that are used if the request does not
+	// set them (e.g. duplex: true).
+	Defaults map[string]string `json:"defaults"`
+}
+
+// Match holds the conditions of a rule. Empty conditions always match.
+type Match struct {
+	// Printers holds glob patterns matched against the target printer or
+	// pool.
+	Printers []string `json:"printers"`
+
+	// Users holds usernames.
+	Users []string `json:"users"`
+
+	// Roles holds role names or IDs of which the user needs at least one.
+	Roles []string `json:"roles"`
+
+	// ExceptUsers and ExceptRoles exclude users from the rule. They are
+	// used to grant an override, e.g. for users with a color-print role.
+	ExceptUsers []string `json:"exceptUsers"`
+	ExceptRoles []string `json:"exceptRoles"`
+
+	// ContentTypes are glob patterns matched against the content type of
+	// the document before it is converted.
+	ContentTypes []string `json:"contentTypes"`
+
+	// MinPages and MaxPages limit the page count of the converted
+	// document. Rules with page conditions do not match documents with an
+	// unknown page count.
+	MinPages int `json:"minPages"`
+	MaxPages int `json:"maxPages"`
+}
+
+// Request holds the attributes of a print job that rules are evaluated
+// against.
+type Request struct {
+	Printer     string   `json:"printer"`
+	ContentType string   `json:"contentType"`
+	User        string   `json:"user"`
+	Roles       []string `json:"roles,omitempty"`
+
+	// Copies holds the number of copies after all options have been
+	// applied. Zero means the printer default is used.
+	Copies int `json:"copies"`
+
+	// HasInfo is set if the page count is known.
+	HasInfo   bool `json:"hasInfo"`
+	PageCount int  `json:"pageCount,omitempty"`
+
+	// PagesPending is set if the document has not been received yet, e.g.
+	// for an IPP Validate-Job request. Page limits are not checked and
+	// rules with page conditions do not match.
+	PagesPending bool `json:"pagesPending,omitempty"`
+}
+
+// Engine evaluates print policies.
+type Engine struct {
+	rules []Rule
+}
+
+// New validates rules and returns a new engine.
+func New(cfg Config) (*Engine, error) {
+	names := make(map[string]bool)
+	for idx, rule := range cfg.Rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("print policy #%d: missing name", idx+1)
+		}
+
+		if names[rule.Name] {
+			return nil, fmt.Errorf("duplicate print policy %q", rule.Name)
+		}
+		names[rule.Name] = true
+
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("print policy %q: %w", rule.Name, err)
+		}
+	}
+
+	return &Engine{
+		rules: cfg.Rules,
+	}, nil
+}
+
+// Rules returns all print policies.
+func (e *Engine) Rules() []Rule {
+	return e.rules
+}
+
+// NeedsInfo returns true if any rule depends on the page count of
+// documents.
+func (e *Engine) NeedsInfo() bool {
+	return slices.ContainsFunc(e.rules, func(rule Rule) bool {
+		return rule.Match.MinPages > 0 || rule.Match.MaxPages > 0 || rule.MaxPages > 0
+	})
+}
+
+// Match returns all rules whose conditions match req in configuration
+// order.
+func (e *Engine) Match(req Request) []Rule {
+	var result []Rule
+
+	for _, rule := range e.rules {
+		if rule.Match.matches(req) {
+			result = append(result, rule)
+		}
+	}
+
+	return result
+}
+
+// Check returns an error wrapping ErrDenied if the rule rejects req. The
+// conditions of the rule are not evaluated, use Engine.Match for that.
+func (r Rule) Check(req Request) error {
+	var reason string
+
+	switch {
+	case r.Deny:
+		reason = "printing is not allowed"
+
+	case len(r.ContentTypes) > 0 && !matchAny(r.ContentTypes, req.ContentType):
+		reason = fmt.Sprintf("documents of type %q are not allowed on printer %q", req.ContentType, req.Printer)
+
+	case r.MaxCopies > 0 && req.Copies > r.MaxCopies:
+		reason = fmt.Sprintf("%d copies requested, at most %d are allowed", req.Copies, r.MaxCopies)
+
+	case r.MaxPages > 0 && req.PagesPending:
+		return nil
+
+	case r.MaxPages > 0 && !req.HasInfo:
+		reason = fmt.Sprintf("the page count of documents of type %q is unknown, at most %d pages are allowed", req.ContentType, r.MaxPages)
+
+	case r.MaxPages > 0 && req.PageCount > r.MaxPages:
+		reason = fmt.Sprintf("the document has %d pages, at most %d are allowed", req.PageCount, r.MaxPages)
+
+	default:
+		return nil
+	}
+
+	if r.Reason != "" {
+		reason = r.Reason
+	}
+
+	return fmt.Errorf("%w %q: %s", ErrDenied, r.Name, reason)
+}
+
+func (r Rule) validate() error {
+	patterns := slices.Concat(r.ContentTypes, r.Match.ContentTypes, r.Match.Printers)
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	m := r.Match
+	if m.MinPages < 0 || m.MaxPages < 0 || (m.MaxPages > 0 && m.MinPages > m.MaxPages) {
+		return fmt.Errorf("invalid page range %d-%d", m.MinPages, m.MaxPages)
+	}
+
+	if r.MaxPages < 0 || r.MaxCopies < 0 {
+		return fmt.Errorf("page and copy limits must not be negative")
+	}
+
+	return nil
+}
+
+func (m Match) matches(req Request) bool {
+	hasRole := func(candidates []string) bool {
+		return slices.ContainsFunc(req.Roles, func(role string) bool {
+			return slices.Contains(candidates, role)
+		})
+	}
+
+	switch {
+	case len(m.Printers) > 0 && !matchAny(m.Printers, req.Printer):
+		return false
+
+	case len(m.Users) > 0 && !slices.Contains(m.Users, req.User):
+		return false
+
+	case len(m.Roles) > 0 && !hasRole(m.Roles):
+		return false
+
+	case slices.Contains(m.ExceptUsers, req.User), hasRole(m.ExceptRoles):
+		return false
+
+	case len(m.ContentTypes) > 0 && !matchAny(m.ContentTypes, req.ContentType):
+		return false
+
+	case (m.MinPages > 0 || m.MaxPages > 0) && !req.HasInfo:
+		return false
+
+	case m.MinPages > 0 && req.PageCount < m.MinPages:
+		return false
+
+	case m.MaxPages > 0 && req.PageCount > m.MaxPages:
+		return false
+	}
+
+	return true
+}
+
+// matchAny matches value case-insensitively against glob patterns.
+func matchAny(patterns []string, value string) bool {
+	value = strings.ToLower(value)
+
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), value); ok {
+			return true
+		}
+	}
+
+	return false
+}
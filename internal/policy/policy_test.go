@@ -0,0 +1,72 @@
+package policy
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestCheckMaxPages(t *testing.T) {
+	rule := Rule{Name: "short", MaxPages: 2}
+
+	cases := []struct {
+		name   string
+		req    Request
+		denied bool
+	}{
+		{"within the limit", Request{HasInfo: true, PageCount: 2}, false},
+		{"too many pages", Request{HasInfo: true, PageCount: 3}, true},
+		{"unknown page count", Request{ContentType: "image/png"}, true},
+		{"pending document", Request{ContentType: "application/pdf", PagesPending: true}, false},
+	}
+
+	for _, c := range cases {
+		err := rule.Check(c.req)
+		if denied := errors.Is(err, ErrDenied); denied != c.denied {
+			t.Errorf("%s: expected denied=%t, got %v", c.name, c.denied, err)
+		}
+	}
+}
+
+func TestMatchExceptRoles(t *testing.T) {
+	engine, err := New(Config{
+		Rules: []Rule{
+			{
+				Name:    "grayscale",
+				Match:   Match{Printers: []string{"office-*"}, ExceptRoles: []string{"color-print"}},
+				Options: map[string]string{"color": "grayscale"},
+			},
+			{
+				Name:      "interns",
+				Match:     Match{Roles: []string{"intern"}, ExceptUsers: []string{"alice"}},
+				MaxCopies: 2,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		req  Request
+		want []string
+	}{
+		{"other printer", Request{Printer: "labels", User: "bob"}, nil},
+		{"no roles", Request{Printer: "office-1", User: "bob"}, []string{"grayscale"}},
+		{"except role", Request{Printer: "Office-1", User: "bob", Roles: []string{"vet", "color-print"}}, nil},
+		{"role", Request{Printer: "labels", User: "bob", Roles: []string{"intern"}}, []string{"interns"}},
+		{"except user", Request{Printer: "office-1", User: "alice", Roles: []string{"intern"}}, []string{"grayscale"}},
+	}
+
+	for _, c := range cases {
+		var names []string
+		for _, rule := range engine.Match(c.req) {
+			names = append(names, rule.Name)
+		}
+
+		if !slices.Equal(names, c.want) {
+			t.Errorf("%s: expected rules %v, got %v", c.name, c.want, names)
+		}
+	}
+}
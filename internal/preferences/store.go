@@ -0,0 +1,243 @@
+// Package preferences stores default printers and print options per user,
+// role and workstation.
+package preferences
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Scope defines who a preference applies to.
+type Scope string
+
+const (
+	ScopeUser        = Scope("user")
+	ScopeRole        = Scope("role")
+	ScopeWorkstation = Scope("workstation")
+)
+
+// ParseScope parses a scope name.
+func ParseScope(value string) (Scope, error) {
+	switch s := Scope(value); s {
+	case ScopeUser, ScopeRole, ScopeWorkstation:
+		return s, nil
+	}
+
+	return "", fmt.Errorf("invalid preference scope %q, expected user, role or workstation", value)
+}
+
+// Preferences holds the default printer and print options of a scope.
+type Preferences struct {
+	// Printer is the default printer. It may be a printer pool.
+	Printer string `json:"printer,omitempty"`
+
+	// Options holds default print options using the same keys as the HTTP
+	// print endpoint.
+	Options map[string]string `json:"options,omitempty"`
+}
+
+// IsZero returns true if p does not hold any preference.
+func (p Preferences) IsZero() bool {
+	return p.Printer == "" && len(p.Options) == 0
+}
+
+// Store holds preferences and persists them in a JSON file.
+type Store struct {
+	path string
+
+	l    sync.RWMutex
+	data map[Scope]map[string]Preferences
+}
+
+// Open loads the preferences stored at path. If path is empty, preferences
+// are only kept in memory.
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path: path,
+		data: make(map[Scope]map[string]Preferences),
+	}
+
+	if path == "" {
+		return s, nil
+	}
+
+	content, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return s, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to read preferences: %w", err)
+	}
+
+	if err := json.Unmarshal(content, &s.data); err != nil {
+		return nil, fmt.Errorf("invalid preferences file %q: %w", path, err)
+	}
+
+	return s, nil
+}
+
+// Get returns the preferences stored for key in scope.
+func (s *Store) Get(scope Scope, key string) (Preferences, bool) {
+	s.l.RLock()
+	defer s.l.RUnlock()
+
+	p, ok := s.data[scope][key]
+
+	return p, ok
+}
+
+// List returns all preferences of scope.
+func (s *Store) List(scope Scope) map[string]Preferences {
+	s.l.RLock()
+	defer s.l.RUnlock()
+
+	return maps.Clone(s.data[scope])
+}
+
+// Set stores the preferences for key in scope. Empty preferences are
+// removed.
+func (s *Store) Set(scope Scope, key string, prefs Preferences) error {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	previous := s.data[scope][key]
+
+	s.put(scope, key, prefs)
+
+	if err := s.save(); err != nil {
+		// keep the in-memory state consistent with the file
+		s.put(scope, key, previous)
+
+		return err
+	}
+
+	return nil
+}
+
+// put stores or removes prefs without saving them.
+func (s *Store) put(scope Scope, key string, prefs Preferences) {
+	if prefs.IsZero() {
+		delete(s.data[scope], key)
+
+		if len(s.data[scope]) == 0 {
+			delete(s.data, scope)
+		}
+
+		return
+	}
+
+	if s.data[scope] == nil {
+		s.data[scope] = make(map[string]Preferences)
+	}
+
+	s.data[scope][key] = prefs
+}
+
+// save writes all preferences to the file. The caller must hold the write
+// lock.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first so the preferences are not lost if
+	// the service is stopped while writing.
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to save preferences: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save preferences: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save preferences: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to save preferences: %w", err)
+	}
+
+	return nil
+}
+
+// Source describes where a resolved preference comes from.
+type Source struct {
+	Scope Scope  `json:"scope"`
+	Key   string `json:"key"`
+}
+
+// Resolved holds the effective preferences of a request.
+type Resolved struct {
+	// Printer is the default printer or empty if none is configured.
+	Printer string `json:"printer,omitempty"`
+
+	// PrinterSource is the scope that defines Printer.
+	PrinterSource *Source `json:"printerSource,omitempty"`
+
+	// Options holds the merged default options.
+	Options map[string]string `json:"options,omitempty"`
+}
+
+// Resolve returns the effective preferences for a request from workstation
+// by user with the given roles. Preferences of the workstation take
+// precedence over the ones of the user so clients always print to a nearby
+// printer, followed by the roles in the given order.
+func (s *Store) Resolve(user string, roles []string, workstation string) Resolved {
+	s.l.RLock()
+	defer s.l.RUnlock()
+
+	var candidates []Source
+	if workstation != "" {
+		candidates = append(candidates, Source{Scope: ScopeWorkstation, Key: workstation})
+	}
+
+	if user != "" {
+		candidates = append(candidates, Source{Scope: ScopeUser, Key: user})
+	}
+
+	for _, role := range roles {
+		candidates = append(candidates, Source{Scope: ScopeRole, Key: role})
+	}
+
+	var result Resolved
+
+	for _, c := range candidates {
+		p, ok := s.data[c.Scope][c.Key]
+		if !ok {
+			continue
+		}
+
+		if result.Printer == "" && p.Printer != "" {
+			result.Printer = p.Printer
+			result.PrinterSource = &c
+		}
+
+		for key, value := range p.Options {
+			if _, ok := result.Options[key]; ok {
+				continue
+			}
+
+			if result.Options == nil {
+				result.Options = make(map[string]string)
+			}
+
+			result.Options[key] = value
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,98 @@
+package preferences
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestResolvePrecedence(t *testing.T) {
+	s, err := Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []struct {
+		scope Scope
+		key   string
+		prefs Preferences
+	}{
+		{ScopeWorkstation, "reception-1", Preferences{Options: map[string]string{"copies": "2"}}},
+		{ScopeUser, "alice", Preferences{Printer: "office", Options: map[string]string{"copies": "1", "color": "monochrome"}}},
+		{ScopeRole, "vet", Preferences{Printer: "surgery", Options: map[string]string{"duplex": "true"}}},
+	} {
+		if err := s.Set(p.scope, p.key, p.prefs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res := s.Resolve("alice", []string{"vet"}, "reception-1")
+
+	if res.Printer != "office" || res.PrinterSource == nil || res.PrinterSource.Scope != ScopeUser {
+		t.Errorf("expected the printer of the user, got %q from %+v", res.Printer, res.PrinterSource)
+	}
+
+	want := map[string]string{"copies": "2", "color": "monochrome", "duplex": "true"}
+	if len(res.Options) != len(want) {
+		t.Fatalf("expected options %v, got %v", want, res.Options)
+	}
+
+	for key, value := range want {
+		if res.Options[key] != value {
+			t.Errorf("expected option %s=%s, got %q", key, value, res.Options[key])
+		}
+	}
+
+	if res := s.Resolve("bob", []string{"vet"}, ""); res.Printer != "surgery" {
+		t.Errorf("expected the printer of the role, got %q", res.Printer)
+	}
+}
+
+func TestStorePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "preferences.json")
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Set(ScopeUser, "alice", Preferences{Printer: "office"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Set(ScopeRole, "vet", Preferences{Printer: "surgery"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// empty preferences are removed
+	if err := s.Set(ScopeRole, "vet", Preferences{}); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p, ok := s.Get(ScopeUser, "alice"); !ok || p.Printer != "office" {
+		t.Errorf("expected the preferences of alice to be loaded, got %+v", p)
+	}
+
+	if _, ok := s.Get(ScopeRole, "vet"); ok {
+		t.Errorf("expected the removed preferences not to be loaded")
+	}
+}
+
+func TestSetFailedSave(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "missing", "preferences.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Set(ScopeUser, "alice", Preferences{Printer: "office"}); err == nil {
+		t.Fatal("expected the preferences not to be saved")
+	}
+
+	if _, ok := s.Get(ScopeUser, "alice"); ok {
+		t.Errorf("expected the in-memory state to be rolled back")
+	}
+}
@@ -0,0 +1,734 @@
+package preview
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+
+	// image decoders for images extracted from PDF documents
+	_ "image/jpeg"
+
+	_ "golang.org/x/image/tiff"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+	"golang.org/x/image/vector"
+)
+
+func init() {
+	// prevent pdfcpu from creating a configuration directory in the home
+	// directory of the service user.
+	model.ConfigPath = "disable"
+}
+
+const (
+	// maxFormDepth limits the nesting of form XObjects.
+	maxFormDepth = 8
+
+	// maxImageEdge is the maximum width and height of rendered images in
+	// pixels. Larger pages are rendered with a lower resolution.
+	maxImageEdge = 4096
+
+	// maxPageEdge is the maximum width and height of pages in points,
+	// which is the largest page size allowed by PDF.
+	maxPageEdge = 14400
+)
+
+// Builtin is a pure-Go rasterizer that renders a simplified version of the
+// first page. Paths, colors and images are drawn while text is shown as
+// gray bars in place of the glyphs, which is good enough for a thumbnail.
+// Rendered images are therefore marked as approximate.
+type Builtin struct{}
+
+// Render implements Rasterizer.
+func (Builtin) Render(ctx context.Context, content []byte, page int, dpi int) (Image, error) {
+	img, err := renderPage(ctx, content, page, dpi)
+	if err != nil {
+		return Image{}, err
+	}
+
+	return Image{
+		PNG:         img,
+		Approximate: true,
+	}, nil
+}
+
+func renderPage(ctx context.Context, content []byte, page int, dpi int) ([]byte, error) {
+	if page != 1 {
+		return nil, fmt.Errorf("built-in rasterizer: page %d: %w", page, ErrPageNotSupported)
+	}
+
+	conf := model.NewDefaultConfiguration()
+	conf.ValidationMode = model.ValidationRelaxed
+
+	pdfCtx, err := api.ReadValidateAndOptimize(bytes.NewReader(content), conf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PDF: %w", err)
+	}
+
+	if err := pdfCtx.EnsurePageCount(); err != nil {
+		return nil, fmt.Errorf("failed to read PDF: %w", err)
+	}
+
+	d, _, inherited, err := pdfCtx.PageDict(page, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get page: %w", err)
+	}
+
+	boundaries, err := pdfCtx.PageBoundaries(types.IntSet{page: true})
+	if err != nil || len(boundaries) == 0 {
+		return nil, fmt.Errorf("failed to get page boundaries: %w", err)
+	}
+
+	pageContent, err := pdfCtx.PageContent(d, page)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get page content: %w", err)
+	}
+
+	resources, _ := pdfCtx.DereferenceDict(d["Resources"])
+	if resources == nil && inherited != nil {
+		resources = inherited.Resources
+	}
+
+	r, err := newRenderer(pdfCtx, boundaries[0], float64(dpi)/72)
+	if err != nil {
+		return nil, fmt.Errorf("built-in rasterizer: %w", err)
+	}
+
+	r.run(ctx, pageContent, resources, 0)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, r.dst); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// matrix is a PDF transformation matrix [a b c d e f].
+type matrix [6]float64
+
+var identity = matrix{1, 0, 0, 1, 0, 0}
+
+// mul returns m × n.
+func (m matrix) mul(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+func (m matrix) apply(x, y float64) (float64, float64) {
+	return x*m[0] + y*m[2] + m[4], x*m[1] + y*m[3] + m[5]
+}
+
+// scale returns the average scale factor of m.
+func (m matrix) scale() float64 {
+	return math.Sqrt(math.Abs(m[0]*m[3] - m[1]*m[2]))
+}
+
+type point struct{ x, y float64 }
+
+type graphicsState struct {
+	ctm         matrix
+	fill        color.RGBA
+	stroke      color.RGBA
+	lineWidth   float64
+	fontSize    float64
+	twoByteFont bool
+	charSpacing float64
+	wordSpacing float64
+	hScale      float64
+	leading     float64
+	rise        float64
+	renderMode  int
+}
+
+type renderer struct {
+	pdf  *model.Context
+	dst  *image.RGBA
+	base matrix
+
+	state graphicsState
+	stack []graphicsState
+
+	// current path in device space
+	path    [][]point
+	current point
+
+	// text state
+	tm, tlm matrix
+}
+
+// newRenderer returns a renderer for a page with the boundaries pb and the
+// scale s from points to pixels. The scale is reduced if the image would
+// exceed maxImageEdge.
+func newRenderer(pdfCtx *model.Context, pb model.PageBoundaries, s float64) (*renderer, error) {
+	box := pb.CropBox()
+	llx, lly, urx, ury := box.LL.X, box.LL.Y, box.UR.X, box.UR.Y
+
+	w, h := box.Width(), box.Height()
+
+	switch {
+	case !(w > 0 && h > 0):
+		return nil, fmt.Errorf("invalid page size %gx%g", w, h)
+	case w > maxPageEdge || h > maxPageEdge:
+		return nil, fmt.Errorf("page size %.0fx%.0f pt exceeds the maximum of %dx%d pt", w, h, maxPageEdge, maxPageEdge)
+	}
+
+	s = min(s, maxImageEdge/max(w, h))
+
+	var base matrix
+	switch ((pb.Rot % 360) + 360) % 360 {
+	case 90:
+		base = matrix{0, s, s, 0, -lly * s, -llx * s}
+		w, h = h, w
+	case 180:
+		base = matrix{-s, 0, 0, s, urx * s, -lly * s}
+	case 270:
+		base = matrix{0, -s, -s, 0, ury * s, urx * s}
+		w, h = h, w
+	default:
+		base = matrix{s, 0, 0, -s, -llx * s, ury * s}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, max(1, int(math.Ceil(w*s))), max(1, int(math.Ceil(h*s)))))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+
+	return &renderer{
+		pdf:  pdfCtx,
+		dst:  dst,
+		base: base,
+		state: graphicsState{
+			ctm:       identity,
+			fill:      color.RGBA{A: 0xff},
+			stroke:    color.RGBA{A: 0xff},
+			lineWidth: 1,
+			hScale:    1,
+		},
+	}, nil
+}
+
+// device returns the transformation from user space to device space.
+func (r *renderer) device() matrix {
+	return r.state.ctm.mul(r.base)
+}
+
+func (r *renderer) run(ctx context.Context, content []byte, resources types.Dict, depth int) {
+	l := &lexer{data: content}
+
+	var operands []token
+
+	for ctx.Err() == nil {
+		tok, ok := l.next()
+		if !ok {
+			return
+		}
+
+		if tok.kind != tokOperator {
+			operands = append(operands, tok)
+			continue
+		}
+
+		if tok.str == "BI" {
+			l.skipInlineImage()
+		} else {
+			r.execute(ctx, tok.str, operands, resources, depth)
+		}
+
+		operands = operands[:0]
+	}
+}
+
+// numbers returns the numeric values of the last n operands. ok is false if
+// there are not enough numeric operands.
+func numbers(operands []token, n int) ([]float64, bool) {
+	if len(operands) < n {
+		return nil, false
+	}
+
+	values := make([]float64, n)
+	for idx, tok := range operands[len(operands)-n:] {
+		if tok.kind != tokNumber {
+			return nil, false
+		}
+
+		values[idx] = tok.num
+	}
+
+	return values, true
+}
+
+func (r *renderer) execute(ctx context.Context, op string, operands []token, resources types.Dict, depth int) {
+	switch op {
+	// graphics state
+	case "q":
+		r.stack = append(r.stack, r.state)
+	case "Q":
+		if n := len(r.stack); n > 0 {
+			r.state = r.stack[n-1]
+			r.stack = r.stack[:n-1]
+		}
+	case "cm":
+		if v, ok := numbers(operands, 6); ok {
+			r.state.ctm = matrix(v).mul(r.state.ctm)
+		}
+	case "w":
+		if v, ok := numbers(operands, 1); ok {
+			r.state.lineWidth = v[0]
+		}
+
+	// colors
+	case "g", "rg", "k", "sc", "scn":
+		if c, ok := parseColor(op, operands); ok {
+			r.state.fill = c
+		}
+	case "G", "RG", "K", "SC", "SCN":
+		if c, ok := parseColor(op, operands); ok {
+			r.state.stroke = c
+		}
+
+	// path construction
+	case "m":
+		if v, ok := numbers(operands, 2); ok {
+			r.current = r.toDevice(v[0], v[1])
+			r.path = append(r.path, []point{r.current})
+		}
+	case "l":
+		if v, ok := numbers(operands, 2); ok {
+			r.lineTo(r.toDevice(v[0], v[1]))
+		}
+	case "c":
+		if v, ok := numbers(operands, 6); ok {
+			r.curveTo(r.toDevice(v[0], v[1]), r.toDevice(v[2], v[3]), r.toDevice(v[4], v[5]))
+		}
+	case "v":
+		if v, ok := numbers(operands, 4); ok {
+			r.curveTo(r.current, r.toDevice(v[0], v[1]), r.toDevice(v[2], v[3]))
+		}
+	case "y":
+		if v, ok := numbers(operands, 4); ok {
+			end := r.toDevice(v[2], v[3])
+			r.curveTo(r.toDevice(v[0], v[1]), end, end)
+		}
+	case "h":
+		r.closePath()
+	case "re":
+		if v, ok := numbers(operands, 4); ok {
+			x, y, w, h := v[0], v[1], v[2], v[3]
+			r.path = append(r.path, []point{
+				r.toDevice(x, y), r.toDevice(x+w, y), r.toDevice(x+w, y+h), r.toDevice(x, y+h), r.toDevice(x, y),
+			})
+			r.current = r.toDevice(x, y)
+		}
+
+	// path painting
+	case "f", "F", "f*":
+		r.fillPath()
+		r.path = nil
+	case "S":
+		r.strokePath()
+		r.path = nil
+	case "s":
+		r.closePath()
+		r.strokePath()
+		r.path = nil
+	case "B", "B*":
+		r.fillPath()
+		r.strokePath()
+		r.path = nil
+	case "b", "b*":
+		r.closePath()
+		r.fillPath()
+		r.strokePath()
+		r.path = nil
+	case "n":
+		r.path = nil
+
+	// text
+	case "BT":
+		r.tm, r.tlm = identity, identity
+	case "Tf":
+		if v, ok := numbers(operands, 1); ok {
+			r.state.fontSize = v[0]
+		}
+		if len(operands) >= 2 && operands[len(operands)-2].kind == tokName {
+			r.state.twoByteFont = r.isTwoByteFont(resources, operands[len(operands)-2].str)
+		}
+	case "Tc":
+		if v, ok := numbers(operands, 1); ok {
+			r.state.charSpacing = v[0]
+		}
+	case "Tw":
+		if v, ok := numbers(operands, 1); ok {
+			r.state.wordSpacing = v[0]
+		}
+	case "Tz":
+		if v, ok := numbers(operands, 1); ok {
+			r.state.hScale = v[0] / 100
+		}
+	case "TL":
+		if v, ok := numbers(operands, 1); ok {
+			r.state.leading = v[0]
+		}
+	case "Ts":
+		if v, ok := numbers(operands, 1); ok {
+			r.state.rise = v[0]
+		}
+	case "Tr":
+		if v, ok := numbers(operands, 1); ok {
+			r.state.renderMode = int(v[0])
+		}
+	case "Td":
+		if v, ok := numbers(operands, 2); ok {
+			r.moveText(v[0], v[1])
+		}
+	case "TD":
+		if v, ok := numbers(operands, 2); ok {
+			r.state.leading = -v[1]
+			r.moveText(v[0], v[1])
+		}
+	case "Tm":
+		if v, ok := numbers(operands, 6); ok {
+			r.tm, r.tlm = matrix(v), matrix(v)
+		}
+	case "T*":
+		r.moveText(0, -r.state.leading)
+	case "Tj":
+		if n := len(operands); n > 0 {
+			r.showText(operands[n-1])
+		}
+	case "'":
+		r.moveText(0, -r.state.leading)
+		if n := len(operands); n > 0 {
+			r.showText(operands[n-1])
+		}
+	case "\"":
+		if v, ok := numbers(operands[:max(0, len(operands)-1)], 2); ok {
+			r.state.wordSpacing, r.state.charSpacing = v[0], v[1]
+		}
+		r.moveText(0, -r.state.leading)
+		if n := len(operands); n > 0 {
+			r.showText(operands[n-1])
+		}
+	case "TJ":
+		if n := len(operands); n > 0 && operands[n-1].kind == tokArray {
+			for _, elem := range operands[n-1].elems {
+				if elem.kind == tokNumber {
+					r.advance(-elem.num / 1000 * r.state.fontSize * r.state.hScale)
+				} else {
+					r.showText(elem)
+				}
+			}
+		}
+
+	// XObjects
+	case "Do":
+		if n := len(operands); n > 0 && operands[n-1].kind == tokName {
+			r.drawXObject(ctx, resources, operands[n-1].str, depth)
+		}
+	}
+}
+
+func parseColor(op string, operands []token) (color.RGBA, bool) {
+	// the number of numeric operands decides the color space for sc/scn
+	var n int
+	for n < len(operands) && operands[len(operands)-1-n].kind == tokNumber {
+		n++
+	}
+
+	switch op {
+	case "g", "G":
+		n = 1
+	case "rg", "RG":
+		n = 3
+	case "k", "K":
+		n = 4
+	}
+
+	v, ok := numbers(operands, n)
+	if !ok {
+		return color.RGBA{}, false
+	}
+
+	clamp := func(f float64) uint8 {
+		return uint8(math.Round(math.Max(0, math.Min(1, f)) * 0xff))
+	}
+
+	switch n {
+	case 1:
+		return color.RGBA{clamp(v[0]), clamp(v[0]), clamp(v[0]), 0xff}, true
+	case 3:
+		return color.RGBA{clamp(v[0]), clamp(v[1]), clamp(v[2]), 0xff}, true
+	case 4:
+		k := 1 - v[3]
+		return color.RGBA{clamp((1 - v[0]) * k), clamp((1 - v[1]) * k), clamp((1 - v[2]) * k), 0xff}, true
+	}
+
+	return color.RGBA{}, false
+}
+
+func (r *renderer) toDevice(x, y float64) point {
+	dx, dy := r.device().apply(x, y)
+	return point{dx, dy}
+}
+
+func (r *renderer) lineTo(p point) {
+	if len(r.path) == 0 {
+		r.path = append(r.path, []point{r.current})
+	}
+
+	r.path[len(r.path)-1] = append(r.path[len(r.path)-1], p)
+	r.current = p
+}
+
+// curveTo flattens a cubic bezier curve into line segments.
+func (r *renderer) curveTo(c1, c2, end point) {
+	const steps = 8
+
+	start := r.current
+	for i := 1; i <= steps; i++ {
+		t := float64(i) / steps
+		mt := 1 - t
+
+		r.lineTo(point{
+			x: mt*mt*mt*start.x + 3*mt*mt*t*c1.x + 3*mt*t*t*c2.x + t*t*t*end.x,
+			y: mt*mt*mt*start.y + 3*mt*mt*t*c1.y + 3*mt*t*t*c2.y + t*t*t*end.y,
+		})
+	}
+}
+
+func (r *renderer) closePath() {
+	if n := len(r.path); n > 0 && len(r.path[n-1]) > 0 {
+		first := r.path[n-1][0]
+		r.lineTo(first)
+	}
+}
+
+func (r *renderer) newRasterizer() *vector.Rasterizer {
+	b := r.dst.Bounds()
+	return vector.NewRasterizer(b.Dx(), b.Dy())
+}
+
+func (r *renderer) paint(z *vector.Rasterizer, c color.RGBA) {
+	z.DrawOp = draw.Over
+	z.Draw(r.dst, r.dst.Bounds(), image.NewUniform(c), image.Point{})
+}
+
+func (r *renderer) fillPath() {
+	z := r.newRasterizer()
+
+	for _, sub := range r.path {
+		if len(sub) < 3 {
+			continue
+		}
+
+		z.MoveTo(float32(sub[0].x), float32(sub[0].y))
+		for _, p := range sub[1:] {
+			z.LineTo(float32(p.x), float32(p.y))
+		}
+		z.ClosePath()
+	}
+
+	r.paint(z, r.state.fill)
+}
+
+func (r *renderer) strokePath() {
+	z := r.newRasterizer()
+
+	// very thin lines would vanish in a thumbnail
+	half := math.Max(r.state.lineWidth*r.device().scale(), 0.7) / 2
+
+	for _, sub := range r.path {
+		for idx := 1; idx < len(sub); idx++ {
+			p0, p1 := sub[idx-1], sub[idx]
+
+			dx, dy := p1.x-p0.x, p1.y-p0.y
+			length := math.Hypot(dx, dy)
+			if length == 0 {
+				continue
+			}
+
+			nx, ny := -dy/length*half, dx/length*half
+
+			z.MoveTo(float32(p0.x+nx), float32(p0.y+ny))
+			z.LineTo(float32(p1.x+nx), float32(p1.y+ny))
+			z.LineTo(float32(p1.x-nx), float32(p1.y-ny))
+			z.LineTo(float32(p0.x-nx), float32(p0.y-ny))
+			z.ClosePath()
+		}
+	}
+
+	r.paint(z, r.state.stroke)
+}
+
+func (r *renderer) moveText(tx, ty float64) {
+	r.tlm = matrix{1, 0, 0, 1, tx, ty}.mul(r.tlm)
+	r.tm = r.tlm
+}
+
+func (r *renderer) advance(tx float64) {
+	r.tm = matrix{1, 0, 0, 1, tx, 0}.mul(r.tm)
+}
+
+// showText draws a bar in place of the glyphs of text and advances the
+// text matrix. Glyph widths are estimated as half of the font size.
+func (r *renderer) showText(text token) {
+	if text.kind != tokString || r.state.fontSize == 0 {
+		return
+	}
+
+	glyphs := len(text.str)
+	if r.state.twoByteFont {
+		glyphs /= 2
+	}
+
+	var spaces int
+	if !r.state.twoByteFont {
+		for _, c := range []byte(text.str) {
+			if c == ' ' {
+				spaces++
+			}
+		}
+	}
+
+	fs, th := r.state.fontSize, r.state.hScale
+	width := (float64(glyphs)*0.5*fs + float64(glyphs)*r.state.charSpacing + float64(spaces)*r.state.wordSpacing) * th
+
+	// render modes 3 and 7 are invisible, e.g. OCR text of scans
+	if mode := r.state.renderMode; glyphs > spaces && mode != 3 && mode != 7 {
+		trm := matrix{1, 0, 0, 1, 0, r.state.rise}.mul(r.tm).mul(r.state.ctm).mul(r.base)
+
+		corners := [4][2]float64{{0, 0.1 * fs}, {width, 0.1 * fs}, {width, 0.6 * fs}, {0, 0.6 * fs}}
+
+		z := r.newRasterizer()
+		for idx, corner := range corners {
+			x, y := trm.apply(corner[0], corner[1])
+			if idx == 0 {
+				z.MoveTo(float32(x), float32(y))
+			} else {
+				z.LineTo(float32(x), float32(y))
+			}
+		}
+		z.ClosePath()
+
+		c := r.state.fill
+		r.paint(z, color.RGBA{c.R / 2, c.G / 2, c.B / 2, 0x80})
+	}
+
+	r.advance(width)
+}
+
+func (r *renderer) isTwoByteFont(resources types.Dict, name string) bool {
+	fonts, _ := r.pdf.DereferenceDict(resources["Font"])
+	if fonts == nil {
+		return false
+	}
+
+	font, _ := r.pdf.DereferenceDict(fonts[name])
+	if font == nil {
+		return false
+	}
+
+	subtype := font.Subtype()
+
+	return subtype != nil && *subtype == "Type0"
+}
+
+func (r *renderer) drawXObject(ctx context.Context, resources types.Dict, name string, depth int) {
+	xobjects, _ := r.pdf.DereferenceDict(resources["XObject"])
+	if xobjects == nil {
+		return
+	}
+
+	ref, ok := xobjects[name].(types.IndirectRef)
+	if !ok {
+		return
+	}
+
+	sd, _, err := r.pdf.DereferenceStreamDict(ref)
+	if err != nil || sd == nil {
+		return
+	}
+
+	subtype := sd.Subtype()
+	if subtype == nil {
+		return
+	}
+
+	switch *subtype {
+	case "Image":
+		r.drawImage(sd, name, ref.ObjectNumber.Value())
+
+	case "Form":
+		if depth >= maxFormDepth {
+			return
+		}
+
+		if err := sd.Decode(); err != nil {
+			return
+		}
+
+		formResources, _ := r.pdf.DereferenceDict(sd.Dict["Resources"])
+		if formResources == nil {
+			formResources = resources
+		}
+
+		saved := r.state
+		if arr := sd.Dict.ArrayEntry("Matrix"); len(arr) == 6 {
+			var m matrix
+			for idx, v := range arr {
+				if f, err := r.pdf.DereferenceNumber(v); err == nil {
+					m[idx] = f
+				}
+			}
+
+			r.state.ctm = m.mul(r.state.ctm)
+		}
+
+		r.run(ctx, sd.Content, formResources, depth+1)
+		r.state = saved
+	}
+}
+
+func (r *renderer) drawImage(sd *types.StreamDict, name string, objNr int) {
+	if mask := sd.BooleanEntry("ImageMask"); mask != nil && *mask {
+		// stencil masks are painted with the fill color, skip them
+		return
+	}
+
+	extracted, err := pdfcpu.ExtractImage(r.pdf, sd, false, name, objNr, false)
+	if err != nil || extracted == nil {
+		return
+	}
+
+	img, _, err := image.Decode(extracted)
+	if err != nil {
+		return
+	}
+
+	// images are drawn into the unit square of user space with the first
+	// row at the top
+	b := img.Bounds()
+	w, h := float64(b.Dx()), float64(b.Dy())
+	d := r.device()
+
+	s2d := f64.Aff3{
+		d[0] / w, -d[2] / h, d[2] + d[4] - d[0]/w*float64(b.Min.X) + d[2]/h*float64(b.Min.Y),
+		d[1] / w, -d[3] / h, d[3] + d[5] - d[1]/w*float64(b.Min.X) + d[3]/h*float64(b.Min.Y),
+	}
+
+	draw.ApproxBiLinear.Transform(r.dst, s2d, img, b, draw.Over, nil)
+}
@@ -0,0 +1,115 @@
+package preview
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"testing"
+)
+
+// pagePDF returns a single page document of the given size in points that
+// draws content.
+func pagePDF(width, height float64, content string) []byte {
+	objs := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %g %g] /Contents 4 0 R /Resources << /Font << /F1 << /Type /Font /Subtype /Type1 /BaseFont /Helvetica >> >> >> >>", width, height),
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+	}
+
+	var buf bytes.Buffer
+
+	buf.WriteString("%PDF-1.4\n")
+
+	offsets := make([]int, len(objs))
+	for i, obj := range objs {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objs)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objs)+1, xref)
+
+	return buf.Bytes()
+}
+
+func render(t *testing.T, content []byte, dpi int) image.Image {
+	t.Helper()
+
+	res, err := Builtin{}.Render(context.Background(), content, 1, dpi)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !res.Approximate {
+		t.Errorf("expected the image to be marked as approximate")
+	}
+
+	img, err := png.Decode(bytes.NewReader(res.PNG))
+	if err != nil {
+		t.Fatalf("failed to decode image: %s", err)
+	}
+
+	return img
+}
+
+func rgba(c color.Color) color.RGBA {
+	return color.RGBAModel.Convert(c).(color.RGBA)
+}
+
+func TestBuiltinRender(t *testing.T) {
+	img := render(t, pagePDF(200, 100, "1 0 0 rg 10 10 50 50 re f q 2 0 0 2 0 0 cm 0 0 1 rg 60 10 10 10 re f Q 0 g BT /F1 20 Tf 120 60 Td (Hello) Tj ET"), 72)
+
+	if b := img.Bounds(); b.Dx() != 200 || b.Dy() != 100 {
+		t.Fatalf("expected a 200x100 image, got %dx%d", b.Dx(), b.Dy())
+	}
+
+	cases := []struct {
+		name string
+		x, y int
+		want color.RGBA
+	}{
+		// the y axis is flipped
+		{"rectangle", 35, 65, color.RGBA{0xff, 0, 0, 0xff}},
+		{"transformed rectangle", 130, 70, color.RGBA{0, 0, 0xff, 0xff}},
+		{"background", 5, 5, color.RGBA{0xff, 0xff, 0xff, 0xff}},
+	}
+
+	for _, c := range cases {
+		if got := rgba(img.At(c.x, c.y)); got != c.want {
+			t.Errorf("%s: expected %v at %d,%d, got %v", c.name, c.want, c.x, c.y, got)
+		}
+	}
+
+	// text is drawn as a gray bar above the baseline
+	if got := rgba(img.At(125, 35)); got.R == 0xff || got.R != got.G || got.G != got.B {
+		t.Errorf("expected a gray text placeholder, got %v", got)
+	}
+}
+
+func TestBuiltinRenderLimits(t *testing.T) {
+	img := render(t, pagePDF(14400, 720, "0 g 0 0 10 10 re f"), 150)
+
+	height := int(math.Ceil(720 * maxImageEdge / 14400.0))
+	if b := img.Bounds(); b.Dx() != maxImageEdge || b.Dy() != height {
+		t.Errorf("expected the image to be scaled down to %dx%d, got %dx%d", maxImageEdge, height, b.Dx(), b.Dy())
+	}
+
+	if _, err := (Builtin{}).Render(context.Background(), pagePDF(20000, 100, ""), 1, 72); err == nil {
+		t.Errorf("expected pages larger than %d pt to be rejected", maxPageEdge)
+	}
+
+	if _, err := (Builtin{}).Render(context.Background(), pagePDF(200, 100, ""), 2, 72); !errors.Is(err, ErrPageNotSupported) {
+		t.Errorf("expected ErrPageNotSupported for page 2, got %v", err)
+	}
+}
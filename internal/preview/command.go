@@ -0,0 +1,74 @@
+package preview
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Command renders pages using an external tool.
+type Command struct {
+	// Tool is one of pdftoppm, mutool or ghostscript.
+	Tool string
+
+	// TempDir is used to store the document while the tool is running. If
+	// empty, the default directory for temporary files is used.
+	TempDir string
+}
+
+// Render implements Rasterizer.
+func (c *Command) Render(ctx context.Context, content []byte, page int, dpi int) (Image, error) {
+	file, err := os.CreateTemp(c.TempDir, "preview-*.pdf")
+	if err != nil {
+		return Image{}, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return Image{}, fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	if err := file.Close(); err != nil {
+		return Image{}, fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	name, args := c.command(file.Name(), page, dpi)
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return Image{}, fmt.Errorf("%s: %w: %s", c.Tool, err, strings.TrimSpace(stderr.String()))
+	}
+
+	if stdout.Len() == 0 {
+		return Image{}, fmt.Errorf("%s: page %d: %w", c.Tool, page, ErrPageNotSupported)
+	}
+
+	return Image{PNG: stdout.Bytes()}, nil
+}
+
+// command returns the command line that writes a PNG of page to stdout.
+func (c *Command) command(path string, page int, dpi int) (string, []string) {
+	p := strconv.Itoa(page)
+	r := strconv.Itoa(dpi)
+
+	switch c.Tool {
+	case "mutool":
+		return "mutool", []string{"draw", "-q", "-F", "png", "-r", r, "-o", "-", path, p}
+
+	case "ghostscript":
+		return "gs", []string{"-q", "-dSAFER", "-dBATCH", "-dNOPAUSE", "-sDEVICE=png16m", "-r" + r, "-dFirstPage=" + p, "-dLastPage=" + p, "-sOutputFile=-", path}
+
+	default:
+		return "pdftoppm", []string{"-png", "-r", r, "-f", p, "-l", p, "-singlefile", path}
+	}
+}
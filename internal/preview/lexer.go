@@ -0,0 +1,272 @@
+package preview
+
+import (
+	"bytes"
+	"strconv"
+)
+
+type tokenKind int
+
+const (
+	tokNumber tokenKind = iota
+	tokName
+	tokString
+	tokArray
+	tokDict
+	tokOperator
+)
+
+// token is a single object or operator of a content stream.
+type token struct {
+	kind tokenKind
+
+	// num holds the value of numbers.
+	num float64
+
+	// str holds names without the leading slash, operators and the raw
+	// bytes of strings.
+	str string
+
+	// elems holds the elements of arrays.
+	elems []token
+}
+
+// lexer splits a PDF content stream into tokens. It is tolerant and skips
+// anything it does not understand.
+type lexer struct {
+	data []byte
+	pos  int
+}
+
+func isWhitespace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+
+	return false
+}
+
+func isDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+
+	return isWhitespace(c)
+}
+
+func (l *lexer) skipWhitespace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+
+		switch {
+		case isWhitespace(c):
+			l.pos++
+
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+
+		default:
+			return
+		}
+	}
+}
+
+// next returns the next token. ok is false at the end of the stream.
+func (l *lexer) next() (tok token, ok bool) {
+	l.skipWhitespace()
+
+	if l.pos >= len(l.data) {
+		return token{}, false
+	}
+
+	switch c := l.data[l.pos]; {
+	case c == '/':
+		l.pos++
+		return token{kind: tokName, str: l.regular()}, true
+
+	case c == '(':
+		return token{kind: tokString, str: l.literalString()}, true
+
+	case c == '<' && l.peek(1) == '<':
+		l.pos += 2
+		l.skipDict()
+		return token{kind: tokDict}, true
+
+	case c == '<':
+		return token{kind: tokString, str: l.hexString()}, true
+
+	case c == '[':
+		l.pos++
+
+		arr := token{kind: tokArray}
+		for {
+			l.skipWhitespace()
+
+			if l.pos >= len(l.data) {
+				return arr, true
+			}
+
+			if l.data[l.pos] == ']' {
+				l.pos++
+				return arr, true
+			}
+
+			elem, ok := l.next()
+			if !ok {
+				return arr, true
+			}
+
+			arr.elems = append(arr.elems, elem)
+		}
+
+	case c == ']' || c == '>' || c == ')' || c == '{' || c == '}':
+		// unbalanced delimiter, skip it
+		l.pos++
+		return l.next()
+	}
+
+	word := l.regular()
+	if num, err := strconv.ParseFloat(word, 64); err == nil {
+		return token{kind: tokNumber, num: num}, true
+	}
+
+	return token{kind: tokOperator, str: word}, true
+}
+
+func (l *lexer) peek(offset int) byte {
+	if l.pos+offset < len(l.data) {
+		return l.data[l.pos+offset]
+	}
+
+	return 0
+}
+
+// regular reads a sequence of regular characters.
+func (l *lexer) regular() string {
+	start := l.pos
+	for l.pos < len(l.data) && !isDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+
+	return string(l.data[start:l.pos])
+}
+
+// skipDict skips a dictionary including nested dictionaries.
+func (l *lexer) skipDict() {
+	depth := 1
+
+	for l.pos < len(l.data) && depth > 0 {
+		switch {
+		case l.data[l.pos] == '(':
+			l.literalString()
+			continue
+		case l.data[l.pos] == '<' && l.peek(1) == '<':
+			depth++
+			l.pos++
+		case l.data[l.pos] == '>' && l.peek(1) == '>':
+			depth--
+			l.pos++
+		}
+
+		l.pos++
+	}
+}
+
+func (l *lexer) literalString() string {
+	var (
+		buf   []byte
+		depth = 0
+	)
+
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+
+		switch c {
+		case '(':
+			depth++
+			if depth == 1 {
+				continue
+			}
+
+		case ')':
+			depth--
+			if depth == 0 {
+				return string(buf)
+			}
+
+		case '\\':
+			if l.pos >= len(l.data) {
+				return string(buf)
+			}
+
+			c = l.data[l.pos]
+			l.pos++
+
+			if c >= '0' && c <= '7' {
+				// octal escape with up to three digits
+				for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+					l.pos++
+				}
+
+				c = '?'
+			}
+		}
+
+		buf = append(buf, c)
+	}
+
+	return string(buf)
+}
+
+func (l *lexer) hexString() string {
+	l.pos++
+
+	end := bytes.IndexByte(l.data[l.pos:], '>')
+	if end < 0 {
+		end = len(l.data) - l.pos
+	}
+
+	var digits int
+	for _, c := range l.data[l.pos : l.pos+end] {
+		if !isWhitespace(c) {
+			digits++
+		}
+	}
+
+	l.pos += end + 1
+
+	// only the length is used for rendering
+	return string(make([]byte, (digits+1)/2))
+}
+
+// skipInlineImage skips the data of an inline image that starts after the
+// BI operator.
+func (l *lexer) skipInlineImage() {
+	for {
+		tok, ok := l.next()
+		if !ok {
+			return
+		}
+
+		if tok.kind == tokOperator && tok.str == "ID" {
+			break
+		}
+	}
+
+	for l.pos < len(l.data)-2 {
+		if isWhitespace(l.data[l.pos]) && l.data[l.pos+1] == 'E' && l.data[l.pos+2] == 'I' &&
+			(l.pos+3 >= len(l.data) || isWhitespace(l.data[l.pos+3])) {
+			l.pos += 3
+			return
+		}
+
+		l.pos++
+	}
+
+	l.pos = len(l.data)
+}
@@ -0,0 +1,86 @@
+package preview
+
+import (
+	"testing"
+)
+
+func TestLexer(t *testing.T) {
+	l := &lexer{data: []byte(`0.5 g % comment
+/F1 12 Tf [(a\)b) -20 <414 2>] TJ << /A << /B (>>) >> >> BI /W 1 ID x EI y ) Q`)}
+
+	want := []token{
+		{kind: tokNumber, num: 0.5},
+		{kind: tokOperator, str: "g"},
+		{kind: tokName, str: "F1"},
+		{kind: tokNumber, num: 12},
+		{kind: tokOperator, str: "Tf"},
+		{kind: tokArray, elems: []token{
+			{kind: tokString, str: "a)b"},
+			{kind: tokNumber, num: -20},
+			{kind: tokString, str: "\x00\x00"},
+		}},
+		{kind: tokOperator, str: "TJ"},
+		{kind: tokDict},
+		{kind: tokOperator, str: "BI"},
+	}
+
+	for idx, w := range want {
+		tok, ok := l.next()
+		if !ok {
+			t.Fatalf("token #%d: unexpected end of stream", idx)
+		}
+
+		if !equalTokens(tok, w) {
+			t.Errorf("token #%d: expected %+v, got %+v", idx, w, tok)
+		}
+	}
+
+	l.skipInlineImage()
+
+	// the unbalanced delimiter is skipped
+	for _, w := range []string{"y", "Q"} {
+		tok, ok := l.next()
+		if !ok || tok.kind != tokOperator || tok.str != w {
+			t.Errorf("expected operator %q, got %+v", w, tok)
+		}
+	}
+
+	if tok, ok := l.next(); ok {
+		t.Errorf("expected the end of the stream, got %+v", tok)
+	}
+}
+
+func TestLexerUnterminated(t *testing.T) {
+	for _, input := range []string{"(abc", "<41", "[1 2", "<< /A 1", "BI /W 1 ID abc"} {
+		l := &lexer{data: []byte(input)}
+
+		for range 10 {
+			tok, ok := l.next()
+			if !ok {
+				break
+			}
+
+			if tok.kind == tokOperator && tok.str == "BI" {
+				l.skipInlineImage()
+			}
+		}
+
+		if _, ok := l.next(); ok {
+			t.Errorf("%q: expected the end of the stream", input)
+		}
+	}
+}
+
+func equalTokens(a, b token) bool {
+	if a.kind != b.kind || a.num != b.num || a.str != b.str || len(a.elems) != len(b.elems) {
+		return false
+	}
+
+	for idx := range a.elems {
+		if !equalTokens(a.elems[idx], b.elems[idx]) {
+			return false
+		}
+	}
+
+	return true
+}
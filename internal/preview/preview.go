@@ -0,0 +1,74 @@
+// Package preview renders PNG thumbnails of PDF documents.
+package preview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrPageNotSupported is returned by rasterizers that cannot render the
+// requested page.
+var ErrPageNotSupported = errors.New("page cannot be rendered")
+
+// Image is a rendered page.
+type Image struct {
+	// PNG holds the PNG encoded image.
+	PNG []byte
+
+	// Approximate is set if the page has been rendered by the built-in
+	// rasterizer which only draws a simplified version of the page.
+	Approximate bool
+}
+
+// Rasterizer renders pages of a PDF document as PNG images.
+type Rasterizer interface {
+	// Render renders page (starting at 1) of the PDF document with the
+	// given resolution.
+	Render(ctx context.Context, content []byte, page int, dpi int) (Image, error)
+}
+
+// New returns the rasterizer for name. Supported names are pdftoppm, mutool
+// and ghostscript which require the respective tool to be installed. An
+// empty name returns the built-in rasterizer that only supports the first
+// page.
+func New(name string, tempDir string) (Rasterizer, error) {
+	switch name {
+	case "":
+		return Builtin{}, nil
+	case "pdftoppm", "mutool", "ghostscript":
+		return &Command{
+			Tool:    name,
+			TempDir: tempDir,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported rasterizer %q", name)
+}
+
+// WithFallback returns a rasterizer that uses fallback for all pages that
+// primary fails to render.
+func WithFallback(primary, fallback Rasterizer) Rasterizer {
+	return fallbackRasterizer{
+		primary:  primary,
+		fallback: fallback,
+	}
+}
+
+type fallbackRasterizer struct {
+	primary  Rasterizer
+	fallback Rasterizer
+}
+
+func (r fallbackRasterizer) Render(ctx context.Context, content []byte, page int, dpi int) (Image, error) {
+	img, err := r.primary.Render(ctx, content, page, dpi)
+	if err == nil {
+		return img, nil
+	}
+
+	if fallback, ferr := r.fallback.Render(ctx, content, page, dpi); ferr == nil {
+		return fallback, nil
+	}
+
+	return Image{}, err
+}
@@ -0,0 +1,56 @@
+package privacy
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	servertiming "github.com/mitchellh/go-server-timing"
+	"github.com/sirupsen/logrus"
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+)
+
+// namedMessage is implemented by requests that carry a document name.
+type namedMessage interface {
+	GetName() string
+}
+
+// NewLoggingInterceptor returns an interceptor that logs handled requests
+// like log.NewLoggingInterceptor but scrubs the document name of the
+// request from logged errors.
+func NewLoggingInterceptor(r *Redactor) connect.UnaryInterceptorFunc {
+	return func(uf connect.UnaryFunc) connect.UnaryFunc {
+		return func(ctx context.Context, ar connect.AnyRequest) (connect.AnyResponse, error) {
+			start := time.Now()
+
+			l := log.L(ctx).WithField("method", ar.Spec().Procedure)
+
+			ctx = log.WithLogger(ctx, l)
+
+			if t := servertiming.FromContext(ctx); t != nil {
+				defer t.NewMetric(strings.ReplaceAll(ar.Spec().Procedure, "/", ".")).Start().Stop()
+			}
+
+			resp, err := uf(ctx, ar)
+
+			l = l.WithFields(logrus.Fields{
+				"duration": time.Since(start),
+			})
+
+			if err != nil {
+				var names []string
+				if msg, ok := ar.Any().(namedMessage); ok {
+					names = append(names, msg.GetName())
+				}
+
+				l = l.WithError(errors.New(r.Scrub(err.Error(), names...)))
+			}
+
+			l.Infof("connect request handled")
+
+			return resp, err
+		}
+	}
+}
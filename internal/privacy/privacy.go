@@ -0,0 +1,147 @@
+// Package privacy keeps personal data contained in document names out of
+// logs and printer queues. Document names often hold the names of patients
+// and owners.
+package privacy
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// Mode selects how document names are written to logs.
+type Mode string
+
+// Supported modes.
+const (
+	// ModeOff logs document names as they are.
+	ModeOff Mode = "off"
+
+	// ModeRedact replaces document names with a placeholder.
+	ModeRedact Mode = "redact"
+
+	// ModePseudonymize replaces document names with a keyed hash so log
+	// entries of the same document can still be correlated.
+	ModePseudonymize Mode = "pseudonymize"
+)
+
+// redacted replaces document names in ModeRedact.
+const redacted = "[redacted]"
+
+// Redactor rewrites document names for logs. A nil Redactor keeps names
+// unchanged.
+type Redactor struct {
+	mode Mode
+	key  []byte
+}
+
+// New returns a redactor for mode. In ModePseudonymize, key is used to
+// derive pseudonyms. If key is empty, a random key is used and pseudonyms
+// change on restart.
+func New(mode string, key string) (*Redactor, error) {
+	r := &Redactor{
+		mode: Mode(strings.ToLower(mode)),
+		key:  []byte(key),
+	}
+
+	switch r.mode {
+	case "":
+		r.mode = ModeOff
+	case ModeOff, ModeRedact:
+	case ModePseudonymize:
+		if len(r.key) == 0 {
+			r.key = make([]byte, 32)
+			if _, err := rand.Read(r.key); err != nil {
+				return nil, fmt.Errorf("failed to generate pseudonym key: %w", err)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported privacy mode %q", mode)
+	}
+
+	return r, nil
+}
+
+// Mode returns the mode of r.
+func (r *Redactor) Mode() Mode {
+	if r == nil {
+		return ModeOff
+	}
+
+	return r.mode
+}
+
+// Name returns name as it may be written to logs. The file extension is
+// kept as it rarely holds personal data but helps to debug conversions.
+func (r *Redactor) Name(name string) string {
+	if name == "" || r.Mode() == ModeOff {
+		return name
+	}
+
+	ext := extension(name)
+
+	if r.mode == ModeRedact {
+		return redacted + ext
+	}
+
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(name))
+
+	return "doc-" + hex.EncodeToString(mac.Sum(nil))[:16] + ext
+}
+
+// Scrub replaces all occurrences of names in s.
+func (r *Redactor) Scrub(s string, names ...string) string {
+	if r.Mode() == ModeOff {
+		return s
+	}
+
+	for _, name := range names {
+		if name != "" {
+			s = strings.ReplaceAll(s, name, r.Name(name))
+		}
+	}
+
+	return s
+}
+
+// extension returns the lower-case file extension of name if it looks like
+// a regular one.
+func extension(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if len(ext) < 2 || len(ext) > 6 {
+		return ""
+	}
+
+	for _, c := range ext[1:] {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9') {
+			return ""
+		}
+	}
+
+	return ext
+}
+
+var defaultRedactor atomic.Pointer[Redactor]
+
+// SetDefault sets the redactor used by Name.
+func SetDefault(r *Redactor) {
+	defaultRedactor.Store(r)
+}
+
+// Default returns the default redactor. It is nil unless set using
+// SetDefault.
+func Default() *Redactor {
+	return defaultRedactor.Load()
+}
+
+// Name returns name as it may be written to logs using the default
+// redactor.
+func Name(name string) string {
+	return Default().Name(name)
+}
@@ -0,0 +1,83 @@
+package privacy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactorName(t *testing.T) {
+	off, err := New("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	redact, err := New("Redact", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pseudo, err := New(string(ModePseudonymize), "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var nilRedactor *Redactor
+
+	cases := []struct {
+		name     string
+		redactor *Redactor
+		input    string
+		want     string
+	}{
+		{"nil", nilRedactor, "Rex Muster.pdf", "Rex Muster.pdf"},
+		{"off", off, "Rex Muster.pdf", "Rex Muster.pdf"},
+		{"redact", redact, "Rex Muster.PDF", "[redacted].pdf"},
+		{"redact without extension", redact, "Rex Muster", "[redacted]"},
+		{"redact unusual extension", redact, "Muster, Rex.Befund vom", "[redacted]"},
+		{"empty", redact, "", ""},
+	}
+
+	for _, c := range cases {
+		if got := c.redactor.Name(c.input); got != c.want {
+			t.Errorf("%s: expected %q, got %q", c.name, c.want, got)
+		}
+	}
+
+	name := pseudo.Name("Rex Muster.pdf")
+	if !strings.HasPrefix(name, "doc-") || !strings.HasSuffix(name, ".pdf") || strings.Contains(name, "Muster") {
+		t.Errorf("unexpected pseudonym %q", name)
+	}
+
+	if pseudo.Name("Rex Muster.pdf") != name {
+		t.Errorf("expected pseudonyms to be stable")
+	}
+
+	if pseudo.Name("Bello Muster.pdf") == name {
+		t.Errorf("expected different names to have different pseudonyms")
+	}
+
+	other, err := New(string(ModePseudonymize), "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if other.Name("Rex Muster.pdf") == name {
+		t.Errorf("expected pseudonyms to depend on the key")
+	}
+
+	if _, err := New("hide", ""); err == nil {
+		t.Errorf("expected an unsupported mode to be rejected")
+	}
+}
+
+func TestRedactorScrub(t *testing.T) {
+	r, err := New(string(ModeRedact), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := r.Scrub(`open /spool/Rex Muster.pdf: permission denied`, "Rex Muster.pdf", "")
+	if want := `open /spool/[redacted].pdf: permission denied`; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
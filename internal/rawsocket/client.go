@@ -0,0 +1,346 @@
+package rawsocket
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phin1x/go-ipp"
+	"github.com/tierklinik-dobersberg/print-service/internal/backend"
+	"github.com/tierklinik-dobersberg/print-service/internal/cups"
+)
+
+// Protocol defines the printer language used to query the device status.
+type Protocol string
+
+const (
+	// ProtocolRaw does not support status queries.
+	ProtocolRaw = Protocol("raw")
+
+	// ProtocolZPL uses the Zebra ~HS host status command.
+	ProtocolZPL = Protocol("zpl")
+
+	// ProtocolESCPOS uses the ESC/POS DLE EOT real-time status command.
+	ProtocolESCPOS = Protocol("escpos")
+)
+
+const (
+	defaultPort    = "9100"
+	defaultTimeout = 10 * time.Second
+
+	// maxHistory is the number of jobs that are kept per printer.
+	maxHistory = 100
+)
+
+// PrinterConfig configures a printer that accepts raw data on a TCP
+// socket (AppSocket/JetDirect).
+type PrinterConfig struct {
+	// Name is the name of the printer as used in print requests.
+	Name string `json:"name"`
+
+	// Address is the host and port of the printer. The port defaults to 9100.
+	Address string `json:"address"`
+
+	// Protocol is used to query the device status. Defaults to raw which
+	// does not support status queries.
+	Protocol Protocol `json:"protocol"`
+
+	// Location, Description and Model are reported when listing printers.
+	Location    string `json:"location"`
+	Description string `json:"description"`
+	Model       string `json:"model"`
+
+	// Default marks the printer as the default printer.
+	Default bool `json:"default"`
+}
+
+// Client is a printer backend that sends raw data to printers using a TCP
+// connection. Since the protocol does not have a notion of jobs, a local
+// job history is kept for each printer.
+type Client struct {
+	printers map[string]*printer
+	order    []string
+
+	defaultPrinter string
+
+	l         sync.Mutex
+	lastJobID int
+}
+
+type printer struct {
+	PrinterConfig
+
+	// l protects jobs
+	l    sync.Mutex
+	jobs []*cups.Job
+
+	// send serializes connections to the printer
+	send sync.Mutex
+}
+
+// Compile time check
+var _ backend.PrinterBackend = (*Client)(nil)
+
+// NewClient creates a new backend for the configured printers.
+func NewClient(printers []PrinterConfig) (*Client, error) {
+	cli := &Client{
+		printers: make(map[string]*printer, len(printers)),
+	}
+
+	for _, cfg := range printers {
+		if cfg.Name == "" {
+			return nil, fmt.Errorf("printer %q: missing name", cfg.Address)
+		}
+
+		if _, ok := cli.printers[cfg.Name]; ok {
+			return nil, fmt.Errorf("printer %q: duplicate name", cfg.Name)
+		}
+
+		if _, _, err := net.SplitHostPort(cfg.Address); err != nil {
+			cfg.Address = net.JoinHostPort(cfg.Address, defaultPort)
+		}
+
+		switch cfg.Protocol {
+		case "":
+			cfg.Protocol = ProtocolRaw
+		case ProtocolRaw, ProtocolZPL, ProtocolESCPOS:
+		default:
+			return nil, fmt.Errorf("printer %q: unsupported protocol %q", cfg.Name, cfg.Protocol)
+		}
+
+		cli.printers[cfg.Name] = &printer{
+			PrinterConfig: cfg,
+		}
+		cli.order = append(cli.order, cfg.Name)
+
+		if cfg.Default && cli.defaultPrinter == "" {
+			cli.defaultPrinter = cfg.Name
+		}
+	}
+
+	return cli, nil
+}
+
+func (cli *Client) HasPrinter(name string) bool {
+	_, ok := cli.printers[name]
+	return ok
+}
+
+func (cli *Client) DefaultPrinter() string {
+	return cli.defaultPrinter
+}
+
+func (cli *Client) ListPrinters() ([]cups.Printer, error) {
+	result := make([]cups.Printer, 0, len(cli.order))
+
+	for _, name := range cli.order {
+		p := cli.printers[name]
+
+		printer := cups.Printer{
+			Name:      p.Name,
+			URI:       p.uri(),
+			Location:  p.Location,
+			Info:      p.Description,
+			Model:     p.Model,
+			State:     cups.PrinterStateIdle,
+			Accepting: true,
+		}
+
+		// do not query the status while a job is being sent since most
+		// printers only accept one connection at a time.
+		if p.isBusy() {
+			printer.State = cups.PrinterStateProcessing
+			printer.QueuedJobs = 1
+			result = append(result, printer)
+
+			continue
+		}
+
+		status, err := p.queryStatus()
+		switch {
+		case err != nil:
+			printer.State = cups.PrinterStateStopped
+			printer.StateReason = "offline-report"
+			printer.StateReasons = []string{printer.StateReason}
+			printer.StateMessage = err.Error()
+
+		case len(status) > 0:
+			printer.State = cups.PrinterStateStopped
+			printer.StateReason = status[0]
+			printer.StateReasons = status
+			printer.StateMessage = strings.Join(status, ", ")
+		}
+
+		result = append(result, printer)
+	}
+
+	return result, nil
+}
+
+func (cli *Client) ListJobs(name string) ([]cups.Job, error) {
+	p, ok := cli.printers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown printer %q", name)
+	}
+
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	jobs := make([]cups.Job, len(p.jobs))
+	for idx, j := range p.jobs {
+		jobs[idx] = *j
+	}
+
+	return jobs, nil
+}
+
+func (cli *Client) GetJob(name string, id int) (cups.Job, error) {
+	p, ok := cli.printers[name]
+	if !ok {
+		return cups.Job{}, fmt.Errorf("unknown printer %q", name)
+	}
+
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	for _, j := range p.jobs {
+		if j.ID == id {
+			return *j, nil
+		}
+	}
+
+	return cups.Job{}, fmt.Errorf("job %d: %w", id, backend.ErrJobNotFound)
+}
+
+func (cli *Client) Print(doc ipp.Document, name string, attrs map[string]any) (int, error) {
+	p, ok := cli.printers[name]
+	if !ok {
+		return -1, fmt.Errorf("unknown printer %q", name)
+	}
+
+	switch {
+	case doc.MimeType == "application/pdf",
+		doc.MimeType == ipp.MimeTypePostscript,
+		strings.HasPrefix(doc.MimeType, "image/"):
+		return -1, fmt.Errorf("printer %q only accepts raw printer data, got %q", name, doc.MimeType)
+	}
+
+	// raw printers cannot report problems once the data is sent so check
+	// the device status before submitting the job.
+	if !p.isBusy() {
+		status, err := p.queryStatus()
+		if err != nil {
+			return -1, fmt.Errorf("printer %q is not reachable: %w", name, err)
+		}
+
+		if len(status) > 0 {
+			return -1, fmt.Errorf("printer %q is not ready: %s", name, strings.Join(status, ", "))
+		}
+	}
+
+	// the document must be read before returning since the caller closes
+	// the document source afterwards.
+	data, err := io.ReadAll(doc.Document)
+	if err != nil {
+		return -1, fmt.Errorf("failed to read document: %w", err)
+	}
+
+	copies := 1
+	if c, ok := attrs[ipp.AttributeCopies].(int); ok && c > 0 {
+		copies = c
+	}
+
+	cli.l.Lock()
+	cli.lastJobID++
+	job := &cups.Job{
+		ID:          cli.lastJobID,
+		Name:        doc.Name,
+		State:       cups.JobStatePending,
+		PrinterName: p.Name,
+		PrinterURI:  p.uri(),
+	}
+	cli.l.Unlock()
+
+	job.OperationID, _ = attrs[cups.AttributeLongRunningOperationID].(string)
+
+	p.addJob(job)
+
+	go p.run(job, data, copies)
+
+	return job.ID, nil
+}
+
+func (p *printer) uri() string {
+	return "socket://" + p.Address
+}
+
+func (p *printer) addJob(job *cups.Job) {
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	p.jobs = append(p.jobs, job)
+	if len(p.jobs) > maxHistory {
+		p.jobs = p.jobs[len(p.jobs)-maxHistory:]
+	}
+}
+
+func (p *printer) setState(job *cups.Job, state cups.JobState, progress int) {
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	job.State = state
+	job.Progress = progress
+}
+
+func (p *printer) isBusy() bool {
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	for _, j := range p.jobs {
+		if j.State == cups.JobStateProcessing {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *printer) run(job *cups.Job, data []byte, copies int) {
+	p.send.Lock()
+	defer p.send.Unlock()
+
+	p.setState(job, cups.JobStateProcessing, 0)
+
+	for i := 0; i < copies; i++ {
+		if err := p.write(data); err != nil {
+			slog.Error("failed to send job to raw printer", "printer", p.Name, "jobId", job.ID, "error", err)
+			p.setState(job, cups.JobStateAborted, i*100/copies)
+			return
+		}
+
+		p.setState(job, cups.JobStateProcessing, (i+1)*100/copies)
+	}
+
+	p.setState(job, cups.JobStateComplete, 100)
+}
+
+func (p *printer) write(data []byte) error {
+	conn, err := net.DialTimeout("tcp", p.Address, defaultTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.SetWriteDeadline(time.Now().Add(time.Minute)); err != nil {
+		return err
+	}
+
+	_, err = io.Copy(conn, bytes.NewReader(data))
+
+	return err
+}
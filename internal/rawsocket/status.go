@@ -0,0 +1,175 @@
+package rawsocket
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const statusTimeout = 3 * time.Second
+
+// queryStatus queries the device status using the configured protocol and
+// returns a list of IPP printer-state-reasons keywords for all problems
+// found. An empty result means the printer is ready.
+func (p *printer) queryStatus() ([]string, error) {
+	switch p.Protocol {
+	case ProtocolZPL:
+		return p.queryZPLStatus()
+
+	case ProtocolESCPOS:
+		return p.queryESCPOSStatus()
+
+	default:
+		// we can only check if the printer accepts connections
+		conn, err := net.DialTimeout("tcp", p.Address, statusTimeout)
+		if err != nil {
+			return nil, err
+		}
+		conn.Close()
+
+		return nil, nil
+	}
+}
+
+// queryZPLStatus sends the ~HS host status command and parses the first two
+// of the three returned status strings.
+func (p *printer) queryZPLStatus() ([]string, error) {
+	p.send.Lock()
+	defer p.send.Unlock()
+
+	conn, err := net.DialTimeout("tcp", p.Address, statusTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(statusTimeout)); err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.Write([]byte("~HS")); err != nil {
+		return nil, err
+	}
+
+	// each status string is wrapped in STX (0x02) and ETX (0x03)
+	var (
+		lines [][]string
+		buf   bytes.Buffer
+		b     = make([]byte, 1)
+	)
+
+	for len(lines) < 2 {
+		if _, err := conn.Read(b); err != nil {
+			return nil, fmt.Errorf("failed to read host status: %w", err)
+		}
+
+		switch b[0] {
+		case 0x02:
+			buf.Reset()
+		case 0x03:
+			lines = append(lines, strings.Split(buf.String(), ","))
+		default:
+			buf.WriteByte(b[0])
+		}
+	}
+
+	return parseZPLStatus(lines[0], lines[1])
+}
+
+func parseZPLStatus(first, second []string) ([]string, error) {
+	if len(first) < 3 || len(second) < 4 {
+		return nil, fmt.Errorf("unexpected host status response")
+	}
+
+	var reasons []string
+
+	// string 1: aaa,b,c,... with b = paper out and c = pause
+	if first[1] == "1" {
+		reasons = append(reasons, "media-empty")
+	}
+	if first[2] == "1" {
+		reasons = append(reasons, "paused")
+	}
+
+	// string 2: mmm,n,o,p,... with o = head up and p = ribbon out
+	if second[2] == "1" {
+		reasons = append(reasons, "cover-open")
+	}
+	if second[3] == "1" {
+		reasons = append(reasons, "marker-supply-empty")
+	}
+
+	return reasons, nil
+}
+
+// queryESCPOSStatus uses DLE EOT n to query the offline, error and paper
+// sensor status.
+func (p *printer) queryESCPOSStatus() ([]string, error) {
+	p.send.Lock()
+	defer p.send.Unlock()
+
+	conn, err := net.DialTimeout("tcp", p.Address, statusTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var reasons []string
+
+	for _, n := range []byte{2, 4} {
+		if err := conn.SetDeadline(time.Now().Add(statusTimeout)); err != nil {
+			return nil, err
+		}
+
+		if _, err := conn.Write([]byte{0x10, 0x04, n}); err != nil {
+			return nil, err
+		}
+
+		b := make([]byte, 1)
+		if _, err := io.ReadFull(conn, b); err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				return nil, fmt.Errorf("printer did not answer status request")
+			}
+
+			return nil, err
+		}
+
+		for _, reason := range parseESCPOSStatus(n, b[0]) {
+			if !slices.Contains(reasons, reason) {
+				reasons = append(reasons, reason)
+			}
+		}
+	}
+
+	return reasons, nil
+}
+
+func parseESCPOSStatus(n byte, status byte) []string {
+	var reasons []string
+
+	switch n {
+	case 2: // offline cause status
+		if status&0x04 != 0 {
+			reasons = append(reasons, "cover-open")
+		}
+		if status&0x20 != 0 {
+			reasons = append(reasons, "media-empty")
+		}
+		if status&0x40 != 0 {
+			reasons = append(reasons, "other")
+		}
+
+	case 4: // roll paper sensor status
+		if status&0x60 != 0 {
+			reasons = append(reasons, "media-empty")
+		}
+	}
+
+	return reasons
+}
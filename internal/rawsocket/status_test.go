@@ -0,0 +1,95 @@
+package rawsocket
+
+import (
+	"net"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseZPLStatus(t *testing.T) {
+	cases := []struct {
+		name   string
+		first  string
+		second string
+		want   []string
+	}{
+		{"ready", "030,0,0,1245,000,0,0,0,000,0,0,0", "000,0,0,0,0,2,4,0,00000000,1,000", nil},
+		{"paper out", "030,1,0,1245,000,0,0,0,000,0,0,0", "000,0,0,0,0,2,4,0,00000000,1,000", []string{"media-empty"}},
+		{"paused", "030,0,1,1245,000,0,0,0,000,0,0,0", "000,0,0,0,0,2,4,0,00000000,1,000", []string{"paused"}},
+		{"head up and ribbon out", "030,0,0,1245,000,0,0,0,000,0,0,0", "000,0,1,1,0,2,4,0,00000000,1,000", []string{"cover-open", "marker-supply-empty"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			reasons, err := parseZPLStatus(strings.Split(c.first, ","), strings.Split(c.second, ","))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(reasons, c.want) {
+				t.Errorf("expected %v, got %v", c.want, reasons)
+			}
+		})
+	}
+
+	if _, err := parseZPLStatus([]string{"030"}, []string{"000"}); err == nil {
+		t.Errorf("expected an error for a truncated status")
+	}
+}
+
+func TestParseESCPOSStatus(t *testing.T) {
+	cases := []struct {
+		n      byte
+		status byte
+		want   []string
+	}{
+		{2, 0x12, nil},
+		{2, 0x16, []string{"cover-open"}},
+		{2, 0x72, []string{"media-empty", "other"}},
+		{4, 0x12, nil},
+		{4, 0x72, []string{"media-empty"}},
+	}
+
+	for _, c := range cases {
+		if reasons := parseESCPOSStatus(c.n, c.status); !slices.Equal(reasons, c.want) {
+			t.Errorf("n=%d status=%#x: expected %v, got %v", c.n, c.status, c.want, reasons)
+		}
+	}
+}
+
+func TestQueryZPLStatus(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		cmd := make([]byte, 3)
+		if _, err := conn.Read(cmd); err != nil || string(cmd) != "~HS" {
+			return
+		}
+
+		conn.Write([]byte("\x02030,1,0,1245,000,0,0,0,000,0,0,0\x03\r\n" +
+			"\x02000,0,0,0,0,2,4,0,00000000,1,000\x03\r\n" +
+			"\x021234,0\x03\r\n"))
+	}()
+
+	p := &printer{PrinterConfig: PrinterConfig{Address: l.Addr().String(), Protocol: ProtocolZPL}}
+
+	reasons, err := p.queryStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(reasons, []string{"media-empty"}) {
+		t.Errorf("expected the printer to be out of paper, got %v", reasons)
+	}
+}
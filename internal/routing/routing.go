@@ -0,0 +1,394 @@
+// Package routing selects the target printer and default print options of
+// documents using rules from the configuration file.
+package routing
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrNoRoute is returned if a document is sent to a logical target but no
+// rule matches.
+var ErrNoRoute = errors.New("no routing rule matches")
+
+// Config holds the routing rules.
+type Config struct {
+	// Rules are evaluated in order and the first matching rule is used.
+	Rules []Rule `json:"rules"`
+}
+
+// Rule routes matching documents to a printer.
+type Rule struct {
+	// Name identifies the rule in logs and ExplainRouting.
+	Name string `json:"name"`
+
+	// Targets holds logical printer names the rule applies to. Rules
+	// without targets only apply to documents that do not specify a
+	// printer.
+	Targets []string `json:"targets"`
+
+	// Match holds the conditions of the rule. All conditions must match.
+	Match Match `json:"match"`
+
+	// Printer is the printer or pool that receives matching documents.
+	Printer string `json:"printer"`
+
+	// Options holds default print options using the same keys as the HTTP
+	// print endpoint. Options set by the request take precedence.
+	Options map[string]string `json:"options"`
+}
+
+// Match holds the conditions of a rule. Empty conditions always match.
+type Match struct {
+	// ContentTypes are glob patterns like image/* matched against the
+	// content type of the document before it is converted.
+	ContentTypes []string `json:"contentTypes"`
+
+	// Names are glob patterns like *.zpl matched case-insensitively against
+	// the document name.
+	Names []string `json:"names"`
+
+	// MinPages and MaxPages limit the page count of PDF documents.
+	MinPages int `json:"minPages"`
+	MaxPages int `json:"maxPages"`
+
+	// Media matches PDF documents with at least one page of the given
+	// paper sizes (e.g. A3).
+	Media []string `json:"media"`
+
+	// Users holds usernames.
+	Users []string `json:"users"`
+
+	// Roles holds role names or IDs of which the user needs at least one.
+	Roles []string `json:"roles"`
+
+	// Workstations and Locations are glob patterns matched against the
+	// X-Workstation and X-Location headers of the request.
+	Workstations []string `json:"workstations"`
+	Locations    []string `json:"locations"`
+
+	// Weekdays holds the days (mon, tue, ...) the rule applies to.
+	Weekdays []string `json:"weekdays"`
+
+	// Time is a time of day range like 07:00-12:00 in local time. Ranges
+	// may span midnight (e.g. 22:00-06:00).
+	Time string `json:"time"`
+}
+
+// Request holds the attributes of a print request that rules match
+// against.
+type Request struct {
+	ContentType string    `json:"contentType"`
+	Name        string    `json:"name"`
+	User        string    `json:"user"`
+	Roles       []string  `json:"roles,omitempty"`
+	Workstation string    `json:"workstation,omitempty"`
+	Location    string    `json:"location,omitempty"`
+	Time        time.Time `json:"time"`
+
+	// HasInfo is set if the page count and media are known. Rules with
+	// page or media conditions do not match otherwise.
+	HasInfo   bool     `json:"hasInfo"`
+	PageCount int      `json:"pageCount,omitempty"`
+	Media     []string `json:"media,omitempty"`
+
+	// PagesPending is set if the document has not been received yet, e.g.
+	// for an IPP Validate-Job request. Page and media conditions are
+	// ignored so the rule selected for the submitted document is used.
+	PagesPending bool `json:"pagesPending,omitempty"`
+}
+
+// Evaluation is the result of evaluating a single rule.
+type Evaluation struct {
+	Rule    string `json:"rule"`
+	Matched bool   `json:"matched"`
+
+	// Reason describes the first condition that did not match.
+	Reason string `json:"reason,omitempty"`
+}
+
+// Decision is the result of routing a document.
+type Decision struct {
+	// Rule is the name of the matching rule. It is empty if no rule
+	// matched.
+	Rule string `json:"rule,omitempty"`
+
+	// Printer is the printer selected by the rule. It is empty if no rule
+	// matched.
+	Printer string `json:"printer,omitempty"`
+
+	// Options holds the default print options of the rule.
+	Options map[string]string `json:"options,omitempty"`
+
+	// Evaluations holds the result of all evaluated rules.
+	Evaluations []Evaluation `json:"evaluations"`
+}
+
+// Engine evaluates routing rules.
+type Engine struct {
+	rules   []Rule
+	times   []timeRange
+	targets map[string]bool
+}
+
+// New validates rules and returns a new engine.
+func New(cfg Config) (*Engine, error) {
+	e := &Engine{
+		rules:   cfg.Rules,
+		times:   make([]timeRange, len(cfg.Rules)),
+		targets: make(map[string]bool),
+	}
+
+	names := make(map[string]bool)
+	for idx, rule := range cfg.Rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("routing rule #%d: missing name", idx+1)
+		}
+
+		if names[rule.Name] {
+			return nil, fmt.Errorf("duplicate routing rule %q", rule.Name)
+		}
+		names[rule.Name] = true
+
+		if rule.Printer == "" {
+			return nil, fmt.Errorf("routing rule %q: missing printer", rule.Name)
+		}
+
+		if err := rule.Match.validate(); err != nil {
+			return nil, fmt.Errorf("routing rule %q: %w", rule.Name, err)
+		}
+
+		if rule.Match.Time != "" {
+			tr, err := parseTimeRange(rule.Match.Time)
+			if err != nil {
+				return nil, fmt.Errorf("routing rule %q: %w", rule.Name, err)
+			}
+
+			e.times[idx] = tr
+		}
+
+		for _, target := range rule.Targets {
+			e.targets[target] = true
+		}
+	}
+
+	return e, nil
+}
+
+// Rules returns all routing rules.
+func (e *Engine) Rules() []Rule {
+	return e.rules
+}
+
+// Applies returns true if documents sent to printer are routed. This is the
+// case if printer is empty or a logical target of a rule.
+func (e *Engine) Applies(printer string) bool {
+	return printer == "" || e.targets[printer]
+}
+
+// NeedsInfo returns true if any rule matches on the page count or media
+// of documents.
+func (e *Engine) NeedsInfo() bool {
+	for _, rule := range e.rules {
+		if rule.Match.MinPages > 0 || rule.Match.MaxPages > 0 || len(rule.Match.Media) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Route evaluates all rules that apply to target and returns the first
+// matching one. If target is a logical target and no rule matches,
+// ErrNoRoute is returned together with the evaluations.
+func (e *Engine) Route(target string, req Request) (Decision, error) {
+	decision := Decision{
+		Evaluations: []Evaluation{},
+	}
+
+	for idx, rule := range e.rules {
+		if !appliesTo(rule, target) {
+			continue
+		}
+
+		reason := rule.Match.mismatch(req, e.times[idx])
+		decision.Evaluations = append(decision.Evaluations, Evaluation{
+			Rule:    rule.Name,
+			Matched: reason == "",
+			Reason:  reason,
+		})
+
+		if reason == "" {
+			decision.Rule = rule.Name
+			decision.Printer = rule.Printer
+			decision.Options = rule.Options
+
+			return decision, nil
+		}
+	}
+
+	if target != "" {
+		return decision, fmt.Errorf("%w for target %q", ErrNoRoute, target)
+	}
+
+	return decision, nil
+}
+
+func appliesTo(rule Rule, target string) bool {
+	if target == "" {
+		return len(rule.Targets) == 0
+	}
+
+	return slices.Contains(rule.Targets, target)
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+func (m Match) validate() error {
+	patterns := slices.Concat(m.ContentTypes, m.Names, m.Workstations, m.Locations)
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	for _, day := range m.Weekdays {
+		if _, ok := weekdays[strings.ToLower(day)]; !ok {
+			return fmt.Errorf("invalid weekday %q", day)
+		}
+	}
+
+	if m.MinPages < 0 || m.MaxPages < 0 || (m.MaxPages > 0 && m.MinPages > m.MaxPages) {
+		return fmt.Errorf("invalid page range %d-%d", m.MinPages, m.MaxPages)
+	}
+
+	return nil
+}
+
+// mismatch returns a description of the first condition that does not
+// match req or an empty string if all conditions match.
+func (m Match) mismatch(req Request, tr timeRange) string {
+	// page and media conditions are checked once the document is known
+	checkInfo := !req.PagesPending
+
+	switch {
+	case len(m.ContentTypes) > 0 && !matchAny(m.ContentTypes, req.ContentType):
+		return fmt.Sprintf("content type %q does not match", req.ContentType)
+
+	case len(m.Names) > 0 && !matchAny(m.Names, req.Name):
+		return fmt.Sprintf("document name %q does not match", req.Name)
+
+	case checkInfo && (m.MinPages > 0 || m.MaxPages > 0) && !req.HasInfo:
+		return "page count is unknown"
+
+	case checkInfo && m.MinPages > 0 && req.PageCount < m.MinPages:
+		return fmt.Sprintf("page count %d is less than %d", req.PageCount, m.MinPages)
+
+	case checkInfo && m.MaxPages > 0 && req.PageCount > m.MaxPages:
+		return fmt.Sprintf("page count %d is more than %d", req.PageCount, m.MaxPages)
+
+	case checkInfo && len(m.Media) > 0 && !req.HasInfo:
+		return "media is unknown"
+
+	case checkInfo && len(m.Media) > 0 && !slices.ContainsFunc(req.Media, func(media string) bool { return containsFold(m.Media, media) }):
+		return fmt.Sprintf("media %v does not match", req.Media)
+
+	case len(m.Users) > 0 && !slices.Contains(m.Users, req.User):
+		return fmt.Sprintf("user %q does not match", req.User)
+
+	case len(m.Roles) > 0 && !slices.ContainsFunc(req.Roles, func(role string) bool { return slices.Contains(m.Roles, role) }):
+		return "user does not have a matching role"
+
+	case len(m.Workstations) > 0 && !matchAny(m.Workstations, req.Workstation):
+		return fmt.Sprintf("workstation %q does not match", req.Workstation)
+
+	case len(m.Locations) > 0 && !matchAny(m.Locations, req.Location):
+		return fmt.Sprintf("location %q does not match", req.Location)
+
+	case len(m.Weekdays) > 0 && !slices.ContainsFunc(m.Weekdays, func(day string) bool { return weekdays[strings.ToLower(day)] == req.Time.Weekday() }):
+		return fmt.Sprintf("weekday %s does not match", req.Time.Weekday())
+
+	case m.Time != "" && !tr.contains(req.Time):
+		return fmt.Sprintf("time %s is outside of %s", req.Time.Format("15:04"), m.Time)
+	}
+
+	return ""
+}
+
+// matchAny matches value case-insensitively against glob patterns.
+func matchAny(patterns []string, value string) bool {
+	value = strings.ToLower(value)
+
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), value); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsFold(values []string, value string) bool {
+	return slices.ContainsFunc(values, func(v string) bool {
+		return strings.EqualFold(v, value)
+	})
+}
+
+// timeRange is a time of day range in minutes since midnight.
+type timeRange struct {
+	from, to int
+}
+
+func parseTimeRange(value string) (timeRange, error) {
+	from, to, ok := strings.Cut(value, "-")
+	if !ok {
+		return timeRange{}, fmt.Errorf("invalid time range %q, expected HH:MM-HH:MM", value)
+	}
+
+	var (
+		tr  timeRange
+		err error
+	)
+
+	if tr.from, err = parseClock(from); err != nil {
+		return timeRange{}, err
+	}
+
+	if tr.to, err = parseClock(to); err != nil {
+		return timeRange{}, err
+	}
+
+	return tr, nil
+}
+
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (tr timeRange) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+
+	if tr.from <= tr.to {
+		return minute >= tr.from && minute < tr.to
+	}
+
+	// the range spans midnight
+	return minute >= tr.from || minute < tr.to
+}
@@ -0,0 +1,109 @@
+package routing
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTimeRangeContains(t *testing.T) {
+	cases := []struct {
+		rng   string
+		clock string
+		want  bool
+	}{
+		{"07:00-12:00", "07:00", true},
+		{"07:00-12:00", "11:59", true},
+		{"07:00-12:00", "12:00", false},
+		{"07:00-12:00", "06:59", false},
+		{"22:00-06:00", "22:00", true},
+		{"22:00-06:00", "23:30", true},
+		{"22:00-06:00", "00:00", true},
+		{"22:00-06:00", "05:59", true},
+		{"22:00-06:00", "06:00", false},
+		{"22:00-06:00", "12:00", false},
+	}
+
+	for _, c := range cases {
+		tr, err := parseTimeRange(c.rng)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		clock, err := time.Parse("15:04", c.clock)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := tr.contains(clock); got != c.want {
+			t.Errorf("%s contains %s: expected %t, got %t", c.rng, c.clock, c.want, got)
+		}
+	}
+}
+
+func TestParseTimeRangeInvalid(t *testing.T) {
+	for _, value := range []string{"", "07:00", "7-12", "07:00-25:00"} {
+		if _, err := parseTimeRange(value); err == nil {
+			t.Errorf("expected %q to be rejected", value)
+		}
+	}
+}
+
+func TestRoute(t *testing.T) {
+	engine, err := New(Config{
+		Rules: []Rule{
+			{
+				Name:    "night-labels",
+				Targets: []string{"labels"},
+				Match:   Match{Names: []string{"*.zpl"}, Time: "22:00-06:00"},
+				Printer: "zebra-night",
+			},
+			{
+				Name:    "labels",
+				Targets: []string{"labels"},
+				Match:   Match{Names: []string{"*.zpl"}},
+				Printer: "zebra",
+			},
+			{
+				Name:    "large",
+				Match:   Match{MinPages: 50},
+				Printer: "office",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	night := time.Date(2025, 3, 3, 23, 0, 0, 0, time.Local)
+	day := time.Date(2025, 3, 3, 10, 0, 0, 0, time.Local)
+
+	decision, err := engine.Route("labels", Request{Name: "Tag.ZPL", Time: night})
+	if err != nil || decision.Printer != "zebra-night" {
+		t.Errorf("expected the night rule to match, got %+v, %v", decision, err)
+	}
+
+	decision, err = engine.Route("labels", Request{Name: "tag.zpl", Time: day})
+	if err != nil || decision.Printer != "zebra" || len(decision.Evaluations) != 2 {
+		t.Errorf("expected the second rule to match, got %+v, %v", decision, err)
+	}
+
+	if _, err := engine.Route("labels", Request{Name: "tag.pdf", Time: day}); !errors.Is(err, ErrNoRoute) {
+		t.Errorf("expected ErrNoRoute, got %v", err)
+	}
+
+	decision, err = engine.Route("", Request{Name: "report.pdf", Time: day})
+	if err != nil || decision.Rule != "" || decision.Evaluations[0].Reason != "page count is unknown" {
+		t.Errorf("expected documents without info not to match page conditions, got %+v, %v", decision, err)
+	}
+
+	decision, err = engine.Route("", Request{Name: "report.pdf", Time: day, HasInfo: true, PageCount: 80})
+	if err != nil || decision.Printer != "office" {
+		t.Errorf("expected the large document rule to match, got %+v, %v", decision, err)
+	}
+
+	decision, err = engine.Route("", Request{Name: "report.pdf", Time: day, PagesPending: true})
+	if err != nil || decision.Printer != "office" {
+		t.Errorf("expected page conditions to be ignored while the document is pending, got %+v, %v", decision, err)
+	}
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	v1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/printing/v1"
+	"github.com/tierklinik-dobersberg/apis/pkg/auth"
+	"github.com/tierklinik-dobersberg/print-service/internal/accounting"
+	"github.com/tierklinik-dobersberg/print-service/internal/audit"
+	"github.com/tierklinik-dobersberg/print-service/internal/backend"
+	"github.com/tierklinik-dobersberg/print-service/internal/cups"
+	"github.com/tierklinik-dobersberg/print-service/internal/pdf"
+	"github.com/tierklinik-dobersberg/print-service/internal/privacy"
+)
+
+// accountingRoles returns the roles of user stored in usage records and
+// matched by quotas. Only the role IDs are used so a job is not counted
+// twice when grouping by role.
+func accountingRoles(user *auth.RemoteUser) []string {
+	return slices.Clone(user.RoleIDs)
+}
+
+// usageRecord returns the accounting record of a job with the impressions
+// and sheets estimated from the document info. info may be nil if the page
+// count is unknown.
+func usageRecord(user *auth.RemoteUser, document *v1.Document, printer string, opts PrintOptions, info *pdf.Info) accounting.Record {
+	r := accounting.Record{
+		User:     user.Username,
+		Roles:    accountingRoles(user),
+		Printer:  printer,
+		Document: document.Name,
+		Copies:   max(opts.Copies, 1),
+		Color:    opts.ColorMode == cups.ColorModeColor,
+		Duplex:   opts.sides() != "" && opts.sides() != cups.SidesOneSided,
+	}
+
+	if info != nil {
+		r.Pages = info.PageCount
+		r.Media = info.Media()
+		r.Color = info.Color && opts.ColorMode != cups.ColorModeMonochrome
+	}
+
+	r.Estimate()
+
+	return r
+}
+
+// reserveQuota returns a ResourceExhausted error if record exceeds a hard
+// quota of the user and records the denial in the audit trail. Otherwise
+// the estimated usage is reserved until the job is finished, see
+// trackUsage. Exceeded soft quotas are only logged.
+func (svc *Service) reserveQuota(ctx context.Context, record accounting.Record, action string) error {
+	statuses, err := svc.providers.Accounting.Reserve(record)
+	if err != nil {
+		slog.Warn("print job denied by quota", "name", privacy.Name(record.Document), "printer", record.Printer, "user", record.User, "error", err)
+
+		svc.providers.Audit.Record(ctx, audit.Event{
+			Action:   audit.ActionQuotaDenied,
+			User:     record.User,
+			Printer:  record.Printer,
+			Document: record.Document,
+			Reason:   err.Error(),
+			Details: map[string]string{
+				"request": action,
+			},
+		})
+
+		return connect.NewError(connect.CodeResourceExhausted, err)
+	}
+
+	for _, s := range statuses {
+		if s.SoftExceeded {
+			slog.Warn("soft print quota exceeded", "quota", s.Quota, "user", record.User, "impressions", s.Usage.Impressions, "cost", s.Usage.Cost)
+		}
+	}
+
+	return nil
+}
+
+// trackUsage adds record to the accounting ledger once the job of op is
+// finished, which replaces the reservation of reserveQuota. Impressions and
+// sheets reported by the printer replace the estimate, see jobUsage.
+func (svc *Service) trackUsage(op *backend.Operation, record accounting.Record) {
+	op.OnComplete(func(j cups.Job) {
+		record = jobUsage(record, j)
+		record.Time = time.Now()
+
+		if err := svc.providers.Accounting.Add(record); err != nil {
+			slog.Error("failed to record print usage", "operation-id", record.OperationID, "user", record.User, "error", err)
+		}
+	})
+}
+
+// jobUsage updates the estimated usage of record with the final state of
+// job j. Aborted and canceled jobs that lack reported counters are recorded
+// without usage. The estimate is kept for jobs whose final state is
+// unknown, e.g. because the printer could not be polled anymore, since
+// they have most likely been printed.
+func jobUsage(record accounting.Record, j cups.Job) accounting.Record {
+	record.JobID = j.ID
+	record.State = j.State.String()
+
+	if j.PrinterName != "" {
+		record.Printer = j.PrinterName
+	}
+
+	switch {
+	case j.ImpressionsCompleted > 0:
+		record.Impressions = j.ImpressionsCompleted
+		if j.MediaSheetsCompleted > 0 {
+			record.Sheets = j.MediaSheetsCompleted
+		}
+
+		record.Reported = true
+
+	case j.State == cups.JobStateAborted, j.State == cups.JobStateCanceled:
+		record.Impressions = 0
+		record.Sheets = 0
+	}
+
+	return record
+}
+
+// parseMonth parses a month like 2025-01. An empty value returns the
+// current month.
+func parseMonth(value string) (time.Time, error) {
+	if value == "" {
+		return accounting.MonthOf(time.Now()), nil
+	}
+
+	t, err := time.ParseInLocation("2006-01", value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid month %q, expected YYYY-MM", value)
+	}
+
+	return t, nil
+}
+
+// usageResponse is returned by HandleGetUsage.
+type usageResponse struct {
+	User   string                   `json:"user"`
+	Month  string                   `json:"month"`
+	Totals accounting.Totals        `json:"totals"`
+	Quotas []accounting.QuotaStatus `json:"quotas,omitempty"`
+}
+
+// HandleGetUsage returns the print usage of the calling user in the month
+// given by the month query parameter (YYYY-MM), defaulting to the current
+// one. Administrators may query other users using the user parameter.
+// Quotas are only reported for the current month of the calling user.
+func (svc *Service) HandleGetUsage(w http.ResponseWriter, r *http.Request) {
+	user, err := svc.UserFromHeader(r.Context(), r.Header)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	query := r.URL.Query()
+
+	month, err := parseMonth(query.Get("month"))
+	if err != nil {
+		writeError(w, connect.NewError(connect.CodeInvalidArgument, err))
+		return
+	}
+
+	username := query.Get("user")
+	if username == "" {
+		username = user.Username
+	}
+
+	if username != user.Username && !svc.isAdmin(user) {
+		writeError(w, connect.NewError(connect.CodePermissionDenied, fmt.Errorf("you're not allowed to read the usage of other users")))
+		return
+	}
+
+	if username != user.Username {
+		svc.auditAdmin(r.Context(), user, "get-usage", map[string]string{
+			"user":  username,
+			"month": month.Format("2006-01"),
+		})
+	}
+
+	ledger := svc.providers.Accounting
+
+	res := usageResponse{
+		User:   username,
+		Month:  month.Format("2006-01"),
+		Totals: ledger.Usage(username, month),
+	}
+
+	if username == user.Username && month.Equal(accounting.MonthOf(time.Now())) {
+		res.Quotas = ledger.Quotas(user.Username, accountingRoles(user))
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+// listUsageResponse is returned by HandleListUsage.
+type listUsageResponse struct {
+	Month   string                   `json:"month"`
+	GroupBy accounting.Grouping      `json:"groupBy"`
+	Groups  []accounting.GroupTotals `json:"groups"`
+	Total   accounting.Totals        `json:"total"`
+}
+
+// HandleListUsage returns the print usage of all users grouped by user,
+// role or printer as selected by the group query parameter. The month is
+// selected like for HandleGetUsage. Only administrators may list the usage.
+func (svc *Service) HandleListUsage(w http.ResponseWriter, r *http.Request) {
+	user, err := svc.UserFromHeader(r.Context(), r.Header)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if !svc.isAdmin(user) {
+		writeError(w, connect.NewError(connect.CodePermissionDenied, fmt.Errorf("you're not allowed to list the print usage")))
+		return
+	}
+
+	query := r.URL.Query()
+
+	month, err := parseMonth(query.Get("month"))
+	if err != nil {
+		writeError(w, connect.NewError(connect.CodeInvalidArgument, err))
+		return
+	}
+
+	group, err := accounting.ParseGrouping(query.Get("group"))
+	if err != nil {
+		writeError(w, connect.NewError(connect.CodeInvalidArgument, err))
+		return
+	}
+
+	svc.auditAdmin(r.Context(), user, "list-usage", map[string]string{
+		"month": month.Format("2006-01"),
+		"group": string(group),
+	})
+
+	ledger := svc.providers.Accounting
+
+	res := listUsageResponse{
+		Month:   month.Format("2006-01"),
+		GroupBy: group,
+		Groups:  ledger.ListUsage(month, group),
+		Total:   ledger.Total(month),
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
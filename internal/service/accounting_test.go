@@ -0,0 +1,68 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	idmv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1"
+	v1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/printing/v1"
+	"github.com/tierklinik-dobersberg/apis/pkg/auth"
+	"github.com/tierklinik-dobersberg/print-service/internal/accounting"
+	"github.com/tierklinik-dobersberg/print-service/internal/cups"
+)
+
+func TestJobUsage(t *testing.T) {
+	estimate := accounting.Record{Pages: 3, Copies: 2}
+	estimate.Estimate()
+
+	cases := []struct {
+		name     string
+		job      cups.Job
+		want     int
+		reported bool
+	}{
+		{"complete", cups.Job{State: cups.JobStateComplete}, 6, false},
+		{"unknown", cups.Job{State: cups.JobStateUnknown}, 6, false},
+		{"aborted", cups.Job{State: cups.JobStateAborted}, 0, false},
+		{"canceled", cups.Job{State: cups.JobStateCanceled}, 0, false},
+		{"reported", cups.Job{State: cups.JobStateAborted, ImpressionsCompleted: 2}, 2, true},
+	}
+
+	for _, c := range cases {
+		record := jobUsage(estimate, c.job)
+
+		if record.Impressions != c.want || record.Reported != c.reported {
+			t.Errorf("%s: expected %d impressions (reported=%t), got %d (reported=%t)", c.name, c.want, c.reported, record.Impressions, record.Reported)
+		}
+	}
+}
+
+func TestUsageByRole(t *testing.T) {
+	ledger, err := accounting.Open(accounting.Config{
+		Quotas: []accounting.Quota{{Name: "vets", Roles: []string{"r1"}, Hard: accounting.Limit{Impressions: 2}}},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := &auth.RemoteUser{
+		Username:      "alice",
+		RoleIDs:       []string{"r1"},
+		ResolvedRoles: []*idmv1.Role{{Id: "r1", Name: "vets"}},
+	}
+
+	record := usageRecord(user, &v1.Document{Name: "letter.pdf"}, "office", PrintOptions{}, nil)
+	if err := ledger.Add(record); err != nil {
+		t.Fatal(err)
+	}
+
+	groups := ledger.ListUsage(accounting.MonthOf(time.Now()), accounting.GroupByRole)
+	if len(groups) != 1 || groups[0].Key != "r1" || groups[0].Jobs != 1 {
+		t.Errorf("expected the job to be counted once for role r1, got %+v", groups)
+	}
+
+	statuses := ledger.Quotas(user.Username, accountingRoles(user))
+	if len(statuses) != 1 || statuses[0].Usage.Jobs != 1 {
+		t.Errorf("expected the role quota to count the job, got %+v", statuses)
+	}
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/apis/pkg/auth"
+	"github.com/tierklinik-dobersberg/print-service/internal/audit"
+)
+
+// Actions checked against the printer ACL.
+const (
+	actionPrint    = "print"
+	actionPreview  = "preview"
+	actionListJobs = "list-jobs"
+)
+
+// canUsePrinter returns nil if user may use printer. Anonymous requests are
+// checked without a username and roles.
+func (svc *Service) canUsePrinter(user *auth.RemoteUser, printer string) error {
+	if user == nil {
+		return svc.providers.ACL.Check(printer, "", nil)
+	}
+
+	return svc.providers.ACL.Check(printer, user.Username, userRoles(user))
+}
+
+// checkPrinterAccess returns a PermissionDenied error if user must not
+// perform action on printer. Denied attempts are recorded in the audit
+// trail.
+func (svc *Service) checkPrinterAccess(ctx context.Context, user *auth.RemoteUser, printer string, action string, document string) error {
+	err := svc.canUsePrinter(user, printer)
+	if err == nil {
+		return nil
+	}
+
+	var username string
+	if user != nil {
+		username = user.Username
+	}
+
+	slog.Warn("denied printer access", "printer", printer, "action", action, "user", username, "error", err)
+
+	svc.providers.Audit.Record(ctx, audit.Event{
+		Action:   audit.ActionAccessDenied,
+		User:     username,
+		Printer:  printer,
+		Document: document,
+		Reason:   err.Error(),
+		Details: map[string]string{
+			"request": action,
+		},
+	})
+
+	return connect.NewError(connect.CodePermissionDenied, err)
+}
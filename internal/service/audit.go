@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/tierklinik-dobersberg/apis/pkg/auth"
+	"github.com/tierklinik-dobersberg/print-service/internal/audit"
+	"github.com/tierklinik-dobersberg/print-service/internal/backend"
+	"github.com/tierklinik-dobersberg/print-service/internal/cups"
+)
+
+// submissionEvent returns the audit event of a submitted job. It describes
+// the document using its metadata only.
+func submissionEvent(op *backend.Operation, sub submission, historyID string) audit.Event {
+	action := audit.ActionSubmitted
+	if sub.reprintOf != "" {
+		action = audit.ActionReprinted
+	}
+
+	details := map[string]string{
+		"operationId": op.ID(),
+		"contentType": sub.mime,
+		"size":        strconv.FormatInt(sub.size, 10),
+	}
+
+	for key, value := range sub.opts.values() {
+		details["option."+key] = value
+	}
+
+	if historyID != "" {
+		details["historyId"] = historyID
+	}
+
+	if sub.reprintOf != "" {
+		details["reprintOf"] = sub.reprintOf
+	}
+
+	if sub.info != nil {
+		details["pages"] = strconv.Itoa(sub.info.PageCount)
+	}
+
+	return audit.Event{
+		Action:   action,
+		User:     sub.user.Username,
+		Printer:  sub.printer,
+		Document: sub.document.Name,
+		Details:  details,
+	}
+}
+
+// trackJobEvents records jobs of op that are moved to another printer of a
+// pool or cancelled. event is the submission event of the job and recorded
+// is closed once it has been recorded so the job events follow it in the
+// audit trail.
+func (svc *Service) trackJobEvents(op *backend.Operation, event audit.Event, recorded <-chan struct{}) {
+	var printer string
+
+	details := func(j cups.Job) map[string]string {
+		return map[string]string{
+			"operationId": op.ID(),
+			"jobId":       strconv.Itoa(j.ID),
+			"historyId":   event.Details["historyId"],
+		}
+	}
+
+	op.OnUpdate(func(j cups.Job) {
+		if printer != "" && j.PrinterName != printer {
+			<-recorded
+
+			d := details(j)
+			d["from"] = printer
+
+			svc.providers.Audit.Record(context.Background(), audit.Event{
+				Action:   audit.ActionMoved,
+				User:     event.User,
+				Printer:  j.PrinterName,
+				Document: event.Document,
+				Details:  d,
+			})
+		}
+
+		printer = j.PrinterName
+	})
+
+	op.OnComplete(func(j cups.Job) {
+		if j.State != cups.JobStateCanceled {
+			return
+		}
+
+		<-recorded
+
+		svc.providers.Audit.Record(context.Background(), audit.Event{
+			Action:   audit.ActionCancelled,
+			User:     event.User,
+			Printer:  j.PrinterName,
+			Document: event.Document,
+			Details:  details(j),
+		})
+	})
+}
+
+// auditAdmin records an administrative request of user.
+func (svc *Service) auditAdmin(ctx context.Context, user *auth.RemoteUser, operation string, details map[string]string) {
+	if details == nil {
+		details = make(map[string]string, 1)
+	}
+
+	details["operation"] = operation
+
+	svc.providers.Audit.Record(ctx, audit.Event{
+		Action:  audit.ActionAdmin,
+		User:    user.Username,
+		Details: details,
+	})
+}
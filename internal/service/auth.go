@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/apis/pkg/auth"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// UserFromHeader extracts the remote user from the X-Remote-* headers added
+// by the forward-authentication proxy.
+// The auth annotation interceptor only handles unary RPCs so streaming
+// handlers must use this method to authenticate the caller. Role names are
+// resolved like the interceptor does so printer ACLs, policies and quotas
+// match the same roles on every path.
+func (svc *Service) UserFromHeader(ctx context.Context, header http.Header) (*auth.RemoteUser, error) {
+	req := connect.NewRequest(&emptypb.Empty{})
+	for key, values := range header {
+		req.Header()[key] = values
+	}
+
+	user, err := auth.RemoteHeaderExtractor(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.ID == "" {
+		return nil, connect.NewError(connect.CodeUnauthenticated, fmt.Errorf("unauthentication"))
+	}
+
+	if err := svc.resolveRoles(ctx, &user); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// resolveRoles adds the definitions of the roles of user. Nothing is done if
+// the RoleService is not available. Requests fail if a role cannot be
+// resolved since deny rules may reference its name.
+func (svc *Service) resolveRoles(ctx context.Context, user *auth.RemoteUser) error {
+	resolve := svc.providers.Roles
+	if resolve == nil || len(user.ResolvedRoles) > 0 {
+		return nil
+	}
+
+	for _, id := range user.RoleIDs {
+		role, err := resolve(ctx, id)
+		if err != nil {
+			slog.Error("failed to resolve role", "user", user.Username, "role-id", id, "error", err)
+
+			return connect.NewError(connect.CodeUnavailable, fmt.Errorf("failed to resolve role %q", id))
+		}
+
+		user.ResolvedRoles = append(user.ResolvedRoles, role)
+	}
+
+	return nil
+}
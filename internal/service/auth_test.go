@@ -0,0 +1,191 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"path/filepath"
+	"testing"
+
+	idmv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1"
+	"github.com/tierklinik-dobersberg/print-service/internal/accounting"
+	"github.com/tierklinik-dobersberg/print-service/internal/acl"
+	"github.com/tierklinik-dobersberg/print-service/internal/audit"
+	"github.com/tierklinik-dobersberg/print-service/internal/backend"
+	"github.com/tierklinik-dobersberg/print-service/internal/config"
+	"github.com/tierklinik-dobersberg/print-service/internal/history"
+	"github.com/tierklinik-dobersberg/print-service/internal/policy"
+	"github.com/tierklinik-dobersberg/print-service/internal/preferences"
+	"github.com/tierklinik-dobersberg/print-service/internal/routing"
+)
+
+// testRoles maps role IDs to names. Unknown IDs fail to resolve.
+func testRoles(names map[string]string) func(context.Context, string) (*idmv1.Role, error) {
+	return func(_ context.Context, id string) (*idmv1.Role, error) {
+		name, ok := names[id]
+		if !ok {
+			return nil, errors.New("role not found")
+		}
+
+		return &idmv1.Role{Id: id, Name: name}, nil
+	}
+}
+
+// newHTTPService returns a service with the providers required by the HTTP
+// handlers up to the submission of a job.
+func newHTTPService(t *testing.T, rules acl.Config) *Service {
+	t.Helper()
+
+	access, err := acl.New(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router, err := routing.New(routing.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policies, err := policy.New(policy.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prefs, err := preferences.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ledger, err := accounting.Open(accounting.Config{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svc, err := New(&config.Providers{
+		Config:      &config.Config{},
+		Printers:    backend.NewRegistry(&jobsBackend{printer: "prescriptions"}),
+		Roles:       testRoles(map[string]string{"r-intern": "intern", "r-admin": "admin"}),
+		Routing:     router,
+		Preferences: prefs,
+		ACL:         access,
+		Policies:    policies,
+		Accounting:  ledger,
+		Audit:       audit.New(nil),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return svc
+}
+
+// printRequest returns a /print request that uploads a text file as a user
+// with the given role ID.
+func printRequest(t *testing.T, printer string, role string) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	if err := mw.WriteField("printer", printer); err != nil {
+		t.Fatal(err)
+	}
+
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Disposition": {`form-data; name="file"; filename="test.txt"`},
+		"Content-Type":        {"text/plain"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte("hello"))
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/print", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("X-Remote-User-ID", "u1")
+	req.Header.Set("X-Remote-User", "alice")
+	req.Header.Set("X-Remote-Role", role)
+
+	return req
+}
+
+func TestHandlePrintDenyRoleName(t *testing.T) {
+	svc := newHTTPService(t, acl.Config{
+		Printers: map[string]acl.Rule{
+			"prescriptions": {DenyRoles: []string{"intern"}},
+		},
+	})
+
+	rec := httptest.NewRecorder()
+	svc.HandlePrint(rec, printRequest(t, "prescriptions", "r-intern"))
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected the role name to be denied, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestHandlePrintUnresolvedRole(t *testing.T) {
+	svc := newHTTPService(t, acl.Config{})
+
+	rec := httptest.NewRecorder()
+	svc.HandlePrint(rec, printRequest(t, "prescriptions", "r-unknown"))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected unresolved roles to fail the request, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestUserFromHeaderResolvesRoles(t *testing.T) {
+	svc := newHTTPService(t, acl.Config{})
+
+	header := make(http.Header)
+	header.Set("X-Remote-User-ID", "u1")
+	header.Set("X-Remote-User", "alice")
+	header.Add("X-Remote-Role", "r-intern")
+	header.Add("X-Remote-Role", "r-admin")
+
+	user, err := svc.UserFromHeader(context.Background(), header)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roles := userRoles(user)
+	if len(roles) != 4 || roles[2] != "intern" || roles[3] != "admin" {
+		t.Fatalf("expected role IDs and names, got %v", roles)
+	}
+}
+
+func TestHandleListJobHistoryAdminRoleName(t *testing.T) {
+	svc := newHTTPService(t, acl.Config{})
+	svc.providers.Config.AdminRoles = []string{"admin"}
+
+	store, err := history.Open(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	svc.providers.History = store
+
+	for role, want := range map[string]int{
+		"r-admin":  http.StatusOK,
+		"r-intern": http.StatusForbidden,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/history?user=bob", nil)
+		req.Header.Set("X-Remote-User-ID", "u1")
+		req.Header.Set("X-Remote-User", "alice")
+		req.Header.Set("X-Remote-Role", role)
+
+		rec := httptest.NewRecorder()
+		svc.HandleListJobHistory(rec, req)
+
+		if rec.Code != want {
+			t.Fatalf("role %s: expected status %d, got %d: %s", role, want, rec.Code, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/bufbuild/connect-go"
+	v1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/printing/v1"
+	"github.com/tierklinik-dobersberg/print-service/internal/pdf"
+)
+
+type formSource struct {
+	// FilePath is the path of the form relative to the storage root.
+	FilePath string `json:"filePath"`
+
+	// URL is used to download the form.
+	URL string `json:"url"`
+}
+
+type fillFormRequest struct {
+	formSource
+
+	Fields  map[string]string `json:"fields"`
+	Flatten bool              `json:"flatten"`
+	Name    string            `json:"name"`
+	Printer string            `json:"printer"`
+	Options map[string]string `json:"options"`
+}
+
+// HandlePrintFilledForm fills the AcroForm fields of a stored PDF form and
+// prints the result.
+func (svc *Service) HandlePrintFilledForm(w http.ResponseWriter, r *http.Request) {
+	user, err := svc.UserFromHeader(r.Context(), r.Header)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	svc.LimitRequestBody(w, r)
+
+	var req fillFormRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid request body: %w", err)))
+		return
+	}
+
+	values := make(url.Values, len(req.Options))
+	for key, value := range req.Options {
+		values.Set(key, value)
+	}
+
+	opts, err := ParsePrintOptions(values)
+	if err != nil {
+		writeError(w, connect.NewError(connect.CodeInvalidArgument, err))
+		return
+	}
+
+	content, name, err := svc.loadForm(req.formSource)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	filled, err := pdf.FillForm(content, req.Fields, req.Flatten)
+	if err != nil {
+		writeError(w, pdfError(err))
+		return
+	}
+
+	if req.Name != "" {
+		name = req.Name
+	}
+
+	doc := &v1.Document{
+		Name:        name,
+		ContentType: "application/pdf",
+		Orientation: opts.Orientation,
+		Printer:     req.Printer,
+	}
+
+	operation, err := svc.printDocument(r.Context(), user, doc, opts, bytes.NewReader(filled), int64(len(filled)), nil, nil)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, operationResponse{
+		OperationID: operation.UniqueId,
+	})
+}
+
+// HandleListFormFields returns the names and types of all AcroForm fields
+// of a stored PDF form.
+func (svc *Service) HandleListFormFields(w http.ResponseWriter, r *http.Request) {
+	if _, err := svc.UserFromHeader(r.Context(), r.Header); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	svc.LimitRequestBody(w, r)
+
+	var req formSource
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid request body: %w", err)))
+		return
+	}
+
+	content, _, err := svc.loadForm(req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	fields, err := pdf.FormFields(content)
+	if err != nil {
+		writeError(w, pdfError(err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"fields": fields,
+	})
+}
+
+// loadForm reads a PDF form from the storage root or a URL and returns its
+// content together with a document name. Forms are processed in memory so
+// they are subject to the maximum document size.
+func (svc *Service) loadForm(src formSource) ([]byte, string, error) {
+	doc := new(v1.Document)
+
+	switch {
+	case src.FilePath != "" && src.URL != "":
+		return nil, "", connect.NewError(connect.CodeInvalidArgument, errors.New("only one of filePath or url may be set"))
+
+	case src.FilePath != "":
+		doc.Name = path.Base(src.FilePath)
+		doc.Source = &v1.Document_FilePath{FilePath: src.FilePath}
+
+	case src.URL != "":
+		doc.Name = "form"
+		if u, err := url.Parse(src.URL); err == nil && path.Base(u.Path) != "/" && path.Base(u.Path) != "." {
+			doc.Name = path.Base(u.Path)
+		}
+
+		doc.Source = &v1.Document_Url{Url: src.URL}
+
+	default:
+		return nil, "", connect.NewError(connect.CodeInvalidArgument, errors.New("missing filePath or url"))
+	}
+
+	reader, size, err := svc.resolveContent(doc)
+	if err != nil {
+		return nil, "", err
+	}
+	defer reader.Close()
+
+	limited, err := svc.limitDocument(reader, size)
+	if err != nil {
+		return nil, "", err
+	}
+
+	content, err := io.ReadAll(limited)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read form: %w", err)
+	}
+
+	return content, doc.Name, nil
+}
+
+// pdfError converts errors returned by the pdf package to connect errors.
+func pdfError(err error) error {
+	if errors.Is(err, pdf.ErrInvalidInput) {
+		return connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	return err
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/tierklinik-dobersberg/print-service/internal/acl"
+	"github.com/tierklinik-dobersberg/print-service/internal/backend"
+	"github.com/tierklinik-dobersberg/print-service/internal/pdf"
+)
+
+// testForm returns a single page document with a text field "name" and a
+// check box "urgent".
+func testForm() []byte {
+	on := "0 g 0 0 12 12 re f"
+
+	return buildTestPDF(
+		"<< /Type /Catalog /Pages 2 0 R /AcroForm << /Fields [4 0 R 5 0 R] /DA (/Helv 12 Tf 0 g) /DR << /Font << /Helv 6 0 R >> >> >> >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595.28 841.89] /Resources << >> /Annots [4 0 R 5 0 R] >>",
+		"<< /Type /Annot /Subtype /Widget /FT /Tx /T (name) /Rect [50 700 250 720] /P 3 0 R /DA (/Helv 12 Tf 0 g) /F 4 >>",
+		"<< /Type /Annot /Subtype /Widget /FT /Btn /T (urgent) /Rect [50 650 62 662] /P 3 0 R /V /Off /AS /Off /F 4 /AP << /N << /Yes 7 0 R /Off 8 0 R >> >> >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Type /XObject /Subtype /Form /BBox [0 0 12 12] /Length %d >>\nstream\n%s\nendstream", len(on), on),
+		"<< /Type /XObject /Subtype /Form /BBox [0 0 12 12] /Length 0 >>\nstream\n\nendstream",
+	)
+}
+
+// newFormService returns a service with a form and a plain document in its
+// storage root.
+func newFormService(t *testing.T) *Service {
+	t.Helper()
+
+	svc := newHTTPService(t, acl.Config{})
+	svc.providers.Storage = fstest.MapFS{
+		"forms/intake.pdf": {Data: testForm()},
+		"letter.pdf":       {Data: testPDF(1)},
+	}
+
+	return svc
+}
+
+func formRequest(body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("X-Remote-User-ID", "u1")
+	req.Header.Set("X-Remote-User", "alice")
+
+	return req
+}
+
+func TestHandleListFormFields(t *testing.T) {
+	svc := newFormService(t)
+
+	rec := httptest.NewRecorder()
+	svc.HandleListFormFields(rec, formRequest(`{"filePath": "forms/intake.pdf"}`))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected the fields to be listed, got %d: %s", rec.Code, rec.Body)
+	}
+
+	var res struct {
+		Fields []pdf.FormField `json:"fields"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, f := range res.Fields {
+		names = append(names, fmt.Sprintf("%s:%s", f.Name, f.Type))
+	}
+	slices.Sort(names)
+
+	if want := []string{"name:text", "urgent:checkbox"}; !slices.Equal(names, want) {
+		t.Errorf("expected fields %v, got %v", want, names)
+	}
+
+	cases := map[string]string{
+		"document without a form": `{"filePath": "letter.pdf"}`,
+		"missing source":          `{}`,
+		"file path and URL":       `{"filePath": "letter.pdf", "url": "http://example.com/form.pdf"}`,
+	}
+
+	for name, body := range cases {
+		rec := httptest.NewRecorder()
+		svc.HandleListFormFields(rec, formRequest(body))
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected the request to be rejected, got %d: %s", name, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestHandlePrintFilledForm(t *testing.T) {
+	printers := &recordingBackend{printers: []string{"office"}}
+
+	svc := newFormService(t)
+	svc.providers.Printers = backend.NewRegistry(printers)
+	svc.providers.LongRunning = &fakeLongRunning{}
+
+	rec := httptest.NewRecorder()
+	svc.HandlePrintFilledForm(rec, formRequest(`{"filePath": "forms/intake.pdf", "printer": "office", "fields": {"name": "Bello", "urgent": "yes"}}`))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected the form to be printed, got %d: %s", rec.Code, rec.Body)
+	}
+
+	fields, err := pdf.FormFields(printers.last())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := make(map[string]string, len(fields))
+	for _, f := range fields {
+		values[f.Name] = f.Value
+	}
+
+	if values["name"] != "Bello" || values["urgent"] != "true" {
+		t.Errorf("expected the filled form to be printed, got %v", values)
+	}
+
+	rec = httptest.NewRecorder()
+	svc.HandlePrintFilledForm(rec, formRequest(`{"filePath": "forms/intake.pdf", "printer": "office", "fields": {"name": "Bello"}, "flatten": true}`))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected the flattened form to be printed, got %d: %s", rec.Code, rec.Body)
+	}
+
+	if _, err := pdf.FormFields(printers.last()); err == nil {
+		t.Errorf("expected the form fields to be removed when flattening")
+	}
+
+	rec = httptest.NewRecorder()
+	svc.HandlePrintFilledForm(rec, formRequest(`{"filePath": "forms/intake.pdf", "printer": "office", "fields": {"owner": "Alice"}}`))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected unknown fields to be rejected, got %d: %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,367 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	v1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/printing/v1"
+	"github.com/tierklinik-dobersberg/apis/pkg/auth"
+	"github.com/tierklinik-dobersberg/print-service/internal/backend"
+	"github.com/tierklinik-dobersberg/print-service/internal/cups"
+	"github.com/tierklinik-dobersberg/print-service/internal/history"
+	"github.com/tierklinik-dobersberg/print-service/internal/pdf"
+	"github.com/tierklinik-dobersberg/print-service/internal/routing"
+)
+
+const (
+	defaultHistoryPageSize = 50
+	maxHistoryPageSize     = 500
+)
+
+// hashingReader calculates the SHA-256 hash of all data read from r.
+type hashingReader struct {
+	r io.Reader
+	h hash.Hash
+}
+
+func newHashingReader(r io.Reader) *hashingReader {
+	return &hashingReader{
+		r: r,
+		h: sha256.New(),
+	}
+}
+
+func (hr *hashingReader) Read(p []byte) (int, error) {
+	n, err := hr.r.Read(p)
+	hr.h.Write(p[:n])
+
+	return n, err
+}
+
+// Sum returns the hex encoded hash of the data read so far.
+func (hr *hashingReader) Sum() string {
+	return hex.EncodeToString(hr.h.Sum(nil))
+}
+
+// historyRecord returns the history record of a job that is about to be
+// submitted.
+func historyRecord(user *auth.RemoteUser, document *v1.Document, printer string, opts PrintOptions, decision *routing.Decision, mime string, size int64, info *pdf.Info) history.Record {
+	r := history.Record{
+		User:                 user.Username,
+		Document:             document.Name,
+		Printer:              printer,
+		Options:              opts.values(),
+		ContentType:          document.ContentType,
+		SubmittedContentType: mime,
+		Converted:            document.ContentType != mime,
+		Size:                 size,
+		Info:                 info,
+	}
+
+	if decision != nil {
+		r.RoutingRule = decision.Rule
+	}
+
+	return r
+}
+
+// trackHistory stores record and keeps it updated with the states of the
+// job of op. It returns the ID of the record or an empty string if the
+// history is disabled or the record could not be stored.
+func (svc *Service) trackHistory(op *backend.Operation, record history.Record) string {
+	store := svc.providers.History
+	if store == nil {
+		return ""
+	}
+
+	record.OperationID = op.ID()
+
+	record, err := store.Add(record)
+	if err != nil {
+		slog.Error("failed to record job history", "operation-id", op.ID(), "error", err)
+		return ""
+	}
+
+	update := func(j cups.Job, final bool) {
+		err := store.Update(record.ID, func(r *history.Record) {
+			now := time.Now()
+
+			r.JobID = j.ID
+			r.JobPrinter = j.PrinterName
+			r.Observe(j.State.String(), now)
+
+			if final {
+				r.FinalState = j.State.String()
+				r.Completed = now
+			}
+		})
+		if err != nil {
+			slog.Error("failed to update job history", "id", record.ID, "operation-id", op.ID(), "error", err)
+		}
+	}
+
+	op.OnUpdate(func(j cups.Job) { update(j, false) })
+	op.OnComplete(func(j cups.Job) { update(j, true) })
+
+	return record.ID
+}
+
+// finishSubmission records the result of submitting the job of the history
+// record id. hash is ignored if the submission failed.
+func (svc *Service) finishSubmission(id string, hash string, submitErr error) {
+	if id == "" {
+		return
+	}
+
+	err := svc.providers.History.Update(id, func(r *history.Record) {
+		now := time.Now()
+
+		if submitErr != nil {
+			r.FinalState = history.StateFailed
+			r.Error = submitErr.Error()
+			r.Completed = now
+
+			return
+		}
+
+		r.DocumentHash = hash
+		r.Observe(history.StateSubmitted, now)
+	})
+	if err != nil {
+		slog.Error("failed to update job history", "id", id, "error", err)
+	}
+}
+
+// historyResponse is returned by HandleListJobHistory.
+type historyResponse struct {
+	Records       []history.Record `json:"records"`
+	NextPageToken string           `json:"nextPageToken,omitempty"`
+}
+
+// HandleListJobHistory lists recorded print jobs, newest first. Records
+// are filtered using the user, printer, document, state, from and to query
+// parameters where from and to are RFC 3339 timestamps or dates. Users only
+// see their own jobs unless they are administrators.
+//
+// Results are paginated using the pageSize and pageToken parameters. If
+// format is csv, all matching records are exported as CSV instead.
+func (svc *Service) HandleListJobHistory(w http.ResponseWriter, r *http.Request) {
+	user, err := svc.UserFromHeader(r.Context(), r.Header)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	store := svc.providers.History
+	if store == nil {
+		writeError(w, connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("the job history is disabled")))
+		return
+	}
+
+	query := r.URL.Query()
+
+	filter := history.Filter{
+		User:     query.Get("user"),
+		Printer:  query.Get("printer"),
+		Document: query.Get("document"),
+		State:    query.Get("state"),
+	}
+
+	if !svc.isAdmin(user) {
+		if filter.User != "" && filter.User != user.Username {
+			writeError(w, connect.NewError(connect.CodePermissionDenied, fmt.Errorf("you're not allowed to read the job history of other users")))
+			return
+		}
+
+		filter.User = user.Username
+	}
+
+	for param, target := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := query.Get(param); value != "" {
+			if *target, err = parseHistoryTime(value); err != nil {
+				writeError(w, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid %s value: %w", param, err)))
+				return
+			}
+		}
+	}
+
+	if filter.User != user.Username {
+		svc.auditAdmin(r.Context(), user, "list-history", map[string]string{
+			"user":    filter.User,
+			"printer": filter.Printer,
+			"format":  query.Get("format"),
+		})
+	}
+
+	if query.Get("format") == "csv" {
+		records, _, err := store.List(filter, 0, "")
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="job-history.csv"`)
+
+		if err := writeHistoryCSV(w, records); err != nil {
+			slog.Error("failed to write job history", "error", err)
+		}
+
+		return
+	}
+
+	pageSize := defaultHistoryPageSize
+	if value := query.Get("pageSize"); value != "" {
+		pageSize, err = strconv.Atoi(value)
+		if err != nil || pageSize < 1 {
+			writeError(w, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid page size %q", value)))
+			return
+		}
+
+		pageSize = min(pageSize, maxHistoryPageSize)
+	}
+
+	records, next, err := store.List(filter, pageSize, query.Get("pageToken"))
+	if err != nil {
+		writeError(w, connect.NewError(connect.CodeInvalidArgument, err))
+		return
+	}
+
+	if records == nil {
+		records = []history.Record{}
+	}
+
+	writeJSON(w, http.StatusOK, historyResponse{
+		Records:       records,
+		NextPageToken: next,
+	})
+}
+
+// parseHistoryTime parses an RFC 3339 timestamp or a date in local time.
+func parseHistoryTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	return time.ParseInLocation(time.DateOnly, value, time.Local)
+}
+
+var historyCSVHeader = []string{
+	"id", "created", "completed", "user", "document", "document_hash", "printer",
+	"job_printer", "job_id", "operation_id", "content_type", "submitted_content_type",
+	"converted", "size", "pages", "routing_rule", "options", "final_state", "error", "states",
+}
+
+// escapeCSVCell prefixes cells that spreadsheet applications would evaluate
+// as a formula with a single quote.
+func escapeCSVCell(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+
+	return cell
+}
+
+// writeHistoryCSV writes records as CSV to w. Options and state timestamps
+// are encoded as sorted key=value lists separated by semicolons.
+func writeHistoryCSV(w io.Writer, records []history.Record) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write(historyCSVHeader); err != nil {
+		return err
+	}
+
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+
+		return t.Format(time.RFC3339)
+	}
+
+	for _, r := range records {
+		var pages string
+		if r.Info != nil {
+			pages = strconv.Itoa(r.Info.PageCount)
+		}
+
+		options := make([]string, 0, len(r.Options))
+		for key, value := range r.Options {
+			options = append(options, key+"="+value)
+		}
+		sort.Strings(options)
+
+		states := make([]string, 0, len(r.States))
+		for state, t := range r.States {
+			states = append(states, state+"="+formatTime(t))
+		}
+		sort.Strings(states)
+
+		row := []string{
+			r.ID,
+			formatTime(r.Created),
+			formatTime(r.Completed),
+			r.User,
+			r.Document,
+			r.DocumentHash,
+			r.Printer,
+			r.JobPrinter,
+			strconv.Itoa(r.JobID),
+			r.OperationID,
+			r.ContentType,
+			r.SubmittedContentType,
+			strconv.FormatBool(r.Converted),
+			strconv.FormatInt(r.Size, 10),
+			pages,
+			r.RoutingRule,
+			strings.Join(options, ";"),
+			r.FinalState,
+			r.Error,
+			strings.Join(states, ";"),
+		}
+
+		for idx, cell := range row {
+			row[idx] = escapeCSVCell(cell)
+		}
+
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// jobName returns the name of j. If opaque job names are enabled, the real
+// document name is looked up in the job history for the owner of the job
+// and administrators.
+func (svc *Service) jobName(user *auth.RemoteUser, j cups.Job) string {
+	store := svc.providers.History
+	if !svc.providers.Config.OpaqueJobNames || store == nil || user == nil || j.OperationID == "" {
+		return j.Name
+	}
+
+	record, err := store.GetByOperation(j.OperationID)
+	if err != nil {
+		return j.Name
+	}
+
+	if record.User != user.Username && !svc.isAdmin(user) {
+		return j.Name
+	}
+
+	return record.Document
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"path/filepath"
+	"testing"
+
+	"github.com/phin1x/go-ipp"
+	"github.com/tierklinik-dobersberg/apis/pkg/auth"
+	"github.com/tierklinik-dobersberg/print-service/internal/acl"
+	"github.com/tierklinik-dobersberg/print-service/internal/backend"
+	"github.com/tierklinik-dobersberg/print-service/internal/config"
+	"github.com/tierklinik-dobersberg/print-service/internal/cups"
+	"github.com/tierklinik-dobersberg/print-service/internal/history"
+)
+
+func TestWriteHistoryCSVEscapesFormulas(t *testing.T) {
+	var buf bytes.Buffer
+
+	err := writeHistoryCSV(&buf, []history.Record{
+		{
+			ID:       "1",
+			User:     "@alice",
+			Document: "=HYPERLINK(\"http://example.com\")",
+			Printer:  "office",
+			Error:    "-1+2",
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to read CSV: %s", err)
+	}
+
+	if len(rows) != 2 {
+		t.Fatalf("expected a header and one record, got %d rows", len(rows))
+	}
+
+	cells := make(map[string]string, len(rows[0]))
+	for idx, name := range rows[0] {
+		cells[name] = rows[1][idx]
+	}
+
+	want := map[string]string{
+		"user":     "'@alice",
+		"document": "'=HYPERLINK(\"http://example.com\")",
+		"printer":  "office",
+		"error":    "'-1+2",
+	}
+
+	for name, value := range want {
+		if cells[name] != value {
+			t.Errorf("%s: expected %q, got %q", name, value, cells[name])
+		}
+	}
+}
+
+// jobsBackend serves a single printer with a fixed list of jobs.
+type jobsBackend struct {
+	printer string
+	jobs    []cups.Job
+}
+
+func (b *jobsBackend) ListPrinters() ([]cups.Printer, error) {
+	return []cups.Printer{{Name: b.printer}}, nil
+}
+
+func (b *jobsBackend) HasPrinter(name string) bool { return name == b.printer }
+func (b *jobsBackend) DefaultPrinter() string      { return b.printer }
+
+func (b *jobsBackend) ListJobs(string) ([]cups.Job, error) {
+	return append([]cups.Job(nil), b.jobs...), nil
+}
+
+func (b *jobsBackend) GetJob(string, int) (cups.Job, error) {
+	return cups.Job{}, backend.ErrJobNotFound
+}
+
+func (b *jobsBackend) Print(ipp.Document, string, map[string]any) (int, error) {
+	return 0, nil
+}
+
+func TestUserJobsResolvesOpaqueNames(t *testing.T) {
+	store, err := history.Open(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	if _, err := store.Add(history.Record{OperationID: "op-1", User: "alice", Document: "Max Mustermann.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+
+	access, err := acl.New(acl.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svc := &Service{
+		providers: &config.Providers{
+			Config:  &config.Config{OpaqueJobNames: true},
+			History: store,
+			ACL:     access,
+			Printers: backend.NewRegistry(&jobsBackend{
+				printer: "office",
+				jobs:    []cups.Job{{ID: 1, Name: "op-1", OperationID: "op-1"}},
+			}),
+		},
+	}
+
+	for user, want := range map[string]string{
+		"alice": "Max Mustermann.pdf",
+		"bob":   "op-1",
+	} {
+		jobs, err := svc.UserJobs(context.Background(), &auth.RemoteUser{Username: user}, "office")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(jobs) != 1 || jobs[0].Name != want {
+			t.Fatalf("expected %s to see job name %q, got %+v", user, want, jobs)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"slices"
+	"sort"
+
+	"github.com/bufbuild/connect-go"
+	v1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/printing/v1"
+	"github.com/tierklinik-dobersberg/apis/pkg/auth"
+)
+
+// maxMemory is the maximum number of bytes of a multipart form that are kept
+// in memory. Larger files are stored in temporary files.
+const maxMemory = 32 << 20
+
+type printResponse struct {
+	Operations []printedDocument `json:"operations"`
+}
+
+// operationResponse is returned by endpoints that submit a single job.
+type operationResponse struct {
+	OperationID string `json:"operationId"`
+}
+
+// printedDocument holds either the operation ID of a submitted file or the
+// reason it could not be printed.
+type printedDocument struct {
+	Name        string `json:"name"`
+	OperationID string `json:"operationId,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// HandlePrint implements a plain HTTP endpoint for printing documents
+// uploaded using a multipart/form-data request. Each file part is printed
+// as a separate job using the options from the form fields.
+//
+// A failing file does not stop the remaining ones. If some files have been
+// submitted and others failed, 207 Multi-Status is returned with the result
+// of each file so clients only retry the failed ones. If no file could be
+// printed, the error of the first one is returned.
+func (svc *Service) HandlePrint(w http.ResponseWriter, r *http.Request) {
+	user, err := svc.UserFromHeader(r.Context(), r.Header)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	svc.LimitRequestBody(w, r)
+
+	if err := r.ParseMultipartForm(maxMemory); err != nil {
+		writeError(w, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid multipart form: %w", err)))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	opts, err := ParsePrintOptions(r.MultipartForm.Value)
+	if err != nil {
+		writeError(w, connect.NewError(connect.CodeInvalidArgument, err))
+		return
+	}
+
+	var files []*multipart.FileHeader
+
+	fields := make([]string, 0, len(r.MultipartForm.File))
+	for field := range r.MultipartForm.File {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		files = append(files, r.MultipartForm.File[field]...)
+	}
+
+	if len(files) == 0 {
+		writeError(w, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("no files uploaded")))
+		return
+	}
+
+	res := printResponse{
+		Operations: make([]printedDocument, 0, len(files)),
+	}
+
+	var firstErr error
+
+	for _, fh := range files {
+		doc := &v1.Document{
+			Name:        fh.Filename,
+			ContentType: fh.Header.Get("Content-Type"),
+			Orientation: opts.Orientation,
+			Printer:     r.FormValue("printer"),
+		}
+
+		// browsers send application/octet-stream for unknown file types so
+		// better sniff the content type in that case.
+		if doc.ContentType == "application/octet-stream" {
+			doc.ContentType = ""
+		}
+
+		if name := r.FormValue("name"); name != "" && len(files) == 1 {
+			doc.Name = name
+		}
+
+		operationID, err := svc.printUpload(r.Context(), user, doc, opts, fh)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+
+			res.Operations = append(res.Operations, printedDocument{
+				Name:  doc.Name,
+				Error: err.Error(),
+			})
+
+			continue
+		}
+
+		res.Operations = append(res.Operations, printedDocument{
+			Name:        doc.Name,
+			OperationID: operationID,
+		})
+	}
+
+	switch {
+	case firstErr == nil:
+		writeJSON(w, http.StatusOK, res)
+
+	case slices.ContainsFunc(res.Operations, func(d printedDocument) bool { return d.OperationID != "" }):
+		writeJSON(w, http.StatusMultiStatus, res)
+
+	default:
+		writeError(w, firstErr)
+	}
+}
+
+// printUpload prints the uploaded file fh and returns the operation ID.
+func (svc *Service) printUpload(ctx context.Context, user *auth.RemoteUser, doc *v1.Document, opts PrintOptions, fh *multipart.FileHeader) (string, error) {
+	file, err := fh.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open uploaded file %q: %w", fh.Filename, err)
+	}
+	defer file.Close()
+
+	operation, err := svc.printDocument(ctx, user, doc, opts, file, fh.Size, nil, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return operation.UniqueId, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		slog.Error("failed to write JSON response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	var cerr *connect.Error
+	if errors.As(err, &cerr) {
+		status = httpStatus(cerr.Code())
+	}
+
+	writeJSON(w, status, map[string]string{
+		"error": err.Error(),
+	})
+}
+
+// httpStatus maps a connect error code to the corresponding HTTP status code.
+func httpStatus(code connect.Code) int {
+	switch code {
+	case connect.CodeInvalidArgument, connect.CodeOutOfRange:
+		return http.StatusBadRequest
+	case connect.CodeUnauthenticated:
+		return http.StatusUnauthorized
+	case connect.CodePermissionDenied:
+		return http.StatusForbidden
+	case connect.CodeNotFound:
+		return http.StatusNotFound
+	case connect.CodeAlreadyExists, connect.CodeAborted:
+		return http.StatusConflict
+	case connect.CodeFailedPrecondition:
+		return http.StatusPreconditionFailed
+	case connect.CodeResourceExhausted:
+		return http.StatusTooManyRequests
+	case connect.CodeUnimplemented:
+		return http.StatusNotImplemented
+	case connect.CodeUnavailable:
+		return http.StatusServiceUnavailable
+	case connect.CodeDeadlineExceeded:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
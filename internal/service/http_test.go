@@ -0,0 +1,84 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	longrunningv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/longrunning/v1"
+	"github.com/tierklinik-dobersberg/apis/gen/go/tkd/longrunning/v1/longrunningv1connect"
+	"github.com/tierklinik-dobersberg/print-service/internal/acl"
+)
+
+// fakeLongRunning registers operations without tracking them.
+type fakeLongRunning struct {
+	longrunningv1connect.LongRunningServiceClient
+}
+
+func (f *fakeLongRunning) RegisterOperation(context.Context, *connect.Request[longrunningv1.RegisterOperationRequest]) (*connect.Response[longrunningv1.RegisterOperationResponse], error) {
+	return connect.NewResponse(&longrunningv1.RegisterOperationResponse{
+		Operation: &longrunningv1.Operation{UniqueId: "op"},
+	}), nil
+}
+
+func (f *fakeLongRunning) UpdateOperation(context.Context, *connect.Request[longrunningv1.UpdateOperationRequest]) (*connect.Response[longrunningv1.Operation], error) {
+	return connect.NewResponse(&longrunningv1.Operation{}), nil
+}
+
+func (f *fakeLongRunning) CompleteOperation(context.Context, *connect.Request[longrunningv1.CompleteOperationRequest]) (*connect.Response[longrunningv1.Operation], error) {
+	return connect.NewResponse(&longrunningv1.Operation{}), nil
+}
+
+func TestHandlePrintPartialFailure(t *testing.T) {
+	svc := newHTTPService(t, acl.Config{})
+	svc.providers.LongRunning = &fakeLongRunning{}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("printer", "prescriptions")
+
+	part, _ := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Disposition": {`form-data; name="a"; filename="ok.txt"`},
+		"Content-Type":        {"text/plain"},
+	})
+	part.Write([]byte("hello"))
+
+	// empty documents cannot be printed
+	mw.CreateFormFile("b", "empty.bin")
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/print", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("X-Remote-User-ID", "u1")
+	req.Header.Set("X-Remote-User", "alice")
+
+	rec := httptest.NewRecorder()
+	svc.HandlePrint(rec, req)
+
+	if rec.Code != http.StatusMultiStatus {
+		t.Fatalf("expected a multi-status response, got %d: %s", rec.Code, rec.Body)
+	}
+
+	var res printResponse
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Operations) != 2 {
+		t.Fatalf("expected a result for each file, got %+v", res.Operations)
+	}
+
+	if ok := res.Operations[0]; ok.Name != "ok.txt" || ok.OperationID != "op" || ok.Error != "" {
+		t.Errorf("expected the first file to be submitted, got %+v", ok)
+	}
+
+	if failed := res.Operations[1]; failed.Name != "empty.bin" || failed.OperationID != "" || failed.Error == "" {
+		t.Errorf("expected the second file to fail, got %+v", failed)
+	}
+}
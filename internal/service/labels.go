@@ -0,0 +1,134 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/png"
+	"log/slog"
+	"net/http"
+
+	"github.com/bufbuild/connect-go"
+	v1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/printing/v1"
+	"github.com/tierklinik-dobersberg/print-service/internal/labels"
+)
+
+type labelRequest struct {
+	Template string            `json:"template"`
+	Fields   map[string]string `json:"fields"`
+	Quantity int               `json:"quantity"`
+	Printer  string            `json:"printer"`
+}
+
+// HandlePrintLabel renders a label template and sends the resulting ZPL
+// to the label printer.
+func (svc *Service) HandlePrintLabel(w http.ResponseWriter, r *http.Request) {
+	user, err := svc.UserFromHeader(r.Context(), r.Header)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	req, tmpl, err := svc.decodeLabelRequest(w, r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if req.Quantity == 0 {
+		req.Quantity = 1
+	}
+
+	zpl, err := tmpl.Render(req.Fields, req.Quantity)
+	if err != nil {
+		writeError(w, connect.NewError(connect.CodeInvalidArgument, err))
+		return
+	}
+
+	printer := req.Printer
+	if printer == "" {
+		printer = svc.providers.Labels.Printer(tmpl)
+	}
+
+	doc := &v1.Document{
+		Name:        tmpl.Name + ".zpl",
+		ContentType: labels.ContentType,
+		Printer:     printer,
+	}
+
+	operation, err := svc.printDocument(r.Context(), user, doc, PrintOptions{}, bytes.NewReader(zpl), int64(len(zpl)), map[string]string{
+		"labelTemplate": tmpl.Name,
+	}, nil)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, operationResponse{
+		OperationID: operation.UniqueId,
+	})
+}
+
+// HandlePreviewLabel renders a PNG preview of a label template.
+func (svc *Service) HandlePreviewLabel(w http.ResponseWriter, r *http.Request) {
+	if _, err := svc.UserFromHeader(r.Context(), r.Header); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	req, tmpl, err := svc.decodeLabelRequest(w, r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	img, err := tmpl.Preview(req.Fields)
+	if err != nil {
+		writeError(w, connect.NewError(connect.CodeInvalidArgument, err))
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		writeError(w, fmt.Errorf("failed to encode preview: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		slog.Error("failed to write label preview", "error", err)
+	}
+}
+
+// HandleListLabelTemplates returns all configured label templates.
+func (svc *Service) HandleListLabelTemplates(w http.ResponseWriter, r *http.Request) {
+	if _, err := svc.UserFromHeader(r.Context(), r.Header); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"templates": svc.providers.Labels.List(),
+	})
+}
+
+func (svc *Service) decodeLabelRequest(w http.ResponseWriter, r *http.Request) (*labelRequest, *labels.Template, error) {
+	svc.LimitRequestBody(w, r)
+
+	var req labelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid request body: %w", err))
+	}
+
+	if req.Template == "" {
+		return nil, nil, connect.NewError(connect.CodeInvalidArgument, errors.New("missing template name"))
+	}
+
+	tmpl, ok := svc.providers.Labels.Get(req.Template)
+	if !ok {
+		return nil, nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("label template %q not found", req.Template))
+	}
+
+	return &req, tmpl, nil
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/bufbuild/connect-go"
+)
+
+// errDocumentTooLarge returns the error reported for documents larger than
+// max bytes.
+func errDocumentTooLarge(max int64) error {
+	return connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("document exceeds the maximum size of %d bytes", max))
+}
+
+// limitedReader fails with errDocumentTooLarge once more than max bytes
+// have been read.
+type limitedReader struct {
+	r    io.Reader
+	read int64
+	max  int64
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	n, err := lr.r.Read(p)
+	lr.read += int64(n)
+
+	if lr.read > lr.max {
+		return n, errDocumentTooLarge(lr.max)
+	}
+
+	return n, err
+}
+
+// limitDocument returns a reader that fails if content exceeds the maximum
+// document size. If size is known, it is checked right away.
+func (svc *Service) limitDocument(content io.Reader, size int64) (io.Reader, error) {
+	max := svc.providers.Config.MaxDocumentSize
+	if max <= 0 {
+		return content, nil
+	}
+
+	if size > max {
+		return nil, errDocumentTooLarge(max)
+	}
+
+	return &limitedReader{
+		r:   io.LimitReader(content, max+1),
+		max: max,
+	}, nil
+}
+
+// LimitRequestBody limits the body of r so requests carrying a document
+// cannot exceed the maximum document size. Some headroom is added for the
+// encoding of the request.
+func (svc *Service) LimitRequestBody(w http.ResponseWriter, r *http.Request) {
+	max := svc.providers.Config.MaxDocumentSize
+	if max <= 0 {
+		return
+	}
+
+	// base64 encoded JSON and multipart forms add up to a third
+	r.Body = http.MaxBytesReader(w, r.Body, max+max/2)
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/print-service/internal/acl"
+	"github.com/tierklinik-dobersberg/print-service/internal/config"
+)
+
+func newLimitedService(max int64) *Service {
+	return &Service{
+		providers: &config.Providers{
+			Config: &config.Config{MaxDocumentSize: max},
+		},
+	}
+}
+
+func TestLimitDocument(t *testing.T) {
+	svc := newLimitedService(10)
+
+	if _, err := svc.limitDocument(strings.NewReader("too large"), 11); connect.CodeOf(err) != connect.CodeInvalidArgument {
+		t.Fatalf("expected known size to be rejected, got %v", err)
+	}
+
+	r, err := svc.limitDocument(strings.NewReader("0123456789"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if content, err := io.ReadAll(r); err != nil || len(content) != 10 {
+		t.Fatalf("expected document of maximum size to be accepted, got %q, %v", content, err)
+	}
+
+	r, _ = svc.limitDocument(strings.NewReader("0123456789a"), 0)
+
+	_, err = io.ReadAll(r)
+
+	var cerr *connect.Error
+	if !errors.As(err, &cerr) || cerr.Code() != connect.CodeInvalidArgument {
+		t.Fatalf("expected oversized stream to fail, got %v", err)
+	}
+
+	r, _ = newLimitedService(0).limitDocument(bytes.NewReader(make([]byte, 100)), 100)
+	if content, _ := io.ReadAll(r); len(content) != 100 {
+		t.Fatalf("expected no limit, got %d bytes", len(content))
+	}
+}
+
+func TestHandlersLimitFileSource(t *testing.T) {
+	svc := newHTTPService(t, acl.Config{})
+	svc.providers.Config.MaxDocumentSize = 64
+	svc.providers.Storage = fstest.MapFS{
+		"large.pdf": {Data: make([]byte, 1000)},
+	}
+
+	// file_path sources are not covered by the request body limit
+	cases := []struct {
+		name    string
+		handler http.HandlerFunc
+		body    string
+	}{
+		{"list form fields", svc.HandleListFormFields, `{"filePath": "large.pdf"}`},
+		{"print filled form", svc.HandlePrintFilledForm, `{"filePath": "large.pdf", "fields": {"name": "Bello"}}`},
+		{"preview", svc.HandlePreviewDocument, `{"name": "large.pdf", "filePath": "large.pdf"}`},
+		{"explain routing", svc.HandleExplainRouting, `{"name": "large.pdf", "filePath": "large.pdf"}`},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(c.body))
+		req.Header.Set("X-Remote-User-ID", "u1")
+		req.Header.Set("X-Remote-User", "alice")
+
+		rec := httptest.NewRecorder()
+		c.handler(rec, req)
+
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "maximum size") {
+			t.Errorf("%s: expected the document to be rejected, got %d: %s", c.name, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestSpoolFileLimit(t *testing.T) {
+	spool, err := newSpoolFile(t.TempDir(), "test", 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spool.Discard()
+
+	if _, err := spool.Write([]byte("01234")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := spool.Write([]byte("56789")); connect.CodeOf(err) != connect.CodeInvalidArgument {
+		t.Fatalf("expected spool limit to be enforced, got %v", err)
+	}
+
+	if spool.Size() != 5 {
+		t.Fatalf("expected rejected chunk not to be written, size is %d", spool.Size())
+	}
+}
@@ -0,0 +1,346 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/phin1x/go-ipp"
+	v1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/printing/v1"
+	"github.com/tierklinik-dobersberg/print-service/internal/cups"
+	"github.com/tierklinik-dobersberg/print-service/internal/pdf"
+)
+
+// PrintOptions holds additional job options that are not part of the
+// tkd.printing.v1.Document message.
+type PrintOptions struct {
+	// Orientation holds the requested document orientation.
+	Orientation v1.Orientation
+
+	// Copies holds the number of copies to print. Zero means the printer
+	// default is used.
+	Copies int
+
+	// Sides holds the IPP sides keyword. If empty, the printer default is
+	// used.
+	Sides cups.Sides
+
+	// ColorMode holds the IPP print-color-mode keyword. If empty, the
+	// color mode of the document or the printer default is used.
+	ColorMode cups.ColorMode
+
+	// Stamps holds the names of stamp profiles to apply.
+	Stamps []string
+
+	// Watermark is a text watermark added to every page.
+	Watermark string
+
+	// AuditFooter adds the default audit footer to every page.
+	AuditFooter bool
+
+	// Overlay holds the name of the letterhead profile to merge underneath
+	// the document.
+	Overlay string
+
+	// Layout holds page selection and imposition options for PDF
+	// documents.
+	Layout pdf.Layout
+}
+
+// optionHeaderPrefix is used to pass print options as HTTP headers for
+// requests that do not support form values, like connect RPCs.
+const optionHeaderPrefix = "X-Print-"
+
+// ParsePrintOptionsFromHeader parses print options from all headers
+// prefixed with X-Print- (e.g. X-Print-Copies: 2).
+func ParsePrintOptionsFromHeader(header http.Header) (PrintOptions, error) {
+	values := make(url.Values)
+
+	for key, value := range header {
+		if name, ok := strings.CutPrefix(http.CanonicalHeaderKey(key), optionHeaderPrefix); ok {
+			values[strings.ToLower(name)] = value
+		}
+	}
+
+	return ParsePrintOptions(values)
+}
+
+// ParsePrintOptions parses print options from values. The keys are the
+// same as the form fields accepted by HandlePrint.
+func ParsePrintOptions(values url.Values) (PrintOptions, error) {
+	var (
+		opts PrintOptions
+		err  error
+	)
+
+	opts.Orientation, err = parseOrientation(values.Get("orientation"))
+	if err != nil {
+		return opts, err
+	}
+
+	if value := values.Get("copies"); value != "" {
+		opts.Copies, err = parseCopies(value)
+		if err != nil {
+			return opts, err
+		}
+	}
+
+	if value := values.Get("duplex"); value != "" {
+		opts.Sides, err = parseSides(value, opts.Orientation)
+		if err != nil {
+			return opts, err
+		}
+	}
+
+	if value := values.Get("color"); value != "" {
+		opts.ColorMode, err = parseColorMode(value)
+		if err != nil {
+			return opts, err
+		}
+	}
+
+	if value := values.Get("stamp"); value != "" {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				opts.Stamps = append(opts.Stamps, name)
+			}
+		}
+	}
+
+	opts.Watermark = values.Get("watermark")
+
+	if value := values.Get("audit-footer"); value != "" {
+		opts.AuditFooter, err = strconv.ParseBool(value)
+		if err != nil {
+			return opts, fmt.Errorf("invalid audit-footer value %q", value)
+		}
+	}
+
+	opts.Overlay = strings.TrimSpace(values.Get("overlay"))
+
+	opts.Layout, err = parseLayout(values)
+	if err != nil {
+		return opts, err
+	}
+
+	return opts, nil
+}
+
+// parseLayout parses the page manipulation options from values.
+func parseLayout(values url.Values) (pdf.Layout, error) {
+	var (
+		layout pdf.Layout
+		err    error
+	)
+
+	layout.Pages = strings.ReplaceAll(values.Get("pages"), " ", "")
+	layout.Media = values.Get("media")
+
+	if value := values.Get("reverse"); value != "" {
+		layout.Reverse, err = strconv.ParseBool(value)
+		if err != nil {
+			return layout, fmt.Errorf("invalid reverse value %q", value)
+		}
+	}
+
+	if value := values.Get("rotate"); value != "" {
+		layout.Rotate, err = strconv.Atoi(value)
+		if err != nil {
+			return layout, fmt.Errorf("invalid rotate value %q", value)
+		}
+	}
+
+	if value := values.Get("nup"); value != "" {
+		layout.NUp, err = strconv.Atoi(value)
+		if err != nil {
+			return layout, fmt.Errorf("invalid nup value %q", value)
+		}
+	}
+
+	if value := values.Get("booklet"); value != "" {
+		layout.Booklet, err = strconv.ParseBool(value)
+		if err != nil {
+			return layout, fmt.Errorf("invalid booklet value %q", value)
+		}
+	}
+
+	return layout, layout.Validate()
+}
+
+// withDefaults returns opts with all options that are not set taken from
+// defaults. Since portrait is the zero value of the orientation, only
+// landscape can be enforced by requests.
+func (opts PrintOptions) withDefaults(defaults PrintOptions) PrintOptions {
+	if opts.Orientation == v1.Orientation_ORIENTATION_PORTRAIT {
+		opts.Orientation = defaults.Orientation
+	}
+
+	if opts.Copies == 0 {
+		opts.Copies = defaults.Copies
+	}
+
+	if opts.Sides == "" {
+		opts.Sides = defaults.Sides
+	}
+
+	if opts.ColorMode == "" {
+		opts.ColorMode = defaults.ColorMode
+	}
+
+	if len(opts.Stamps) == 0 {
+		opts.Stamps = defaults.Stamps
+	}
+
+	if opts.Watermark == "" {
+		opts.Watermark = defaults.Watermark
+	}
+
+	opts.AuditFooter = opts.AuditFooter || defaults.AuditFooter
+
+	if opts.Overlay == "" {
+		opts.Overlay = defaults.Overlay
+	}
+
+	if opts.Layout.IsZero() {
+		opts.Layout = defaults.Layout
+	}
+
+	return opts
+}
+
+// values returns opts using the keys accepted by ParsePrintOptions. Unset
+// options are omitted.
+func (opts PrintOptions) values() map[string]string {
+	values := make(map[string]string)
+
+	set := func(key string, value string, ok bool) {
+		if ok {
+			values[key] = value
+		}
+	}
+
+	set("orientation", "landscape", opts.Orientation == v1.Orientation_ORIENTATION_LANDSCAPE)
+	set("copies", strconv.Itoa(opts.Copies), opts.Copies > 0)
+	set("duplex", string(opts.Sides), opts.Sides != "")
+	set("color", string(opts.ColorMode), opts.ColorMode != "")
+	set("stamp", strings.Join(opts.Stamps, ","), len(opts.Stamps) > 0)
+	set("watermark", opts.Watermark, opts.Watermark != "")
+	set("audit-footer", "true", opts.AuditFooter)
+	set("overlay", opts.Overlay, opts.Overlay != "")
+	set("pages", opts.Layout.Pages, opts.Layout.Pages != "")
+	set("media", opts.Layout.Media, opts.Layout.Media != "")
+	set("reverse", "true", opts.Layout.Reverse)
+	set("rotate", strconv.Itoa(opts.Layout.Rotate), opts.Layout.Rotate != 0)
+	set("nup", strconv.Itoa(opts.Layout.NUp), opts.Layout.NUp != 0)
+	set("booklet", "true", opts.Layout.Booklet)
+
+	return values
+}
+
+// withDocument returns opts with the color mode of document if opts does
+// not specify one.
+func (opts PrintOptions) withDocument(document *v1.Document) PrintOptions {
+	if opts.ColorMode != "" {
+		return opts
+	}
+
+	switch document.ColorMode {
+	case v1.ColorMode_COLORMODE_COLOR:
+		opts.ColorMode = cups.ColorModeColor
+	case v1.ColorMode_COLORMODE_GRAYSCALE:
+		opts.ColorMode = cups.ColorModeMonochrome
+	}
+
+	return opts
+}
+
+// jobAttributes adds the IPP job attributes for opts to attrs.
+func (opts PrintOptions) jobAttributes(attrs map[string]any) {
+	if opts.Copies > 0 {
+		attrs[ipp.AttributeCopies] = opts.Copies
+	}
+
+	if sides := opts.sides(); sides != "" {
+		attrs[cups.AttributeSides] = string(sides)
+	}
+
+	if opts.ColorMode != "" {
+		attrs[cups.AttributePrintColorMode] = string(opts.ColorMode)
+	}
+}
+
+// sides returns the sides keyword the job is printed with. Booklets are
+// always printed duplex and folded along the short edge of the sheet so
+// the sides requested by the user, preferences or policies are ignored.
+func (opts PrintOptions) sides() cups.Sides {
+	if opts.Layout.Booklet {
+		return cups.SidesTwoSidedShortEdge
+	}
+
+	return opts.Sides
+}
+
+func parseCopies(value string) (int, error) {
+	copies, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number of copies %q", value)
+	}
+
+	if copies < 1 {
+		return 0, fmt.Errorf("number of copies must be at least 1")
+	}
+
+	return copies, nil
+}
+
+// parseSides parses value either as a boolean duplex flag or as an IPP sides
+// keyword. If duplex is requested the binding edge is choosen based on the
+// orientation.
+func parseSides(value string, orientation v1.Orientation) (cups.Sides, error) {
+	switch sides := cups.Sides(strings.ToLower(value)); sides {
+	case cups.SidesOneSided, cups.SidesTwoSidedLongEdge, cups.SidesTwoSidedShortEdge:
+		return sides, nil
+	}
+
+	duplex, err := strconv.ParseBool(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid duplex value %q", value)
+	}
+
+	switch {
+	case !duplex:
+		return cups.SidesOneSided, nil
+	case orientation == v1.Orientation_ORIENTATION_LANDSCAPE:
+		return cups.SidesTwoSidedShortEdge, nil
+	default:
+		return cups.SidesTwoSidedLongEdge, nil
+	}
+}
+
+// parseColorMode parses value as a color mode. Grayscale is accepted as an
+// alias for monochrome.
+func parseColorMode(value string) (cups.ColorMode, error) {
+	switch strings.ToLower(value) {
+	case "auto":
+		return cups.ColorModeAuto, nil
+	case "color":
+		return cups.ColorModeColor, nil
+	case "monochrome", "grayscale", "gray", "mono":
+		return cups.ColorModeMonochrome, nil
+	}
+
+	return "", fmt.Errorf("invalid color mode %q", value)
+}
+
+func parseOrientation(value string) (v1.Orientation, error) {
+	switch strings.ToLower(value) {
+	case "", "portrait":
+		return v1.Orientation_ORIENTATION_PORTRAIT, nil
+	case "landscape":
+		return v1.Orientation_ORIENTATION_LANDSCAPE, nil
+	}
+
+	return v1.Orientation_ORIENTATION_PORTRAIT, fmt.Errorf("invalid orientation %q", value)
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"testing"
+
+	v1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/printing/v1"
+	"github.com/tierklinik-dobersberg/apis/pkg/auth"
+	"github.com/tierklinik-dobersberg/print-service/internal/cups"
+	"github.com/tierklinik-dobersberg/print-service/internal/pdf"
+)
+
+func TestBookletSides(t *testing.T) {
+	cases := []struct {
+		name   string
+		opts   PrintOptions
+		want   cups.Sides
+		duplex bool
+	}{
+		{"default", PrintOptions{}, "", false},
+		{"one-sided", PrintOptions{Sides: cups.SidesOneSided}, cups.SidesOneSided, false},
+		{"booklet", PrintOptions{Layout: pdf.Layout{Booklet: true}}, cups.SidesTwoSidedShortEdge, true},
+		{"booklet one-sided", PrintOptions{Sides: cups.SidesOneSided, Layout: pdf.Layout{Booklet: true}}, cups.SidesTwoSidedShortEdge, true},
+		{"booklet long edge", PrintOptions{Sides: cups.SidesTwoSidedLongEdge, Layout: pdf.Layout{Booklet: true}}, cups.SidesTwoSidedShortEdge, true},
+	}
+
+	for _, c := range cases {
+		attrs := make(map[string]any)
+		c.opts.jobAttributes(attrs)
+
+		if got, _ := attrs[cups.AttributeSides].(string); got != string(c.want) {
+			t.Errorf("%s: expected sides %q, got %q", c.name, c.want, got)
+		}
+
+		record := usageRecord(&auth.RemoteUser{Username: "alice"}, &v1.Document{Name: "test.pdf"}, "office", c.opts, nil)
+		if record.Duplex != c.duplex {
+			t.Errorf("%s: expected duplex=%t to be billed, got %t", c.name, c.duplex, record.Duplex)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/bufbuild/connect-go"
+	v1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/printing/v1"
+	"github.com/tierklinik-dobersberg/apis/pkg/auth"
+	"github.com/tierklinik-dobersberg/print-service/internal/audit"
+	"github.com/tierklinik-dobersberg/print-service/internal/pdf"
+	"github.com/tierklinik-dobersberg/print-service/internal/policy"
+	"github.com/tierklinik-dobersberg/print-service/internal/privacy"
+)
+
+// policyOptions holds the parsed print options of a policy.
+type policyOptions struct {
+	forced   PrintOptions
+	defaults PrintOptions
+}
+
+// parsePolicyOptions parses the forced and default print options of all
+// policies.
+func parsePolicyOptions(rules []policy.Rule) (map[string]policyOptions, error) {
+	result := make(map[string]policyOptions, len(rules))
+
+	for _, rule := range rules {
+		forced, err := parseOptionMap(rule.Options)
+		if err != nil {
+			return nil, fmt.Errorf("print policy %q: %w", rule.Name, err)
+		}
+
+		defaults, err := parseOptionMap(rule.Defaults)
+		if err != nil {
+			return nil, fmt.Errorf("print policy %q: %w", rule.Name, err)
+		}
+
+		result[rule.Name] = policyOptions{
+			forced:   forced,
+			defaults: defaults,
+		}
+	}
+
+	return result, nil
+}
+
+// evaluatePolicies applies the options of all policies matching a job for
+// printer and returns the resulting options together with the names of the
+// matching policies. Forced options of later policies take precedence while
+// defaults of earlier ones win. Limits are checked after all options have
+// been applied and an error wrapping policy.ErrDenied is returned if a
+// policy rejects the job. If pending is set, the content of the document
+// has not been received yet and page limits are not checked.
+func (svc *Service) evaluatePolicies(user *auth.RemoteUser, document *v1.Document, printer string, opts PrintOptions, info *pdf.Info, pending bool) (PrintOptions, []string, error) {
+	req := policy.Request{
+		Printer:      printer,
+		ContentType:  document.ContentType,
+		User:         user.Username,
+		Roles:        userRoles(user),
+		PagesPending: pending,
+	}
+
+	if info != nil {
+		req.HasInfo = true
+		req.PageCount = info.PageCount
+	}
+
+	rules := svc.providers.Policies.Match(req)
+
+	names := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		parsed := svc.policyOptions[rule.Name]
+
+		opts = parsed.forced.withDefaults(opts).withDefaults(parsed.defaults)
+		names = append(names, rule.Name)
+	}
+
+	req.Copies = opts.Copies
+
+	for _, rule := range rules {
+		if err := rule.Check(req); err != nil {
+			return opts, names, err
+		}
+	}
+
+	return opts, names, nil
+}
+
+// applyPolicies is like evaluatePolicies but returns a PermissionDenied
+// error if the job is rejected and records the denial in the audit trail.
+func (svc *Service) applyPolicies(ctx context.Context, user *auth.RemoteUser, document *v1.Document, printer string, opts PrintOptions, info *pdf.Info, action string) (PrintOptions, error) {
+	opts, names, err := svc.evaluatePolicies(user, document, printer, opts, info, false)
+	if err != nil {
+		slog.Warn("print job denied by policy", "name", privacy.Name(document.Name), "printer", printer, "user", user.Username, "error", err)
+
+		svc.providers.Audit.Record(ctx, audit.Event{
+			Action:   audit.ActionPolicyDenied,
+			User:     user.Username,
+			Printer:  printer,
+			Document: document.Name,
+			Reason:   err.Error(),
+			Details: map[string]string{
+				"request": action,
+			},
+		})
+
+		return opts, connect.NewError(connect.CodePermissionDenied, err)
+	}
+
+	if len(names) > 0 {
+		slog.Info("applied print policies", "name", privacy.Name(document.Name), "printer", printer, "policies", names, "user", user.Username)
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/print-service/internal/pdf"
+	"github.com/tierklinik-dobersberg/print-service/internal/privacy"
+)
+
+// printJob holds information about a job that is about to be submitted.
+type printJob struct {
+	User        string
+	Document    string
+	Printer     string
+	OperationID string
+	Options     PrintOptions
+
+	// Info holds the result of inspecting the final PDF document. It is
+	// nil for other content types.
+	Info *pdf.Info
+}
+
+// pdfStage is a post-processing step applied to PDF documents after they
+// have been converted and before they are submitted to the printer.
+type pdfStage struct {
+	name  string
+	apply func(content []byte, job *printJob) ([]byte, error)
+}
+
+// pdfStages returns all post-processing stages that must be applied to a
+// document printed on printer using opts. requested is set if at least one
+// stage was explicitly requested by the caller rather than being configured
+// for the printer.
+func (svc *Service) pdfStages(printer string, opts PrintOptions) (stages []pdfStage, requested bool, err error) {
+	if opts.Layout.Arranges() {
+		stages = append(stages, pdfStage{
+			name: "arrange",
+			apply: func(content []byte, _ *printJob) ([]byte, error) {
+				return pdf.ArrangePages(content, opts.Layout)
+			},
+		})
+	}
+
+	// the letterhead is applied before stamps so it ends up underneath them
+	overlay, ok, err := svc.overlayFor(printer, opts)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if ok {
+		stages = append(stages, pdfStage{
+			name: "overlay",
+			apply: func(content []byte, _ *printJob) ([]byte, error) {
+				return pdf.ApplyOverlay(content, overlay)
+			},
+		})
+	}
+
+	stamps, stampsRequested, err := svc.stampsFor(printer, opts)
+	if err != nil {
+		return nil, false, err
+	}
+
+	requested = !opts.Layout.IsZero() || opts.Overlay != "" || stampsRequested
+
+	if len(stamps) > 0 {
+		stages = append(stages, pdfStage{
+			name: "stamp",
+			apply: func(content []byte, job *printJob) ([]byte, error) {
+				return pdf.ApplyStamps(content, stamps, pdf.StampData{
+					User:        job.User,
+					OperationID: job.OperationID,
+					Document:    job.Document,
+					Printer:     job.Printer,
+					Time:        time.Now(),
+				})
+			},
+		})
+	}
+
+	// imposition runs last so letterheads and stamps are applied to the
+	// document pages rather than the printed sheets
+	if opts.Layout.Imposes() {
+		stages = append(stages, pdfStage{
+			name: "impose",
+			apply: func(content []byte, _ *printJob) ([]byte, error) {
+				return pdf.Impose(content, opts.Layout)
+			},
+		})
+	}
+
+	return stages, requested, nil
+}
+
+// applyPDFStages runs all stages on content.
+func applyPDFStages(content []byte, stages []pdfStage, job *printJob) ([]byte, error) {
+	for _, stage := range stages {
+		var err error
+
+		content, err = stage.apply(content, job)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", stage.name, pdfError(err))
+		}
+
+		slog.Debug("applied post-processing stage", "stage", stage.name, "document", privacy.Name(job.Document), "size", len(content))
+	}
+
+	return content, nil
+}
+
+// stampsFor returns the stamps configured for printer and requested in opts.
+func (svc *Service) stampsFor(printer string, opts PrintOptions) ([]pdf.Stamp, bool, error) {
+	cfg := svc.providers.Config.Stamps
+
+	var (
+		stamps    []pdf.Stamp
+		requested bool
+	)
+
+	for _, name := range cfg.Printers[printer] {
+		stamps = append(stamps, cfg.Profiles[name])
+	}
+
+	for _, name := range opts.Stamps {
+		stamp, ok := cfg.Profiles[name]
+		if !ok {
+			return nil, false, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("unknown stamp profile %q", name))
+		}
+
+		stamps = append(stamps, stamp)
+		requested = true
+	}
+
+	if opts.Watermark != "" {
+		stamps = append(stamps, pdf.Stamp{
+			Watermark: &pdf.Watermark{
+				// the text is quoted so it is not interpreted as a template
+				Text: "{{ " + strconv.Quote(opts.Watermark) + " }}",
+			},
+		})
+		requested = true
+	}
+
+	if opts.AuditFooter {
+		stamps = append(stamps, pdf.Stamp{
+			Footer: &pdf.Footer{},
+		})
+		requested = true
+	}
+
+	return stamps, requested, nil
+}
+
+// overlayFor returns the letterhead forced for printer or requested in opts.
+// A printer letterhead cannot be replaced by a different one.
+func (svc *Service) overlayFor(printer string, opts PrintOptions) (pdf.Overlay, bool, error) {
+	cfg := svc.providers.Config.Overlays
+
+	name := cfg.Printers[printer]
+	if opts.Overlay != "" {
+		if name != "" && name != opts.Overlay {
+			return pdf.Overlay{}, false, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("printer %q always uses overlay profile %q", printer, name))
+		}
+
+		name = opts.Overlay
+	}
+
+	if name == "" {
+		return pdf.Overlay{}, false, nil
+	}
+
+	overlay, ok := cfg.Profiles[name]
+	if !ok {
+		return pdf.Overlay{}, false, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("unknown overlay profile %q", name))
+	}
+
+	return overlay, true, nil
+}
+
+// documentAnnotations returns the operation annotations for the inspected
+// document.
+func documentAnnotations(info *pdf.Info) map[string]string {
+	annotations := map[string]string{
+		"pageCount": strconv.Itoa(info.PageCount),
+		"color":     strconv.FormatBool(info.Color),
+		"encrypted": strconv.FormatBool(info.Encrypted),
+		"damaged":   strconv.FormatBool(info.Damaged),
+	}
+
+	if media := info.Media(); media != "" {
+		annotations["media"] = media
+	}
+
+	if len(info.Fonts) > 0 {
+		names := make([]string, len(info.Fonts))
+		for idx, font := range info.Fonts {
+			names[idx] = font.Name
+		}
+
+		annotations["fonts"] = strings.Join(names, ",")
+	}
+
+	return annotations
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/print-service/internal/acl"
+	"github.com/tierklinik-dobersberg/print-service/internal/config"
+	"github.com/tierklinik-dobersberg/print-service/internal/pdf"
+)
+
+func TestStampsFor(t *testing.T) {
+	svc := newHTTPService(t, acl.Config{})
+	svc.providers.Config.Stamps = config.Stamps{
+		Profiles: map[string]pdf.Stamp{
+			"copy":  {Watermark: &pdf.Watermark{Text: "KOPIE"}},
+			"audit": {Footer: &pdf.Footer{}},
+		},
+		Printers: map[string][]string{
+			"prescriptions": {"audit"},
+		},
+	}
+
+	stamps, requested, err := svc.stampsFor("prescriptions", PrintOptions{})
+	if err != nil || requested || len(stamps) != 1 {
+		t.Errorf("expected the printer stamp only, got %+v, %t, %v", stamps, requested, err)
+	}
+
+	if _, _, err := svc.stampsFor("prescriptions", PrintOptions{Stamps: []string{"unknown"}}); err == nil {
+		t.Errorf("expected unknown stamp profiles to be rejected")
+	}
+
+	// watermarks of users must not be executed as templates
+	stamps, requested, err = svc.stampsFor("prescriptions", PrintOptions{Watermark: "{{ .Unknown }} }} {{"})
+	if err != nil || !requested || len(stamps) != 2 {
+		t.Fatalf("expected the printer stamp and the watermark, got %+v, %t, %v", stamps, requested, err)
+	}
+
+	if _, err := pdf.ApplyStamps(testPDF(1), stamps, pdf.StampData{User: "alice"}); err != nil {
+		t.Errorf("expected the watermark to be printed as is, got %v", err)
+	}
+}
+
+func TestOverlayFor(t *testing.T) {
+	svc := newHTTPService(t, acl.Config{})
+	svc.providers.Config.Overlays = config.Overlays{
+		Profiles: map[string]pdf.Overlay{
+			"clinic":  {FirstPage: "clinic.pdf"},
+			"surgery": {FirstPage: "surgery.pdf"},
+		},
+		Printers: map[string]string{
+			"prescriptions": "clinic",
+		},
+	}
+
+	cases := []struct {
+		name     string
+		printer  string
+		overlay  string
+		expected string
+		ok       bool
+		code     connect.Code
+	}{
+		{"no letterhead", "office", "", "", false, 0},
+		{"requested", "office", "surgery", "surgery.pdf", true, 0},
+		{"printer letterhead", "prescriptions", "", "clinic.pdf", true, 0},
+		{"same as printer", "prescriptions", "clinic", "clinic.pdf", true, 0},
+		{"replaces printer letterhead", "prescriptions", "surgery", "", false, connect.CodeInvalidArgument},
+		{"unknown", "office", "unknown", "", false, connect.CodeInvalidArgument},
+	}
+
+	for _, c := range cases {
+		overlay, ok, err := svc.overlayFor(c.printer, PrintOptions{Overlay: c.overlay})
+
+		if c.code != 0 {
+			var cerr *connect.Error
+			if !errors.As(err, &cerr) || cerr.Code() != c.code {
+				t.Errorf("%s: expected %s, got %v", c.name, c.code, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+			continue
+		}
+
+		if ok != c.ok || overlay.FirstPage != c.expected {
+			t.Errorf("%s: expected %q (%t), got %q (%t)", c.name, c.expected, c.ok, overlay.FirstPage, ok)
+		}
+	}
+}
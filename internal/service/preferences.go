@@ -0,0 +1,233 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/apis/pkg/auth"
+	"github.com/tierklinik-dobersberg/print-service/internal/preferences"
+)
+
+// userRoles returns the role IDs and names of user.
+func userRoles(user *auth.RemoteUser) []string {
+	roles := slices.Clone(user.RoleIDs)
+	for _, role := range user.ResolvedRoles {
+		roles = append(roles, role.Name)
+	}
+
+	return roles
+}
+
+// isAdmin returns true if user may manage settings of other users. Admin is
+// only set by the auth interceptor for unary RPCs so HTTP handlers rely on
+// the configured admin roles, which are matched against the role IDs and
+// the names resolved by UserFromHeader.
+func (svc *Service) isAdmin(user *auth.RemoteUser) bool {
+	if user.Admin {
+		return true
+	}
+
+	return slices.ContainsFunc(userRoles(user), func(role string) bool {
+		return slices.Contains(svc.providers.Config.AdminRoles, role)
+	})
+}
+
+// preferredDefaults returns the effective preferences for user and the
+// workstation the request has been sent from together with the parsed
+// default options. Invalid options are ignored.
+func (svc *Service) preferredDefaults(user *auth.RemoteUser, workstation string) (preferences.Resolved, PrintOptions) {
+	resolved := svc.providers.Preferences.Resolve(user.Username, userRoles(user), workstation)
+
+	opts, err := parseOptionMap(resolved.Options)
+	if err != nil {
+		slog.Error("ignoring invalid default print options", "user", user.Username, "workstation", workstation, "error", err)
+
+		return resolved, PrintOptions{}
+	}
+
+	return resolved, opts
+}
+
+func parseOptionMap(options map[string]string) (PrintOptions, error) {
+	values := make(url.Values)
+	for key, value := range options {
+		values.Set(key, value)
+	}
+
+	return ParsePrintOptions(values)
+}
+
+// preferencesRequest is accepted by HandleSetPrintPreferences.
+type preferencesRequest struct {
+	Scope string `json:"scope"`
+
+	// Key is the username, role or workstation. It defaults to the calling
+	// user or the workstation of the request.
+	Key string `json:"key"`
+
+	preferences.Preferences
+}
+
+// preferencesResponse is returned by HandleGetPrintPreferences.
+type preferencesResponse struct {
+	// Effective holds the preferences used for requests of the caller.
+	Effective preferences.Resolved `json:"effective"`
+
+	User        *preferences.Preferences           `json:"user,omitempty"`
+	Workstation *preferences.Preferences           `json:"workstation,omitempty"`
+	Roles       map[string]preferences.Preferences `json:"roles,omitempty"`
+}
+
+// HandleGetPrintPreferences returns the preferences of the calling user. If
+// the scope query parameter is set, the preferences stored for key in that
+// scope are returned instead, or all preferences of the scope if key is
+// empty. Only administrators may query preferences other than their own.
+func (svc *Service) HandleGetPrintPreferences(w http.ResponseWriter, r *http.Request) {
+	user, err := svc.UserFromHeader(r.Context(), r.Header)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	store := svc.providers.Preferences
+	query := r.URL.Query()
+
+	if value := query.Get("scope"); value != "" {
+		scope, err := preferences.ParseScope(value)
+		if err != nil {
+			writeError(w, connect.NewError(connect.CodeInvalidArgument, err))
+			return
+		}
+
+		key := query.Get("key")
+		if (scope != preferences.ScopeUser || key != user.Username) && !svc.isAdmin(user) {
+			writeError(w, connect.NewError(connect.CodePermissionDenied, fmt.Errorf("you're not allowed to read these preferences")))
+			return
+		}
+
+		if key == "" {
+			writeJSON(w, http.StatusOK, store.List(scope))
+			return
+		}
+
+		prefs, _ := store.Get(scope, key)
+		writeJSON(w, http.StatusOK, prefs)
+
+		return
+	}
+
+	workstation := clientInfoFrom(r.Context()).Workstation
+	res := preferencesResponse{}
+	res.Effective, _ = svc.preferredDefaults(user, workstation)
+
+	if prefs, ok := store.Get(preferences.ScopeUser, user.Username); ok {
+		res.User = &prefs
+	}
+
+	if prefs, ok := store.Get(preferences.ScopeWorkstation, workstation); ok && workstation != "" {
+		res.Workstation = &prefs
+	}
+
+	for _, role := range userRoles(user) {
+		if prefs, ok := store.Get(preferences.ScopeRole, role); ok {
+			if res.Roles == nil {
+				res.Roles = make(map[string]preferences.Preferences)
+			}
+
+			res.Roles[role] = prefs
+		}
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+// HandleSetPrintPreferences stores the default printer and options of a
+// user, role or workstation. Users may change their own preferences while
+// all other scopes require an administrator. Sending empty preferences
+// removes them.
+func (svc *Service) HandleSetPrintPreferences(w http.ResponseWriter, r *http.Request) {
+	user, err := svc.UserFromHeader(r.Context(), r.Header)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	svc.LimitRequestBody(w, r)
+
+	var req preferencesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid request: %w", err)))
+		return
+	}
+
+	if req.Scope == "" {
+		req.Scope = string(preferences.ScopeUser)
+	}
+
+	scope, err := preferences.ParseScope(req.Scope)
+	if err != nil {
+		writeError(w, connect.NewError(connect.CodeInvalidArgument, err))
+		return
+	}
+
+	if req.Key == "" {
+		switch scope {
+		case preferences.ScopeUser:
+			req.Key = user.Username
+		case preferences.ScopeWorkstation:
+			req.Key = clientInfoFrom(r.Context()).Workstation
+		}
+	}
+
+	if req.Key == "" {
+		writeError(w, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("missing key for scope %q", scope)))
+		return
+	}
+
+	if (scope != preferences.ScopeUser || req.Key != user.Username) && !svc.isAdmin(user) {
+		writeError(w, connect.NewError(connect.CodePermissionDenied, fmt.Errorf("you're not allowed to change these preferences")))
+		return
+	}
+
+	if req.Printer != "" {
+		switch err := svc.checkPrinter(req.Printer); {
+		case connect.CodeOf(err) == connect.CodeNotFound:
+			writeError(w, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("unknown printer %q", req.Printer)))
+			return
+		case err != nil:
+			writeError(w, err)
+			return
+		}
+	}
+
+	if req.Printer != "" && scope == preferences.ScopeUser && req.Key == user.Username && svc.canUsePrinter(user, req.Printer) != nil {
+		writeError(w, connect.NewError(connect.CodePermissionDenied, fmt.Errorf("you're not allowed to use printer %q", req.Printer)))
+		return
+	}
+
+	if _, err := parseOptionMap(req.Options); err != nil {
+		writeError(w, connect.NewError(connect.CodeInvalidArgument, err))
+		return
+	}
+
+	if err := svc.providers.Preferences.Set(scope, req.Key, req.Preferences); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	slog.Info("updated print preferences", "scope", scope, "key", req.Key, "printer", req.Printer, "user", user.Username)
+
+	if scope != preferences.ScopeUser || req.Key != user.Username {
+		svc.auditAdmin(r.Context(), user, "set-preferences", map[string]string{
+			"scope": string(scope),
+			"key":   req.Key,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, req)
+}
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bufbuild/connect-go"
+	v1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/printing/v1"
+	"github.com/tierklinik-dobersberg/print-service/internal/pdf"
+	"github.com/tierklinik-dobersberg/print-service/internal/preview"
+	"github.com/tierklinik-dobersberg/print-service/internal/privacy"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	defaultPreviewDPI = 72
+	minPreviewDPI     = 10
+	maxPreviewDPI     = 150
+
+	// maxThumbnails limits the number of pages rendered per request.
+	maxThumbnails = 20
+)
+
+type previewResponse struct {
+	// Document is the final PDF document.
+	Document []byte `json:"document"`
+
+	Info       *pdf.Info   `json:"info"`
+	Thumbnails []thumbnail `json:"thumbnails"`
+	Warnings   []string    `json:"warnings"`
+}
+
+type thumbnail struct {
+	Page  int    `json:"page"`
+	Image []byte `json:"image"`
+
+	// Approximate is set if the page has been rendered by the built-in
+	// rasterizer that shows text as placeholders.
+	Approximate bool `json:"approximate,omitempty"`
+}
+
+// HandlePreviewDocument runs the conversion and post-processing of
+// PrintDocument and returns the resulting PDF document without printing it.
+// The request body is a JSON encoded tkd.printing.v1.Document and print
+// options are passed as X-Print- headers.
+//
+// Without query parameters the PDF document is returned as is. If the
+// thumbnails parameter holds a comma separated list of page numbers, a JSON
+// object with the base64 encoded document, the document info and PNG
+// thumbnails of the selected pages is returned. The resolution of the
+// thumbnails is set using the dpi parameter.
+func (svc *Service) HandlePreviewDocument(w http.ResponseWriter, r *http.Request) {
+	user, err := svc.UserFromHeader(r.Context(), r.Header)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	pages, dpi, err := parseThumbnailQuery(r)
+	if err != nil {
+		writeError(w, connect.NewError(connect.CodeInvalidArgument, err))
+		return
+	}
+
+	svc.LimitRequestBody(w, r)
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("failed to read request: %w", err)))
+		return
+	}
+
+	var document v1.Document
+	if err := protojson.Unmarshal(body, &document); err != nil {
+		writeError(w, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid request: %w", err)))
+		return
+	}
+
+	opts, err := ParsePrintOptionsFromHeader(r.Header)
+	if err != nil {
+		writeError(w, connect.NewError(connect.CodeInvalidArgument, err))
+		return
+	}
+
+	reader, size, err := svc.resolveContent(&document)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer reader.Close()
+
+	// url and file_path sources are not covered by the request body limit
+	limited, err := svc.limitDocument(reader, size)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	converted, _, mime, err := svc.convertDocument(r.Context(), &document, limited, size)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if mime != "application/pdf" {
+		writeError(w, connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("documents of type %q cannot be previewed", mime)))
+		return
+	}
+
+	converted, info, err := svc.documentInfo(&document, mime, converted)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	printer, opts, _, err := svc.resolveTarget(r.Context(), user, &document, opts, info, false)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if err := svc.checkPrinterAccess(r.Context(), user, printer, actionPreview, document.Name); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	opts, err = svc.applyPolicies(r.Context(), user, &document, printer, opts, info, actionPreview)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	stages, err := svc.stagesFor(&document, printer, mime, opts)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// stamps referencing the operation ID show a placeholder since no
+	// operation is created for previews.
+	job := &printJob{
+		User:        user.Username,
+		Document:    document.Name,
+		Printer:     printer,
+		OperationID: "preview",
+		Options:     opts,
+	}
+
+	content, err := finishPDF(converted, stages, job)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if len(pages) == 0 {
+		w.Header().Set("Content-Type", "application/pdf")
+		if _, err := w.Write(content); err != nil {
+			slog.Error("failed to write document preview", "name", privacy.Name(document.Name), "error", err)
+		}
+
+		return
+	}
+
+	res := previewResponse{
+		Document:   content,
+		Info:       job.Info,
+		Thumbnails: []thumbnail{},
+		Warnings:   []string{},
+	}
+
+	for _, page := range pages {
+		if page > job.Info.PageCount {
+			res.Warnings = append(res.Warnings, fmt.Sprintf("page %d: the document has %d pages", page, job.Info.PageCount))
+			continue
+		}
+
+		img, err := svc.providers.Preview.Render(r.Context(), content, page, dpi)
+		switch {
+		case errors.Is(err, preview.ErrPageNotSupported):
+			res.Warnings = append(res.Warnings, fmt.Sprintf("page %d: no rasterizer configured for this page", page))
+		case err != nil:
+			slog.Error("failed to render preview", "name", privacy.Name(document.Name), "page", page, "error", err)
+			res.Warnings = append(res.Warnings, fmt.Sprintf("page %d: failed to render page: %s", page, err))
+		default:
+			if img.Approximate {
+				res.Warnings = append(res.Warnings, fmt.Sprintf("page %d: the thumbnail is approximate, text is shown as placeholders", page))
+			}
+
+			res.Thumbnails = append(res.Thumbnails, thumbnail{
+				Page:        page,
+				Image:       img.PNG,
+				Approximate: img.Approximate,
+			})
+		}
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+// parseThumbnailQuery parses the thumbnails and dpi query parameters.
+func parseThumbnailQuery(r *http.Request) ([]int, int, error) {
+	query := r.URL.Query()
+
+	var pages []int
+	if value := query.Get("thumbnails"); value != "" {
+		for _, part := range strings.Split(value, ",") {
+			page, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil || page < 1 {
+				return nil, 0, fmt.Errorf("invalid thumbnail page %q", part)
+			}
+
+			pages = append(pages, page)
+		}
+	}
+
+	if len(pages) > maxThumbnails {
+		return nil, 0, fmt.Errorf("at most %d thumbnails can be rendered at once", maxThumbnails)
+	}
+
+	dpi := defaultPreviewDPI
+	if value := query.Get("dpi"); value != "" {
+		var err error
+
+		dpi, err = strconv.Atoi(value)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid dpi %q", value)
+		}
+
+		dpi = min(max(dpi, minPreviewDPI), maxPreviewDPI)
+	}
+
+	return pages, dpi, nil
+}
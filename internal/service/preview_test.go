@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/tierklinik-dobersberg/print-service/internal/acl"
+	"github.com/tierklinik-dobersberg/print-service/internal/pdf"
+	"github.com/tierklinik-dobersberg/print-service/internal/preview"
+)
+
+// recordingRasterizer renders placeholder images and records the rendered
+// pages. Pages in unsupported are rejected.
+type recordingRasterizer struct {
+	unsupported []int
+
+	mu    sync.Mutex
+	pages []int
+	dpi   []int
+}
+
+func (r *recordingRasterizer) Render(_ context.Context, _ []byte, page int, dpi int) (preview.Image, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.pages = append(r.pages, page)
+	r.dpi = append(r.dpi, dpi)
+
+	if slices.Contains(r.unsupported, page) {
+		return preview.Image{}, preview.ErrPageNotSupported
+	}
+
+	return preview.Image{PNG: []byte(fmt.Sprintf("page %d", page))}, nil
+}
+
+func previewRequest(query string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/preview"+query, strings.NewReader(`{"name": "letter.pdf", "filePath": "letter.pdf", "contentType": "application/pdf", "printer": "prescriptions"}`))
+	req.Header.Set("X-Remote-User-ID", "u1")
+	req.Header.Set("X-Remote-User", "alice")
+
+	return req
+}
+
+func TestHandlePreviewDocument(t *testing.T) {
+	rasterizer := &recordingRasterizer{unsupported: []int{2}}
+
+	svc := newHTTPService(t, acl.Config{})
+	svc.providers.Preview = rasterizer
+	svc.providers.Storage = fstest.MapFS{
+		"letter.pdf": {Data: testPDF(3)},
+	}
+
+	// without thumbnails the document is returned as is
+	rec := httptest.NewRecorder()
+	svc.HandlePreviewDocument(rec, previewRequest(""))
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/pdf" {
+		t.Fatalf("expected the PDF document, got %d: %s", rec.Code, rec.Body)
+	}
+
+	if info := pdf.Inspect(rec.Body.Bytes()); info.PageCount != 3 {
+		t.Errorf("expected a document with 3 pages, got %d", info.PageCount)
+	}
+
+	rec = httptest.NewRecorder()
+	svc.HandlePreviewDocument(rec, previewRequest("?thumbnails=1,2,5&dpi=1000"))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected the thumbnails, got %d: %s", rec.Code, rec.Body)
+	}
+
+	var res previewResponse
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Thumbnails) != 1 || res.Thumbnails[0].Page != 1 || string(res.Thumbnails[0].Image) != "page 1" {
+		t.Errorf("expected a thumbnail of page 1, got %+v", res.Thumbnails)
+	}
+
+	if len(res.Warnings) != 2 {
+		t.Errorf("expected warnings for the unsupported and the missing page, got %v", res.Warnings)
+	}
+
+	// pages beyond the end of the document are not rendered
+	if !slices.Equal(rasterizer.pages, []int{1, 2}) || !slices.Equal(rasterizer.dpi, []int{maxPreviewDPI, maxPreviewDPI}) {
+		t.Errorf("expected pages 1 and 2 to be rendered with %d dpi, got %v with %v", maxPreviewDPI, rasterizer.pages, rasterizer.dpi)
+	}
+
+	for _, query := range []string{"?thumbnails=0", "?thumbnails=a", "?thumbnails=1&dpi=high"} {
+		rec := httptest.NewRecorder()
+		svc.HandlePreviewDocument(rec, previewRequest(query))
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected the request to be rejected, got %d: %s", query, rec.Code, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/bufbuild/connect-go"
+	v1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/printing/v1"
+	"github.com/tierklinik-dobersberg/apis/pkg/auth"
+	"github.com/tierklinik-dobersberg/print-service/internal/archive"
+	"github.com/tierklinik-dobersberg/print-service/internal/backend"
+	"github.com/tierklinik-dobersberg/print-service/internal/history"
+	"github.com/tierklinik-dobersberg/print-service/internal/pdf"
+	"github.com/tierklinik-dobersberg/print-service/internal/privacy"
+)
+
+// actionReprint is checked against the printer ACL when a job of the
+// history is printed again.
+const actionReprint = "reprint"
+
+// originalID returns the archive ID of the document of the history record
+// id before post-processing.
+func originalID(id string) string {
+	return id + "-original"
+}
+
+// archiveDocument stores the submitted document of the history record id
+// for reprints. If original differs from final, the document before
+// post-processing is stored as well. original is nil if final has been
+// post-processed but the original is not available anymore. Nothing is
+// stored if the archive is disabled or there is no document.
+func (svc *Service) archiveDocument(id string, final []byte, original []byte) {
+	store := svc.providers.Archive
+	if store == nil || id == "" || final == nil {
+		return
+	}
+
+	if err := store.Store(id, final); err != nil {
+		slog.Error("failed to archive document", "id", id, "error", err)
+		return
+	}
+
+	processed := !bytes.Equal(final, original)
+
+	var stored bool
+	if processed && original != nil {
+		if err := store.Store(originalID(id), original); err != nil {
+			slog.Error("failed to archive original document", "id", id, "error", err)
+		} else {
+			stored = true
+		}
+	}
+
+	err := svc.providers.History.Update(id, func(r *history.Record) {
+		r.Archived = true
+		r.Unprocessed = !processed
+		r.Original = stored
+	})
+	if err != nil {
+		slog.Error("failed to update job history", "id", id, "error", err)
+	}
+}
+
+// originalContent returns the archived document of record before
+// post-processing or nil if it is not available.
+func (svc *Service) originalContent(record history.Record) ([]byte, error) {
+	store := svc.providers.Archive
+	if store == nil || !record.Original {
+		return nil, nil
+	}
+
+	content, err := store.Load(originalID(record.ID))
+	if errors.Is(err, archive.ErrNotFound) {
+		return nil, nil
+	}
+
+	return content, err
+}
+
+// reprintContent returns the document and content type submitted for
+// record. Documents are loaded from the archive or, if CUPS preserved the
+// job files, from CUPS. processed is set if the document has been
+// post-processed for the printer of record.
+func (svc *Service) reprintContent(record history.Record) (content []byte, mime string, processed bool, err error) {
+	if store := svc.providers.Archive; store != nil && record.Archived {
+		content, err := store.Load(record.ID)
+		if err == nil {
+			return content, record.SubmittedContentType, !record.Unprocessed, nil
+		}
+
+		if !errors.Is(err, archive.ErrNotFound) {
+			return nil, "", false, err
+		}
+	}
+
+	cli := svc.providers.CUPS
+	if cli == nil || record.JobID == 0 || record.JobPrinter == "" {
+		return nil, "", false, connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("the document of job %s is not available anymore", record.ID))
+	}
+
+	// pools and printers of other backends cannot be queried
+	if b, err := svc.providers.Printers.Lookup(record.JobPrinter); err != nil || b != backend.PrinterBackend(cli) {
+		return nil, "", false, connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("the document of job %s is not available anymore", record.ID))
+	}
+
+	content, format, err := cli.GetDocument(record.JobPrinter, record.JobID)
+	if err != nil {
+		slog.Error("failed to get document from CUPS", "id", record.ID, "printer", record.JobPrinter, "job-id", record.JobID, "error", err)
+
+		return nil, "", false, connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("the document of job %s is not available anymore", record.ID))
+	}
+
+	if format == "" || format == "application/octet-stream" {
+		format = record.SubmittedContentType
+	}
+
+	return content, format, true, nil
+}
+
+// reprintRequest is accepted by HandleReprint.
+type reprintRequest struct {
+	// Printer overwrites the printer of the original job.
+	Printer string `json:"printer"`
+
+	// Copies overwrites the number of copies of the original job.
+	Copies int `json:"copies"`
+}
+
+// HandleReprint submits the document of a job from the history again,
+// optionally to a different printer or with a different number of copies.
+// Only the user that printed the job and administrators may reprint it.
+func (svc *Service) HandleReprint(w http.ResponseWriter, r *http.Request) {
+	user, err := svc.UserFromHeader(r.Context(), r.Header)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	svc.LimitRequestBody(w, r)
+
+	var req reprintRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			writeError(w, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid request body: %w", err)))
+			return
+		}
+	}
+
+	if req.Copies < 0 {
+		writeError(w, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid number of copies %d", req.Copies)))
+		return
+	}
+
+	operationID, err := svc.reprint(r.Context(), user, r.PathValue("id"), req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, operationResponse{
+		OperationID: operationID,
+	})
+}
+
+func (svc *Service) reprint(ctx context.Context, user *auth.RemoteUser, id string, req reprintRequest) (string, error) {
+	store := svc.providers.History
+	if store == nil {
+		return "", connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("the job history is disabled"))
+	}
+
+	record, err := store.Get(id)
+	if errors.Is(err, history.ErrNotFound) {
+		return "", connect.NewError(connect.CodeNotFound, fmt.Errorf("job %q not found", id))
+	} else if err != nil {
+		return "", err
+	}
+
+	// jobs of other users are reported as not found
+	if record.User != user.Username && !svc.isAdmin(user) {
+		return "", connect.NewError(connect.CodeNotFound, fmt.Errorf("job %q not found", id))
+	}
+
+	if record.User != user.Username {
+		svc.auditAdmin(ctx, user, "reprint", map[string]string{
+			"user":      record.User,
+			"historyId": record.ID,
+		})
+	}
+
+	content, mime, processed, err := svc.reprintContent(record)
+	if err != nil {
+		return "", err
+	}
+
+	opts, err := parseOptionMap(record.Options)
+	if err != nil {
+		return "", connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("invalid print options of job %s: %w", id, err))
+	}
+
+	if req.Copies > 0 {
+		opts.Copies = req.Copies
+	}
+
+	printer := record.Printer
+	if req.Printer != "" {
+		printer = req.Printer
+	}
+
+	isPDF := strings.HasPrefix(mime, "application/pdf")
+
+	// the document before post-processing is archived again for the
+	// reprint and used if it is sent to another printer.
+	original := content
+	if processed && isPDF {
+		original, err = svc.originalContent(record)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if processed && isPDF && printer != record.Printer {
+		// the overlay and stamps of the original printer cannot be removed
+		// from the submitted document.
+		if original == nil {
+			return "", connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("the document of job %s has already been post-processed for printer %q and cannot be reprinted on %q", record.ID, record.Printer, printer))
+		}
+
+		content = original
+		processed = false
+	}
+
+	if err := svc.checkPrinter(printer); err != nil {
+		return "", err
+	}
+
+	document := &v1.Document{
+		Name:        record.Document,
+		ContentType: mime,
+		Printer:     printer,
+	}
+
+	if err := svc.checkPrinterAccess(ctx, user, printer, actionReprint, document.Name); err != nil {
+		return "", err
+	}
+
+	// the recorded info describes the post-processed document
+	info := record.Info
+	if isPDF && (info == nil || !processed) {
+		info = pdf.Inspect(content)
+	}
+
+	opts, err = svc.applyPolicies(ctx, user, document, printer, opts, info, actionReprint)
+	if err != nil {
+		return "", err
+	}
+
+	var stages []pdfStage
+	if !processed {
+		stages, err = svc.stagesFor(document, printer, mime, opts)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	op, err := backend.StartOperation(ctx, svc.providers.LongRunning, document.Name, user.Username, map[string]string{
+		"reprintOf": record.ID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	slog.Info("reprinting document", "id", record.ID, "name", privacy.Name(document.Name), "printer", printer, "operation-id", op.ID())
+
+	sub := submission{
+		user:      user,
+		document:  document,
+		printer:   printer,
+		opts:      opts,
+		mime:      mime,
+		content:   bytes.NewReader(content),
+		size:      int64(len(content)),
+		info:      info,
+		final:     content,
+		original:  original,
+		reprintOf: record.ID,
+		action:    actionReprint,
+	}
+
+	// unprocessed documents get the stages of the target printer while
+	// processed ones are submitted as is.
+	if !processed && isPDF {
+		job := &printJob{
+			User:        user.Username,
+			Document:    document.Name,
+			Printer:     printer,
+			OperationID: op.ID(),
+			Options:     opts,
+		}
+
+		final, err := finishPDF(bytes.NewReader(content), stages, job)
+		if err != nil {
+			op.Fail(err)
+
+			return "", err
+		}
+
+		sub.content = bytes.NewReader(final)
+		sub.size = int64(len(final))
+		sub.info = job.Info
+		sub.final = final
+	}
+
+	err = svc.submit(ctx, op, sub)
+	if err != nil {
+		return "", err
+	}
+
+	return op.ID(), nil
+}
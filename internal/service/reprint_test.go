@@ -0,0 +1,257 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/phin1x/go-ipp"
+	v1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/printing/v1"
+	"github.com/tierklinik-dobersberg/apis/pkg/auth"
+	"github.com/tierklinik-dobersberg/print-service/internal/acl"
+	"github.com/tierklinik-dobersberg/print-service/internal/archive"
+	"github.com/tierklinik-dobersberg/print-service/internal/backend"
+	"github.com/tierklinik-dobersberg/print-service/internal/config"
+	"github.com/tierklinik-dobersberg/print-service/internal/history"
+	"github.com/tierklinik-dobersberg/print-service/internal/pdf"
+)
+
+func newReprintService(t *testing.T) *Service {
+	t.Helper()
+
+	store, err := history.Open(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	docs, err := archive.New(t.TempDir(), make([]byte, 32), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Service{
+		providers: &config.Providers{
+			Config:  &config.Config{},
+			History: store,
+			Archive: docs,
+		},
+	}
+}
+
+func TestArchiveDocument(t *testing.T) {
+	svc := newReprintService(t)
+
+	cases := []struct {
+		name        string
+		original    []byte
+		processed   bool
+		hasOriginal bool
+	}{
+		{"unprocessed", []byte("%PDF-1.7"), false, false},
+		{"processed", []byte("%PDF-1.4"), true, true},
+		{"original not available", nil, true, false},
+	}
+
+	for _, c := range cases {
+		record, err := svc.providers.History.Add(history.Record{
+			User:                 "alice",
+			Document:             "test.pdf",
+			Printer:              "office",
+			SubmittedContentType: "application/pdf",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		svc.archiveDocument(record.ID, []byte("%PDF-1.7"), c.original)
+
+		record, err = svc.providers.History.Get(record.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		content, mime, processed, err := svc.reprintContent(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(content) != "%PDF-1.7" || mime != "application/pdf" || processed != c.processed {
+			t.Errorf("%s: expected the submitted document with processed=%t, got %q, %q, %t", c.name, c.processed, content, mime, processed)
+		}
+
+		original, err := svc.originalContent(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if hasOriginal := original != nil; hasOriginal != c.hasOriginal || (hasOriginal && !bytes.Equal(original, c.original)) {
+			t.Errorf("%s: expected original=%t, got %q", c.name, c.hasOriginal, original)
+		}
+	}
+}
+
+func TestReprintProcessedToOtherPrinter(t *testing.T) {
+	svc := newReprintService(t)
+
+	// documents archived by older versions have been post-processed
+	record, err := svc.providers.History.Add(history.Record{
+		User:                 "alice",
+		Document:             "test.pdf",
+		Printer:              "office",
+		SubmittedContentType: "application/pdf",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := svc.providers.Archive.Store(record.ID, []byte("%PDF-1.7")); err != nil {
+		t.Fatal(err)
+	}
+
+	err = svc.providers.History.Update(record.ID, func(r *history.Record) {
+		r.Archived = true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := &auth.RemoteUser{Username: "alice"}
+
+	_, err = svc.reprint(context.Background(), user, record.ID, reprintRequest{Printer: "reception"})
+	if connect.CodeOf(err) != connect.CodeFailedPrecondition {
+		t.Fatalf("expected reprint to another printer to be rejected, got %v", err)
+	}
+}
+
+// testPDF returns a document with the given number of empty A4 pages.
+func testPDF(pages int) []byte {
+	var kids []string
+	for i := range pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", i+3))
+	}
+
+	objs := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), pages),
+	}
+	for range pages {
+		objs = append(objs, "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595.28 841.89] /Resources << >> >>")
+	}
+
+	return buildTestPDF(objs...)
+}
+
+// buildTestPDF returns a PDF document with objs numbered from 1. The first
+// object must be the catalog.
+func buildTestPDF(objs ...string) []byte {
+	var (
+		buf     bytes.Buffer
+		offsets []int
+	)
+
+	buf.WriteString("%PDF-1.4\n")
+	for i, obj := range objs {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objs)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objs)+1, xref)
+
+	return buf.Bytes()
+}
+
+// recordingBackend serves multiple printers and records the submitted
+// documents.
+type recordingBackend struct {
+	jobsBackend
+
+	printers  []string
+	mu        sync.Mutex
+	submitted [][]byte
+}
+
+func (b *recordingBackend) HasPrinter(name string) bool { return slices.Contains(b.printers, name) }
+
+func (b *recordingBackend) Print(doc ipp.Document, _ string, _ map[string]any) (int, error) {
+	content, err := io.ReadAll(doc.Document)
+	if err != nil {
+		return 0, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.submitted = append(b.submitted, content)
+
+	return len(b.submitted), nil
+}
+
+func (b *recordingBackend) last() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.submitted[len(b.submitted)-1]
+}
+
+func TestReprintSubmittedDocument(t *testing.T) {
+	printers := &recordingBackend{printers: []string{"office", "reception"}}
+
+	svc := newHTTPService(t, acl.Config{})
+	reprints := newReprintService(t)
+	svc.providers.History = reprints.providers.History
+	svc.providers.Archive = reprints.providers.Archive
+	svc.providers.Printers = backend.NewRegistry(printers)
+	svc.providers.LongRunning = &fakeLongRunning{}
+
+	user := &auth.RemoteUser{ID: "u1", Username: "alice"}
+	content := testPDF(2)
+	document := &v1.Document{Name: "letter.pdf", ContentType: "application/pdf", Printer: "office"}
+
+	// the page selection makes the submitted document differ from the
+	// original one
+	opts := PrintOptions{Layout: pdf.Layout{Pages: "1"}}
+	if _, err := svc.startPrint(context.Background(), user, document, opts, bytes.NewReader(content), int64(len(content)), nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	printed := printers.last()
+
+	records, _, err := svc.providers.History.List(history.Filter{}, 1, "")
+	if err != nil || len(records) != 1 {
+		t.Fatalf("expected a single history record, got %v, %v", records, err)
+	}
+
+	record := records[0]
+	if !record.Archived || record.Unprocessed || !record.Original {
+		t.Fatalf("expected the submitted and the original document to be archived, got %+v", record)
+	}
+
+	if _, err := svc.reprint(context.Background(), user, record.ID, reprintRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(printers.last(), printed) {
+		t.Errorf("expected the submitted document to be reprinted as is")
+	}
+
+	if _, err := svc.reprint(context.Background(), user, record.ID, reprintRequest{Printer: "reception"}); err != nil {
+		t.Fatalf("expected the original document to be reprinted on another printer, got %v", err)
+	}
+
+	if info := pdf.Inspect(printers.last()); info.PageCount != 1 {
+		t.Errorf("expected the options to be applied to the original document, got %d pages", info.PageCount)
+	}
+}
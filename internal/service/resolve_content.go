@@ -42,13 +42,16 @@ func (svc *Service) resolveContent(document *v1.Document) (io.ReadCloser, int64,
 		return file, s.Size(), nil
 
 	case *v1.Document_Url:
-		dst, err := os.CreateTemp(svc.providers.Config.StoragePath, document.Name+"-*")
+		// the document name is not used for the file name since it may
+		// contain personal data
+		dst, err := os.CreateTemp(svc.providers.Config.StoragePath, "document-*")
 		if err != nil {
 			return nil, 0, fmt.Errorf("failed to create temporary file: %w", err)
 		}
 		dst.Close()
 
 		if err := getter.GetFile(v.Url, dst.Name()); err != nil {
+			os.Remove(dst.Name())
 			return nil, 0, fmt.Errorf("failed to download document content: %w", err)
 		}
 
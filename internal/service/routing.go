@@ -0,0 +1,264 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	v1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/printing/v1"
+	"github.com/tierklinik-dobersberg/apis/pkg/auth"
+	"github.com/tierklinik-dobersberg/print-service/internal/backend"
+	"github.com/tierklinik-dobersberg/print-service/internal/pdf"
+	"github.com/tierklinik-dobersberg/print-service/internal/preferences"
+	"github.com/tierklinik-dobersberg/print-service/internal/privacy"
+	"github.com/tierklinik-dobersberg/print-service/internal/routing"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Headers used by clients to identify the workstation and location a
+// request is sent from.
+const (
+	workstationHeader = "X-Workstation"
+	locationHeader    = "X-Location"
+)
+
+// clientInfo describes the client that sent a request.
+type clientInfo struct {
+	Workstation string
+	Location    string
+}
+
+type clientInfoKey struct{}
+
+// ClientInfoHandler stores the workstation and location headers of each
+// request in the request context so they are available for routing.
+func ClientInfoHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := clientInfo{
+			Workstation: r.Header.Get(workstationHeader),
+			Location:    r.Header.Get(locationHeader),
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientInfoKey{}, info)))
+	})
+}
+
+func clientInfoFrom(ctx context.Context) clientInfo {
+	info, _ := ctx.Value(clientInfoKey{}).(clientInfo)
+
+	return info
+}
+
+// parseRoutingOptions parses the default print options of all routing
+// rules.
+func parseRoutingOptions(rules []routing.Rule) (map[string]PrintOptions, error) {
+	result := make(map[string]PrintOptions, len(rules))
+
+	for _, rule := range rules {
+		opts, err := parseOptionMap(rule.Options)
+		if err != nil {
+			return nil, fmt.Errorf("routing rule %q: %w", rule.Name, err)
+		}
+
+		result[rule.Name] = opts
+	}
+
+	return result, nil
+}
+
+// documentInfo inspects PDF documents if routing rules or print policies
+// depend on the page count or media. The returned reader must be used
+// instead of content.
+func (svc *Service) documentInfo(document *v1.Document, mime string, content io.Reader) (io.Reader, *pdf.Info, error) {
+	router := svc.providers.Routing
+	routed := router.Applies(document.Printer) && router.NeedsInfo()
+
+	if (!routed && !svc.providers.Policies.NeedsInfo()) || mime != "application/pdf" {
+		return content, nil, nil
+	}
+
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read document: %w", err)
+	}
+
+	return bytes.NewReader(data), pdf.Inspect(data), nil
+}
+
+// routingRequest returns the attributes of a print request used for
+// routing. pending is set if the content of the document has not been
+// received yet.
+func routingRequest(ctx context.Context, user *auth.RemoteUser, document *v1.Document, info *pdf.Info, pending bool) routing.Request {
+	client := clientInfoFrom(ctx)
+
+	req := routing.Request{
+		ContentType: document.ContentType,
+		Name:        document.Name,
+		User:        user.Username,
+		Roles:       userRoles(user),
+		Workstation: client.Workstation,
+		Location:    client.Location,
+		Time:        time.Now(),
+
+		PagesPending: pending,
+	}
+
+	if info != nil {
+		req.HasInfo = true
+		req.PageCount = info.PageCount
+
+		for _, page := range info.Pages {
+			if page.Media != "" && !slices.Contains(req.Media, page.Media) {
+				req.Media = append(req.Media, page.Media)
+			}
+		}
+	}
+
+	return req
+}
+
+// resolveTarget returns the printer for document and the print options
+// including the defaults of the matching routing rule and the preferences
+// of the user and workstation. Documents that do not specify a printer or
+// use a logical target are routed. If no rule matches, the preferred
+// printer is used before falling back to the default printer of the
+// backends. If pending is set, the content of the document has not been
+// received yet and page and media conditions are ignored.
+func (svc *Service) resolveTarget(ctx context.Context, user *auth.RemoteUser, document *v1.Document, opts PrintOptions, info *pdf.Info, pending bool) (string, PrintOptions, *routing.Decision, error) {
+	router := svc.providers.Routing
+
+	prefs, prefOpts := svc.preferredDefaults(user, clientInfoFrom(ctx).Workstation)
+	opts = opts.withDocument(document)
+
+	if !router.Applies(document.Printer) {
+		return document.Printer, opts.withDefaults(prefOpts), nil, nil
+	}
+
+	decision, err := router.Route(document.Printer, routingRequest(ctx, user, document, info, pending))
+	if err != nil {
+		if errors.Is(err, routing.ErrNoRoute) {
+			return "", opts, &decision, connect.NewError(connect.CodeFailedPrecondition, err)
+		}
+
+		return "", opts, &decision, err
+	}
+
+	if decision.Rule == "" {
+		printer := prefs.Printer
+		if printer == "" {
+			printer, err = backend.ResolvePrinter(svc.providers.Printers, document.Printer)
+			if err != nil {
+				return "", opts, &decision, err
+			}
+		} else {
+			slog.Info("using preferred printer", "name", privacy.Name(document.Name), "printer", printer, "scope", prefs.PrinterSource.Scope, "key", prefs.PrinterSource.Key, "user", user.Username)
+		}
+
+		return printer, opts.withDefaults(prefOpts), &decision, nil
+	}
+
+	slog.Info("routed document", "name", privacy.Name(document.Name), "rule", decision.Rule, "printer", decision.Printer, "user", user.Username)
+
+	return decision.Printer, opts.withDefaults(svc.routingOptions[decision.Rule]).withDefaults(prefOpts), &decision, nil
+}
+
+// explainResponse is returned by HandleExplainRouting.
+type explainResponse struct {
+	// Routed is false if the requested printer is used as is.
+	Routed   bool              `json:"routed"`
+	Printer  string            `json:"printer,omitempty"`
+	Error    string            `json:"error,omitempty"`
+	Request  *routing.Request  `json:"request,omitempty"`
+	Decision *routing.Decision `json:"decision,omitempty"`
+	Rules    []routing.Rule    `json:"rules"`
+
+	// Preferences holds the preferences of the user and workstation.
+	Preferences preferences.Resolved `json:"preferences"`
+}
+
+// HandleExplainRouting reports how a document would be routed without
+// printing it. The request body is a JSON encoded tkd.printing.v1.Document
+// and print options are passed as X-Print- headers. The document content
+// is optional and only required for rules that match on the page count or
+// media.
+func (svc *Service) HandleExplainRouting(w http.ResponseWriter, r *http.Request) {
+	user, err := svc.UserFromHeader(r.Context(), r.Header)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	svc.LimitRequestBody(w, r)
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("failed to read request: %w", err)))
+		return
+	}
+
+	var document v1.Document
+	if err := protojson.Unmarshal(body, &document); err != nil {
+		writeError(w, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid request: %w", err)))
+		return
+	}
+
+	opts, err := ParsePrintOptionsFromHeader(r.Header)
+	if err != nil {
+		writeError(w, connect.NewError(connect.CodeInvalidArgument, err))
+		return
+	}
+
+	var info *pdf.Info
+	if document.Source != nil {
+		reader, size, err := svc.resolveContent(&document)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		defer reader.Close()
+
+		// url and file_path sources are not covered by the request body limit
+		limited, err := svc.limitDocument(reader, size)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		converted, _, mime, err := svc.convertDocument(r.Context(), &document, limited, size)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		if _, info, err = svc.documentInfo(&document, mime, converted); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+
+	res := explainResponse{
+		Routed: svc.providers.Routing.Applies(document.Printer),
+		Rules:  svc.providers.Routing.Rules(),
+	}
+
+	if res.Routed {
+		req := routingRequest(r.Context(), user, &document, info, false)
+		res.Request = &req
+	}
+
+	res.Preferences, _ = svc.preferredDefaults(user, clientInfoFrom(r.Context()).Workstation)
+
+	res.Printer, _, res.Decision, err = svc.resolveTarget(r.Context(), user, &document, opts, info, false)
+	if err != nil {
+		res.Error = errorMessage(err)
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/tierklinik-dobersberg/print-service/internal/acl"
+	"github.com/tierklinik-dobersberg/print-service/internal/routing"
+)
+
+// withRouting replaces the routing rules of svc.
+func withRouting(t *testing.T, svc *Service, rules ...routing.Rule) {
+	t.Helper()
+
+	engine, err := routing.New(routing.Config{Rules: rules})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svc.providers.Routing = engine
+	if svc.routingOptions, err = parseRoutingOptions(rules); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandleExplainRouting(t *testing.T) {
+	svc := newHTTPService(t, acl.Config{})
+	svc.providers.Storage = fstest.MapFS{
+		"report.pdf": {Data: testPDF(3)},
+		"letter.pdf": {Data: testPDF(1)},
+	}
+
+	withRouting(t, svc,
+		routing.Rule{Name: "long", Match: routing.Match{MinPages: 3}, Printer: "prescriptions"},
+		routing.Rule{Name: "labels", Match: routing.Match{Names: []string{"*.zpl"}}, Printer: "prescriptions"},
+		routing.Rule{Name: "default", Printer: "prescriptions"},
+	)
+
+	cases := []struct {
+		name   string
+		body   string
+		routed bool
+		rule   string
+	}{
+		{"page condition", `{"name": "report.pdf", "filePath": "report.pdf", "contentType": "application/pdf"}`, true, "long"},
+		{"page condition not met", `{"name": "letter.pdf", "filePath": "letter.pdf", "contentType": "application/pdf"}`, true, "default"},
+		{"unknown page count", `{"name": "report.pdf"}`, true, "default"},
+		{"name", `{"name": "shelf.zpl"}`, true, "labels"},
+		{"printer", `{"name": "shelf.zpl", "printer": "prescriptions"}`, false, ""},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/routing/explain", strings.NewReader(c.body))
+		req.Header.Set("X-Remote-User-ID", "u1")
+		req.Header.Set("X-Remote-User", "alice")
+
+		rec := httptest.NewRecorder()
+		svc.HandleExplainRouting(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: expected an explanation, got %d: %s", c.name, rec.Code, rec.Body)
+			continue
+		}
+
+		var res explainResponse
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+
+		var rule string
+		if res.Decision != nil {
+			rule = res.Decision.Rule
+		}
+
+		if res.Routed != c.routed || rule != c.rule || res.Printer != "prescriptions" || res.Error != "" {
+			t.Errorf("%s: expected rule %q (routed=%t), got %q (routed=%t, printer %q, error %q)", c.name, c.rule, c.routed, rule, res.Routed, res.Printer, res.Error)
+		}
+	}
+}
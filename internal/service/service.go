@@ -9,6 +9,7 @@ import (
 	"log/slog"
 	"net/http"
 	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/bufbuild/connect-go"
@@ -19,35 +20,110 @@ import (
 	v1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/printing/v1"
 	"github.com/tierklinik-dobersberg/apis/gen/go/tkd/printing/v1/printingv1connect"
 	"github.com/tierklinik-dobersberg/apis/pkg/auth"
+	"github.com/tierklinik-dobersberg/print-service/internal/audit"
+	"github.com/tierklinik-dobersberg/print-service/internal/backend"
 	"github.com/tierklinik-dobersberg/print-service/internal/config"
+	"github.com/tierklinik-dobersberg/print-service/internal/cups"
+	"github.com/tierklinik-dobersberg/print-service/internal/pdf"
+	"github.com/tierklinik-dobersberg/print-service/internal/privacy"
+	"github.com/tierklinik-dobersberg/print-service/internal/routing"
 )
 
 type Service struct {
 	printingv1connect.UnimplementedPrintServiceHandler
 
 	providers *config.Providers
+
+	// routingOptions holds the parsed default options of each routing rule.
+	routingOptions map[string]PrintOptions
+
+	// policyOptions holds the parsed options of each print policy.
+	policyOptions map[string]policyOptions
 }
 
-func New(providers *config.Providers) *Service {
+func New(providers *config.Providers) (*Service, error) {
+	routingOptions, err := parseRoutingOptions(providers.Routing.Rules())
+	if err != nil {
+		return nil, err
+	}
+
+	policyOptions, err := parsePolicyOptions(providers.Policies.Rules())
+	if err != nil {
+		return nil, err
+	}
+
 	svc := &Service{
-		providers: providers,
+		providers:      providers,
+		routingOptions: routingOptions,
+		policyOptions:  policyOptions,
+	}
+
+	return svc, nil
+}
+
+// Printers returns all printers that are available for printing.
+func (svc *Service) Printers() ([]cups.Printer, error) {
+	return svc.providers.Printers.ListPrinters()
+}
+
+// checkPrinter returns a NotFound error if printer does not exist and an
+// Unavailable error if the printer backend cannot be asked.
+func (svc *Service) checkPrinter(printer string) error {
+	err := svc.providers.Printers.CheckPrinter(printer)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, backend.ErrUnknownPrinter):
+		return connect.NewError(connect.CodeNotFound, err)
+	default:
+		return connect.NewError(connect.CodeUnavailable, err)
 	}
+}
 
-	return svc
+// Jobs returns all jobs that are known for printer.
+func (svc *Service) Jobs(printer string) ([]cups.Job, error) {
+	return svc.providers.Printers.ListJobs(printer)
+}
+
+// UserJobs returns the jobs of printer if user may list them. Job names are
+// resolved like for ListJobs so opaque names are only replaced for the
+// owner of a job and administrators.
+func (svc *Service) UserJobs(ctx context.Context, user *auth.RemoteUser, printer string) ([]cups.Job, error) {
+	if err := svc.checkPrinterAccess(ctx, user, printer, actionListJobs, ""); err != nil {
+		return nil, err
+	}
+
+	jobs, err := svc.providers.Printers.ListJobs(printer)
+	if err != nil {
+		return nil, err
+	}
+
+	for idx := range jobs {
+		jobs[idx].Name = svc.jobName(user, jobs[idx])
+	}
+
+	return jobs, nil
 }
 
 func (svc *Service) ListPrinters(ctx context.Context, req *connect.Request[v1.ListPrintersRequest]) (*connect.Response[v1.ListPrintersResponse], error) {
-	printers, err := svc.providers.CUPS.ListPrinters()
+	printers, err := svc.providers.Printers.ListPrinters()
 	if err != nil {
 		return nil, err
 	}
 
+	// users only see the printers they are allowed to use
+	user := auth.From(ctx)
+
 	res := &v1.ListPrintersResponse{
-		Printers: make([]*v1.Printer, len(printers)),
+		Printers: make([]*v1.Printer, 0, len(printers)),
 	}
 
-	for idx, p := range printers {
-		res.Printers[idx] = p.ToProto()
+	for _, p := range printers {
+		if svc.canUsePrinter(user, p.Name) != nil {
+			continue
+		}
+
+		res.Printers = append(res.Printers, p.ToProto())
 	}
 
 	return connect.NewResponse(res), nil
@@ -65,125 +141,498 @@ func (svc *Service) PrintDocument(ctx context.Context, req *connect.Request[v1.D
 		return nil, err
 	}
 
-	var closer io.Closer = reader
-	var content io.Reader = reader
+	// close the document source
+	defer func() {
+		if err := reader.Close(); err != nil {
+			slog.Error("failed to close document source", "name", privacy.Name(req.Msg.Name), "error", err)
+		}
+	}()
+
+	opts, err := ParsePrintOptionsFromHeader(req.Header())
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	operation, err := svc.printDocument(ctx, user, req.Msg, opts, reader, size, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(operation), nil
+}
+
+func (svc *Service) PrintDocumentStream(ctx context.Context, stream *connect.ClientStream[v1.PrintDocumentRequest]) (*connect.Response[longrunningv1.Operation], error) {
+	user, err := svc.UserFromHeader(ctx, stream.RequestHeader())
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := ParsePrintOptionsFromHeader(stream.RequestHeader())
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	// the first message must contain the document metadata
+	if !stream.Receive() {
+		if err := stream.Err(); err != nil {
+			return nil, err
+		}
+
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("missing document header"))
+	}
+
+	doc := stream.Msg().GetDocument()
+	switch {
+	case doc == nil:
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("the first message must contain the document header"))
+	case doc.Name == "":
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("missing document name"))
+	case doc.Source != nil:
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("document source must not be set when streaming content"))
+	}
+
+	spool, err := newSpoolFile(svc.providers.Config.StoragePath, doc.Name, svc.providers.Config.MaxDocumentSize)
+	if err != nil {
+		return nil, err
+	}
+
+	for stream.Receive() {
+		if stream.Msg().GetDocument() != nil {
+			spool.Discard()
+			return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("unexpected document header"))
+		}
+
+		if _, err := spool.Write(stream.Msg().GetData()); err != nil {
+			spool.Discard()
+			return nil, fmt.Errorf("failed to write to spool file: %w", err)
+		}
+	}
+
+	if err := stream.Err(); err != nil {
+		spool.Discard()
+		return nil, err
+	}
+
+	if spool.Size() == 0 {
+		spool.Discard()
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("empty document content"))
+	}
+
+	if doc.ContentType == "" {
+		doc.ContentType = spool.ContentType()
+		slog.Info("auto detected content type for document", "name", privacy.Name(doc.Name), "content-type", doc.ContentType)
+	}
+
+	slog.Info("received streamed document", "name", privacy.Name(doc.Name), "size", spool.Size(), "sha256", spool.Sum())
+
+	file, err := spool.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			slog.Error("failed to close spool file", "name", privacy.Name(doc.Name), "error", err)
+		}
+	}()
+
+	operation, err := svc.printDocument(ctx, user, doc, opts, file, spool.Size(), map[string]string{
+		"sha256": spool.Sum(),
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(operation), nil
+}
+
+// PrintContent prints content using the normal print pipeline. It's used
+// by subsystems that receive documents outside of the connect API. If done
+// is not nil, it is called with the job once it reached its final state.
+// The returned operation reports the submitted job.
+func (svc *Service) PrintContent(ctx context.Context, user *auth.RemoteUser, document *v1.Document, opts PrintOptions, content io.Reader, size int64, done func(cups.Job)) (*backend.Operation, error) {
+	return svc.startPrint(ctx, user, document, opts, content, size, nil, done)
+}
+
+// printDocument detects the content type of content if required, converts
+// it to PDF if necessary and finally submits it to the printer. done is
+// optional and called with the final state of the job.
+func (svc *Service) printDocument(ctx context.Context, user *auth.RemoteUser, document *v1.Document, opts PrintOptions, content io.Reader, size int64, annotations map[string]string, done func(cups.Job)) (*longrunningv1.Operation, error) {
+	op, err := svc.startPrint(ctx, user, document, opts, content, size, annotations, done)
+	if err != nil {
+		return nil, err
+	}
+
+	return op.Proto(), nil
+}
+
+// startPrint implements printDocument and returns the operation of the
+// submitted job.
+func (svc *Service) startPrint(ctx context.Context, user *auth.RemoteUser, document *v1.Document, opts PrintOptions, content io.Reader, size int64, annotations map[string]string, done func(cups.Job)) (*backend.Operation, error) {
+	content, err := svc.limitDocument(content, size)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, size, convertedMime, err := svc.convertDocument(ctx, document, content, size)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, info, err := svc.documentInfo(document, convertedMime, wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	printer, opts, decision, err := svc.resolveTarget(ctx, user, document, opts, info, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := svc.checkPrinterAccess(ctx, user, printer, actionPrint, document.Name); err != nil {
+		return nil, err
+	}
+
+	opts, err = svc.applyPolicies(ctx, user, document, printer, opts, info, actionPrint)
+	if err != nil {
+		return nil, err
+	}
+
+	stages, err := svc.stagesFor(document, printer, convertedMime, opts)
+	if err != nil {
+		return nil, err
+	}
 
-	mime := req.Msg.ContentType
+	op, err := backend.StartOperation(ctx, svc.providers.LongRunning, document.Name, user.Username, annotations)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &printJob{
+		User:        user.Username,
+		Document:    document.Name,
+		Printer:     printer,
+		OperationID: op.ID(),
+		Options:     opts,
+	}
+
+	sub := submission{
+		user:     user,
+		document: document,
+		printer:  printer,
+		opts:     opts,
+		decision: decision,
+		mime:     convertedMime,
+		content:  wrapped,
+		size:     size,
+		action:   actionPrint,
+		done:     done,
+	}
+
+	if convertedMime == "application/pdf" {
+		// the document before post-processing is archived as well so it
+		// can be reprinted on other printers.
+		original, err := io.ReadAll(wrapped)
+		if err != nil {
+			err = fmt.Errorf("failed to read document: %w", err)
+			op.Fail(err)
+
+			return nil, err
+		}
+
+		content, err := finishPDF(bytes.NewReader(original), stages, job)
+		if err != nil {
+			op.Fail(err)
+
+			return nil, err
+		}
+
+		if err := op.Annotate(ctx, documentAnnotations(job.Info)); err != nil {
+			slog.Error("failed to annotate operation with document info", "operation-id", op.ID(), "error", err)
+		}
+
+		slog.Info("inspected document", "name", privacy.Name(document.Name), "operation-id", op.ID(), "pages", job.Info.PageCount, "media", job.Info.Media(), "color", job.Info.Color)
+
+		sub.content = bytes.NewReader(content)
+		sub.size = int64(len(content))
+		sub.info = job.Info
+		sub.final = content
+		sub.original = original
+	}
+
+	if err := svc.submit(ctx, op, sub); err != nil {
+		return nil, err
+	}
+
+	return op, nil
+}
+
+// submission holds a prepared document that is ready to be sent to the
+// printer.
+type submission struct {
+	user     *auth.RemoteUser
+	document *v1.Document
+	printer  string
+	opts     PrintOptions
+	decision *routing.Decision
+
+	// mime is the content type of the submitted document.
+	mime    string
+	content io.Reader
+	size    int64
+	info    *pdf.Info
+
+	// final holds the submitted PDF document, if any, which is archived
+	// for reprints. original holds the document before post-processing and
+	// is archived as well if it differs from final, see archiveDocument.
+	final    []byte
+	original []byte
+
+	// reprintOf is the history record ID of the reprinted job.
+	reprintOf string
+
+	// action is reported in the audit trail if the job is denied.
+	action string
+
+	// done is called with the final state of the job, if set.
+	done func(cups.Job)
+}
+
+// submit checks the quotas of the user and submits the document using op.
+// The usage and the job states are recorded in the accounting ledger and
+// the job history.
+func (svc *Service) submit(ctx context.Context, op *backend.Operation, sub submission) error {
+	usage := usageRecord(sub.user, sub.document, sub.printer, sub.opts, sub.info)
+	usage.OperationID = op.ID()
+
+	if err := svc.reserveQuota(ctx, usage, sub.action); err != nil {
+		op.Fail(err)
+
+		return err
+	}
+
+	svc.trackUsage(op, usage)
+
+	record := historyRecord(sub.user, sub.document, sub.printer, sub.opts, sub.decision, sub.mime, sub.size, sub.info)
+	record.ReprintOf = sub.reprintOf
+
+	historyID := svc.trackHistory(op, record)
+
+	// the hash of the submitted document is recorded in the job history
+	hashed := newHashingReader(sub.content)
+
+	doc := ipp.Document{
+		Document: hashed,
+		Size:     int(sub.size),
+		Name:     sub.document.Name,
+		MimeType: sub.mime,
+	}
+
+	// printers only see the operation ID, the real name is kept in the
+	// job history
+	if svc.providers.Config.OpaqueJobNames {
+		doc.Name = op.ID()
+	}
+
+	/*
+		orientation := cups.OrientationPortrait
+		if req.Msg.Orientation == v1.Orientation_ORIENTATION_LANDSCAPE {
+			orientation = cups.OrientationLandscape
+		}
+	*/
+
+	attrs := map[string]any{
+		ipp.AttributeRequestingUserName: sub.user.Username,
+		// ipp.AttributeOrientationRequested: string(orientation),
+	}
+	sub.opts.jobAttributes(attrs)
+
+	// events of the job are recorded after the submission itself
+	event := submissionEvent(op, sub, historyID)
+	recorded := make(chan struct{})
+	svc.trackJobEvents(op, event, recorded)
+
+	if sub.done != nil {
+		op.OnComplete(sub.done)
+	}
+
+	err := op.Submit(svc.providers.Printers, doc, sub.printer, attrs)
+	svc.finishSubmission(historyID, hashed.Sum(), err)
+
+	if err != nil {
+		svc.providers.Accounting.Release(op.ID())
+
+		event.Action = audit.ActionSubmitFailed
+		event.Reason = err.Error()
+		svc.providers.Audit.Record(ctx, event)
+		close(recorded)
+
+		return err
+	}
+
+	if _, jobID := op.Job(); jobID != 0 {
+		event.Details["jobId"] = strconv.Itoa(jobID)
+	}
+
+	event.DocumentHash = hashed.Sum()
+	svc.providers.Audit.Record(ctx, event)
+	close(recorded)
+
+	svc.archiveDocument(historyID, sub.final, sub.original)
+
+	return nil
+}
+
+// convertDocument detects the content type of content if required and
+// converts it to PDF if necessary. It returns the content to print, its size
+// and content type.
+func (svc *Service) convertDocument(ctx context.Context, document *v1.Document, content io.Reader, size int64) (io.Reader, int64, string, error) {
+	mime := document.ContentType
 
 	// finally, if there's no content-type, try to autodetect it
-	if req.Msg.ContentType == "" {
+	if mime == "" {
 		// try to read the first bytes
-		buf := make([]byte, 512)
-		read, err := io.ReadFull(reader, buf)
+		buf := make([]byte, sniffLength)
+		read, err := io.ReadFull(content, buf)
 
 		switch {
 		case err == nil:
 		case errors.Is(err, io.ErrUnexpectedEOF):
 			buf = buf[:read]
 		case errors.Is(err, io.EOF):
-			return nil, fmt.Errorf("empty document content")
+			return nil, 0, "", fmt.Errorf("empty document content")
 		default:
-			return nil, fmt.Errorf("failed to read document content: %w", err)
+			return nil, 0, "", fmt.Errorf("failed to read document content: %w", err)
 		}
 
 		mime = http.DetectContentType(buf)
-		slog.Info("auto detected content type for document", "name", req.Msg.Name, "content-type", mime)
+		slog.Info("auto detected content type for document", "name", privacy.Name(document.Name), "content-type", mime)
+
+		document.ContentType = mime
 
 		content = io.MultiReader(
 			bytes.NewReader(buf),
-			reader,
+			content,
 		)
 	}
 
-	// close the document source
-	defer func() {
-		if err := closer.Close(); err != nil {
-			slog.Error("failed to close document source", "name", req.Msg.Name, "error", err)
-		}
-	}()
-
 	// check if we need to convert the given mime-type to PDF:
 	// TODO(ppacher): this could actually be part of the long-running-operation.
-	wrapped, mime, err := svc.mayConvertToPDF(ctx, req.Msg.Name, mime, content, req.Msg.Orientation)
+	wrapped, convertedMime, err := svc.mayConvertToPDF(ctx, document.Name, mime, content, document.Orientation)
 	if err != nil {
-		return nil, err
+		return nil, 0, "", err
 	}
 
-	// if the returned wrapped reader is also a closer, defer closing
-	if c, ok := wrapped.(io.Closer); ok && wrapped != content {
-		if err := c.Close(); err != nil {
-			slog.Error("failed to close wrapped content source", "name", req.Msg.Name, "error", err)
-		}
+	if wrapped == content {
+		return content, size, mime, nil
 	}
 
-	doc := ipp.Document{
-		Document: wrapped,
-		Size:     int(size),
-		Name:     req.Msg.Name,
-		MimeType: mime,
+	// if the returned wrapped reader is also a closer, close it after the
+	// converted document has been read.
+	if c, ok := wrapped.(io.Closer); ok {
+		defer func() {
+			if err := c.Close(); err != nil {
+				slog.Error("failed to close wrapped content source", "name", privacy.Name(document.Name), "error", err)
+			}
+		}()
 	}
 
-	/*
-		orientation := cups.OrientationPortrait
-		if req.Msg.Orientation == v1.Orientation_ORIENTATION_LANDSCAPE {
-			orientation = cups.OrientationLandscape
-		}
+	limited, err := svc.limitDocument(wrapped, 0)
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	// the IPP request requires the exact content length so converted
+	// documents need to be buffered.
+	converted, err := io.ReadAll(limited)
+	if err != nil {
+		return nil, 0, "", fmt.Errorf("failed to read converted document: %w", err)
+	}
+
+	return bytes.NewReader(converted), int64(len(converted)), convertedMime, nil
+}
 
-		color := cups.ColorModeAuto
-		switch req.Msg.ColorMode {
-		case v1.ColorMode_COLORMODE_AUTO:
-			color = cups.ColorModeAuto
-		case v1.ColorMode_COLORMODE_COLOR:
-			color = cups.ColorModeColor
-		case v1.ColorMode_COLORMODE_GRAYSCALE:
-			color = cups.ColorModeGrayScale
+// stagesFor returns the post-processing stages for a document with the
+// given content type. Stages configured for printer are skipped for non-PDF
+// documents while requested stages cause an error.
+func (svc *Service) stagesFor(document *v1.Document, printer string, mime string, opts PrintOptions) ([]pdfStage, error) {
+	stages, requested, err := svc.pdfStages(printer, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(stages) > 0 && mime != "application/pdf" {
+		if requested {
+			return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("post-processing is only supported for PDF documents, got %q", mime))
 		}
-	*/
 
-	operation, err := svc.providers.CUPS.PrintWithOperation(
-		ctx,
-		svc.providers.LongRunning,
-		doc,
-		req.Msg.Printer,
-		map[string]any{
-			ipp.AttributeRequestingUserName: user.Username,
-			// ipp.AttributeOrientationRequested: string(orientation),
-			// cups.AttributePrintColorMode:      string(color),
-		},
-	)
+		slog.Warn("skipping post-processing of non-PDF document", "name", privacy.Name(document.Name), "printer", printer, "content-type", mime)
+		stages = nil
+	}
+
+	return stages, nil
+}
+
+// finishPDF applies all stages to the PDF document and inspects the result.
+// The document info is stored in job.
+func finishPDF(content io.Reader, stages []pdfStage, job *printJob) ([]byte, error) {
+	// post-processing and inspection require the complete document
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read document: %w", err)
+	}
+
+	data, err = applyPDFStages(data, stages, job)
 	if err != nil {
 		return nil, err
 	}
 
-	return connect.NewResponse(operation), nil
+	job.Info = pdf.Inspect(data)
+
+	return data, nil
 }
 
 func (svc *Service) ListJobs(ctx context.Context, req *connect.Request[v1.ListJobsRequest]) (*connect.Response[v1.ListJobsResponse], error) {
+	user := auth.From(ctx)
+
 	var printers []string
 
 	if len(req.Msg.Printers) == 0 {
-		all, err := svc.providers.CUPS.ListPrinters()
+		all, err := svc.providers.Printers.ListPrinters()
 		if err != nil {
 			return nil, fmt.Errorf("failed to get printers: %w", err)
 		}
 
 		for _, p := range all {
+			// jobs of pools are already listed for their members
+			if svc.providers.Printers.IsPool(p.Name) || svc.canUsePrinter(user, p.Name) != nil {
+				continue
+			}
+
 			printers = append(printers, p.Name)
 		}
 	} else {
+		for _, p := range req.Msg.Printers {
+			if err := svc.checkPrinterAccess(ctx, user, p, actionListJobs, ""); err != nil {
+				return nil, err
+			}
+		}
+
 		printers = req.Msg.Printers
 	}
 
 	var jobs []*v1.Job
 
 	for _, p := range printers {
-		pj, err := svc.providers.CUPS.ListJobs(p)
+		pj, err := svc.providers.Printers.ListJobs(p)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get jobs for printer %q: %w", p, err)
 		}
 
 		for _, j := range pj {
-			jobs = append(jobs, j.ToProto())
+			pb := j.ToProto()
+			pb.Name = svc.jobName(user, j)
+
+			jobs = append(jobs, pb)
 		}
 	}
 
@@ -205,21 +654,31 @@ func isOfficeRequest(name string) bool {
 }
 
 func (svc *Service) mayConvertToPDF(ctx context.Context, name, mime string, reader io.Reader, orientation v1.Orientation) (io.Reader, string, error) {
+	if !needsConversion(name, mime) {
+		return reader, mime, nil
+	}
+
+	if mime == "text/html" {
+		return svc.renderHTML(ctx, name, reader, orientation)
+	}
+
+	return svc.renderOffice(ctx, name, reader, orientation)
+}
+
+// needsConversion reports whether a document must be converted to PDF using
+// Gotenberg before it can be printed.
+func needsConversion(name, mime string) bool {
 	// Skip PDF, postscript, octet-stream,  plain text and image documents
 	switch mime {
 	case "application/pdf", "application/postscript", "text/plain":
-		return reader, mime, nil
+		return false
 
 		// this might be an office request
 	case "text/html":
-		return svc.renderHTML(ctx, name, reader, orientation)
+		return true
 
 	default:
-		if isOfficeRequest(name) {
-			return svc.renderOffice(ctx, name, reader, orientation)
-		}
-
-		return reader, mime, nil
+		return isOfficeRequest(name)
 	}
 }
 
@@ -229,7 +688,16 @@ func (svc *Service) renderHTML(ctx context.Context, name string, reader io.Reade
 		return nil, "", err
 	}
 
-	req := gotenberg.NewHTMLRequest(indexDoc)
+	content, err := svc.sendHTMLRequest(ctx, newHTMLRequest(indexDoc, orientation))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return io.NopCloser(bytes.NewReader(content)), "application/pdf", nil
+}
+
+func newHTMLRequest(index document.Document, orientation v1.Orientation) *gotenberg.HTMLRequest {
+	req := gotenberg.NewHTMLRequest(index)
 	req.WaitDelay(time.Second * 3)
 	req.SkipNetworkIdleEvent()
 
@@ -246,18 +714,37 @@ func (svc *Service) renderHTML(ctx context.Context, name string, reader io.Reade
 		// nothing to do, portrait is default
 	}
 
+	return req
+}
+
+func (svc *Service) sendHTMLRequest(ctx context.Context, req *gotenberg.HTMLRequest) ([]byte, error) {
+	if svc.providers.Gotenberg == nil {
+		return nil, connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("HTML conversion is not configured"))
+	}
+
 	res, err := svc.providers.Gotenberg.Send(ctx, req)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
+	defer res.Body.Close()
 
-	content, err := io.ReadAll(res.Body)
+	body, err := svc.limitDocument(res.Body, res.ContentLength)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
+
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to convert HTML document: %s: %s", res.Status, bytes.TrimSpace(content))
+	}
+
 	slog.Info("successfully converted HTML document to PDF", "size", len(content))
 
-	return io.NopCloser(bytes.NewReader(content)), "application/pdf", nil
+	return content, nil
 }
 
 func (svc *Service) renderOffice(ctx context.Context, name string, reader io.Reader, orientation v1.Orientation) (io.Reader, string, error) {
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"log/slog"
+	"net/http"
+	"os"
+)
+
+// sniffLength is the number of bytes used by http.DetectContentType.
+const sniffLength = 512
+
+// spoolFile writes streamed document content to a temporary file while
+// calculating the SHA256 checksum and keeping the first bytes for content
+// type detection.
+type spoolFile struct {
+	file *os.File
+	hash hash.Hash
+	size int64
+	head []byte
+
+	// max is the maximum size of the spooled content. Zero disables the
+	// limit.
+	max int64
+}
+
+func newSpoolFile(dir string, name string, max int64) (*spoolFile, error) {
+	f, err := os.CreateTemp(dir, "spool-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool file for %q: %w", name, err)
+	}
+
+	return &spoolFile{
+		file: f,
+		hash: sha256.New(),
+		head: make([]byte, 0, sniffLength),
+		max:  max,
+	}, nil
+}
+
+func (s *spoolFile) Write(p []byte) (int, error) {
+	if s.max > 0 && s.size+int64(len(p)) > s.max {
+		return 0, errDocumentTooLarge(s.max)
+	}
+
+	if missing := sniffLength - len(s.head); missing > 0 {
+		s.head = append(s.head, p[:min(missing, len(p))]...)
+	}
+
+	n, err := s.file.Write(p)
+	s.hash.Write(p[:n])
+	s.size += int64(n)
+
+	return n, err
+}
+
+// Size returns the number of bytes written to the spool file.
+func (s *spoolFile) Size() int64 {
+	return s.size
+}
+
+// Sum returns the hex encoded SHA256 checksum of the spooled content.
+func (s *spoolFile) Sum() string {
+	return hex.EncodeToString(s.hash.Sum(nil))
+}
+
+// ContentType returns the content type detected from the first bytes of the
+// spooled content.
+func (s *spoolFile) ContentType() string {
+	return http.DetectContentType(s.head)
+}
+
+// Open closes the spool file for writing and re-opens it for reading. The
+// returned file is removed from disk once it is closed.
+func (s *spoolFile) Open() (*selfDeletingFile, error) {
+	if err := s.file.Close(); err != nil {
+		s.Discard()
+		return nil, fmt.Errorf("failed to close spool file: %w", err)
+	}
+
+	f, err := newSelfDeletingFile(s.file.Name())
+	if err != nil {
+		s.Discard()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Discard closes and removes the spool file.
+func (s *spoolFile) Discard() {
+	s.file.Close()
+
+	if err := os.Remove(s.file.Name()); err != nil && !os.IsNotExist(err) {
+		slog.Error("failed to delete spool file", "path", s.file.Name(), "error", err)
+	}
+}
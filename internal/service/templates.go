@@ -0,0 +1,202 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/dcaraxes/gotenberg-go-client/v8/document"
+	v1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/printing/v1"
+	"github.com/tierklinik-dobersberg/print-service/internal/templates"
+)
+
+type templateRequest struct {
+	Template string            `json:"template"`
+	Data     any               `json:"data"`
+	Name     string            `json:"name"`
+	Printer  string            `json:"printer"`
+	Options  map[string]string `json:"options"`
+}
+
+// HandlePrintTemplate renders a HTML document template using the request
+// payload, converts it to PDF and prints the result.
+func (svc *Service) HandlePrintTemplate(w http.ResponseWriter, r *http.Request) {
+	user, err := svc.UserFromHeader(r.Context(), r.Header)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	req, opts, err := svc.decodeTemplateRequest(w, r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	pdf, err := svc.renderTemplate(r.Context(), req, opts)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	name := req.Name
+	if name == "" {
+		name = req.Template + ".pdf"
+	}
+
+	doc := &v1.Document{
+		Name:        name,
+		ContentType: "application/pdf",
+		Orientation: opts.Orientation,
+		Printer:     req.Printer,
+	}
+
+	operation, err := svc.printDocument(r.Context(), user, doc, opts, bytes.NewReader(pdf), int64(len(pdf)), map[string]string{
+		"documentTemplate": req.Template,
+	}, nil)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, operationResponse{
+		OperationID: operation.UniqueId,
+	})
+}
+
+// HandleRenderTemplate renders a HTML document template and returns the
+// resulting PDF without printing it.
+func (svc *Service) HandleRenderTemplate(w http.ResponseWriter, r *http.Request) {
+	if _, err := svc.UserFromHeader(r.Context(), r.Header); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	req, opts, err := svc.decodeTemplateRequest(w, r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	pdf, err := svc.renderTemplate(r.Context(), req, opts)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	if _, err := w.Write(pdf); err != nil {
+		slog.Error("failed to write rendered template", "error", err)
+	}
+}
+
+// HandleListTemplates returns all document templates together with their
+// payload schema.
+func (svc *Service) HandleListTemplates(w http.ResponseWriter, r *http.Request) {
+	if _, err := svc.UserFromHeader(r.Context(), r.Header); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	list := []*templates.Template{}
+	if svc.providers.Templates != nil {
+		list = svc.providers.Templates.List()
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"templates": list,
+	})
+}
+
+func (svc *Service) decodeTemplateRequest(w http.ResponseWriter, r *http.Request) (*templateRequest, PrintOptions, error) {
+	svc.LimitRequestBody(w, r)
+
+	var req templateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, PrintOptions{}, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid request body: %w", err))
+	}
+
+	if req.Template == "" {
+		return nil, PrintOptions{}, connect.NewError(connect.CodeInvalidArgument, errors.New("missing template name"))
+	}
+
+	values := make(url.Values, len(req.Options))
+	for key, value := range req.Options {
+		values.Set(key, value)
+	}
+
+	opts, err := ParsePrintOptions(values)
+	if err != nil {
+		return nil, PrintOptions{}, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	return &req, opts, nil
+}
+
+func (svc *Service) renderTemplate(ctx context.Context, req *templateRequest, opts PrintOptions) ([]byte, error) {
+	if svc.providers.Templates == nil {
+		return nil, connect.NewError(connect.CodeFailedPrecondition, errors.New("document templates are not configured"))
+	}
+
+	tmpl, ok := svc.providers.Templates.Get(req.Template)
+	if !ok {
+		return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("template %q not found", req.Template))
+	}
+
+	rendered, err := tmpl.Execute(req.Data)
+	if err != nil {
+		var verr *templates.ValidationError
+		if errors.As(err, &verr) {
+			return nil, connect.NewError(connect.CodeInvalidArgument, err)
+		}
+
+		return nil, err
+	}
+
+	index, err := document.FromBytes("index.html", rendered.Index)
+	if err != nil {
+		return nil, err
+	}
+
+	gotenbergReq := newHTMLRequest(index, opts.Orientation)
+
+	// let templates define the paper size using @page rules
+	gotenbergReq.PreferCSSPageSize()
+
+	if rendered.Header != nil {
+		header, err := document.FromBytes("header.html", rendered.Header)
+		if err != nil {
+			return nil, err
+		}
+
+		gotenbergReq.Header(header)
+	}
+
+	if rendered.Footer != nil {
+		footer, err := document.FromBytes("footer.html", rendered.Footer)
+		if err != nil {
+			return nil, err
+		}
+
+		gotenbergReq.Footer(footer)
+	}
+
+	assets := make([]document.Document, 0, len(rendered.Assets))
+	for _, a := range rendered.Assets {
+		doc, err := document.FromPath(a.Name, a.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load template asset %q: %w", a.Name, err)
+		}
+
+		assets = append(assets, doc)
+	}
+	gotenbergReq.Assets(assets...)
+
+	return svc.sendHTMLRequest(ctx, gotenbergReq)
+}
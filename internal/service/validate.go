@@ -0,0 +1,452 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/phin1x/go-ipp"
+	v1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/printing/v1"
+	"github.com/tierklinik-dobersberg/apis/pkg/auth"
+	"github.com/tierklinik-dobersberg/print-service/internal/backend"
+	"github.com/tierklinik-dobersberg/print-service/internal/pdf"
+	"github.com/tierklinik-dobersberg/print-service/internal/routing"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Severity of a problem found while validating a print request.
+type Severity string
+
+const (
+	// SeverityError means the document would not be printed.
+	SeverityError = Severity("error")
+
+	// SeverityWarning means the document would be printed but the result
+	// might not be what the user expects.
+	SeverityWarning = Severity("warning")
+)
+
+// Checks performed by ValidatePrint.
+const (
+	CheckContent        = "content"
+	CheckOptions        = "options"
+	CheckConversion     = "conversion"
+	CheckPrinter        = "printer"
+	CheckPolicy         = "policy"
+	CheckQuota          = "quota"
+	CheckPostProcessing = "post-processing"
+	CheckDocument       = "document"
+	CheckCapabilities   = "capabilities"
+)
+
+// Problem is a single finding of ValidatePrint.
+type Problem struct {
+	Severity Severity `json:"severity"`
+	Check    string   `json:"check"`
+	Message  string   `json:"message"`
+}
+
+// ValidationReport is the result of a print dry-run.
+type ValidationReport struct {
+	// Valid is set if no errors have been found.
+	Valid bool `json:"valid"`
+
+	Document             string    `json:"document"`
+	Printer              string    `json:"printer,omitempty"`
+	ContentType          string    `json:"contentType,omitempty"`
+	ConvertedContentType string    `json:"convertedContentType,omitempty"`
+	Info                 *pdf.Info `json:"info,omitempty"`
+	Problems             []Problem `json:"problems"`
+
+	// Routing is set if the printer has been selected by routing rules.
+	Routing *routing.Decision `json:"routing,omitempty"`
+
+	// Policies holds the names of the print policies that apply.
+	Policies []string `json:"policies,omitempty"`
+}
+
+func (r *ValidationReport) errorf(check string, format string, args ...any) {
+	r.Problems = append(r.Problems, Problem{
+		Severity: SeverityError,
+		Check:    check,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (r *ValidationReport) warnf(check string, format string, args ...any) {
+	r.Problems = append(r.Problems, Problem{
+		Severity: SeverityWarning,
+		Check:    check,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (r *ValidationReport) hasErrors() bool {
+	for _, p := range r.Problems {
+		if p.Severity == SeverityError {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HandleValidatePrint performs all checks of a print request without
+// printing anything. The request body is a JSON encoded tkd.printing.v1.Document,
+// the same message accepted by PrintDocument, and print options are passed
+// as X-Print- headers. Large documents may be uploaded as the "file" part
+// of a multipart/form-data request with the optional fields name,
+// content-type and printer instead.
+func (svc *Service) HandleValidatePrint(w http.ResponseWriter, r *http.Request) {
+	user, err := svc.UserFromHeader(r.Context(), r.Header)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	svc.LimitRequestBody(w, r)
+
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		svc.validateUpload(w, r, user)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("failed to read request: %w", err)))
+		return
+	}
+
+	var document v1.Document
+	if err := protojson.Unmarshal(body, &document); err != nil {
+		writeError(w, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid request: %w", err)))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, svc.validatePrint(r.Context(), user, &document, nil, r.Header))
+}
+
+// validateUpload validates a document uploaded using a multipart/form-data
+// request.
+func (svc *Service) validateUpload(w http.ResponseWriter, r *http.Request, user *auth.RemoteUser) {
+	if err := r.ParseMultipartForm(maxMemory); err != nil {
+		writeError(w, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid multipart form: %w", err)))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, fh, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("missing file: %w", err)))
+		return
+	}
+	defer file.Close()
+
+	document := &v1.Document{
+		Name:        fh.Filename,
+		ContentType: r.FormValue("content-type"),
+		Printer:     r.FormValue("printer"),
+	}
+
+	if name := r.FormValue("name"); name != "" {
+		document.Name = name
+	}
+
+	writeJSON(w, http.StatusOK, svc.validatePrint(r.Context(), user, document, file, r.Header))
+}
+
+// validatePrint runs content resolution, type detection, conversion and
+// post-processing checks as well as the printer capability check for
+// document. If source is nil, the content is resolved from the document.
+func (svc *Service) validatePrint(ctx context.Context, user *auth.RemoteUser, document *v1.Document, source io.Reader, header http.Header) *ValidationReport {
+	report := &ValidationReport{
+		Document: document.Name,
+		Problems: []Problem{},
+	}
+
+	defer func() {
+		report.Valid = !report.hasErrors()
+	}()
+
+	opts, err := ParsePrintOptionsFromHeader(header)
+	if err != nil {
+		report.errorf(CheckOptions, "%s", err)
+	}
+
+	if source == nil {
+		reader, _, err := svc.resolveContent(document)
+		if err != nil {
+			report.errorf(CheckContent, "failed to resolve document content: %s", err)
+			return report
+		}
+		defer reader.Close()
+
+		source = reader
+	}
+
+	limited, err := svc.limitDocument(source, 0)
+	if err != nil {
+		report.errorf(CheckContent, "%s", errorMessage(err))
+		return report
+	}
+
+	content, err := io.ReadAll(limited)
+	switch {
+	case err != nil:
+		report.errorf(CheckContent, "failed to read document content: %s", err)
+		return report
+	case len(content) == 0:
+		report.errorf(CheckContent, "empty document content")
+		return report
+	}
+
+	report.ContentType = document.ContentType
+	if report.ContentType == "" {
+		report.ContentType = http.DetectContentType(content)
+	}
+
+	report.ConvertedContentType = report.ContentType
+	if needsConversion(document.Name, report.ContentType) {
+		report.ConvertedContentType = "application/pdf"
+
+		if svc.providers.Gotenberg == nil {
+			report.errorf(CheckConversion, "conversion of %q documents is not configured", report.ContentType)
+		} else {
+			// the converted document is checked like a submitted PDF
+			document.ContentType = report.ContentType
+
+			converted, _, convertedMime, err := svc.convertDocument(ctx, document, bytes.NewReader(content), int64(len(content)))
+			if err != nil {
+				report.errorf(CheckConversion, "failed to convert the document: %s", errorMessage(err))
+				return report
+			}
+
+			content, err = io.ReadAll(converted)
+			if err != nil {
+				report.errorf(CheckConversion, "failed to read the converted document: %s", err)
+				return report
+			}
+
+			report.ConvertedContentType = convertedMime
+		}
+	}
+
+	_, info, err := svc.documentInfo(document, report.ConvertedContentType, bytes.NewReader(content))
+	if err != nil {
+		report.errorf(CheckContent, "%s", err)
+		return report
+	}
+
+	opts, ok := svc.validateTarget(ctx, report, user, document, opts, info, false)
+	if !ok {
+		return report
+	}
+
+	svc.validatePDF(report, user, document, opts, content)
+
+	svc.validateQuota(report, user, document, opts)
+
+	svc.validateCapabilities(report, user, opts)
+
+	return report
+}
+
+// ValidateJob checks whether a job for document could be printed before
+// its content is known. The printer is resolved by the routing rules and
+// the printer ACL, print policies, quotas and the capabilities of the
+// printer are checked. Page and media conditions of routing rules and page
+// limits of print policies are skipped and reported as warnings since they
+// are checked once the document is submitted.
+func (svc *Service) ValidateJob(ctx context.Context, user *auth.RemoteUser, document *v1.Document, opts PrintOptions) *ValidationReport {
+	report := &ValidationReport{
+		Document:             document.Name,
+		ContentType:          document.ContentType,
+		ConvertedContentType: document.ContentType,
+		Problems:             []Problem{},
+	}
+
+	defer func() {
+		report.Valid = !report.hasErrors()
+	}()
+
+	// the content type is detected once the document is sent
+	if report.ConvertedContentType == "" {
+		report.ConvertedContentType = "application/octet-stream"
+	}
+
+	if needsConversion(document.Name, document.ContentType) {
+		report.ConvertedContentType = "application/pdf"
+
+		if svc.providers.Gotenberg == nil {
+			report.errorf(CheckConversion, "conversion of %q documents is not configured", document.ContentType)
+			return report
+		}
+	}
+
+	opts, ok := svc.validateTarget(ctx, report, user, document, opts, nil, true)
+	if !ok {
+		return report
+	}
+
+	svc.validatePending(report, document)
+
+	svc.validateQuota(report, user, document, opts)
+
+	svc.validateCapabilities(report, user, opts)
+
+	return report
+}
+
+// validateTarget resolves the printer for document and checks the printer
+// ACL and print policies. It returns the options after applying the
+// policies and false if the document cannot be printed. pending is set if
+// the content of the document is not known yet.
+func (svc *Service) validateTarget(ctx context.Context, report *ValidationReport, user *auth.RemoteUser, document *v1.Document, opts PrintOptions, info *pdf.Info, pending bool) (PrintOptions, bool) {
+	var err error
+
+	report.Printer, opts, report.Routing, err = svc.resolveTarget(ctx, user, document, opts, info, pending)
+	if err != nil {
+		report.errorf(CheckPrinter, "%s", errorMessage(err))
+		return opts, false
+	}
+
+	if err := svc.checkPrinter(report.Printer); err != nil {
+		report.errorf(CheckPrinter, "%s", errorMessage(err))
+		return opts, false
+	}
+
+	if err := svc.canUsePrinter(user, report.Printer); err != nil {
+		report.errorf(CheckPrinter, "%s", err)
+		return opts, false
+	}
+
+	opts, report.Policies, err = svc.evaluatePolicies(user, document, report.Printer, opts, info, pending)
+	if err != nil {
+		report.errorf(CheckPolicy, "%s", err)
+		return opts, false
+	}
+
+	return opts, true
+}
+
+// validatePending reports the checks of routing rules and print policies
+// that depend on the content of a document that has not been received yet.
+func (svc *Service) validatePending(report *ValidationReport, document *v1.Document) {
+	router := svc.providers.Routing
+	if router.Applies(document.Printer) && router.NeedsInfo() {
+		report.warnf(CheckPrinter, "page and media conditions of routing rules are checked once the document is received, it may be printed on another printer")
+	}
+
+	for _, rule := range svc.providers.Policies.Rules() {
+		switch {
+		case rule.MaxPages > 0 && slices.Contains(report.Policies, rule.Name):
+			report.warnf(CheckPolicy, "the page limit of print policy %q is checked once the document is received", rule.Name)
+		case rule.Match.MinPages > 0 || rule.Match.MaxPages > 0:
+			report.warnf(CheckPolicy, "print policy %q depends on the page count and is checked once the document is received", rule.Name)
+		}
+	}
+}
+
+// validateCapabilities asks the printer whether it accepts a job with
+// opts.
+func (svc *Service) validateCapabilities(report *ValidationReport, user *auth.RemoteUser, opts PrintOptions) {
+	attrs := map[string]any{
+		ipp.AttributeRequestingUserName: user.Username,
+	}
+	opts.jobAttributes(attrs)
+
+	err := svc.providers.Printers.ValidateJob(report.Printer, report.ConvertedContentType, attrs)
+	switch {
+	case errors.Is(err, backend.ErrValidationNotSupported):
+		report.warnf(CheckCapabilities, "printer %q cannot validate jobs in advance", report.Printer)
+	case err != nil:
+		report.errorf(CheckCapabilities, "printer %q rejected the job: %s", report.Printer, err)
+	}
+}
+
+// validatePDF checks the post-processing stages and inspects the resulting
+// document if it is a PDF.
+func (svc *Service) validatePDF(report *ValidationReport, user *auth.RemoteUser, document *v1.Document, opts PrintOptions, content []byte) {
+	stages, requested, err := svc.pdfStages(report.Printer, opts)
+	if err != nil {
+		report.errorf(CheckPostProcessing, "%s", errorMessage(err))
+		return
+	}
+
+	switch {
+	case report.ConvertedContentType != "application/pdf":
+		if len(stages) > 0 && requested {
+			report.errorf(CheckPostProcessing, "post-processing is only supported for PDF documents, got %q", report.ConvertedContentType)
+		} else if len(stages) > 0 {
+			report.warnf(CheckPostProcessing, "post-processing configured for printer %q is skipped for %q documents", report.Printer, report.ConvertedContentType)
+		}
+
+		return
+
+	case report.ContentType != report.ConvertedContentType && svc.providers.Gotenberg == nil:
+		// the document has not been converted
+		return
+	}
+
+	content, err = applyPDFStages(content, stages, &printJob{
+		User:        user.Username,
+		Document:    document.Name,
+		Printer:     report.Printer,
+		OperationID: "dry-run",
+		Options:     opts,
+	})
+	if err != nil {
+		report.errorf(CheckPostProcessing, "%s", errorMessage(err))
+		return
+	}
+
+	report.Info = pdf.Inspect(content)
+
+	switch {
+	case report.Info.Damaged:
+		report.errorf(CheckDocument, "the document is damaged: %s", report.Info.Error)
+	case report.Info.Encrypted && report.Info.PageCount == 0:
+		report.errorf(CheckDocument, "the document is password protected")
+	case report.Info.PageCount == 0:
+		report.errorf(CheckDocument, "the document does not have any pages")
+	}
+}
+
+// validateQuota checks the quotas of user including the estimated usage of
+// the document.
+func (svc *Service) validateQuota(report *ValidationReport, user *auth.RemoteUser, document *v1.Document, opts PrintOptions) {
+	record := usageRecord(user, document, report.Printer, opts, report.Info)
+
+	statuses, err := svc.providers.Accounting.Check(record)
+	if err != nil {
+		report.errorf(CheckQuota, "%s", err)
+		return
+	}
+
+	if report.Info == nil && len(statuses) > 0 {
+		report.warnf(CheckQuota, "the page count is unknown, the usage of the document has been estimated as one page per copy")
+	}
+
+	for _, s := range statuses {
+		if s.SoftExceeded {
+			report.warnf(CheckQuota, "the soft limit of quota %q is exceeded", s.Quota)
+		}
+	}
+}
+
+// errorMessage returns the message of err without the code prefix added by
+// connect errors.
+func errorMessage(err error) string {
+	var cerr *connect.Error
+	if errors.As(err, &cerr) && cerr.Message() != "" {
+		return cerr.Message()
+	}
+
+	return err.Error()
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	v1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/printing/v1"
+	"github.com/tierklinik-dobersberg/apis/pkg/auth"
+	"github.com/tierklinik-dobersberg/print-service/internal/accounting"
+	"github.com/tierklinik-dobersberg/print-service/internal/acl"
+	"github.com/tierklinik-dobersberg/print-service/internal/backend"
+	"github.com/tierklinik-dobersberg/print-service/internal/policy"
+)
+
+// validatingBackend rejects all jobs validated in advance with err.
+type validatingBackend struct {
+	jobsBackend
+	err error
+}
+
+func (b *validatingBackend) ValidateJob(string, string, map[string]any) error {
+	return b.err
+}
+
+// withPolicies replaces the print policies of svc.
+func withPolicies(t *testing.T, svc *Service, rules ...policy.Rule) {
+	t.Helper()
+
+	engine, err := policy.New(policy.Config{Rules: rules})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svc.providers.Policies = engine
+	if svc.policyOptions, err = parsePolicyOptions(rules); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// hasProblem returns true if report contains a problem of check with the
+// given severity.
+func hasProblem(report *ValidationReport, severity Severity, check string) bool {
+	for _, p := range report.Problems {
+		if p.Severity == severity && p.Check == check {
+			return true
+		}
+	}
+
+	return false
+}
+
+// withQuota replaces the accounting ledger of svc with one enforcing quota.
+func withQuota(t *testing.T, svc *Service, quota accounting.Quota) {
+	t.Helper()
+
+	ledger, err := accounting.Open(accounting.Config{Quotas: []accounting.Quota{quota}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svc.providers.Accounting = ledger
+}
+
+func TestValidateJobSkipsPageLimits(t *testing.T) {
+	svc := newHTTPService(t, acl.Config{})
+	withPolicies(t, svc, policy.Rule{Name: "short", MaxPages: 5})
+
+	user := &auth.RemoteUser{ID: "u1", Username: "alice"}
+	document := &v1.Document{Name: "letter.pdf", ContentType: "application/pdf", Printer: "prescriptions"}
+
+	report := svc.ValidateJob(context.Background(), user, document, PrintOptions{})
+	if !report.Valid {
+		t.Fatalf("expected the job to be valid, got %+v", report.Problems)
+	}
+
+	if !hasProblem(report, SeverityWarning, CheckPolicy) {
+		t.Errorf("expected a warning about the pending page limit, got %+v", report.Problems)
+	}
+
+	// the page limit still applies once the content is known
+	_, _, err := svc.evaluatePolicies(user, document, "prescriptions", PrintOptions{}, nil, false)
+	if err == nil || !strings.Contains(err.Error(), "page count") {
+		t.Errorf("expected documents with an unknown page count to be denied, got %v", err)
+	}
+}
+
+func TestValidatePrint(t *testing.T) {
+	cases := []struct {
+		name     string
+		document *v1.Document
+		content  []byte
+		header   http.Header
+		setup    func(t *testing.T, svc *Service)
+		severity Severity
+		check    string
+	}{
+		{
+			name:     "empty content",
+			document: &v1.Document{Name: "empty.pdf"},
+			severity: SeverityError,
+			check:    CheckContent,
+		},
+		{
+			name:     "damaged PDF",
+			document: &v1.Document{Name: "letter.pdf", ContentType: "application/pdf"},
+			content:  []byte("%PDF-1.4\nnot a document"),
+			severity: SeverityError,
+			check:    CheckDocument,
+		},
+		{
+			name:     "PDF without pages",
+			document: &v1.Document{Name: "letter.pdf", ContentType: "application/pdf"},
+			content:  testPDF(0),
+			severity: SeverityError,
+			check:    CheckDocument,
+		},
+		{
+			name:     "conversion not configured",
+			document: &v1.Document{Name: "letter.docx", ContentType: "application/octet-stream"},
+			content:  []byte("PK"),
+			severity: SeverityError,
+			check:    CheckConversion,
+		},
+		{
+			name:     "policy denial",
+			document: &v1.Document{Name: "letter.pdf", ContentType: "application/pdf"},
+			content:  testPDF(1),
+			setup: func(t *testing.T, svc *Service) {
+				withPolicies(t, svc, policy.Rule{Name: "closed", Deny: true})
+			},
+			severity: SeverityError,
+			check:    CheckPolicy,
+		},
+		{
+			name:     "hard quota exceeded",
+			document: &v1.Document{Name: "letter.pdf", ContentType: "application/pdf"},
+			content:  testPDF(1),
+			header:   http.Header{"X-Print-Copies": {"2"}},
+			setup: func(t *testing.T, svc *Service) {
+				withQuota(t, svc, accounting.Quota{Name: "monthly", Hard: accounting.Limit{Impressions: 1}})
+			},
+			severity: SeverityError,
+			check:    CheckQuota,
+		},
+		{
+			name:     "soft quota exceeded",
+			document: &v1.Document{Name: "letter.pdf", ContentType: "application/pdf"},
+			content:  testPDF(1),
+			header:   http.Header{"X-Print-Copies": {"2"}},
+			setup: func(t *testing.T, svc *Service) {
+				withQuota(t, svc, accounting.Quota{Name: "monthly", Soft: accounting.Limit{Impressions: 1}})
+			},
+			severity: SeverityWarning,
+			check:    CheckQuota,
+		},
+		{
+			name:     "validation not supported",
+			document: &v1.Document{Name: "letter.pdf", ContentType: "application/pdf"},
+			content:  testPDF(1),
+			severity: SeverityWarning,
+			check:    CheckCapabilities,
+		},
+		{
+			name:     "rejected by the printer",
+			document: &v1.Document{Name: "letter.pdf", ContentType: "application/pdf"},
+			content:  testPDF(1),
+			setup: func(t *testing.T, svc *Service) {
+				svc.providers.Printers = backend.NewRegistry(&validatingBackend{
+					jobsBackend: jobsBackend{printer: "prescriptions"},
+					err:         errors.New("sides not supported"),
+				})
+			},
+			severity: SeverityError,
+			check:    CheckCapabilities,
+		},
+	}
+
+	user := &auth.RemoteUser{ID: "u1", Username: "alice"}
+
+	for _, c := range cases {
+		svc := newHTTPService(t, acl.Config{})
+		if c.setup != nil {
+			c.setup(t, svc)
+		}
+
+		c.document.Printer = "prescriptions"
+
+		report := svc.validatePrint(context.Background(), user, c.document, strings.NewReader(string(c.content)), c.header)
+
+		if !hasProblem(report, c.severity, c.check) {
+			t.Errorf("%s: expected a %s of the %s check, got %+v", c.name, c.severity, c.check, report.Problems)
+		}
+
+		if valid := c.severity == SeverityWarning; report.Valid != valid {
+			t.Errorf("%s: expected valid=%t, got %+v", c.name, valid, report.Problems)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package templates
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Registry holds all document templates found in the sub-directories of
+// a root directory.
+type Registry struct {
+	root string
+
+	l           sync.RWMutex
+	templates   map[string]*Template
+	fingerprint uint64
+}
+
+// NewRegistry loads all templates from root.
+func NewRegistry(root string) (*Registry, error) {
+	r := &Registry{
+		root:      root,
+		templates: make(map[string]*Template),
+	}
+
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Get returns the template with the given name.
+func (r *Registry) Get(name string) (*Template, bool) {
+	r.l.RLock()
+	defer r.l.RUnlock()
+
+	t, ok := r.templates[name]
+	return t, ok
+}
+
+// List returns all templates sorted by name.
+func (r *Registry) List() []*Template {
+	r.l.RLock()
+	defer r.l.RUnlock()
+
+	result := make([]*Template, 0, len(r.templates))
+	for _, t := range r.templates {
+		result = append(result, t)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
+
+// Reload loads all templates from disk. If any template fails to load the
+// currently loaded templates are kept.
+func (r *Registry) Reload() error {
+	fingerprint, err := r.computeFingerprint()
+	if err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(r.root)
+	if err != nil {
+		return fmt.Errorf("failed to read template directory: %w", err)
+	}
+
+	templates := make(map[string]*Template, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() || e.Name()[0] == '.' {
+			continue
+		}
+
+		t, err := loadTemplate(e.Name(), filepath.Join(r.root, e.Name()))
+		if err != nil {
+			return fmt.Errorf("template %q: %w", e.Name(), err)
+		}
+
+		templates[t.Name] = t
+	}
+
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	r.templates = templates
+	r.fingerprint = fingerprint
+
+	return nil
+}
+
+// Watch polls the template directory for changes and reloads all templates
+// if a change is detected. Watch blocks until ctx is cancelled. A
+// non-positive interval disables reloading.
+func (r *Registry) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		fingerprint, err := r.computeFingerprint()
+		if err != nil {
+			slog.Error("failed to check template directory", "path", r.root, "error", err)
+			continue
+		}
+
+		r.l.RLock()
+		changed := fingerprint != r.fingerprint
+		r.l.RUnlock()
+
+		if !changed {
+			continue
+		}
+
+		if err := r.Reload(); err != nil {
+			slog.Error("failed to reload templates, keeping previous version", "path", r.root, "error", err)
+
+			// do not retry until the directory changes again
+			r.l.Lock()
+			r.fingerprint = fingerprint
+			r.l.Unlock()
+
+			continue
+		}
+
+		slog.Info("reloaded document templates", "path", r.root)
+	}
+}
+
+// computeFingerprint hashes the path, size and modification time of all
+// files below the root directory.
+func (r *Registry) computeFingerprint() (uint64, error) {
+	h := fnv.New64a()
+
+	err := filepath.WalkDir(r.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(h, "%s:%d:%d\n", path, info.Size(), info.ModTime().UnixNano())
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return h.Sum64(), nil
+}
@@ -0,0 +1,236 @@
+package templates
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+const (
+	indexFile  = "index.html"
+	headerFile = "header.html"
+	footerFile = "footer.html"
+	schemaFile = "schema.json"
+)
+
+// Template is a HTML document template loaded from a directory. The
+// directory must contain an index.html and may contain a header.html and
+// footer.html which are rendered on each page, a schema.json used to
+// validate the payload and any number of assets like images, fonts or
+// stylesheets.
+//
+// Assets are passed to Gotenberg by their base name so templates must
+// reference them without a directory (e.g. <img src="logo.png">).
+type Template struct {
+	// Name is the name of the template directory.
+	Name string `json:"name"`
+
+	// Schema holds the JSON schema of the payload, if any.
+	Schema json.RawMessage `json:"schema,omitempty"`
+
+	schema *jsonschema.Schema
+
+	index  *template.Template
+	header *template.Template
+	footer *template.Template
+
+	// assets maps the base name of an asset to its path.
+	assets map[string]string
+}
+
+// Asset is an additional file that must be sent to Gotenberg together with
+// the rendered HTML.
+type Asset struct {
+	Name string
+	Path string
+}
+
+// Rendered holds the output of a rendered template.
+type Rendered struct {
+	Index  []byte
+	Header []byte
+	Footer []byte
+	Assets []Asset
+}
+
+// ValidationError is returned if the payload does not match the template
+// schema.
+type ValidationError struct {
+	err error
+}
+
+func (v *ValidationError) Error() string {
+	return fmt.Sprintf("invalid template payload: %s", v.err)
+}
+
+func (v *ValidationError) Unwrap() error {
+	return v.err
+}
+
+var funcs = template.FuncMap{
+	// formatDate parses value as an RFC3339 timestamp or date and formats it
+	// using layout.
+	"formatDate": func(layout string, value string) (string, error) {
+		for _, l := range []string{time.RFC3339, "2006-01-02"} {
+			if t, err := time.ParseInLocation(l, value, time.Local); err == nil {
+				return t.Format(layout), nil
+			}
+		}
+
+		return "", fmt.Errorf("invalid date %q", value)
+	},
+
+	// default returns def if value is empty.
+	"default": func(def any, value any) any {
+		if value == nil || value == "" {
+			return def
+		}
+
+		return value
+	},
+}
+
+func loadTemplate(name, dir string) (*Template, error) {
+	t := &Template{
+		Name:   name,
+		assets: make(map[string]string),
+	}
+
+	var err error
+
+	t.index, err = parseFile(dir, indexFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.index == nil {
+		return nil, fmt.Errorf("missing %s", indexFile)
+	}
+
+	if t.header, err = parseFile(dir, headerFile); err != nil {
+		return nil, err
+	}
+
+	if t.footer, err = parseFile(dir, footerFile); err != nil {
+		return nil, err
+	}
+
+	schema, err := os.ReadFile(filepath.Join(dir, schemaFile))
+	switch {
+	case err == nil:
+		t.Schema = schema
+		t.schema, err = jsonschema.CompileString(filepath.Join(dir, schemaFile), string(schema))
+		if err != nil {
+			return nil, fmt.Errorf("invalid schema: %w", err)
+		}
+
+	case errors.Is(err, os.ErrNotExist):
+	default:
+		return nil, err
+	}
+
+	err = filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+
+		if path == filepath.Join(dir, d.Name()) {
+			switch d.Name() {
+			case indexFile, headerFile, footerFile, schemaFile:
+				return nil
+			}
+		}
+
+		if existing, ok := t.assets[d.Name()]; ok {
+			return fmt.Errorf("asset %q conflicts with %q", path, existing)
+		}
+
+		t.assets[d.Name()] = path
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func parseFile(dir, name string) (*template.Template, error) {
+	content, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	t, err := template.New(name).Funcs(funcs).Option("missingkey=zero").Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+
+	return t, nil
+}
+
+// Execute validates data against the template schema and renders the
+// template.
+func (t *Template) Execute(data any) (*Rendered, error) {
+	if t.schema != nil {
+		if err := t.schema.Validate(data); err != nil {
+			return nil, &ValidationError{err: err}
+		}
+	}
+
+	var (
+		res = new(Rendered)
+		err error
+	)
+
+	if res.Index, err = execute(t.index, data); err != nil {
+		return nil, err
+	}
+
+	if res.Header, err = execute(t.header, data); err != nil {
+		return nil, err
+	}
+
+	if res.Footer, err = execute(t.footer, data); err != nil {
+		return nil, err
+	}
+
+	for name, path := range t.assets {
+		res.Assets = append(res.Assets, Asset{
+			Name: name,
+			Path: path,
+		})
+	}
+
+	return res, nil
+}
+
+func execute(t *template.Template, data any) ([]byte, error) {
+	if t == nil {
+		return nil, nil
+	}
+
+	buf := new(bytes.Buffer)
+	if err := t.Execute(buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render %s: %w", t.Name(), err)
+	}
+
+	return buf.Bytes(), nil
+}
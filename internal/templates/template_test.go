@@ -0,0 +1,107 @@
+package templates
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFiles creates files relative to dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTemplateExecute(t *testing.T) {
+	root := t.TempDir()
+
+	writeFiles(t, root, map[string]string{
+		"invoice/index.html":       `<h1>{{ .customer }}</h1><p>{{ formatDate "02.01.2006" .date }}</p><p>{{ default "-" .note }}</p>`,
+		"invoice/footer.html":      `<span class="pageNumber"></span>`,
+		"invoice/schema.json":      `{"type": "object", "required": ["customer", "date"]}`,
+		"invoice/assets/logo.png":  "png",
+		"invoice/.hidden":          "ignored",
+		"prescription/index.html":  `{{ .patient }}`,
+		".drafts/draft/index.html": `draft`,
+	})
+
+	reg, err := NewRegistry(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, tmpl := range reg.List() {
+		names = append(names, tmpl.Name)
+	}
+
+	if strings.Join(names, ",") != "invoice,prescription" {
+		t.Fatalf("unexpected templates %v", names)
+	}
+
+	tmpl, _ := reg.Get("invoice")
+
+	res, err := tmpl.Execute(map[string]any{"customer": "Alice", "date": "2025-03-01"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := `<h1>Alice</h1><p>01.03.2025</p><p>-</p>`; string(res.Index) != want {
+		t.Errorf("expected index %q, got %q", want, res.Index)
+	}
+
+	if res.Header != nil || string(res.Footer) != `<span class="pageNumber"></span>` {
+		t.Errorf("unexpected header %q or footer %q", res.Header, res.Footer)
+	}
+
+	if len(res.Assets) != 1 || res.Assets[0].Name != "logo.png" {
+		t.Errorf("expected the logo asset, got %v", res.Assets)
+	}
+
+	var verr *ValidationError
+	if _, err := tmpl.Execute(map[string]any{"customer": "Alice"}); !errors.As(err, &verr) {
+		t.Errorf("expected a validation error, got %v", err)
+	}
+}
+
+func TestRegistryReloadKeepsTemplates(t *testing.T) {
+	root := t.TempDir()
+
+	writeFiles(t, root, map[string]string{
+		"invoice/index.html": `{{ .customer }}`,
+	})
+
+	reg, err := NewRegistry(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFiles(t, root, map[string]string{
+		"broken/index.html": `{{ .customer`,
+	})
+
+	if err := reg.Reload(); err == nil {
+		t.Fatal("expected the broken template to fail the reload")
+	}
+
+	if _, ok := reg.Get("invoice"); !ok {
+		t.Errorf("expected the loaded templates to be kept")
+	}
+
+	if _, ok := reg.Get("broken"); ok {
+		t.Errorf("expected the broken template not to be loaded")
+	}
+}